@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	roleViewer = "viewer"
+	roleAdmin  = "admin"
+
+	tokenReviewCacheTTL         = 30 * time.Second
+	tokenReviewNegativeCacheTTL = 5 * time.Second
+	maxCachedTokenReviews       = 1024
+)
+
+// errTokenNotAuthenticated marks a TokenReview that rejected the token, as
+// opposed to one that could not be made.
+var errTokenNotAuthenticated = errors.New("token not authenticated")
+
+type principal struct {
+	User   string
+	Groups []string
+	Via    string
+}
+
+type principalKey struct{}
+
+// requestPrincipal names the caller authenticated by requireRole.
+func requestPrincipal(r *http.Request) string {
+	if p, ok := r.Context().Value(principalKey{}).(*principal); ok {
+		return p.User
+	}
+	return "unknown"
+}
+
+type cachedPrincipal struct {
+	principal *principal
+	err       error
+	expires   time.Time
+}
+
+type adminAuth struct {
+	viewers []string
+	admins  []string
+
+	reviewToken func(ctx context.Context, token string) (*principal, error)
+
+	mu     sync.Mutex
+	tokens map[[sha256.Size]byte]cachedPrincipal
+}
+
+var admin = newAdminAuth(nil, nil)
+
+func newAdminAuth(viewers, admins []string) *adminAuth {
+	return &adminAuth{
+		viewers:     viewers,
+		admins:      admins,
+		reviewToken: tokenReview,
+		tokens:      make(map[[sha256.Size]byte]cachedPrincipal),
+	}
+}
+
+func (a *adminAuth) authenticate(r *http.Request) (*principal, error) {
+	if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found && token != "" {
+		key := sha256.Sum256([]byte(token))
+
+		a.mu.Lock()
+		cached, exists := a.tokens[key]
+		if exists && !time.Now().Before(cached.expires) {
+			delete(a.tokens, key)
+			exists = false
+		}
+		a.mu.Unlock()
+		if exists {
+			return cached.principal, cached.err
+		}
+
+		p, err := a.reviewToken(r.Context(), token)
+		switch {
+		case err == nil:
+			a.cacheToken(key, cachedPrincipal{principal: p, expires: time.Now().Add(tokenReviewCacheTTL)})
+		case errors.Is(err, errTokenNotAuthenticated):
+			a.cacheToken(key, cachedPrincipal{err: err, expires: time.Now().Add(tokenReviewNegativeCacheTTL)})
+		}
+		return p, err
+	}
+
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		cert := r.TLS.VerifiedChains[0][0]
+		return &principal{User: cert.Subject.CommonName, Groups: cert.Subject.Organization, Via: "client-certificate"}, nil
+	}
+
+	return nil, errors.New("no bearer token or verified client certificate")
+}
+
+// cacheToken stores a TokenReview result, dropping expired entries and, once
+// the cache is full, the entry closest to expiry.
+func (a *adminAuth) cacheToken(key [sha256.Size]byte, entry cachedPrincipal) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.tokens) >= maxCachedTokenReviews {
+		now := time.Now()
+		for k, cached := range a.tokens {
+			if !now.Before(cached.expires) {
+				delete(a.tokens, k)
+			}
+		}
+	}
+	for len(a.tokens) >= maxCachedTokenReviews {
+		var oldest [sha256.Size]byte
+		var oldestExpires time.Time
+		for k, cached := range a.tokens {
+			if oldestExpires.IsZero() || cached.expires.Before(oldestExpires) {
+				oldest, oldestExpires = k, cached.expires
+			}
+		}
+		delete(a.tokens, oldest)
+	}
+	a.tokens[key] = entry
+}
+
+func (a *adminAuth) authorize(p *principal, role string) bool {
+	subjects := a.admins
+	if role == roleViewer {
+		subjects = append(append([]string{}, a.viewers...), a.admins...)
+	}
+	for _, subject := range subjects {
+		if group, isGroup := strings.CutPrefix(subject, "group:"); isGroup {
+			for _, g := range p.Groups {
+				if g == group {
+					return true
+				}
+			}
+		} else if subject == p.User {
+			return true
+		}
+	}
+	return false
+}
+
+func requireRole(role string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a := admin
+		p, err := a.authenticate(r)
+		if err != nil {
+			klog.Warningf("Unauthenticated request from %s to %s: %v", r.RemoteAddr, r.URL.Path, err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gateway-yeeter"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !a.authorize(p, role) {
+			klog.Warningf("Denied %s (via %s) %s role for %s %s", p.User, p.Via, role, r.Method, r.URL.Path)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		klog.V(2).Infof("Granted %s (via %s) %s role for %s %s", p.User, p.Via, role, r.Method, r.URL.Path)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	})
+}
+
+func tokenReview(ctx context.Context, token string) (*principal, error) {
+	client, err := kube.typedFor(lookupAuth)
+	if err != nil {
+		return nil, err
+	}
+	review, err := client.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token, Audiences: cfg.AdminAudiences},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if !review.Status.Authenticated {
+		return nil, fmt.Errorf("%w: %s", errTokenNotAuthenticated, review.Status.Error)
+	}
+	// The API server answers with the requested audiences the token is
+	// valid for, which authenticators unaware of audiences may leave out.
+	if !slices.ContainsFunc(review.Status.Audiences, func(audience string) bool { return contains(cfg.AdminAudiences, audience) }) {
+		return nil, fmt.Errorf("%w: not issued for %s", errTokenNotAuthenticated, strings.Join(cfg.AdminAudiences, ", "))
+	}
+	return &principal{User: review.Status.User.Username, Groups: review.Status.User.Groups, Via: "token"}, nil
+}
+
+func registerAdminHandlers(mux *http.ServeMux) {
+	mux.Handle("/decisions", requireRole(roleViewer, http.HandlerFunc(handleDecisions)))
+	mux.Handle("/decisions/browse", requireRole(roleViewer, http.HandlerFunc(handleDecisionBrowser)))
+	mux.Handle("/decisions/stream", requireRole(roleViewer, http.HandlerFunc(handleDecisionStream)))
+	mux.Handle("/decisions/query", requireRole(roleViewer, http.HandlerFunc(handleDecisionQuery)))
+	mux.Handle("/configz", requireRole(roleViewer, http.HandlerFunc(handleConfigz)))
+	mux.Handle("/stats", requireRole(roleViewer, http.HandlerFunc(handleStats)))
+
+	mux.Handle("/maintenance", requireRole(roleAdmin, http.HandlerFunc(handleMaintenance)))
+	mux.Handle("/reload", requireRole(roleAdmin, http.HandlerFunc(handleReload)))
+	mux.Handle("/debug/faults", requireRole(roleAdmin, http.HandlerFunc(handleFaults)))
+	mux.Handle("/debug/dump", requireRole(roleAdmin, http.HandlerFunc(handleDump)))
+
+	mux.Handle("/debug/pprof/", requireRole(roleAdmin, http.HandlerFunc(pprof.Index)))
+	mux.Handle("/debug/pprof/cmdline", requireRole(roleAdmin, http.HandlerFunc(pprof.Cmdline)))
+	mux.Handle("/debug/pprof/profile", requireRole(roleAdmin, http.HandlerFunc(pprof.Profile)))
+	mux.Handle("/debug/pprof/symbol", requireRole(roleAdmin, http.HandlerFunc(pprof.Symbol)))
+	mux.Handle("/debug/pprof/trace", requireRole(roleAdmin, http.HandlerFunc(pprof.Trace)))
+}
+
+func handleDecisions(w http.ResponseWriter, r *http.Request) {
+	records, err := filteredDecisions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, records)
+}
+
+func handleConfigz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, struct {
+		Hash   string      `json:"hash"`
+		Config config      `json:"config"`
+		Rules  mergedRules `json:"rules"`
+	}{cfg.hash(), cfg, ruleSources.view()})
+}
+
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, recentDecisions.stats())
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		klog.Errorf("Could not write response: %v", err)
+	}
+}
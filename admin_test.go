@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func withAdminAuth(t *testing.T, a *adminAuth) {
+	old := admin
+	admin = a
+	t.Cleanup(func() { admin = old })
+}
+
+func fakeTokenReview(tokens map[string]*principal) func(context.Context, string) (*principal, error) {
+	return func(ctx context.Context, token string) (*principal, error) {
+		if p, exists := tokens[token]; exists {
+			return p, nil
+		}
+		return nil, errTokenNotAuthenticated
+	}
+}
+
+func adminRequest(handler http.Handler, path, token string) int {
+	req := httptest.NewRequest("GET", path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestAdminEndpointsRequireAuthentication(t *testing.T) {
+	a := newAdminAuth([]string{"viewer"}, []string{"group:ops"})
+	a.reviewToken = fakeTokenReview(map[string]*principal{
+		"viewer-token": {User: "viewer"},
+		"ops-token":    {User: "someone", Groups: []string{"ops"}},
+		"other-token":  {User: "other"},
+	})
+	withAdminAuth(t, a)
+
+	mux := http.NewServeMux()
+	registerAdminHandlers(mux)
+
+	cases := []struct {
+		path  string
+		token string
+		code  int
+	}{
+		{"/decisions", "", http.StatusUnauthorized},
+		{"/decisions", "invalid", http.StatusUnauthorized},
+		{"/decisions", "other-token", http.StatusForbidden},
+		{"/decisions", "viewer-token", http.StatusOK},
+		{"/configz", "ops-token", http.StatusOK},
+		{"/stats", "viewer-token", http.StatusOK},
+		{"/debug/pprof/", "viewer-token", http.StatusForbidden},
+		{"/debug/pprof/", "ops-token", http.StatusOK},
+	}
+	for _, c := range cases {
+		if code := adminRequest(mux, c.path, c.token); code != c.code {
+			t.Errorf("%s with token %q: expected %d, got %d", c.path, c.token, c.code, code)
+		}
+	}
+}
+
+func TestAdminTokenReviewIsCached(t *testing.T) {
+	reviews := 0
+	a := newAdminAuth([]string{"viewer"}, nil)
+	a.reviewToken = func(ctx context.Context, token string) (*principal, error) {
+		reviews++
+		return &principal{User: "viewer"}, nil
+	}
+	withAdminAuth(t, a)
+
+	handler := requireRole(roleViewer, http.HandlerFunc(handleStats))
+	adminRequest(handler, "/stats", "token")
+	adminRequest(handler, "/stats", "token")
+
+	if reviews != 1 {
+		t.Fatalf("expected 1 token review, got %d", reviews)
+	}
+}
+
+func TestAdminFailedTokenReviewIsCached(t *testing.T) {
+	reviews := 0
+	a := newAdminAuth([]string{"viewer"}, nil)
+	a.reviewToken = func(ctx context.Context, token string) (*principal, error) {
+		reviews++
+		return nil, errTokenNotAuthenticated
+	}
+	withAdminAuth(t, a)
+
+	handler := requireRole(roleViewer, http.HandlerFunc(handleStats))
+	for i := 0; i < 2; i++ {
+		if code := adminRequest(handler, "/stats", "bad-token"); code != http.StatusUnauthorized {
+			t.Fatalf("expected %d, got %d", http.StatusUnauthorized, code)
+		}
+	}
+	if reviews != 1 {
+		t.Fatalf("expected 1 token review, got %d", reviews)
+	}
+
+	key := sha256.Sum256([]byte("bad-token"))
+	a.tokens[key] = cachedPrincipal{err: a.tokens[key].err, expires: time.Now().Add(-time.Second)}
+	adminRequest(handler, "/stats", "bad-token")
+	if reviews != 2 {
+		t.Fatalf("expected expired failure to be reviewed again, got %d reviews", reviews)
+	}
+}
+
+func TestAdminUnavailableTokenReviewIsNotCached(t *testing.T) {
+	reviews := 0
+	a := newAdminAuth([]string{"viewer"}, nil)
+	a.reviewToken = func(ctx context.Context, token string) (*principal, error) {
+		reviews++
+		if reviews == 1 {
+			return nil, errors.New("connection refused")
+		}
+		return &principal{User: "viewer"}, nil
+	}
+	withAdminAuth(t, a)
+
+	handler := requireRole(roleViewer, http.HandlerFunc(handleStats))
+	if code := adminRequest(handler, "/stats", "token"); code != http.StatusUnauthorized {
+		t.Fatalf("expected %d while the API server is unavailable, got %d", http.StatusUnauthorized, code)
+	}
+	if code := adminRequest(handler, "/stats", "token"); code != http.StatusOK || reviews != 2 {
+		t.Fatalf("expected the token to be reviewed again, got %d after %d reviews", code, reviews)
+	}
+}
+
+func TestTokenReviewAudiences(t *testing.T) {
+	client := fake.NewClientset()
+	var requested []string
+	client.PrependReactor("create", "tokenreviews", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		review := action.(clienttesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		requested = review.Spec.Audiences
+		review.Status.Authenticated = review.Spec.Token != "rejected"
+		review.Status.User.Username = "ops"
+		if review.Spec.Token == "api-server" {
+			review.Status.Audiences = []string{"https://kubernetes.default.svc"}
+		} else {
+			review.Status.Audiences = review.Spec.Audiences
+		}
+		return true, review, nil
+	})
+	old := kube
+	kube = &kubeClients{typed: map[lookupCategory]kubernetes.Interface{lookupAuth: client}}
+	t.Cleanup(func() { kube = old })
+
+	p, err := tokenReview(context.Background(), "token")
+	if err != nil || p.User != "ops" || !reflect.DeepEqual(requested, []string(cfg.AdminAudiences)) {
+		t.Fatalf("expected the token to be reviewed for %v, got %v for %v", cfg.AdminAudiences, err, requested)
+	}
+	for _, token := range []string{"rejected", "api-server"} {
+		if _, err := tokenReview(context.Background(), token); !errors.Is(err, errTokenNotAuthenticated) {
+			t.Errorf("%s: expected the token not to be authenticated, got %v", token, err)
+		}
+	}
+}
+
+func TestAdminTokenCacheIsBounded(t *testing.T) {
+	a := newAdminAuth(nil, nil)
+	expired := sha256.Sum256([]byte("expired"))
+	a.tokens[expired] = cachedPrincipal{expires: time.Now().Add(-time.Second)}
+	for i := 0; i < maxCachedTokenReviews+10; i++ {
+		a.cacheToken(sha256.Sum256([]byte(fmt.Sprint(i))), cachedPrincipal{expires: time.Now().Add(time.Duration(i) * time.Millisecond)})
+	}
+	if len(a.tokens) != maxCachedTokenReviews {
+		t.Fatalf("expected %d cached tokens, got %d", maxCachedTokenReviews, len(a.tokens))
+	}
+	if _, exists := a.tokens[expired]; exists {
+		t.Fatal("expected expired token to be dropped")
+	}
+	if _, exists := a.tokens[sha256.Sum256([]byte("0"))]; exists {
+		t.Fatal("expected the token closest to expiry to be evicted")
+	}
+}
+
+func TestAdminClientCertificateAuthentication(t *testing.T) {
+	withAdminAuth(t, newAdminAuth(nil, []string{"admin-user"}))
+
+	req := httptest.NewRequest("GET", "/configz", nil)
+	req.TLS = &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "admin-user"}}}},
+	}
+	w := httptest.NewRecorder()
+	requireRole(roleAdmin, http.HandlerFunc(handleConfigz)).ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var body struct {
+		Hash string `json:"hash"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body.Hash != cfg.hash() {
+		t.Fatal("expected configz to report the configuration hash")
+	}
+}
+
+func TestDecisionLogRing(t *testing.T) {
+	l := newDecisionLog(2)
+	l.add(&decision{UID: "1", Outcome: outcomeMutated})
+	l.add(&decision{UID: "2", Outcome: outcomeSkipped})
+	l.add(&decision{UID: "3", Outcome: outcomeMutated})
+
+	records := l.list()
+	if len(records) != 2 || records[0].UID != "3" || records[1].UID != "2" {
+		t.Fatalf("expected newest two decisions, got %+v", records)
+	}
+
+	stats := l.stats()
+	if stats.Total != 3 || stats.Outcomes[outcomeMutated] != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
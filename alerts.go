@@ -0,0 +1,205 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+type alertOptions struct {
+	name              string
+	namespace         string
+	selector          string
+	webhookTimeout    time.Duration
+	errorRatio        float64
+	certExpiryWarning time.Duration
+}
+
+type alertSpec struct {
+	name        string
+	metric      string
+	expr        string
+	forDuration string
+	severity    string
+	summary     string
+	description string
+}
+
+// series formats a metric selector with the configured label matchers plus
+// any extra ones.
+func series(name, selector string, extra ...string) string {
+	var matchers []string
+	if selector != "" {
+		matchers = append(matchers, selector)
+	}
+	matchers = append(matchers, extra...)
+	return name + "{" + strings.Join(matchers, ", ") + "}"
+}
+
+func alertSpecs(o alertOptions) []alertSpec {
+	const (
+		reviews     = "gateway_yeeter_admission_reviews_total"
+		duration    = "gateway_yeeter_admission_review_duration_seconds"
+		certExpiry  = "gateway_yeeter_serving_certificate_expiry_timestamp_seconds"
+		misdirected = "gateway_yeeter_misdirected_requests_total"
+		violations  = "gateway_yeeter_network_status_violations"
+		anomaly     = "gateway_yeeter_namespace_mutation_anomaly"
+		conflicting = "gateway_yeeter_conflicting_webhooks"
+		selfProbes  = "gateway_yeeter_self_probes_total"
+	)
+	latency := 0.8 * o.webhookTimeout.Seconds()
+	return []alertSpec{
+		{
+			name:   "GatewayYeeterAdmissionErrors",
+			metric: reviews,
+			expr: fmt.Sprintf("sum(rate(%s[5m])) / sum(rate(%s[5m])) > %s",
+				series(reviews, o.selector, `outcome="error"`), series(reviews, o.selector), formatPromFloat(o.errorRatio)),
+			forDuration: "10m",
+			severity:    "warning",
+			summary:     "gateway-yeeter fails to review pods",
+			description: "More than {{ $value | humanizePercentage }} of pod admission reviews end in an error. The webhook fails open, so affected migration pods keep their default routes.",
+		},
+		{
+			name:   "GatewayYeeterAdmissionLatencyHigh",
+			metric: duration,
+			expr: fmt.Sprintf("histogram_quantile(0.99, sum by (le) (rate(%s[5m]))) > %s",
+				series(duration+"_bucket", o.selector), formatPromFloat(latency)),
+			forDuration: "10m",
+			severity:    "warning",
+			summary:     "gateway-yeeter admission latency is close to the webhook timeout",
+			description: fmt.Sprintf("The 99th percentile admission review latency is {{ $value | humanizeDuration }}, close to the %s webhook timeout. Requests that time out are admitted unmodified.", o.webhookTimeout),
+		},
+		{
+			name:        "GatewayYeeterServingCertificateExpiring",
+			metric:      certExpiry,
+			expr:        fmt.Sprintf("min(%s) - time() < %s", series(certExpiry, o.selector), formatPromFloat(o.certExpiryWarning.Seconds())),
+			forDuration: "1h",
+			severity:    "warning",
+			summary:     "gateway-yeeter serving certificate expires soon",
+			description: "The serving certificate expires in {{ $value | humanizeDuration }}. The certificate is read at startup, so restart the webhook after it has been renewed.",
+		},
+		{
+			name:        "GatewayYeeterRegistrationDrift",
+			metric:      misdirected,
+			expr:        fmt.Sprintf("sum by (kind) (increase(%s[15m])) > 0", series(misdirected, o.selector)),
+			severity:    "warning",
+			summary:     "gateway-yeeter receives requests outside its scope",
+			description: "The webhook received {{ $labels.kind }} requests it should never see, which means the MutatingWebhookConfiguration no longer matches the deployed configuration.",
+		},
+		{
+			name:        "GatewayYeeterNetworkStatusViolations",
+			metric:      violations,
+			expr:        fmt.Sprintf("max(%s) > 0", series(violations, o.selector)),
+			forDuration: "5m",
+			severity:    "critical",
+			summary:     "Migration pods run with a default route on a secondary network",
+			description: "{{ $value }} target pods report a default route on a secondary attachment in their Multus network-status.",
+		},
+		{
+			name:        "GatewayYeeterNamespaceMutationAnomaly",
+			metric:      anomaly,
+			expr:        fmt.Sprintf("max by (namespace) (%s) > 0", series(anomaly, o.selector)),
+			severity:    "warning",
+			summary:     "Unusual number of pod mutations in a namespace",
+			description: "Namespace {{ $labels.namespace }} exceeded --namespace-mutation-threshold, which usually indicates a stuck controller recreating importer pods in a loop.",
+		},
+		{
+			name:        "GatewayYeeterConflictingWebhook",
+			metric:      conflicting,
+			expr:        fmt.Sprintf("max by (configuration, webhook) (%s) > 0", series(conflicting, o.selector)),
+			severity:    "warning",
+			summary:     "Another mutating webhook receives migration pods",
+			description: "Mutating webhook {{ $labels.configuration }}/{{ $labels.webhook }} also receives migration pods. If it rewrites the networks annotation after gateway-yeeter, default routes are reintroduced.",
+		},
+		{
+			name:        "GatewayYeeterSelfProbeFailing",
+			metric:      selfProbes,
+			expr:        fmt.Sprintf("sum by (pod) (increase(%s[10m])) > 0", series(selfProbes, o.selector, `result="failure"`)),
+			forDuration: "10m",
+			severity:    "critical",
+			summary:     "gateway-yeeter cannot review its own synthetic admission requests",
+			description: "Synthetic admission reviews of {{ $labels.pod }} over loopback fail, so the API server is likely unable to call the webhook either. Check the serving certificate, the listener and the logs.",
+		},
+	}
+}
+
+func formatPromFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// renderPrometheusRule builds the PrometheusRule manifest. Every alert must
+// reference a metric the binary defines, so renamed metrics fail here
+// instead of silently producing alerts that never fire.
+func renderPrometheusRule(o alertOptions, defs []metricDefinition) ([]byte, error) {
+	defined := make(map[string]bool, len(defs))
+	for _, def := range defs {
+		defined[def.Name] = true
+	}
+
+	var rules []interface{}
+	for _, spec := range alertSpecs(o) {
+		if !defined[spec.metric] {
+			return nil, fmt.Errorf("alert %s uses undefined metric %s", spec.name, spec.metric)
+		}
+		rule := map[string]interface{}{
+			"alert":  spec.name,
+			"expr":   spec.expr,
+			"labels": map[string]string{"severity": spec.severity},
+			"annotations": map[string]string{
+				"summary":     spec.summary,
+				"description": spec.description,
+			},
+		}
+		if spec.forDuration != "" {
+			rule["for"] = spec.forDuration
+		}
+		rules = append(rules, rule)
+	}
+
+	return yaml.Marshal(map[string]interface{}{
+		"apiVersion": "monitoring.coreos.com/v1",
+		"kind":       "PrometheusRule",
+		"metadata": map[string]interface{}{
+			"name":      o.name,
+			"namespace": o.namespace,
+			"labels":    map[string]string{"app": "gateway-yeeter"},
+		},
+		"spec": map[string]interface{}{
+			"groups": []interface{}{map[string]interface{}{
+				"name":  "gateway-yeeter",
+				"rules": rules,
+			}},
+		},
+	})
+}
+
+func runExportAlerts(args []string) int {
+	fs := flag.NewFlagSet("export-alerts", flag.ContinueOnError)
+	var o alertOptions
+	fs.StringVar(&o.name, "name", "gateway-yeeter", "Name of the PrometheusRule")
+	fs.StringVar(&o.namespace, "namespace", "openshift-mtv", "Namespace of the PrometheusRule")
+	fs.StringVar(&o.selector, "selector", "", "Label matchers added to every query, e.g. namespace=\"openshift-mtv\"")
+	fs.DurationVar(&o.webhookTimeout, "webhook-timeout", 5*time.Second, "timeoutSeconds of the MutatingWebhookConfiguration; latency alerts fire at 80%")
+	fs.Float64Var(&o.errorRatio, "error-ratio", 0.05, "Ratio of admission reviews ending in an error that fires an alert")
+	fs.DurationVar(&o.certExpiryWarning, "cert-expiry-warning", 7*24*time.Hour, "Remaining serving certificate validity that fires an alert")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if o.webhookTimeout <= 0 || o.certExpiryWarning <= 0 || o.errorRatio <= 0 || o.errorRatio > 1 {
+		fmt.Fprintln(os.Stderr, "--webhook-timeout and --cert-expiry-warning must be positive and --error-ratio within (0, 1]")
+		return exitUsage
+	}
+
+	out, err := renderPrometheusRule(o, metricDefinitions)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFindings
+	}
+	os.Stdout.Write(out)
+	return exitOK
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+type testPrometheusRule struct {
+	Kind string `json:"kind"`
+	Spec struct {
+		Groups []struct {
+			Rules []struct {
+				Alert string `json:"alert"`
+				Expr  string `json:"expr"`
+			} `json:"rules"`
+		} `json:"groups"`
+	} `json:"spec"`
+}
+
+func TestExportAlerts(t *testing.T) {
+	code, out := captureStdout(t, func() int {
+		return runExportAlerts([]string{"--selector", `namespace="openshift-mtv"`, "--webhook-timeout", "10s"})
+	})
+	if code != exitOK {
+		t.Fatalf("expected exit code %d, got %d", exitOK, code)
+	}
+	var rule testPrometheusRule
+	if err := yaml.Unmarshal(out, &rule); err != nil {
+		t.Fatal(err)
+	}
+	if rule.Kind != "PrometheusRule" || len(rule.Spec.Groups) != 1 {
+		t.Fatalf("unexpected manifest:\n%s", out)
+	}
+
+	exprs := map[string]string{}
+	for _, r := range rule.Spec.Groups[0].Rules {
+		if !strings.Contains(r.Expr, `namespace="openshift-mtv"`) {
+			t.Fatalf("expected selector in %s", r.Expr)
+		}
+		exprs[r.Alert] = r.Expr
+	}
+	if len(exprs) != len(alertSpecs(alertOptions{})) {
+		t.Fatalf("unexpected alerts %v", exprs)
+	}
+	if expr := exprs["GatewayYeeterAdmissionErrors"]; !strings.Contains(expr, `{namespace="openshift-mtv", outcome="error"}`) || !strings.HasSuffix(expr, "> 0.05") {
+		t.Fatalf("unexpected error rate alert %s", expr)
+	}
+	if expr := exprs["GatewayYeeterAdmissionLatencyHigh"]; !strings.HasSuffix(expr, "> 8") {
+		t.Fatalf("expected latency threshold at 80%% of the webhook timeout, got %s", expr)
+	}
+	if expr := exprs["GatewayYeeterServingCertificateExpiring"]; !strings.HasSuffix(expr, "< 604800") {
+		t.Fatalf("unexpected certificate expiry alert %s", expr)
+	}
+}
+
+func TestExportAlertsRejectsUndefinedMetrics(t *testing.T) {
+	if _, err := renderPrometheusRule(alertOptions{webhookTimeout: 5 * time.Second}, nil); err == nil {
+		t.Fatal("expected alerts on undefined metrics to be rejected")
+	}
+	if code, _ := captureStdout(t, func() int { return runExportAlerts([]string{"--error-ratio", "2"}) }); code != exitUsage {
+		t.Fatalf("expected exit code %d, got %d", exitUsage, code)
+	}
+}
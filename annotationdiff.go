@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// networksDiff describes how modified differs from the original networks
+// annotation, one attachment at a time, e.g.
+//
+//	mtv/transfer: -default-route=["10.0.0.1"]; mtv/backup: -cni-args.gateway="10.0.1.1"; 1 unchanged
+//
+// Removed keys are prefixed with -, added keys with + and changed values
+// with ~, showing the old and new value. Attachments are matched by position, the webhook
+// never reorders them. Names and values follow the redaction policy of
+// channel.
+func networksDiff(original, modified, channel string) (string, error) {
+	var before, after []map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(original), &before); err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal([]byte(modified), &after); err != nil {
+		return "", err
+	}
+	if len(before) != len(after) {
+		return "", fmt.Errorf("attachment count changed from %d to %d", len(before), len(after))
+	}
+
+	var parts []string
+	unchanged := 0
+	for i := range before {
+		changes := objectDiff("", before[i], after[i], channel)
+		if len(changes) == 0 {
+			unchanged++
+			continue
+		}
+		parts = append(parts, attachmentLabel(before[i], i, channel)+": "+strings.Join(changes, ", "))
+	}
+	if unchanged > 0 {
+		parts = append(parts, fmt.Sprintf("%d unchanged", unchanged))
+	}
+	return strings.Join(parts, "; "), nil
+}
+
+// objectDiff compares two JSON objects key by key, descending into nested
+// objects such as cni-args.
+func objectDiff(prefix string, before, after map[string]json.RawMessage, channel string) []string {
+	keys := make(map[string]bool, len(before)+len(after))
+	for key := range before {
+		keys[key] = true
+	}
+	for key := range after {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	var changes []string
+	for _, key := range sorted {
+		old, hadOld := before[key]
+		updated, hasUpdated := after[key]
+		switch {
+		case !hasUpdated:
+			changes = append(changes, "-"+prefix+key+"="+diffValue(old, channel))
+		case !hadOld:
+			changes = append(changes, "+"+prefix+key+"="+diffValue(updated, channel))
+		case !bytes.Equal(compactJSON(old), compactJSON(updated)):
+			var oldObject, updatedObject map[string]json.RawMessage
+			if json.Unmarshal(old, &oldObject) == nil && json.Unmarshal(updated, &updatedObject) == nil {
+				changes = append(changes, objectDiff(prefix+key+".", oldObject, updatedObject, channel)...)
+				continue
+			}
+			changes = append(changes, "~"+prefix+key+"="+diffValue(old, channel)+" -> "+diffValue(updated, channel))
+		}
+	}
+	return changes
+}
+
+func attachmentLabel(entry map[string]json.RawMessage, index int, channel string) string {
+	var namespace, name string
+	json.Unmarshal(entry["namespace"], &namespace)
+	json.Unmarshal(entry["name"], &name)
+	if name == "" {
+		return fmt.Sprintf("#%d", index)
+	}
+	return cfg.Redaction.value(channel, fieldNetworks, namespace+"/"+name)
+}
+
+// diffValue renders a value of the annotation. Values are gateways and
+// routes for the keys the webhook changes, so they are redacted as such.
+func diffValue(raw json.RawMessage, channel string) string {
+	return cfg.Redaction.value(channel, fieldGateways, string(compactJSON(raw)))
+}
+
+func compactJSON(raw json.RawMessage) []byte {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return raw
+	}
+	return buf.Bytes()
+}
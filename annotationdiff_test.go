@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNetworksDiff(t *testing.T) {
+	cases := []struct {
+		original, modified, want string
+	}{
+		{
+			`[{"name":"transfer","namespace":"mtv","default-route":["10.0.0.1"]},{"name":"storage"}]`,
+			`[{"name":"transfer","namespace":"mtv"},{"name":"storage"}]`,
+			`mtv/transfer: -default-route=["10.0.0.1"]; 1 unchanged`,
+		},
+		{
+			`[{"name":"transfer","cni-args":{"gateway":"10.0.0.1","mtu":9000}}]`,
+			`[{"name":"transfer","cni-args":{"mtu":9000}}]`,
+			`/transfer: -cni-args.gateway="10.0.0.1"`,
+		},
+		{
+			`[{"name":"transfer","ips":["10.0.0.5/24"]},{"name":"backup","default-route":["10.0.1.1"]}]`,
+			`[{"name":"transfer","ips":["10.0.0.6/24"]},{"name":"backup","routes":[{"dst":"10.1.0.0/16"}]}]`,
+			`/transfer: ~ips=["10.0.0.5/24"] -> ["10.0.0.6/24"]; /backup: -default-route=["10.0.1.1"], +routes=[{"dst":"10.1.0.0/16"}]`,
+		},
+	}
+	for _, c := range cases {
+		got, err := networksDiff(c.original, c.modified, channelLogs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("expected %s, got %s", c.want, got)
+		}
+	}
+
+	if _, err := networksDiff(`[{"name":"a"}]`, `[]`, channelLogs); err == nil {
+		t.Fatalf("expected an error for removed attachments")
+	}
+}
+
+func TestNetworksDiffRedaction(t *testing.T) {
+	old := cfg
+	defer func() { cfg = old }()
+	cfg.Redaction = redactionPolicy{channelLogs: {fieldNetworks, fieldGateways}}
+
+	got, err := networksDiff(`[{"name":"transfer","namespace":"mtv","default-route":["10.0.0.1"]}]`, `[{"name":"transfer","namespace":"mtv"}]`, channelLogs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := cfg.Redaction.value(channelLogs, fieldNetworks, "mtv/transfer") + ": -default-route=" + cfg.Redaction.value(channelLogs, fieldGateways, `["10.0.0.1"]`)
+	if got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
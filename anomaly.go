@@ -0,0 +1,100 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+)
+
+var namespaceMutationAnomaly = newGaugeVec(prometheus.GaugeOpts{
+	Name: "gateway_yeeter_namespace_mutation_anomaly",
+	Help: "1 while a namespace exceeds the configured number of mutations per window, which usually indicates a controller recreating pods in a loop.",
+}, "namespace")
+
+// mutationRateTracker counts mutations per namespace in a sliding window
+// and flags namespaces exceeding the threshold. Only the most recent
+// threshold+1 mutations are kept per namespace.
+type mutationRateTracker struct {
+	threshold int
+	window    time.Duration
+	now       func() time.Time
+
+	mu        sync.Mutex
+	mutations map[string][]time.Time
+	alerting  map[string]bool
+}
+
+var mutationRates *mutationRateTracker
+
+func newMutationRateTracker(threshold int, window time.Duration) *mutationRateTracker {
+	return &mutationRateTracker{
+		threshold: threshold,
+		window:    window,
+		now:       time.Now,
+		mutations: make(map[string][]time.Time),
+		alerting:  make(map[string]bool),
+	}
+}
+
+func (t *mutationRateTracker) record(d *decision) {
+	if t == nil || d.Outcome != outcomeMutated || d.Mode != "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	times := append(t.mutations[d.Namespace], t.now())
+	if len(times) > t.threshold+1 {
+		times = times[len(times)-t.threshold-1:]
+	}
+	t.mutations[d.Namespace] = times
+	t.evaluate(d.Namespace)
+}
+
+// evaluate updates the anomaly state of namespace, t.mu must be held.
+func (t *mutationRateTracker) evaluate(namespace string) {
+	cutoff := t.now().Add(-t.window)
+	times := t.mutations[namespace]
+	for len(times) > 0 && !times[0].After(cutoff) {
+		times = times[1:]
+	}
+	if len(times) == 0 {
+		delete(t.mutations, namespace)
+	} else {
+		t.mutations[namespace] = times
+	}
+
+	label := cfg.Redaction.value(channelMetrics, fieldNamespace, namespace)
+	exceeded := len(times) > t.threshold
+	switch {
+	case exceeded && !t.alerting[namespace]:
+		t.alerting[namespace] = true
+		namespaceMutationAnomaly.WithLabelValues(label).Set(1)
+		klog.Warningf("Namespace %s exceeded %d mutations within %s, a controller may be recreating pods in a loop", cfg.Redaction.value(channelLogs, fieldNamespace, namespace), t.threshold, t.window)
+	case !exceeded && t.alerting[namespace]:
+		delete(t.alerting, namespace)
+		namespaceMutationAnomaly.DeleteLabelValues(label)
+		klog.Infof("Mutation rate of namespace %s is back below %d within %s", cfg.Redaction.value(channelLogs, fieldNamespace, namespace), t.threshold, t.window)
+	}
+}
+
+// sweep clears namespaces that stopped receiving mutations.
+func (t *mutationRateTracker) sweep() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for namespace := range t.mutations {
+		t.evaluate(namespace)
+	}
+}
+
+func (t *mutationRateTracker) run(interval time.Duration) {
+	if t == nil {
+		return
+	}
+	for range time.Tick(interval) {
+		t.sweep()
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMutationRateTracker(t *testing.T) {
+	now := time.Now()
+	tracker := newMutationRateTracker(2, time.Minute)
+	tracker.now = func() time.Time { return now }
+	defer namespaceMutationAnomaly.Reset()
+
+	mutate := func(namespace string) {
+		tracker.record(&decision{Namespace: namespace, Outcome: outcomeMutated})
+		now = now.Add(time.Second)
+	}
+	for i := 0; i < 2; i++ {
+		mutate("looping")
+	}
+	tracker.record(&decision{Namespace: "looping", Outcome: outcomeUnchanged})
+	tracker.record(&decision{Namespace: "looping", Outcome: outcomeMutated, Mode: modeShadow})
+	if got := testutil.CollectAndCount(namespaceMutationAnomaly); got != 0 {
+		t.Fatalf("expected no anomaly at the threshold, got %d series", got)
+	}
+
+	mutate("looping")
+	mutate("quiet")
+	if got := testutil.ToFloat64(namespaceMutationAnomaly.WithLabelValues("looping")); got != 1 {
+		t.Fatalf("expected anomaly for namespace looping, got %v", got)
+	}
+	if got := len(tracker.mutations["looping"]); got != 3 {
+		t.Fatalf("expected only threshold+1 mutations to be kept, got %d", got)
+	}
+
+	now = now.Add(time.Minute)
+	tracker.sweep()
+	if got := testutil.CollectAndCount(namespaceMutationAnomaly); got != 0 {
+		t.Fatalf("expected anomaly to clear after the window, got %d series", got)
+	}
+	if len(tracker.mutations) != 0 || len(tracker.alerting) != 0 {
+		t.Fatalf("expected idle namespaces to be forgotten, got %v %v", tracker.mutations, tracker.alerting)
+	}
+}
@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+type auditLog struct {
+	mu sync.Mutex
+	w  io.Writer
+
+	path            string
+	cipher          *recordCipher
+	format          string
+	chain           bool
+	seq             uint64
+	head            string
+	signer          ed25519.PrivateKey
+	sinceCheckpoint int
+}
+
+type chainedEntry struct {
+	Seq      uint64          `json:"seq"`
+	PrevHash string          `json:"prevHash"`
+	Hash     string          `json:"hash"`
+	Record   json.RawMessage `json:"record"`
+}
+
+type checkpointRecord struct {
+	Kind      string    `json:"kind"`
+	Time      time.Time `json:"time"`
+	Seq       uint64    `json:"seq"`
+	Hash      string    `json:"hash"`
+	Signature string    `json:"signature"`
+}
+
+// Sources of the configuration changes applied at runtime. Periodic
+// refreshes are attributed to actorRefresh, watch events to actorWatch and
+// /reload to its caller.
+const (
+	changeSourceRules      = "rule-sources"
+	changeSourceTargets    = "target-policies"
+	changeSourceConfigFile = "config-file"
+
+	actorRefresh = "refresh"
+	actorWatch   = "watch"
+)
+
+type configChangeRecord struct {
+	Kind    string    `json:"kind"`
+	Time    time.Time `json:"time"`
+	Source  string    `json:"source"`
+	Actor   string    `json:"actor"`
+	OldHash string    `json:"oldHash,omitempty"`
+	NewHash string    `json:"newHash"`
+	// Config is the new configuration, or the new rules or targets when
+	// Source changed at runtime.
+	Config interface{} `json:"config"`
+}
+
+var auditor *auditLog
+
+func openAuditLog(path, format string, chain bool, checkpointKey string, cipher *recordCipher) (*auditLog, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	a := &auditLog{format: format, chain: chain, cipher: cipher}
+	if checkpointKey != "" {
+		if !chain {
+			return nil, errors.New("audit checkpoints require the hash chain to be enabled")
+		}
+		signer, err := loadCheckpointKey(checkpointKey)
+		if err != nil {
+			return nil, err
+		}
+		a.signer = signer
+	}
+
+	if path == "-" {
+		a.w = os.Stdout
+		return a, nil
+	}
+
+	a.path = path
+	if chain {
+		if err := a.resumeChain(path); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("could not open audit log %s: %w", path, err)
+	}
+	a.w = f
+	return a, nil
+}
+
+// resumeChain continues the chain after the last hash-chained entry of the
+// log. Entries written while --audit-hash-chain was off are left out of the
+// chain, and a log without chained entries starts a new chain at seq=1.
+func (a *auditLog) resumeChain(path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not read audit log %s: %w", path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var last chainedEntry
+	unchained := 0
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry chainedEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.Hash == "" {
+			unchained++
+			continue
+		}
+		last, unchained = entry, 0
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("could not read audit log %s: %w", path, err)
+	}
+	if last.Hash == "" {
+		if unchained > 0 {
+			klog.Warningf("Audit log %s has no hash-chained entries, starting a new chain after its %d unchained entries", path, unchained)
+		}
+		return nil
+	}
+	if unchained > 0 {
+		klog.Warningf("Audit log %s ends with %d unchained entries, which are left out of the chain", path, unchained)
+	}
+	a.seq, a.head = last.Seq, last.Hash
+	klog.Infof("Resuming audit log hash chain at seq=%d hash=%s", a.seq, a.head)
+	return nil
+}
+
+func (a *auditLog) write(record interface{}) error {
+	if a == nil {
+		return nil
+	}
+
+	if a.format == auditFormatKubernetes {
+		record = toAuditEvent(record)
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if a.cipher != nil {
+		if line, err = a.cipher.seal(line); err != nil {
+			return err
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.appendLocked(line)
+}
+
+func (a *auditLog) appendLocked(line []byte) error {
+	if a.chain {
+		entry := chainedEntry{
+			Seq:      a.seq + 1,
+			PrevHash: a.head,
+			Record:   line,
+		}
+		entry.Hash = chainHash(entry.Seq, entry.PrevHash, entry.Record)
+
+		var err error
+		if line, err = json.Marshal(entry); err != nil {
+			return err
+		}
+		a.seq, a.head = entry.Seq, entry.Hash
+		a.sinceCheckpoint++
+	}
+
+	_, err := a.w.Write(append(line, '\n'))
+	return err
+}
+
+func (a *auditLog) checkpoint() error {
+	if a == nil || a.signer == nil {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.sinceCheckpoint == 0 {
+		return nil
+	}
+
+	record := checkpointRecord{
+		Kind:      "Checkpoint",
+		Time:      time.Now().UTC(),
+		Seq:       a.seq,
+		Hash:      a.head,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(a.signer, checkpointPayload(a.seq, a.head))),
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := a.appendLocked(line); err != nil {
+		return err
+	}
+	a.sinceCheckpoint = 0
+	return nil
+}
+
+func (a *auditLog) runCheckpoints(interval time.Duration) {
+	if a == nil || a.signer == nil || interval <= 0 {
+		return
+	}
+	for range time.Tick(interval) {
+		if err := a.checkpoint(); err != nil {
+			klog.Errorf("Could not write audit log checkpoint: %v", err)
+		}
+	}
+}
+
+func chainHash(seq uint64, prevHash string, record []byte) string {
+	h := sha256.New()
+	h.Write([]byte(strconv.FormatUint(seq, 10)))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(prevHash))
+	h.Write([]byte{'\n'})
+	h.Write(record)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func checkpointPayload(seq uint64, hash string) []byte {
+	return []byte("gateway-yeeter-audit-checkpoint:" + strconv.FormatUint(seq, 10) + ":" + hash)
+}
+
+func loadCheckpointKey(path string) (ed25519.PrivateKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read audit checkpoint key: %w", err)
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("audit checkpoint key %s is not PEM encoded", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse audit checkpoint key: %w", err)
+	}
+	signer, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("audit checkpoint key %s is not an Ed25519 key", path)
+	}
+	return signer, nil
+}
+
+func loadCheckpointPublicKey(path string) (ed25519.PublicKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read audit checkpoint public key: %w", err)
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("audit checkpoint public key %s is not PEM encoded", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse audit checkpoint public key: %w", err)
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("audit checkpoint public key %s is not an Ed25519 key", path)
+	}
+	return pub, nil
+}
+
+// verifyAuditChain verifies the hash chain and checkpoints of an audit log.
+// Entries written while --audit-hash-chain was off are skipped and counted
+// as unchained; the chained entries around them must still be consecutive.
+func verifyAuditChain(r io.Reader, pub ed25519.PublicKey) (entries, checkpoints, unchained int, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var prevSeq uint64
+	var prevHash string
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var entry chainedEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.Hash == "" {
+			unchained++
+			continue
+		}
+		// The chain starts at seq=1 without a previous hash, so removing
+		// entries from the head breaks it too.
+		if entry.Seq != prevSeq+1 || entry.PrevHash != prevHash {
+			return entries, checkpoints, unchained, fmt.Errorf("line %d: chain broken at seq=%d (expected seq=%d after hash %s)", line, entry.Seq, prevSeq+1, prevHash)
+		}
+		if chainHash(entry.Seq, entry.PrevHash, entry.Record) != entry.Hash {
+			return entries, checkpoints, unchained, fmt.Errorf("line %d: hash mismatch at seq=%d, entry was modified", line, entry.Seq)
+		}
+
+		var checkpoint checkpointRecord
+		if err := json.Unmarshal(entry.Record, &checkpoint); err == nil && checkpoint.Kind == "Checkpoint" {
+			if checkpoint.Seq != prevSeq || checkpoint.Hash != prevHash {
+				return entries, checkpoints, unchained, fmt.Errorf("line %d: checkpoint does not cover the preceding entry", line)
+			}
+			if pub != nil {
+				signature, err := base64.StdEncoding.DecodeString(checkpoint.Signature)
+				if err != nil || !ed25519.Verify(pub, checkpointPayload(checkpoint.Seq, checkpoint.Hash), signature) {
+					return entries, checkpoints, unchained, fmt.Errorf("line %d: invalid checkpoint signature at seq=%d", line, checkpoint.Seq)
+				}
+			}
+			checkpoints++
+		}
+
+		prevSeq, prevHash = entry.Seq, entry.Hash
+		entries++
+	}
+	if err := scanner.Err(); err != nil {
+		return entries, checkpoints, unchained, err
+	}
+	if entries == 0 && unchained > 0 {
+		return entries, checkpoints, unchained, errors.New("no hash-chained entries")
+	}
+	return entries, checkpoints, unchained, nil
+}
+
+func runVerifyAuditLog(args []string) int {
+	fs := flag.NewFlagSet("verify-audit-log", flag.ExitOnError)
+	publicKey := fs.String("public-key", "", "PEM encoded Ed25519 public key used to verify checkpoint signatures")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: gateway-yeeter verify-audit-log [--public-key=<file>] <audit-log>")
+		return 2
+	}
+
+	var pub ed25519.PublicKey
+	if *publicKey != "" {
+		var err error
+		if pub, err = loadCheckpointPublicKey(*publicKey); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer f.Close()
+
+	entries, checkpoints, unchained, err := verifyAuditChain(f, pub)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "audit log verification FAILED after %d entries: %v\n", entries, err)
+		return 1
+	}
+	fmt.Printf("audit log OK: %d entries, %d checkpoints\n", entries, checkpoints)
+	if unchained > 0 {
+		fmt.Printf("%d unchained entries, written without --audit-hash-chain, are not covered\n", unchained)
+	}
+	return 0
+}
+
+func runDecryptAuditLog(args []string) int {
+	fs := flag.NewFlagSet("decrypt-audit-log", flag.ExitOnError)
+	keyFile := fs.String("key", "", "File containing the base64 encoded AES-256 record encryption key")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || *keyFile == "" {
+		fmt.Fprintln(os.Stderr, "usage: gateway-yeeter decrypt-audit-log --key=<file> <audit-log>")
+		return 2
+	}
+
+	c, err := loadRecordCipher(*keyFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		record := scanner.Bytes()
+		var entry chainedEntry
+		if err := json.Unmarshal(record, &entry); err == nil && entry.Hash != "" {
+			record = entry.Record
+		}
+
+		plaintext, err := c.open(record)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "line %d: %v\n", line, err)
+			return 1
+		}
+		fmt.Printf("%s\n", plaintext)
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func auditConfigChange(source, actor string, old *config, next config) {
+	var oldHash string
+	if old != nil {
+		oldHash = old.hash()
+	}
+	auditPolicyChange(source, actor, oldHash, next.hash(), next)
+}
+
+// auditPolicyChange records a change of the configuration or of the rules
+// and targets read at runtime, which change the policy without a restart.
+func auditPolicyChange(source, actor, oldHash, newHash string, content interface{}) {
+	record := configChangeRecord{
+		Kind:    "ConfigChange",
+		Time:    time.Now().UTC(),
+		Source:  source,
+		Actor:   actor,
+		OldHash: oldHash,
+		NewHash: newHash,
+		Config:  content,
+	}
+
+	klog.Infof("Configuration changed by %s via %s: %s -> %s", actor, source, record.OldHash, record.NewHash)
+	if err := auditor.write(record); err != nil {
+		klog.Errorf("Could not write configuration change to audit log: %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAuditConfigChange(t *testing.T) {
+	var buf bytes.Buffer
+	auditor = &auditLog{w: &buf}
+	defer func() { auditor = nil }()
+
+	old := defaultConfig()
+	next := defaultConfig()
+	next.RateLimit = 5
+
+	auditConfigChange("test", "tester", &old, next)
+
+	var record configChangeRecord
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("failed to unmarshal audit record: %v", err)
+	}
+	if record.Kind != "ConfigChange" || record.Source != "test" || record.Actor != "tester" {
+		t.Fatalf("unexpected audit record: %+v", record)
+	}
+	if record.OldHash != old.hash() || record.NewHash != next.hash() {
+		t.Fatal("expected old and new configuration hashes")
+	}
+	if record.OldHash == record.NewHash {
+		t.Fatal("expected hashes of different configurations to differ")
+	}
+}
+
+func TestAuditLogDisabled(t *testing.T) {
+	var a *auditLog
+	if err := a.write(struct{}{}); err != nil {
+		t.Fatalf("expected disabled audit log to be a no-op, got %v", err)
+	}
+}
+
+func newTestChainedAuditLog(t *testing.T, buf *bytes.Buffer) (*auditLog, ed25519.PublicKey) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &auditLog{w: buf, chain: true, signer: priv}, pub
+}
+
+func TestAuditHashChainVerifies(t *testing.T) {
+	var buf bytes.Buffer
+	a, pub := newTestChainedAuditLog(t, &buf)
+
+	a.write(&decision{Kind: "Decision", UID: "1", Outcome: outcomeMutated})
+	a.write(&decision{Kind: "Decision", UID: "2", Outcome: outcomeUnchanged})
+	if err := a.checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	a.write(&decision{Kind: "Decision", UID: "3", Outcome: outcomeSkipped})
+
+	entries, checkpoints, _, err := verifyAuditChain(bytes.NewReader(buf.Bytes()), pub)
+	if err != nil {
+		t.Fatalf("expected chain to verify, got %v", err)
+	}
+	if entries != 4 || checkpoints != 1 {
+		t.Fatalf("expected 4 entries and 1 checkpoint, got %d and %d", entries, checkpoints)
+	}
+}
+
+func TestAuditHashChainDetectsTampering(t *testing.T) {
+	var buf bytes.Buffer
+	a, pub := newTestChainedAuditLog(t, &buf)
+
+	a.write(&decision{Kind: "Decision", UID: "1", Namespace: "ns-a", Outcome: outcomeMutated})
+	a.write(&decision{Kind: "Decision", UID: "2", Namespace: "ns-b", Outcome: outcomeMutated})
+	a.write(&decision{Kind: "Decision", UID: "3", Namespace: "ns-c", Outcome: outcomeMutated})
+
+	modified := bytes.Replace(buf.Bytes(), []byte("ns-b"), []byte("ns-x"), 1)
+	if _, _, _, err := verifyAuditChain(bytes.NewReader(modified), pub); err == nil {
+		t.Fatal("expected modified entry to be detected")
+	}
+
+	lines := bytes.SplitAfter(buf.Bytes(), []byte("\n"))
+	removed := append(append([]byte{}, lines[0]...), lines[2]...)
+	if _, _, _, err := verifyAuditChain(bytes.NewReader(removed), pub); err == nil {
+		t.Fatal("expected removed entry to be detected")
+	}
+}
+
+func TestAuditHashChainDetectsTruncatedHead(t *testing.T) {
+	var buf bytes.Buffer
+	a, pub := newTestChainedAuditLog(t, &buf)
+
+	a.write(&decision{Kind: "Decision", UID: "1", Outcome: outcomeMutated})
+	a.write(&decision{Kind: "Decision", UID: "2", Outcome: outcomeMutated})
+	if err := a.checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	a.write(&decision{Kind: "Decision", UID: "3", Outcome: outcomeMutated})
+
+	truncated := buf.Bytes()[bytes.IndexByte(buf.Bytes(), '\n')+1:]
+	if _, _, _, err := verifyAuditChain(bytes.NewReader(truncated), pub); err == nil || !strings.Contains(err.Error(), "chain broken at seq=2") {
+		t.Fatalf("expected the truncated head to be detected, got %v", err)
+	}
+}
+
+func TestAuditCheckpointSignatureVerification(t *testing.T) {
+	var buf bytes.Buffer
+	a, _ := newTestChainedAuditLog(t, &buf)
+
+	a.write(&decision{Kind: "Decision", UID: "1"})
+	if err := a.checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	otherPub, _, _ := ed25519.GenerateKey(nil)
+	if _, _, _, err := verifyAuditChain(bytes.NewReader(buf.Bytes()), otherPub); err == nil {
+		t.Fatal("expected checkpoint signed by another key to be rejected")
+	}
+}
+
+func TestAuditHashChainResumes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	a, err := openAuditLog(path, auditFormatNative, true, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.write(&decision{Kind: "Decision", UID: "1"})
+
+	a, err = openAuditLog(path, auditFormatNative, true, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.write(&decision{Kind: "Decision", UID: "2"})
+
+	raw, _ := os.ReadFile(path)
+	entries, _, _, err := verifyAuditChain(bytes.NewReader(raw), nil)
+	if err != nil {
+		t.Fatalf("expected resumed chain to verify, got %v", err)
+	}
+	if entries != 2 {
+		t.Fatalf("expected 2 entries, got %d", entries)
+	}
+}
+
+func TestAuditHashChainOnUnchainedLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for i, chain := range []bool{false, false, true, false, true} {
+		a, err := openAuditLog(path, auditFormatNative, chain, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.write(&decision{Kind: "Decision", UID: strconv.Itoa(i)})
+	}
+
+	raw, _ := os.ReadFile(path)
+	entries, _, unchained, err := verifyAuditChain(bytes.NewReader(raw), nil)
+	if err != nil || entries != 2 || unchained != 3 {
+		t.Fatalf("expected 2 chained and 3 unchained entries, got %d and %d: %v", entries, unchained, err)
+	}
+
+	lines := bytes.SplitAfter(raw, []byte("\n"))
+	removed := bytes.Join(append(lines[:2:2], lines[3:]...), nil)
+	if _, _, _, err := verifyAuditChain(bytes.NewReader(removed), nil); err == nil || !strings.Contains(err.Error(), "chain broken at seq=2") {
+		t.Fatalf("expected the removed first chained entry to be detected, got %v", err)
+	}
+	if _, _, _, err := verifyAuditChain(bytes.NewReader(bytes.Join(lines[:2], nil)), nil); err == nil {
+		t.Fatal("expected a log without chained entries to fail verification")
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// startupBanner is logged as one JSON record when the server starts, so a
+// support bundle shows how the instance was configured without access to
+// its flags.
+type startupBanner struct {
+	Version    buildVersion     `json:"version"`
+	Instance   instanceIdentity `json:"instance"`
+	Listen     listenSettings   `json:"listen"`
+	TLS        tlsSettings      `json:"tls"`
+	Features   []string         `json:"features"`
+	Rules      []ruleSummary    `json:"rules"`
+	ConfigHash string           `json:"configHash"`
+	Settings   config           `json:"settings"`
+}
+
+type buildVersion struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"goVersion"`
+}
+
+type listenSettings struct {
+	Address           string        `json:"address"`
+	MaxConnections    int           `json:"maxConnections"`
+	ReadHeaderTimeout time.Duration `json:"readHeaderTimeout"`
+}
+
+type tlsSettings struct {
+	MinVersion    string    `json:"minVersion"`
+	ClientAuth    string    `json:"clientAuth"`
+	Subject       string    `json:"subject,omitempty"`
+	DNSNames      []string  `json:"dnsNames,omitempty"`
+	NotAfter      time.Time `json:"notAfter,omitempty"`
+	AdminClientCA string    `json:"adminClientCA,omitempty"`
+}
+
+type ruleSummary struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	Hash   string `json:"hash"`
+}
+
+func readBuildVersion() buildVersion {
+	v := buildVersion{Version: "unknown"}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return v
+	}
+	v.Version, v.GoVersion = info.Main.Version, info.GoVersion
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			v.Revision = setting.Value
+		case "vcs.modified":
+			v.Modified = setting.Value == "true"
+		}
+	}
+	return v
+}
+
+func newStartupBanner(c config, tlsConfig *tls.Config, leaf *x509.Certificate) startupBanner {
+	b := startupBanner{
+		Version:    readBuildVersion(),
+		Instance:   identity,
+		Listen:     listenSettings{Address: c.ListenAddress, MaxConnections: c.MaxConnections, ReadHeaderTimeout: c.ReadHeaderTimeout},
+		Features:   enabledFeatures(c),
+		Rules:      []ruleSummary{},
+		ConfigHash: c.hash(),
+		Settings:   c.redacted(),
+	}
+
+	// The server does not set a minimum, so the crypto/tls default applies.
+	b.TLS.MinVersion = tls.VersionName(tls.VersionTLS12)
+	if tlsConfig.MinVersion != 0 {
+		b.TLS.MinVersion = tls.VersionName(tlsConfig.MinVersion)
+	}
+	b.TLS.ClientAuth = tlsConfig.ClientAuth.String()
+	b.TLS.AdminClientCA = c.AdminClientCA
+	if leaf != nil {
+		b.TLS.Subject, b.TLS.DNSNames, b.TLS.NotAfter = leaf.Subject.String(), leaf.DNSNames, leaf.NotAfter
+	}
+	for _, r := range c.Rules {
+		b.Rules = append(b.Rules, ruleSummary{Name: r.Name, Action: r.Action, Hash: r.hash()})
+	}
+	return b
+}
+
+// enabledFeatures lists the optional behavior and integrations c turns on.
+func enabledFeatures(c config) []string {
+	features := []string{}
+	add := func(enabled bool, feature string) {
+		if enabled {
+			features = append(features, feature)
+		}
+	}
+	add(c.Maintenance, "maintenance")
+	add(c.Shadow, "shadow")
+	add(c.DryRun, "dry-run")
+	add(len(c.Rules) > 0, "rules")
+	add(len(c.RulesConfigMaps) > 0, "rules-configmaps")
+	add(c.RulesPolicies, "rules-policies")
+	add(c.TargetPolicies, "target-policies")
+	add(c.ConfigFile != "", "config")
+	add(c.CompareRules, "compare-rules")
+	add(len(c.ScopeNamespaces) > 0, "scope-namespaces")
+	add(len(c.ScopePlans) > 0, "scope-plans")
+	add(c.IgnoreNamespaceSelector != "", "ignore-namespace-selector")
+	add(c.HandleOVNPodNetworks, "ovn-pod-networks")
+	add(c.OVNRoutingAnnotations != ovnRoutingIgnore, "ovn-routing-annotations="+c.OVNRoutingAnnotations)
+	add(c.CheckNamespaceRouting, "check-namespace-routing")
+	add(c.SRIOVPolicy != sriovPolicyIgnore, "sriov-policy="+c.SRIOVPolicy)
+	add(c.StripIPAMRoutes, "strip-ipam-routes")
+	add(len(c.KeepGatewayCIDRs) > 0, "keep-gateway-cidrs")
+	add(rawNetworks, "cnitypes-raw-mode")
+	add(c.MaxAttachments > 0 || c.MaxNetworksAnnotationBytes > 0, "annotation-limits="+c.AnnotationLimitAction)
+	add(c.LogFormat == logFormatJSON, "log-format=json")
+	add(len(c.PodContext) > 0, "pod-context="+strings.Join(c.PodContext, ","))
+	add(c.InterfaceConflictAction != interfaceConflictWarn, "interface-conflicts="+c.InterfaceConflictAction)
+	add(c.HandleHotplug, "hotplug")
+	add(c.GatekeeperProvider, "gatekeeper-provider")
+	add(c.RateLimit > 0, "rate-limit")
+	add(c.MaxInFlight > 0, "max-in-flight")
+	add(c.NamespaceMutationThreshold > 0, "namespace-mutation-threshold")
+	add(c.AuditLog != "", "audit-log")
+	add(c.AuditHashChain, "audit-hash-chain")
+	add(c.AuditCheckpointKey != "", "audit-checkpoints")
+	add(c.RecordEncryptionKey != "", "record-encryption")
+	add(c.RedactionKey != "", "redaction-key")
+	add(c.DecisionStore != decisionStoreMemory, "decision-store="+c.DecisionStore)
+	add(len(c.Admins) > 0 || len(c.AdminViewers) > 0, "admin")
+	add(c.ElasticsearchURL != "", "elasticsearch")
+	add(c.S3Endpoint != "", "s3")
+	add(c.StatsdAddress != "", "statsd")
+	add(c.OTLPEndpoint != "", "otlp")
+	add(c.FleetCollector != "", "fleet")
+	add(c.DenialWebhook != "", "denial-webhook")
+	add(c.VerifyNetworkStatus, "verify-network-status")
+	add(c.CheckWebhookConflicts, "check-webhook-conflicts")
+	add(c.RequireWebhookRegistration, "require-webhook-registration")
+	add(c.PlanSummaries, "plan-summaries")
+	add(c.Events, "events")
+	add(c.ValidateMode != validateModeOff, "validate="+c.ValidateMode)
+	add(c.SelfProbeInterval > 0, "self-probe")
+	add(c.FaultLatency > 0 || c.FaultErrorRate > 0 || c.FaultTLSFailureRate > 0, "fault-injection")
+	return features
+}
+
+// redacted returns a copy of c that is safe to log. Sink headers are never
+// serialized, credentials embedded in sink URLs are masked here.
+func (c config) redacted() config {
+	c.ElasticsearchURL = redactURL(c.ElasticsearchURL)
+	c.S3Endpoint = redactURL(c.S3Endpoint)
+	c.OTLPEndpoint = redactURL(c.OTLPEndpoint)
+	c.FleetCollector = redactURL(c.FleetCollector)
+	c.DenialWebhook = redactURL(c.DenialWebhook)
+	return c
+}
+
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	return u.Redacted()
+}
+
+func logStartupBanner(c config, tlsConfig *tls.Config, leaf *x509.Certificate) {
+	raw, err := json.Marshal(newStartupBanner(c, tlsConfig, leaf))
+	if err != nil {
+		klog.Errorf("Could not marshal startup banner: %v", err)
+		return
+	}
+	klog.Infof("Startup configuration: %s", raw)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// decisionFilter selects recent decisions. Filters apply to the redacted
+// records, so viewers cannot probe for masked namespaces or pods.
+type decisionFilter struct {
+	Namespace string
+	Pod       string
+	PodType   string
+	Outcome   string
+	Gateway   string
+	Since     time.Time
+	Until     time.Time
+}
+
+// parseDecisionFilter reads the filter from query parameters. namespace and
+// pod accept glob patterns, since and until accept RFC 3339 timestamps or a
+// duration relative to now.
+func parseDecisionFilter(q url.Values, now time.Time) (decisionFilter, error) {
+	f := decisionFilter{
+		Namespace: q.Get("namespace"),
+		Pod:       q.Get("pod"),
+		PodType:   q.Get("podType"),
+		Outcome:   q.Get("outcome"),
+		Gateway:   q.Get("gateway"),
+	}
+	for _, pattern := range []string{f.Namespace, f.Pod} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return f, fmt.Errorf("invalid pattern %q", pattern)
+		}
+	}
+	var err error
+	if f.Since, err = parseFilterTime(q.Get("since"), now); err != nil {
+		return f, fmt.Errorf("invalid since: %v", err)
+	}
+	if f.Until, err = parseFilterTime(q.Get("until"), now); err != nil {
+		return f, fmt.Errorf("invalid until: %v", err)
+	}
+	return f, nil
+}
+
+func parseFilterTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func (f decisionFilter) matches(d *decision) bool {
+	if f.Namespace != "" {
+		if matched, _ := path.Match(f.Namespace, d.Namespace); !matched {
+			return false
+		}
+	}
+	if f.Pod != "" {
+		if matched, _ := path.Match(f.Pod, d.Pod); !matched {
+			return false
+		}
+	}
+	if f.PodType != "" && f.PodType != d.PodType {
+		return false
+	}
+	if f.Outcome != "" && f.Outcome != d.Outcome {
+		return false
+	}
+	if f.Gateway != "" && !removedGateway(d, f.Gateway) {
+		return false
+	}
+	if !f.Since.IsZero() && d.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && d.Time.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+func removedGateway(d *decision, gateway string) bool {
+	for _, n := range d.Networks {
+		if contains(n.RemovedGateways, gateway) {
+			return true
+		}
+	}
+	return false
+}
+
+// filteredDecisions returns the redacted recent decisions matching the
+// filter in r, newest first.
+func filteredDecisions(r *http.Request) ([]*decision, error) {
+	f, err := parseDecisionFilter(r.URL.Query(), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	records := []*decision{}
+	for _, d := range recentDecisions.list() {
+		if d = cfg.Redaction.decision(channelAdmin, d); f.matches(d) {
+			records = append(records, d)
+		}
+	}
+	return records, nil
+}
+
+var decisionBrowser = template.Must(template.New("browse").Funcs(template.FuncMap{
+	"gateways": func(networks []networkChange) string {
+		var parts []string
+		for _, n := range networks {
+			parts = append(parts, n.Network+": "+strings.Join(n.RemovedGateways, ", "))
+		}
+		return strings.Join(parts, "; ")
+	},
+	"timestamp": func(t time.Time) string { return t.Format(time.RFC3339) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>gateway-yeeter decisions</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #ddd; padding: 0.3em; text-align: left; vertical-align: top; }
+.mutated { color: #2a7; } .denied, .error { color: #c33; }
+</style>
+</head>
+<body>
+<h1>Decisions</h1>
+<form method="get">
+<input name="namespace" placeholder="namespace" value="{{.Query.Get "namespace"}}">
+<input name="pod" placeholder="pod" value="{{.Query.Get "pod"}}">
+<select name="podType">
+{{- $podType := .Query.Get "podType"}}
+<option value="">any pod type</option>
+{{- range .PodTypes}}<option{{if eq . $podType}} selected{{end}}>{{.}}</option>{{end}}
+</select>
+<select name="outcome">
+{{- $outcome := .Query.Get "outcome"}}
+<option value="">any outcome</option>
+{{- range .Outcomes}}<option{{if eq . $outcome}} selected{{end}}>{{.}}</option>{{end}}
+</select>
+<input name="gateway" placeholder="removed gateway" value="{{.Query.Get "gateway"}}">
+<input name="since" placeholder="since (1h or RFC 3339)" value="{{.Query.Get "since"}}">
+<input name="until" placeholder="until" value="{{.Query.Get "until"}}">
+<button type="submit">Filter</button>
+</form>
+<p>{{len .Decisions}} of the last {{.Total}} decisions</p>
+<table>
+<tr><th>Time</th><th>Namespace</th><th>Pod</th><th>Type</th><th>Rule</th><th>Outcome</th><th>Removed gateways</th><th>Details</th></tr>
+{{- range .Decisions}}
+<tr>
+<td>{{timestamp .Time}}</td><td>{{.Namespace}}</td><td>{{.Pod}}</td><td>{{.PodType}}</td><td>{{.Rule}}</td>
+<td class="{{.Outcome}}">{{.Outcome}}{{if .Mode}} ({{.Mode}}){{end}}</td>
+<td>{{gateways .Networks}}</td>
+<td>{{.Message}}{{if .Patch}}<details><summary>patch</summary><code>{{.Patch}}</code></details>{{end}}</td>
+</tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+func handleDecisionBrowser(w http.ResponseWriter, r *http.Request) {
+	records, err := filteredDecisions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := decisionBrowser.Execute(w, struct {
+		Query     url.Values
+		PodTypes  []string
+		Outcomes  []string
+		Decisions []*decision
+		Total     int
+	}{
+		Query:     r.URL.Query(),
+		PodTypes:  []string{"virt-v2v", "cdi"},
+		Outcomes:  []string{outcomeMutated, outcomeUnchanged, outcomeSkipped, outcomeDenied, outcomeError},
+		Decisions: records,
+		Total:     len(recentDecisions.list()),
+	}); err != nil {
+		klog.Errorf("Could not render decision browser: %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecisionFilter(t *testing.T) {
+	now := time.Date(2025, 11, 20, 12, 0, 0, 0, time.UTC)
+	d := &decision{Time: now.Add(-30 * time.Minute), Namespace: "mtv-prod", Pod: "importer-disk-0", PodType: "cdi", Outcome: outcomeMutated}
+
+	cases := []struct {
+		query string
+		want  bool
+	}{
+		{"", true},
+		{"namespace=mtv-*", true},
+		{"namespace=mtv-test", false},
+		{"pod=importer-*&podType=cdi", true},
+		{"podType=virt-v2v", false},
+		{"outcome=mutated", true},
+		{"outcome=denied", false},
+		{"since=1h", true},
+		{"since=10m", false},
+		{"until=2025-11-20T11:00:00Z", false},
+		{"since=2025-11-20T11:00:00Z&until=2025-11-20T12:00:00Z", true},
+	}
+	for _, c := range cases {
+		q, _ := url.ParseQuery(c.query)
+		f, err := parseDecisionFilter(q, now)
+		if err != nil {
+			t.Fatalf("%q: %v", c.query, err)
+		}
+		if got := f.matches(d); got != c.want {
+			t.Errorf("%q: expected %v, got %v", c.query, c.want, got)
+		}
+	}
+
+	for _, query := range []string{"namespace=[", "since=yesterday"} {
+		q, _ := url.ParseQuery(query)
+		if _, err := parseDecisionFilter(q, now); err == nil {
+			t.Errorf("%q: expected an error", query)
+		}
+	}
+}
+
+func TestDecisionBrowser(t *testing.T) {
+	old, oldDecisions := cfg, recentDecisions
+	cfg.Redaction = redactionPolicy{channelAdmin: {fieldPod}}
+	recentDecisions = newDecisionLog(10)
+	defer func() { cfg, recentDecisions = old, oldDecisions }()
+
+	recentDecisions.add(&decision{Time: time.Now(), Namespace: "mtv", Pod: "importer-a", PodType: "cdi", Outcome: outcomeMutated,
+		Networks: []networkChange{{Network: "transfer", RemovedGateways: []string{"10.0.0.1"}}}})
+	recentDecisions.add(&decision{Time: time.Now(), Namespace: "other", Pod: "importer-b", PodType: "cdi", Outcome: outcomeUnchanged})
+
+	w := httptest.NewRecorder()
+	handleDecisions(w, httptest.NewRequest("GET", "/decisions?namespace=mtv", nil))
+	var records []decision
+	json.Unmarshal(w.Body.Bytes(), &records)
+	if len(records) != 1 || records[0].Namespace != "mtv" || !strings.HasPrefix(records[0].Pod, "redacted:") {
+		t.Fatalf("expected the redacted mtv decision, got %s", w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	handleDecisions(w, httptest.NewRequest("GET", "/decisions?pod=importer-a", nil))
+	if strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Fatalf("expected filters not to match redacted values, got %s", w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	handleDecisionBrowser(w, httptest.NewRequest("GET", "/decisions/browse?outcome=mutated", nil))
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, "transfer: 10.0.0.1") || strings.Contains(body, "<td>other</td>") {
+		t.Fatalf("unexpected browser response %d: %s", w.Code, body)
+	}
+	if !strings.Contains(body, "<option selected>mutated</option>") {
+		t.Fatalf("expected the outcome filter to be preserved, got %s", body)
+	}
+
+	w = httptest.NewRecorder()
+	handleDecisionBrowser(w, httptest.NewRequest("GET", "/decisions/browse?since=soon", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected an invalid filter to be rejected, got %d", w.Code)
+	}
+}
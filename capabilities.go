@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/discovery"
+	"k8s.io/klog/v2"
+)
+
+const (
+	capabilityAdmission      = "admissionregistration-v1"
+	capabilityMultus         = "multus"
+	capabilityKubeVirt       = "kubevirt"
+	capabilityCDI            = "cdi"
+	capabilityForklift       = "forklift"
+	capabilityRulesPolicies  = "rules-policies"
+	capabilityTargetPolicies = "target-policies"
+)
+
+// capabilityResources are the API resources whose presence makes up a
+// capability.
+var capabilityResources = map[string]struct{ groupVersion, resource string }{
+	capabilityAdmission:      {"admissionregistration.k8s.io/v1", "mutatingwebhookconfigurations"},
+	capabilityMultus:         {nadGVR.GroupVersion().String(), nadGVR.Resource},
+	capabilityKubeVirt:       {"kubevirt.io/v1", "virtualmachineinstances"},
+	capabilityCDI:            {ownerGVRs["DataVolume"].GroupVersion().String(), ownerGVRs["DataVolume"].Resource},
+	capabilityForklift:       {planGVR.GroupVersion().String(), planGVR.Resource},
+	capabilityRulesPolicies:  {ruleSetGVR.GroupVersion().String(), ruleSetGVR.Resource},
+	capabilityTargetPolicies: {targetPolicyGVR.GroupVersion().String(), targetPolicyGVR.Resource},
+}
+
+var clusterCapability = newGaugeVec(prometheus.GaugeOpts{
+	Name: "gateway_yeeter_cluster_capability",
+	Help: "Whether the API resources of a capability were found at startup (1) or not (0).",
+}, "capability")
+
+// detectCapabilities looks up every capability in the discovery API. Group
+// versions the server does not serve are missing capabilities, any other
+// error makes the detection inconclusive.
+func detectCapabilities(client discovery.DiscoveryInterface) (map[string]bool, error) {
+	served := make(map[string]map[string]bool)
+	available := make(map[string]bool, len(capabilityResources))
+	for name, want := range capabilityResources {
+		resources, cached := served[want.groupVersion]
+		if !cached {
+			list, err := client.ServerResourcesForGroupVersion(want.groupVersion)
+			if err != nil && !apierrors.IsNotFound(err) {
+				return nil, fmt.Errorf("could not discover %s: %w", want.groupVersion, err)
+			}
+			resources = make(map[string]bool)
+			if list != nil {
+				for _, resource := range list.APIResources {
+					resources[resource.Name] = true
+				}
+			}
+			served[want.groupVersion] = resources
+		}
+		available[name] = resources[want.resource]
+	}
+	return available, nil
+}
+
+// adaptToCapabilities turns off the features of c whose API resources are
+// missing, so they do not fail on every request or poll, and returns what
+// was changed. Scoping to Forklift Plans cannot be turned off without
+// mutating pods outside the scope, so it is an error instead.
+func adaptToCapabilities(c config, available map[string]bool) (config, []string, error) {
+	var changes []string
+	if !available[capabilityForklift] && len(c.ScopePlans) > 0 {
+		return c, nil, fmt.Errorf("scope-plans requires the Forklift %s API, which the cluster does not serve", capabilityResources[capabilityForklift].groupVersion)
+	}
+	if !available[capabilityForklift] && c.PlanSummaries {
+		c.PlanSummaries = false
+		changes = append(changes, "plan-summaries disabled, Forklift Plans are not served")
+	}
+	if !available[capabilityMultus] && c.SRIOVPolicy != sriovPolicyIgnore {
+		c.SRIOVPolicy = sriovPolicyIgnore
+		changes = append(changes, "sriov-policy set to ignore, NetworkAttachmentDefinitions are not served")
+	}
+	if !available[capabilityAdmission] && c.CheckWebhookConflicts {
+		c.CheckWebhookConflicts = false
+		changes = append(changes, "check-webhook-conflicts disabled, admissionregistration.k8s.io/v1 is not served")
+	}
+	if !available[capabilityAdmission] && c.RequireWebhookRegistration {
+		c.RequireWebhookRegistration = false
+		changes = append(changes, "require-webhook-registration disabled, admissionregistration.k8s.io/v1 is not served")
+	}
+	if !available[capabilityRulesPolicies] && c.RulesPolicies {
+		c.RulesPolicies = false
+		changes = append(changes, "rules-policies disabled, the GatewayYeetRuleSet CRD is not installed")
+	}
+	if !available[capabilityTargetPolicies] && c.TargetPolicies {
+		c.TargetPolicies = false
+		changes = append(changes, "target-policies disabled, the GatewayYeetPolicy CRD is not installed")
+	}
+	return c, changes, nil
+}
+
+// preflight detects the cluster capabilities and adapts c to them. When
+// the cluster cannot be reached c is returned unchanged and features fail
+// at request time as before.
+func preflight(c config) (config, error) {
+	client, err := kube.typedFor(lookupDiscovery)
+	if err != nil {
+		klog.Warningf("Skipping cluster capability detection: %v", err)
+		return c, nil
+	}
+	available, err := detectCapabilities(client.Discovery())
+	if err != nil {
+		klog.Warningf("Skipping cluster capability detection: %v", err)
+		return c, nil
+	}
+
+	report := make([]string, 0, len(available))
+	for name, found := range available {
+		report = append(report, fmt.Sprintf("%s=%t", name, found))
+		value := 0.0
+		if found {
+			value = 1
+		}
+		clusterCapability.WithLabelValues(name).Set(value)
+	}
+	sort.Strings(report)
+	klog.Infof("Cluster capabilities: %s", strings.Join(report, " "))
+
+	c, changes, err := adaptToCapabilities(c, available)
+	if err != nil {
+		return c, err
+	}
+	for _, change := range changes {
+		klog.Warningf("Adapting to cluster capabilities: %s", change)
+	}
+	return c, nil
+}
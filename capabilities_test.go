@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	coretesting "k8s.io/client-go/testing"
+)
+
+func TestDetectCapabilities(t *testing.T) {
+	client := &fakediscovery.FakeDiscovery{Fake: &coretesting.Fake{Resources: []*metav1.APIResourceList{
+		{GroupVersion: "admissionregistration.k8s.io/v1", APIResources: []metav1.APIResource{{Name: "mutatingwebhookconfigurations"}}},
+		{GroupVersion: "k8s.cni.cncf.io/v1", APIResources: []metav1.APIResource{{Name: "network-attachment-definitions"}}},
+		{GroupVersion: "gateway.yeet/v1beta1", APIResources: []metav1.APIResource{{Name: "gatewayyeetrulesets"}}},
+	}}}
+	available, err := detectCapabilities(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{
+		capabilityAdmission:      true,
+		capabilityMultus:         true,
+		capabilityRulesPolicies:  true,
+		capabilityTargetPolicies: false,
+		capabilityForklift:       false,
+		capabilityKubeVirt:       false,
+	} {
+		if available[name] != want {
+			t.Errorf("expected %s to be %t", name, want)
+		}
+	}
+
+	c := defaultConfig()
+	c.PlanSummaries, c.TargetPolicies, c.RulesPolicies, c.SRIOVPolicy = true, true, true, sriovPolicyDeny
+	adapted, changes, err := adaptToCapabilities(c, available)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adapted.PlanSummaries || adapted.TargetPolicies || !adapted.RulesPolicies || adapted.SRIOVPolicy != sriovPolicyDeny || len(changes) != 2 {
+		t.Fatalf("unexpected adaptation %v", changes)
+	}
+
+	c.ScopePlans = stringList{"mtv/plan"}
+	if _, _, err := adaptToCapabilities(c, available); err == nil {
+		t.Fatal("expected scope-plans without Forklift to be an error")
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// servingCertCheck reports not ready while the serving keypair cannot be
+// loaded from its mount, or the certificate being served by the reloader or
+// the one on disk expires within the window. The API server rejects the TLS handshake with
+// an expired certificate, so an unready replica is taken out of the Service
+// instead of failing every review.
+type servingCertCheck struct {
+	certFile, keyFile string
+	served            *certReloader
+	window            time.Duration
+	now               func() time.Time
+
+	mu    sync.Mutex
+	ready bool
+}
+
+var servingCert *servingCertCheck
+
+func newServingCertCheck(certFile, keyFile string, served *certReloader, window time.Duration) *servingCertCheck {
+	return &servingCertCheck{certFile: certFile, keyFile: keyFile, served: served, window: window, now: time.Now, ready: true}
+}
+
+func (c *servingCertCheck) status() (bool, string) {
+	if c == nil {
+		return true, "serving certificate not checked"
+	}
+	ready, message := c.check()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ready != c.ready {
+		if ready {
+			klog.Infof("Serving certificate is usable again: %s", message)
+		} else {
+			klog.Errorf("Serving certificate is not usable, reporting not ready: %s", message)
+		}
+	}
+	c.ready = ready
+	return ready, message
+}
+
+func (c *servingCertCheck) check() (bool, string) {
+	served, err := x509.ParseCertificate(c.served.current().Certificate[0])
+	if err != nil {
+		return false, fmt.Sprintf("could not parse served certificate: %v", err)
+	}
+	servingCertificateExpiry.Set(float64(served.NotAfter.Unix()))
+	leaf, err := loadLeafCertificate(c.certFile, c.keyFile)
+	if err != nil {
+		return false, fmt.Sprintf("could not load serving keypair %s: %v", c.certFile, err)
+	}
+	notAfter := served.NotAfter
+	if leaf.NotAfter.Before(notAfter) {
+		notAfter = leaf.NotAfter
+	}
+	now := c.now()
+	if !now.Before(notAfter) {
+		return false, "serving certificate expired at " + notAfter.UTC().Format(time.RFC3339)
+	}
+	if notAfter.Sub(now) <= c.window {
+		return false, fmt.Sprintf("serving certificate expires at %s, within --cert-expiry-window %s", notAfter.UTC().Format(time.RFC3339), c.window)
+	}
+	return true, "serving certificate valid until " + notAfter.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/x509"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServingCertCheck(t *testing.T) {
+	certFile, keyFile := writeTestKeyPair(t, t.TempDir(), "webhook", time.Now())
+	leaf, err := loadLeafCertificate(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newServingCertCheck(certFile, keyFile, reloader, 10*time.Minute)
+	if ready, message := c.status(); !ready {
+		t.Fatalf("expected a fresh certificate to be ready, got %s", message)
+	}
+	c.window = 2 * time.Hour
+	if ready, message := c.status(); ready || !strings.Contains(message, "within --cert-expiry-window") {
+		t.Fatalf("expected a certificate expiring within the window not to be ready, got %s", message)
+	}
+	c.window = 0
+	c.now = func() time.Time { return leaf.NotAfter }
+	if ready, message := c.status(); ready || !strings.Contains(message, "expired") {
+		t.Fatalf("expected an expired certificate not to be ready, got %s", message)
+	}
+	c.now = time.Now
+	os.Remove(keyFile)
+	if ready, message := c.status(); ready || !strings.Contains(message, "could not load") {
+		t.Fatalf("expected a missing key not to be ready, got %s", message)
+	}
+}
+
+func TestServingCertCheckFollowsRotation(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestKeyPair(t, dir, "webhook", time.Now().Add(-time.Minute))
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	reloader.now = func() time.Time { return now }
+	c := newServingCertCheck(certFile, keyFile, reloader, 2*time.Hour)
+	if ready, _ := c.status(); ready {
+		t.Fatal("expected a certificate expiring within the window not to be ready")
+	}
+
+	renewed := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	writeTestKeyPairUntil(t, dir, "webhook", time.Now(), renewed)
+	if ready, _ := c.status(); ready {
+		t.Fatal("expected the expiring certificate to be checked while it is still served")
+	}
+	now = now.Add(certReloadCheckInterval)
+	if ready, message := c.status(); !ready || !strings.Contains(message, renewed.UTC().Format(time.RFC3339)) {
+		t.Fatalf("expected the renewed certificate to be ready once served, got %s", message)
+	}
+	served, _ := reloader.getCertificate(nil)
+	if leaf, _ := x509.ParseCertificate(served.Certificate[0]); !leaf.NotAfter.Equal(renewed) {
+		t.Fatalf("expected the renewed certificate to be served, got one valid until %s", leaf.NotAfter)
+	}
+}
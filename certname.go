@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+)
+
+var servingCertificateNameValid = newGauge(prometheus.GaugeOpts{
+	Name: "gateway_yeeter_serving_certificate_name_valid",
+	Help: "Whether the serving certificate is valid for the Service DNS name <service>.<namespace>.svc (1) or not (0), with --check-serving-cert-name.",
+})
+
+// servingCertNameCheck is the result of checking the serving certificate
+// against the name the API server calls the webhook by. The certificate is
+// loaded once, so the result is fixed until the next start.
+type servingCertNameCheck struct {
+	ready   bool
+	message string
+}
+
+var servingCertName *servingCertNameCheck
+
+// serviceDNSName is the name the API server verifies the serving certificate
+// against when the webhook is registered with a Service reference.
+func serviceDNSName() string {
+	return identity.Service + "." + identity.Namespace + ".svc"
+}
+
+func newServingCertNameCheck(leaf *x509.Certificate, name string) *servingCertNameCheck {
+	if err := verifyServingCertName(leaf, name); err != nil {
+		klog.Errorf("Serving certificate is misissued: %v", err)
+		servingCertificateNameValid.Set(0)
+		return &servingCertNameCheck{message: err.Error()}
+	}
+	klog.Infof("Serving certificate is valid for %s", name)
+	servingCertificateNameValid.Set(1)
+	return &servingCertNameCheck{ready: true, message: "serving certificate is valid for " + name}
+}
+
+// verifyServingCertName checks the SANs of leaf. Like the API server, the
+// common name is ignored.
+func verifyServingCertName(leaf *x509.Certificate, name string) error {
+	if err := leaf.VerifyHostname(name); err != nil {
+		return fmt.Errorf("certificate with SANs [%s] is not valid for %s, the API server will reject it", strings.Join(certificateSANs(leaf), ", "), name)
+	}
+	return nil
+}
+
+func certificateSANs(leaf *x509.Certificate) []string {
+	sans := append([]string(nil), leaf.DNSNames...)
+	for _, ip := range leaf.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	return sans
+}
+
+func (c *servingCertNameCheck) status() (bool, string) {
+	if c == nil {
+		return true, "serving certificate name not checked"
+	}
+	return c.ready, c.message
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestVerifyServingCertName(t *testing.T) {
+	cases := []struct {
+		dnsNames []string
+		ips      []net.IP
+		valid    bool
+	}{
+		{[]string{"gateway-yeeter.openshift-mtv.svc"}, nil, true},
+		{[]string{"gateway-yeeter", "gateway-yeeter.openshift-mtv.svc", "gateway-yeeter.openshift-mtv.svc.cluster.local"}, nil, true},
+		{[]string{"*.openshift-mtv.svc"}, nil, true},
+		{[]string{"gateway-yeeter.openshift-mtv.svc.cluster.local"}, nil, false},
+		{[]string{"gateway-yeeter.other.svc"}, []net.IP{net.ParseIP("10.0.0.1")}, false},
+		{nil, nil, false},
+	}
+	for _, c := range cases {
+		leaf := &x509.Certificate{DNSNames: c.dnsNames, IPAddresses: c.ips}
+		err := verifyServingCertName(leaf, "gateway-yeeter.openshift-mtv.svc")
+		if (err == nil) != c.valid {
+			t.Errorf("%v %v: expected valid %v, got %v", c.dnsNames, c.ips, c.valid, err)
+		}
+		if err != nil && len(c.ips) > 0 && !strings.Contains(err.Error(), "10.0.0.1") {
+			t.Errorf("expected the SANs in the error, got %v", err)
+		}
+	}
+}
+
+func TestServingCertNameReadiness(t *testing.T) {
+	old := servingCertName
+	defer func() { servingCertName = old }()
+
+	servingCertName = newServingCertNameCheck(&x509.Certificate{DNSNames: []string{"gateway-yeeter"}}, "gateway-yeeter.openshift-mtv.svc")
+	if testutil.ToFloat64(servingCertificateNameValid) != 0 {
+		t.Fatal("expected the name gauge to be 0")
+	}
+	w := httptest.NewRecorder()
+	handleReadyz(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "not valid for gateway-yeeter.openshift-mtv.svc") {
+		t.Fatalf("expected not ready with the expected name, got %d %q", w.Code, w.Body)
+	}
+
+	servingCertName = newServingCertNameCheck(&x509.Certificate{DNSNames: []string{"gateway-yeeter.openshift-mtv.svc"}}, "gateway-yeeter.openshift-mtv.svc")
+	w = httptest.NewRecorder()
+	handleReadyz(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusOK || testutil.ToFloat64(servingCertificateNameValid) != 1 {
+		t.Fatalf("expected ready, got %d %q", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestKeyPair(t *testing.T, dir, cn string, modTime time.Time) (string, string) {
+	return writeTestKeyPairUntil(t, dir, cn, modTime, time.Now().Add(time.Hour))
+}
+
+func writeTestKeyPairUntil(t *testing.T, dir, cn string, modTime, notAfter time.Time) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(key)
+
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600)
+	os.Chtimes(certFile, modTime, modTime)
+	os.Chtimes(keyFile, modTime, modTime)
+	return certFile, keyFile
+}
+
+func leafCN(t *testing.T, r *certReloader) string {
+	cert, err := x509.ParseCertificate(r.current().Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Subject.CommonName
+}
+
+func TestCertReloaderPicksUpRotation(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestKeyPair(t, dir, "first", time.Now().Add(-time.Minute))
+
+	r, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	r.now = func() time.Time { return now }
+	if cn := leafCN(t, r); cn != "first" {
+		t.Fatalf("expected first certificate, got %s", cn)
+	}
+
+	writeTestKeyPair(t, dir, "second", time.Now())
+	if cn := leafCN(t, r); cn != "first" {
+		t.Fatalf("expected certificate to be cached until the next check, got %s", cn)
+	}
+
+	now = now.Add(certReloadCheckInterval)
+	if cn := leafCN(t, r); cn != "second" {
+		t.Fatalf("expected rotated certificate, got %s", cn)
+	}
+}
+
+func TestCertReloaderKeepsCertificateOnBrokenRotation(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestKeyPair(t, dir, "first", time.Now().Add(-time.Minute))
+
+	r, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	os.WriteFile(certFile, []byte("garbage"), 0o600)
+	now = now.Add(certReloadCheckInterval)
+	if cn := leafCN(t, r); cn != "first" {
+		t.Fatalf("expected previous certificate to be kept, got %s", cn)
+	}
+}
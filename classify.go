@@ -0,0 +1,161 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	ambiguousPodType = "pod_type"
+	ambiguousRule    = "rule"
+)
+
+var ambiguousClassifications = newCounterVec(prometheus.CounterOpts{
+	Name: "gateway_yeeter_ambiguous_classifications_total",
+	Help: "Reviews where more than one pod type or rules with different actions matched, by kind.",
+}, "kind")
+
+var classificationCacheLookups = newCounterVec(prometheus.CounterOpts{
+	Name: "gateway_yeeter_classification_cache_lookups_total",
+	Help: "Pod type classifications answered from the owner cache (hit) or by matching the targets (miss).",
+}, "result")
+
+// classificationCacheSize bounds the cache, expired entries are dropped when
+// it is full.
+const classificationCacheSize = 10000
+
+// podTargets returns the target pods matching a pod with labels in
+// namespace, in order of precedence.
+func podTargets(namespace string, labels map[string]string) []targetPod {
+	var targets []targetPod
+	for _, target := range targetPolicies.current() {
+		if target.matches(namespace, labels) {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// classificationCache remembers the target pods an owner's pods matched.
+// Retried importer pods of one DataVolume or PVC carry the same labels, so
+// they are classified once per owner and consistently across retries.
+// Entries are only valid for the targets they were matched against, a
+// reload of the targets invalidates them.
+type classificationCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[types.UID]classification
+	now     func() time.Time
+}
+
+type classification struct {
+	namespace string
+	source    []targetPod
+	targets   []targetPod
+	expires   time.Time
+}
+
+var classifications *classificationCache
+
+func newClassificationCache(ttl time.Duration) *classificationCache {
+	return &classificationCache{ttl: ttl, entries: make(map[types.UID]classification), now: time.Now}
+}
+
+// classify returns the target pods matching a pod, cached by the UID of its
+// controller. Pods without owner are always matched.
+func (c *classificationCache) classify(namespace string, labels map[string]string, owners []metav1.OwnerReference) []targetPod {
+	owner := controllerUID(owners)
+	if c == nil || owner == "" {
+		return podTargets(namespace, labels)
+	}
+	source := targetPolicies.current()
+	now := c.now()
+
+	c.mu.Lock()
+	entry, exists := c.entries[owner]
+	c.mu.Unlock()
+	if exists && entry.namespace == namespace && now.Before(entry.expires) && sameTargets(entry.source, source) {
+		classificationCacheLookups.WithLabelValues("hit").Inc()
+		return entry.targets
+	}
+
+	classificationCacheLookups.WithLabelValues("miss").Inc()
+	targets := podTargets(namespace, labels)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= classificationCacheSize {
+		for uid, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, uid)
+			}
+		}
+		if len(c.entries) >= classificationCacheSize {
+			return targets
+		}
+	}
+	c.entries[owner] = classification{namespace: namespace, source: source, targets: targets, expires: now.Add(c.ttl)}
+	return targets
+}
+
+func (c *classificationCache) size() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// controllerUID returns the UID of the controller of a pod, or of its first
+// owner without controller.
+func controllerUID(owners []metav1.OwnerReference) types.UID {
+	for _, ref := range owners {
+		if ref.Controller != nil && *ref.Controller {
+			return ref.UID
+		}
+	}
+	if len(owners) > 0 {
+		return owners[0].UID
+	}
+	return ""
+}
+
+// sameTargets reports whether a and b are the same target list, not merely
+// equal ones. Reloads always replace the list.
+func sameTargets(a, b []targetPod) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// ambiguousRuleNames returns the names of matches if they disagree on the
+// action, or nil if the first match is unambiguous. Trailing rules without
+// any condition are fallbacks by design and never make a match ambiguous.
+func ambiguousRuleNames(matches []*rule) []string {
+	ambiguous := false
+	var names []string
+	for _, r := range matches {
+		if len(names) > 0 && r.unconditional() {
+			continue
+		}
+		names = append(names, r.Name)
+		if r.Action != matches[0].Action {
+			ambiguous = true
+		}
+	}
+	if !ambiguous {
+		return nil
+	}
+	return names
+}
+
+func recordAmbiguity(d *decision) {
+	if len(d.MatchedPodTypes) > 0 {
+		ambiguousClassifications.WithLabelValues(ambiguousPodType).Inc()
+	}
+	if len(d.MatchedRules) > 0 {
+		ambiguousClassifications.WithLabelValues(ambiguousRule).Inc()
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestPodTargets(t *testing.T) {
+	for _, tt := range []struct {
+		labels map[string]string
+		want   []string
+	}{
+		{map[string]string{"forklift.app": "virt-v2v"}, []string{"virt-v2v"}},
+		{map[string]string{"app": "containerized-data-importer"}, []string{"cdi"}},
+		{map[string]string{"app": "containerized-data-importer", "forklift.app": "virt-v2v"}, []string{"virt-v2v", "cdi"}},
+		{map[string]string{"app": "web"}, nil},
+	} {
+		var got []string
+		for _, target := range podTargets("mtv", tt.labels) {
+			got = append(got, target.name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("labels %v: expected %v, got %v", tt.labels, tt.want, got)
+		}
+	}
+}
+
+func TestClassificationCache(t *testing.T) {
+	oldConfig := targetConfig
+	defer func() { targetConfig = oldConfig }()
+	c := newClassificationCache(time.Minute)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	isController := true
+	owners := []metav1.OwnerReference{
+		{Kind: "Plan", UID: "plan-uid"},
+		{Kind: "PersistentVolumeClaim", UID: "pvc-uid", Controller: &isController},
+	}
+	cdi := map[string]string{"app": "containerized-data-importer"}
+
+	hits := testutil.ToFloat64(classificationCacheLookups.WithLabelValues("hit"))
+	if targets := c.classify("mtv", cdi, owners); len(targets) != 1 || targets[0].name != "cdi" {
+		t.Fatalf("unexpected classification %v", targets)
+	}
+	if _, exists := c.entries["pvc-uid"]; !exists {
+		t.Fatalf("expected the controller to be the cache key, got %v", c.entries)
+	}
+	// A retried pod of the same owner is classified from the cache.
+	if targets := c.classify("mtv", map[string]string{}, owners); len(targets) != 1 || targets[0].name != "cdi" {
+		t.Fatalf("expected the cached classification, got %v", targets)
+	}
+	if got := testutil.ToFloat64(classificationCacheLookups.WithLabelValues("hit")); got != hits+1 {
+		t.Fatalf("expected a cache hit")
+	}
+
+	if targets := c.classify("other", map[string]string{}, owners); len(targets) != 0 {
+		t.Fatalf("expected other namespaces to be matched, got %v", targets)
+	}
+	if targets := c.classify("mtv", map[string]string{}, nil); len(targets) != 0 {
+		t.Fatalf("expected pods without owner to be matched, got %v", targets)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if targets := c.classify("mtv", map[string]string{}, owners); len(targets) != 0 {
+		t.Fatalf("expected expired entries to be matched again, got %v", targets)
+	}
+
+	c.classify("mtv", cdi, owners)
+	targetConfig = &targetConfigWatcher{targets: []targetPod{{name: "converter", labels: map[string]string{"app": "converter"}}}}
+	if targets := c.classify("mtv", map[string]string{}, owners); len(targets) != 0 {
+		t.Fatalf("expected reloaded targets to invalidate the cache, got %v", targets)
+	}
+
+	targetConfig = oldConfig
+	var disabled *classificationCache
+	if targets := disabled.classify("mtv", cdi, owners); len(targets) != 1 {
+		t.Fatalf("expected a disabled cache to match, got %v", targets)
+	}
+}
+
+func TestAmbiguousRuleNames(t *testing.T) {
+	deny := &rule{Name: "platform", Namespaces: []string{"team-*"}, Action: actionDeny}
+	strip := &rule{Name: "cdi", PodTypes: []string{"cdi"}, Action: actionStrip}
+	denyToo := &rule{Name: "audit", PodTypes: []string{"cdi"}, Action: actionDeny}
+	fallback := &rule{Name: "everything-else", Action: actionStrip}
+
+	for _, tt := range []struct {
+		matches []*rule
+		want    []string
+	}{
+		{[]*rule{deny}, nil},
+		{[]*rule{deny, denyToo}, nil},
+		{[]*rule{deny, fallback}, nil},
+		{[]*rule{deny, strip, fallback}, []string{"platform", "cdi"}},
+		{[]*rule{fallback, deny}, []string{"everything-else", "platform"}},
+	} {
+		if got := ambiguousRuleNames(tt.matches); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("expected %v, got %v", tt.want, got)
+		}
+	}
+}
+
+func TestReviewPodAmbiguousClassification(t *testing.T) {
+	defer ambiguousClassifications.Reset()
+	rawPod, _ := json.Marshal(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "both",
+			Namespace:   "team-a",
+			Labels:      map[string]string{"app": "containerized-data-importer", "forklift.app": "virt-v2v"},
+			Annotations: map[string]string{"k8s.v1.cni.cncf.io/networks": `[{"name":"transfer","default-route":["10.0.0.1"]}]`},
+		},
+	})
+	ar := &admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{UID: "test", Namespace: "team-a", Object: runtime.RawExtension{Raw: rawPod}},
+	}
+	rules := ruleSet{
+		{Name: "platform", Namespaces: []string{"team-*"}, Action: actionDeny},
+		{Name: "v2v", PodTypes: []string{"virt-v2v"}, Action: actionStrip},
+	}
+	d := newDecision(ar)
+	evaluatePod(ar, d, rules)
+	if d.PodType != "virt-v2v" || !reflect.DeepEqual(d.MatchedPodTypes, []string{"virt-v2v", "cdi"}) {
+		t.Fatalf("expected virt-v2v to win with both pod types recorded, got %+v", d)
+	}
+	if d.Outcome != outcomeDenied || !reflect.DeepEqual(d.MatchedRules, []string{"platform", "v2v"}) {
+		t.Fatalf("expected the first rule to apply with all matches recorded, got %+v", d)
+	}
+
+	d.Time = time.Now()
+	recordDecision(d)
+	for _, kind := range []string{ambiguousPodType, ambiguousRule} {
+		if got := testutil.ToFloat64(ambiguousClassifications.WithLabelValues(kind)); got != 1 {
+			t.Errorf("expected one ambiguous %s classification, got %v", kind, got)
+		}
+	}
+}
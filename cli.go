@@ -0,0 +1,591 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+
+	"gateway-yeeter/pkg/podtemplate"
+)
+
+// Exit codes shared by all subcommands: findings are conditions the caller
+// asked about (invalid configuration, pods that would be changed, failed
+// checks), usage covers bad flags and unreadable input.
+const (
+	exitOK       = 0
+	exitFindings = 1
+	exitUsage    = 2
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+
+	certExpiryWarning = 30 * 24 * time.Hour
+	doctorTimeout     = 10 * time.Second
+)
+
+func outputFlag(fs *flag.FlagSet) *string {
+	return fs.String("output", outputText, "Output format: text or json")
+}
+
+func validOutput(output string) bool {
+	if output != outputText && output != outputJSON {
+		fmt.Fprintf(os.Stderr, "unsupported output %q, expected text or json\n", output)
+		return false
+	}
+	return true
+}
+
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+type validateConfigResult struct {
+	Valid  bool    `json:"valid"`
+	Error  string  `json:"error,omitempty"`
+	Hash   string  `json:"hash"`
+	Config *config `json:"config"`
+}
+
+func runValidateConfig(args []string) int {
+	fs := flag.NewFlagSet("validate-config", flag.ContinueOnError)
+	output := outputFlag(fs)
+	conf := defaultConfig()
+	conf.bindFlags(fs)
+	if err := fs.Parse(args); err != nil || !validOutput(*output) {
+		return exitUsage
+	}
+
+	result := validateConfigResult{Valid: true, Hash: conf.hash(), Config: &conf}
+	if err := conf.validate(); err != nil {
+		result.Valid, result.Error = false, err.Error()
+	}
+
+	if *output == outputJSON {
+		printJSON(result)
+	} else if result.Valid {
+		fmt.Printf("configuration valid (%s)\n", result.Hash)
+	} else {
+		fmt.Printf("configuration invalid: %s\n", result.Error)
+	}
+	if !result.Valid {
+		return exitFindings
+	}
+	return exitOK
+}
+
+type reviewResult struct {
+	Source   string    `json:"source"`
+	Object   string    `json:"object,omitempty"`
+	Allowed  bool      `json:"allowed"`
+	Warnings []string  `json:"warnings,omitempty"`
+	Decision *decision `json:"decision"`
+}
+
+func offlineReview(source string, ar *admissionv1.AdmissionReview) reviewResult {
+	d := newDecision(ar)
+	resp := evaluatePod(ar, d, cfg.Rules)
+	return reviewResult{Source: source, Allowed: resp.Allowed, Warnings: resp.Warnings, Decision: d}
+}
+
+// checkObject is one reviewable object of a check input.
+type checkObject struct {
+	object string
+	ar     *admissionv1.AdmissionReview
+}
+
+// checkObjectsFor accepts AdmissionReviews, Pods, the objects podtemplate
+// extracts pods from and Lists of them, in JSON or (multi-document) YAML, and returns the
+// AdmissionReview the webhook would receive for every pod. Other kinds, like
+// the Services and ConfigMaps of a rendered Helm chart, are skipped.
+func checkObjectsFor(raw []byte) ([]checkObject, error) {
+	var objects []checkObject
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(raw)))
+	for i := 1; ; i++ {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		data, err := yaml.YAMLToJSON(doc)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || string(trimmed) == "null" {
+			continue
+		}
+		found, err := checkObjectsOf(data)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		objects = append(objects, found...)
+	}
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("expected a Pod, AdmissionReview, List or workload controller, found none")
+	}
+	return objects, nil
+}
+
+func checkObjectsOf(data []byte) ([]checkObject, error) {
+	var meta struct {
+		metav1.TypeMeta
+		Metadata metav1.ObjectMeta `json:"metadata"`
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+	namespace := meta.Metadata.Namespace
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	object := meta.Kind + " " + namespace + "/" + meta.Metadata.Name
+
+	switch {
+	case meta.Kind == "AdmissionReview":
+		var ar admissionv1.AdmissionReview
+		if err := json.Unmarshal(data, &ar); err != nil {
+			return nil, err
+		}
+		if err := validateAdmissionReview(&ar); err != nil {
+			return nil, err
+		}
+		return []checkObject{{object: meta.Kind + " " + string(ar.Request.UID), ar: &ar}}, nil
+	case strings.HasSuffix(meta.Kind, "List"):
+		var list struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, err
+		}
+		var objects []checkObject
+		for i, item := range list.Items {
+			found, err := checkObjectsOf(item)
+			if err != nil {
+				return nil, fmt.Errorf("item %d: %w", i+1, err)
+			}
+			objects = append(objects, found...)
+		}
+		return objects, nil
+	case podtemplate.Supported(meta.Kind):
+		template, err := podtemplate.Extract(meta.Kind, data)
+		if err != nil {
+			return nil, err
+		}
+		return []checkObject{{object: object, ar: podReview(template.Pod, namespace)}}, nil
+	}
+	return nil, nil
+}
+
+// podReview returns the CREATE AdmissionReview of pod in namespace.
+func podReview(pod corev1.Pod, namespace string) *admissionv1.AdmissionReview {
+	pod.APIVersion, pod.Kind, pod.Namespace = "v1", "Pod", namespace
+	raw, _ := json.Marshal(pod)
+	return &admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{
+		UID:       "offline-check",
+		Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		Namespace: namespace,
+		Operation: admissionv1.Create,
+		Object:    runtime.RawExtension{Raw: raw},
+	}}
+}
+
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+func printReviewResults(results []reviewResult) {
+	for _, result := range results {
+		d := result.Decision
+		source := result.Source
+		if result.Object != "" {
+			source += " " + result.Object
+		}
+		fmt.Printf("%s: %s pod %s/%s: %s", source, d.PodType, d.Namespace, d.Pod, d.Outcome)
+		if d.Message != "" {
+			fmt.Printf(" (%s)", d.Message)
+		}
+		fmt.Println()
+		for _, network := range d.Networks {
+			fmt.Printf("  network %s: removing %s\n", network.Network, strings.Join(network.RemovedGateways, ", "))
+		}
+		for _, warning := range result.Warnings {
+			fmt.Printf("  warning: %s\n", warning)
+		}
+	}
+}
+
+func changesPod(d *decision) bool {
+	return d.Outcome == outcomeMutated || d.Outcome == outcomeDenied
+}
+
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	output := outputFlag(fs)
+	conf := defaultConfig()
+	conf.bindFlags(fs)
+	if err := fs.Parse(args); err != nil || !validOutput(*output) {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: gateway-yeeter check [flags] <manifests-or-admission-reviews>... (\"-\" for stdin)")
+		return exitUsage
+	}
+	if err := conf.validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	cfg = conf
+	watcher, err := newTargetConfigWatcher(conf.ConfigFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	targetConfig = watcher
+
+	var results []reviewResult
+	for _, path := range fs.Args() {
+		raw, err := readInput(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+		objects, err := checkObjectsFor(raw)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			return exitUsage
+		}
+		for i, object := range objects {
+			source := path
+			if len(objects) > 1 {
+				source = fmt.Sprintf("%s#%d", path, i+1)
+			}
+			result := offlineReview(source, object.ar)
+			result.Object = object.object
+			results = append(results, result)
+		}
+	}
+
+	if *output == outputJSON {
+		printJSON(results)
+	} else {
+		printReviewResults(results)
+	}
+	for _, result := range results {
+		if changesPod(result.Decision) {
+			return exitFindings
+		}
+	}
+	return exitOK
+}
+
+type replaySummary struct {
+	Total    int            `json:"total"`
+	Outcomes map[string]int `json:"outcomes"`
+}
+
+type replayResult struct {
+	Results []reviewResult `json:"results"`
+	Summary replaySummary  `json:"summary"`
+}
+
+// decisionChange is a review whose decision differs between the compared
+// configurations.
+type decisionChange struct {
+	Source    string    `json:"source"`
+	Namespace string    `json:"namespace"`
+	Pod       string    `json:"pod"`
+	Old       *decision `json:"old"`
+	New       *decision `json:"new"`
+}
+
+type compareSummary struct {
+	Total       int            `json:"total"`
+	Changed     int            `json:"changed"`
+	Transitions map[string]int `json:"transitions"`
+}
+
+type compareResult struct {
+	Old     string           `json:"old"`
+	New     string           `json:"new"`
+	OldHash string           `json:"oldHash"`
+	NewHash string           `json:"newHash"`
+	Changes []decisionChange `json:"changes"`
+	Summary compareSummary   `json:"summary"`
+}
+
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	output := outputFlag(fs)
+	var compare stringList
+	fs.Var(&compare, "compare-config", "Comma-separated old and new configuration files to replay the reviews through and diff")
+	conf := defaultConfig()
+	conf.bindFlags(fs)
+	if err := fs.Parse(args); err != nil || !validOutput(*output) {
+		return exitUsage
+	}
+	if fs.NArg() != 1 || (len(compare) != 0 && len(compare) != 2) {
+		fmt.Fprintln(os.Stderr, "usage: gateway-yeeter replay [flags] [--compare-config=<old>,<new>] <admission-reviews.jsonl> (\"-\" for stdin)")
+		return exitUsage
+	}
+	if err := conf.validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	cfg = conf
+	watcher, err := newTargetConfigWatcher(conf.ConfigFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	targetConfig = watcher
+
+	raw, err := readInput(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	var reviews []*admissionv1.AdmissionReview
+	dec := json.NewDecoder(strings.NewReader(string(raw)))
+	for i := 1; ; i++ {
+		var ar admissionv1.AdmissionReview
+		if err := dec.Decode(&ar); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "review %d: %v\n", i, err)
+			return exitUsage
+		}
+		if err := validateAdmissionReview(&ar); err != nil {
+			fmt.Fprintf(os.Stderr, "review %d: %v\n", i, err)
+			return exitUsage
+		}
+		reviews = append(reviews, &ar)
+	}
+
+	if len(compare) == 2 {
+		return replayCompare(fs.Arg(0), reviews, conf, compare[0], compare[1], *output)
+	}
+
+	result := replayResult{Summary: replaySummary{Outcomes: make(map[string]int)}}
+	for i, ar := range reviews {
+		review := offlineReview(fmt.Sprintf("%s#%d", fs.Arg(0), i+1), ar)
+		result.Results = append(result.Results, review)
+		result.Summary.Total++
+		result.Summary.Outcomes[review.Decision.Outcome]++
+	}
+
+	if *output == outputJSON {
+		printJSON(result)
+		return exitOK
+	}
+	printReviewResults(result.Results)
+	fmt.Printf("replayed %d review(s): %s\n", result.Summary.Total, formatCounts(result.Summary.Outcomes))
+	return exitOK
+}
+
+// replayCompare evaluates every review with the configuration files oldFile
+// and newFile, both on top of the command line flags, and reports the
+// reviews whose outcome, reason, rule or patch differ.
+func replayCompare(input string, reviews []*admissionv1.AdmissionReview, base config, oldFile, newFile, output string) int {
+	oldConf, err := loadConfigFile(base, oldFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	newConf, err := loadConfigFile(base, newFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	result := compareResult{Old: oldFile, New: newFile, OldHash: oldConf.hash(), NewHash: newConf.hash(), Changes: []decisionChange{}}
+	result.Summary.Transitions = make(map[string]int)
+	for i, ar := range reviews {
+		cfg = oldConf
+		old := newDecision(ar)
+		evaluatePod(ar, old, cfg.Rules)
+		cfg = newConf
+		next := newDecision(ar)
+		// Time windows of rules must be evaluated at the same instant.
+		next.Time = old.Time
+		evaluatePod(ar, next, cfg.Rules)
+
+		result.Summary.Total++
+		if old.Outcome == next.Outcome && old.Reason == next.Reason && old.Rule == next.Rule && old.Patch == next.Patch {
+			continue
+		}
+		result.Summary.Changed++
+		result.Summary.Transitions[old.Outcome+"->"+next.Outcome]++
+		result.Changes = append(result.Changes, decisionChange{Source: fmt.Sprintf("%s#%d", input, i+1), Namespace: next.Namespace, Pod: next.Pod, Old: old, New: next})
+	}
+	cfg = base
+
+	if output == outputJSON {
+		printJSON(result)
+	} else {
+		for _, change := range result.Changes {
+			fmt.Printf("%s: %s pod %s/%s: %s -> %s\n", change.Source, change.New.PodType, change.Namespace, change.Pod, describeDecision(change.Old), describeDecision(change.New))
+			if change.Old.Outcome == change.New.Outcome && change.Old.Patch != change.New.Patch {
+				fmt.Printf("  old patch: %s\n  new patch: %s\n", change.Old.Patch, change.New.Patch)
+			}
+		}
+		fmt.Printf("compared %d review(s), %d changed: %s\n", result.Summary.Total, result.Summary.Changed, formatCounts(result.Summary.Transitions))
+	}
+	if result.Summary.Changed > 0 {
+		return exitFindings
+	}
+	return exitOK
+}
+
+func describeDecision(d *decision) string {
+	s := d.Outcome + " (" + d.Reason
+	if d.Rule != "" {
+		s += ", rule " + d.Rule
+	}
+	return s + ")"
+}
+
+func formatCounts(counts map[string]int) string {
+	formatted := make([]string, 0, len(counts))
+	for key, n := range counts {
+		formatted = append(formatted, fmt.Sprintf("%s=%d", key, n))
+	}
+	sort.Strings(formatted)
+	return strings.Join(formatted, " ")
+}
+
+const (
+	checkOK      = "ok"
+	checkWarning = "warning"
+	checkError   = "error"
+)
+
+type doctorCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+type doctorResult struct {
+	OK     bool          `json:"ok"`
+	Checks []doctorCheck `json:"checks"`
+}
+
+func runDoctor(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	output := outputFlag(fs)
+	certFile := fs.String("cert", servingCertFile, "Serving certificate to check")
+	keyFile := fs.String("key", servingKeyFile, "Serving key to check")
+	webhookName := fs.String("webhook-configuration", "gateway-yeeter", "Name of the MutatingWebhookConfiguration to check (empty skips the cluster checks)")
+	conf := defaultConfig()
+	conf.bindFlags(fs)
+	if err := fs.Parse(args); err != nil || !validOutput(*output) {
+		return exitUsage
+	}
+
+	result := doctorResult{OK: true}
+	add := func(name, status, format string, args ...interface{}) {
+		result.Checks = append(result.Checks, doctorCheck{Name: name, Status: status, Message: fmt.Sprintf(format, args...)})
+		if status == checkError {
+			result.OK = false
+		}
+	}
+
+	if err := conf.validate(); err != nil {
+		add("config", checkError, "%v", err)
+	} else {
+		add("config", checkOK, "configuration valid (%s)", conf.hash())
+	}
+
+	leaf, err := loadLeafCertificate(*certFile, *keyFile)
+	if err != nil {
+		add("serving-certificate", checkError, "%v", err)
+	} else if remaining := time.Until(leaf.NotAfter); remaining <= 0 {
+		add("serving-certificate", checkError, "expired at %s", leaf.NotAfter.UTC().Format(time.RFC3339))
+	} else if remaining < certExpiryWarning {
+		add("serving-certificate", checkWarning, "expires at %s", leaf.NotAfter.UTC().Format(time.RFC3339))
+	} else {
+		add("serving-certificate", checkOK, "valid until %s", leaf.NotAfter.UTC().Format(time.RFC3339))
+	}
+	if leaf != nil && conf.CheckServingCertName {
+		if err := verifyServingCertName(leaf, serviceDNSName()); err != nil {
+			add("serving-certificate-name", checkError, "%v", err)
+		} else {
+			add("serving-certificate-name", checkOK, "valid for %s", serviceDNSName())
+		}
+	}
+
+	if *webhookName != "" {
+		kube.configure(conf.Kubeconfig, nil)
+		doctorCluster(*webhookName, add)
+	}
+
+	if *output == outputJSON {
+		printJSON(result)
+	} else {
+		for _, check := range result.Checks {
+			fmt.Printf("[%s] %s: %s\n", check.Status, check.Name, check.Message)
+		}
+	}
+	if !result.OK {
+		return exitFindings
+	}
+	return exitOK
+}
+
+func doctorCluster(webhookName string, add func(name, status, format string, args ...interface{})) {
+	client, err := kube.typedFor(lookupWebhook)
+	if err != nil {
+		add("cluster", checkError, "%v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+
+	configuration, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, webhookName, metav1.GetOptions{})
+	if err != nil {
+		add("webhook-registration", checkError, "%v", err)
+		return
+	}
+	if len(configuration.Webhooks) == 0 {
+		add("webhook-registration", checkError, "%s has no webhooks", webhookName)
+		return
+	}
+	for _, webhook := range configuration.Webhooks {
+		name := "webhook/" + webhook.Name
+		switch {
+		case webhook.ClientConfig.Service == nil && webhook.ClientConfig.URL == nil:
+			add(name, checkError, "no client configuration")
+		case webhook.ClientConfig.Service != nil && (webhook.ClientConfig.Service.Path == nil || *webhook.ClientConfig.Service.Path != "/mutate"):
+			add(name, checkError, "service path is not /mutate")
+		case len(webhook.ClientConfig.CABundle) == 0:
+			add(name, checkWarning, "no caBundle, the API server cannot verify the serving certificate unless it is injected")
+		case webhook.ObjectSelector == nil || len(webhook.ObjectSelector.MatchLabels)+len(webhook.ObjectSelector.MatchExpressions) == 0:
+			add(name, checkWarning, "no objectSelector, every pod is sent to the webhook")
+		default:
+			add(name, checkOK, "registered")
+		}
+	}
+}
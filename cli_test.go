@@ -0,0 +1,345 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const checkPodYAML = `apiVersion: v1
+kind: Pod
+metadata:
+  name: importer
+  labels:
+    app: containerized-data-importer
+  annotations:
+    k8s.v1.cni.cncf.io/networks: '[{"name":"transfer","default-route":["10.0.0.1"]}]'
+`
+
+func captureStdout(t *testing.T, run func() int) (int, []byte) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := os.Stdout
+	os.Stdout = w
+	oldCfg := cfg
+	defer func() { os.Stdout, cfg = old, oldCfg }()
+
+	code := run()
+	w.Close()
+	out, _ := io.ReadAll(r)
+	return code, out
+}
+
+func writeTestFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunValidateConfig(t *testing.T) {
+	code, out := captureStdout(t, func() int { return runValidateConfig([]string{"--output=json"}) })
+	var result validateConfigResult
+	if err := json.Unmarshal(out, &result); err != nil || code != exitOK || !result.Valid || result.Hash == "" {
+		t.Fatalf("expected a valid configuration, got %d %s", code, out)
+	}
+
+	code, out = captureStdout(t, func() int { return runValidateConfig([]string{"--output=json", "--sriov-policy=bogus"}) })
+	if err := json.Unmarshal(out, &result); err != nil || code != exitFindings || result.Valid || result.Error == "" {
+		t.Fatalf("expected an invalid configuration, got %d %s", code, out)
+	}
+
+	if code, _ := captureStdout(t, func() int { return runValidateConfig([]string{"--output=xml"}) }); code != exitUsage {
+		t.Fatalf("expected a usage error, got %d", code)
+	}
+}
+
+func checkReview(t *testing.T, manifest string) *admissionv1.AdmissionReview {
+	objects, err := checkObjectsFor([]byte(manifest))
+	if err != nil || len(objects) != 1 {
+		t.Fatalf("expected one object, got %+v (%v)", objects, err)
+	}
+	return objects[0].ar
+}
+
+func TestCheckObjectsFor(t *testing.T) {
+	ar := checkReview(t, checkPodYAML)
+	if ar.Request.Namespace != "default" || ar.Request.Operation != admissionv1.Create || ar.Request.Kind.Kind != "Pod" {
+		t.Fatalf("unexpected request %+v", ar.Request)
+	}
+
+	review, _ := json.Marshal(ar)
+	review = append([]byte(`{"kind":"AdmissionReview",`), review[1:]...)
+	if _, err := checkObjectsFor(review); err != nil {
+		t.Fatalf("expected an AdmissionReview to be accepted: %v", err)
+	}
+
+	if _, err := checkObjectsFor([]byte("kind: ConfigMap")); err == nil {
+		t.Fatal("expected input without pods to be rejected")
+	}
+	if _, err := checkObjectsFor([]byte("kind: Deployment\nmetadata:\n  name: importer\n")); err == nil {
+		t.Fatal("expected a workload without pod template to be rejected")
+	}
+}
+
+const checkStackYAML = `# rendered by helm
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: importer
+  namespace: mtv-prod
+spec:
+  template:
+    metadata:
+      labels:
+        app: containerized-data-importer
+      annotations:
+        k8s.v1.cni.cncf.io/networks: '[{"name":"transfer","default-route":["10.0.0.1"]}]'
+---
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: v2v
+  namespace: mtv-prod
+spec:
+  jobTemplate:
+    spec:
+      template:
+        metadata:
+          labels:
+            forklift.app: virt-v2v
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Pod
+  metadata:
+    name: importer-a
+    namespace: mtv-test
+    labels:
+      app: containerized-data-importer
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: ignored
+- apiVersion: apps/v1
+  kind: StatefulSetList
+  items:
+  - apiVersion: apps/v1
+    kind: StatefulSet
+    metadata:
+      name: importer-b
+    spec:
+      template:
+        metadata:
+          labels:
+            app: containerized-data-importer
+`
+
+func TestCheckObjectsForStack(t *testing.T) {
+	objects, err := checkObjectsFor([]byte(checkStackYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"Deployment mtv-prod/importer", "CronJob mtv-prod/v2v", "Pod mtv-test/importer-a", "StatefulSet default/importer-b"}
+	if len(objects) != len(expected) {
+		t.Fatalf("expected %d objects, got %+v", len(expected), objects)
+	}
+	for i, object := range objects {
+		if object.object != expected[i] {
+			t.Errorf("object %d: expected %s, got %s", i, expected[i], object.object)
+		}
+	}
+
+	var pod corev1.Pod
+	json.Unmarshal(objects[0].ar.Request.Object.Raw, &pod)
+	if pod.Namespace != "mtv-prod" || pod.GenerateName != "importer-" || pod.Labels["app"] != "containerized-data-importer" || pod.Annotations["k8s.v1.cni.cncf.io/networks"] == "" {
+		t.Fatalf("unexpected pod from the Deployment template %+v", pod.ObjectMeta)
+	}
+}
+
+func TestRunCheckStack(t *testing.T) {
+	path := writeTestFile(t, "stack.yaml", checkStackYAML)
+	code, out := captureStdout(t, func() int { return runCheck([]string{"--output=json", path}) })
+	var results []reviewResult
+	if err := json.Unmarshal(out, &results); err != nil {
+		t.Fatalf("invalid output %s: %v", out, err)
+	}
+	if code != exitFindings || len(results) != 4 {
+		t.Fatalf("expected four results with findings, got %d %s", code, out)
+	}
+	if results[0].Source != path+"#1" || results[0].Object != "Deployment mtv-prod/importer" || results[0].Decision.Outcome != outcomeMutated || results[0].Decision.Pod != "importer-<generated>" {
+		t.Fatalf("unexpected result for the Deployment %+v", results[0])
+	}
+	if results[1].Decision.PodType != "virt-v2v" || results[1].Decision.Outcome != outcomeUnchanged {
+		t.Fatalf("unexpected result for the CronJob %+v", results[1].Decision)
+	}
+}
+
+func TestRunCheck(t *testing.T) {
+	path := writeTestFile(t, "pod.yaml", checkPodYAML)
+	code, out := captureStdout(t, func() int { return runCheck([]string{"--output=json", path}) })
+	var results []reviewResult
+	if err := json.Unmarshal(out, &results); err != nil {
+		t.Fatalf("invalid output %s: %v", out, err)
+	}
+	if code != exitFindings || len(results) != 1 || results[0].Decision.Outcome != outcomeMutated || !results[0].Allowed {
+		t.Fatalf("expected the pod to be mutated, got %d %s", code, out)
+	}
+
+	clean := writeTestFile(t, "clean.yaml", "apiVersion: v1\nkind: Pod\nmetadata:\n  name: importer\n  labels:\n    app: containerized-data-importer\n")
+	if code, _ := captureStdout(t, func() int { return runCheck([]string{clean}) }); code != exitOK {
+		t.Fatalf("expected exit %d for an unchanged pod, got %d", exitOK, code)
+	}
+
+	if code, _ := captureStdout(t, func() int { return runCheck([]string{filepath.Join(t.TempDir(), "missing")}) }); code != exitUsage {
+		t.Fatalf("expected a usage error for a missing file, got %d", code)
+	}
+}
+
+func TestRunReplay(t *testing.T) {
+	review, _ := json.Marshal(checkReview(t, checkPodYAML))
+	path := writeTestFile(t, "reviews.jsonl", string(review)+"\n"+string(review)+"\n")
+
+	code, out := captureStdout(t, func() int { return runReplay([]string{"--output=json", path}) })
+	var result replayResult
+	if err := json.Unmarshal(out, &result); err != nil {
+		t.Fatalf("invalid output %s: %v", out, err)
+	}
+	if code != exitOK || result.Summary.Total != 2 || result.Summary.Outcomes[outcomeMutated] != 2 {
+		t.Fatalf("unexpected replay result %d %s", code, out)
+	}
+
+	broken := writeTestFile(t, "broken.jsonl", "{")
+	if code, _ := captureStdout(t, func() int { return runReplay([]string{broken}) }); code != exitUsage {
+		t.Fatalf("expected a usage error for malformed input, got %d", code)
+	}
+}
+
+func TestRunReplayCompareConfig(t *testing.T) {
+	platform := checkReview(t, strings.Replace(checkPodYAML, "name: importer", "name: importer\n  namespace: platform", 1))
+	other := checkReview(t, checkPodYAML)
+	var reviews []string
+	for _, ar := range []*admissionv1.AdmissionReview{platform, other} {
+		review, _ := json.Marshal(ar)
+		reviews = append(reviews, string(review))
+	}
+	path := writeTestFile(t, "reviews.jsonl", strings.Join(reviews, "\n"))
+	oldConfig := writeTestFile(t, "old.yaml", "excludeNamespaces: [kube-system]\n")
+	rules := writeTestFile(t, "rules.yaml", "rules:\n- name: platform\n  namespaces: [platform]\n  action: deny\n")
+	newConfig := writeTestFile(t, "new.yaml", "rulesFile: "+rules+"\n")
+
+	code, out := captureStdout(t, func() int {
+		return runReplay([]string{"--output=json", "--compare-config=" + oldConfig + "," + newConfig, path})
+	})
+	var result compareResult
+	if err := json.Unmarshal(out, &result); err != nil {
+		t.Fatalf("invalid output %s: %v", out, err)
+	}
+	if code != exitFindings || result.Summary.Total != 2 || result.Summary.Changed != 1 || result.Summary.Transitions["mutated->denied"] != 1 {
+		t.Fatalf("expected one pod to change from mutated to denied, got %d %s", code, out)
+	}
+	change := result.Changes[0]
+	if change.Source != path+"#1" || change.Namespace != "platform" || change.Old.Reason != reasonMutated || change.New.Reason != reasonDenyRule || change.New.Rule != "platform" {
+		t.Fatalf("unexpected change %+v", change)
+	}
+
+	if code, _ := captureStdout(t, func() int {
+		return runReplay([]string{"--compare-config=" + oldConfig + "," + oldConfig, path})
+	}); code != exitOK {
+		t.Fatalf("expected no changes between identical configurations, got %d", code)
+	}
+
+	broken := writeTestFile(t, "broken.yaml", "sriovPolicy: bogus\n")
+	if code, _ := captureStdout(t, func() int {
+		return runReplay([]string{"--compare-config=" + oldConfig + "," + broken, path})
+	}); code != exitUsage {
+		t.Fatalf("expected a usage error for an invalid configuration, got %d", code)
+	}
+	unknown := writeTestFile(t, "unknown.yaml", "noSuchSetting: true\n")
+	if code, _ := captureStdout(t, func() int {
+		return runReplay([]string{"--compare-config=" + unknown + "," + oldConfig, path})
+	}); code != exitUsage {
+		t.Fatalf("expected a usage error for unknown settings, got %d", code)
+	}
+}
+
+func TestRunDoctor(t *testing.T) {
+	certFile, keyFile := writeTestKeyPair(t, t.TempDir(), "gateway-yeeter", time.Now())
+
+	code, out := captureStdout(t, func() int {
+		return runDoctor([]string{"--output=json", "--cert=" + certFile, "--key=" + keyFile, "--webhook-configuration=", "--check-serving-cert-name=false"})
+	})
+	var result doctorResult
+	if err := json.Unmarshal(out, &result); err != nil {
+		t.Fatalf("invalid output %s: %v", out, err)
+	}
+	if code != exitOK || !result.OK || len(result.Checks) != 2 || result.Checks[1].Status != checkWarning {
+		t.Fatalf("expected a soon expiring certificate warning, got %d %s", code, out)
+	}
+
+	code, out = captureStdout(t, func() int {
+		return runDoctor([]string{"--output=json", "--cert=" + certFile, "--key=" + keyFile, "--webhook-configuration="})
+	})
+	result = doctorResult{}
+	json.Unmarshal(out, &result)
+	if code != exitFindings || len(result.Checks) != 3 || result.Checks[2].Name != "serving-certificate-name" || result.Checks[2].Status != checkError {
+		t.Fatalf("expected a certificate without the Service name to be reported, got %d %s", code, out)
+	}
+
+	if code, _ := captureStdout(t, func() int {
+		return runDoctor([]string{"--cert=/nonexistent", "--key=/nonexistent", "--webhook-configuration="})
+	}); code != exitFindings {
+		t.Fatalf("expected exit %d for a missing certificate, got %d", exitFindings, code)
+	}
+}
+
+func TestDoctorCluster(t *testing.T) {
+	path := "/mutate"
+	withFakeKube(t, lookupWebhook, fake.NewClientset(&admissionregistrationv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "gateway-yeeter"},
+		Webhooks: []admissionregistrationv1.MutatingWebhook{
+			{
+				Name:           "cdi.gateway.yeet",
+				ClientConfig:   admissionregistrationv1.WebhookClientConfig{Service: &admissionregistrationv1.ServiceReference{Path: &path}, CABundle: []byte("ca")},
+				ObjectSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "containerized-data-importer"}},
+			},
+			{
+				Name:         "virt-v2v.gateway.yeet",
+				ClientConfig: admissionregistrationv1.WebhookClientConfig{Service: &admissionregistrationv1.ServiceReference{Path: &path}},
+			},
+		},
+	}))
+
+	statuses := map[string]string{}
+	doctorCluster("gateway-yeeter", func(name, status, format string, args ...interface{}) { statuses[name] = status })
+	if statuses["webhook/cdi.gateway.yeet"] != checkOK || statuses["webhook/virt-v2v.gateway.yeet"] != checkWarning {
+		t.Fatalf("unexpected checks %v", statuses)
+	}
+
+	statuses = map[string]string{}
+	doctorCluster("missing", func(name, status, format string, args ...interface{}) { statuses[name] = status })
+	if statuses["webhook-registration"] != checkError {
+		t.Fatalf("expected a missing registration to fail, got %v", statuses)
+	}
+}
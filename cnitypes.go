@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+
+	cnitypes "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/cni/types"
+)
+
+const (
+	cnitypesSkewRaw  = "raw"
+	cnitypesSkewFail = "fail"
+)
+
+// referenceNetworks uses every field of the Multus NetworkSelectionElement,
+// so the startup self-test notices when the cnitypes structs would drop or
+// rewrite any of them on the way back into the annotation.
+const referenceNetworks = `[{
+	"name": "mtv-transfer",
+	"namespace": "default",
+	"ips": ["192.0.2.10/24"],
+	"mac": "02:00:00:00:00:01",
+	"interface": "net1",
+	"infiniband-guid": "c2:11:22:33:44:55:66:77",
+	"portMappings": [{"hostPort": 8080, "containerPort": 80, "protocol": "tcp"}],
+	"bandwidth": {"ingressRate": 1000, "ingressBurst": 1000, "egressRate": 1000, "egressBurst": 1000},
+	"cni-args": {"gateway": ["192.0.2.1"]},
+	"default-route": ["192.0.2.1", "2001:db8::1"],
+	"ipam-claim-reference": "mtv-transfer-claim"
+}]`
+
+var cnitypesRawMode = newGauge(prometheus.GaugeOpts{
+	Name: "gateway_yeeter_cnitypes_raw_mode",
+	Help: "Whether the networks annotation is parsed as raw JSON (1) because the cnitypes structs failed the startup round-trip self-test, or through the structs (0).",
+})
+
+// rawNetworks makes parseNetworks bypass the cnitypes structs, set at
+// startup when they would lose fields.
+var rawNetworks bool
+
+// networkSelectionRequest holds the fields the webhook reads in raw mode,
+// with the tags the Multus specification defines.
+type networkSelectionRequest struct {
+	Name           string   `json:"name"`
+	Namespace      string   `json:"namespace,omitempty"`
+	GatewayRequest []net.IP `json:"default-route,omitempty"`
+}
+
+// checkCNITypes round-trips the reference annotation through the cnitypes
+// structs and switches to raw mode, or fails with --cnitypes-skew=fail, if
+// fields would be lost.
+func checkCNITypes(policy string) error {
+	lost, err := lostFields(referenceNetworks, func(annotation []byte) ([]byte, error) {
+		var networks []cnitypes.NetworkSelectionElement
+		if err := json.Unmarshal(annotation, &networks); err != nil {
+			return nil, err
+		}
+		return json.Marshal(networks)
+	})
+	if err != nil {
+		lost = []string{"(round-trip failed: " + err.Error() + ")"}
+	}
+	rawNetworks = len(lost) > 0
+	if !rawNetworks {
+		cnitypesRawMode.Set(0)
+		return nil
+	}
+	if policy == cnitypesSkewFail {
+		return fmt.Errorf("cnitypes would lose networks annotation fields %v", lost)
+	}
+	klog.Warningf("cnitypes would lose networks annotation fields %v, rewriting the annotation as raw JSON", lost)
+	cnitypesRawMode.Set(1)
+	return nil
+}
+
+// lostFields returns the fields of the elements of annotation that are
+// missing or changed after roundTrip.
+func lostFields(annotation string, roundTrip func([]byte) ([]byte, error)) ([]string, error) {
+	out, err := roundTrip([]byte(annotation))
+	if err != nil {
+		return nil, err
+	}
+	var before, after []map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(annotation), &before); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(out, &after); err != nil {
+		return nil, err
+	}
+	if len(before) != len(after) {
+		return nil, fmt.Errorf("%d elements became %d", len(before), len(after))
+	}
+
+	seen := make(map[string]bool)
+	var lost []string
+	for i := range before {
+		for field, raw := range before[i] {
+			if !seen[field] && !equalJSON(raw, after[i][field]) {
+				seen[field] = true
+				lost = append(lost, field)
+			}
+		}
+	}
+	sort.Strings(lost)
+	return lost, nil
+}
+
+// equalJSON compares a and b by value, so reordered object keys are not
+// reported as lost.
+func equalJSON(a, b json.RawMessage) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+func parseNetworks(annotation string) ([]cnitypes.NetworkSelectionElement, error) {
+	annotation, _, err := expandNetworks(annotation)
+	if err != nil {
+		return nil, err
+	}
+	if rawNetworks {
+		var requests []networkSelectionRequest
+		if err := json.Unmarshal([]byte(annotation), &requests); err != nil {
+			return nil, err
+		}
+		networks := make([]cnitypes.NetworkSelectionElement, len(requests))
+		for i, request := range requests {
+			networks[i].Name, networks[i].Namespace, networks[i].GatewayRequest = request.Name, request.Namespace, request.GatewayRequest
+		}
+		return networks, nil
+	}
+	var networks []cnitypes.NetworkSelectionElement
+	if err := json.Unmarshal([]byte(annotation), &networks); err != nil {
+		return nil, err
+	}
+	return networks, nil
+}
+
+// marshalNetworks writes networks back into annotation. Only the
+// default-route of elements whose GatewayRequest was cleared or shortened is
+// rewritten, every other byte of the annotation is kept as it was, including
+// fields the cnitypes structs do not know, like newer Multus keys or vendor
+// extensions.
+func marshalNetworks(annotation string, networks []cnitypes.NetworkSelectionElement) ([]byte, error) {
+	data := []byte(annotation)
+	elements, err := scanMembers(data, "default-route")
+	if err != nil {
+		return nil, err
+	}
+	if len(elements) != len(networks) {
+		return nil, fmt.Errorf("annotation has %d elements, expected %d", len(elements), len(networks))
+	}
+
+	out := make([]byte, 0, len(data))
+	last := 0
+	for i, members := range elements {
+		if len(networks[i].GatewayRequest) > 0 {
+			replacement, _ := json.Marshal(networks[i].GatewayRequest)
+			for _, m := range members {
+				if !m.matches {
+					continue
+				}
+				var requested []net.IP
+				json.Unmarshal(data[m.value:m.end], &requested)
+				if len(requested) != len(networks[i].GatewayRequest) {
+					out = append(append(out, data[last:m.value]...), replacement...)
+					last = m.end
+				}
+			}
+			continue
+		}
+		for _, cut := range removals(members) {
+			out = append(out, data[last:cut[0]]...)
+			last = cut[1]
+		}
+	}
+	return append(out, data[last:]...), nil
+}
+
+// memberSpan is the position of an object member in a JSON document:
+// data[start:end] is the member with the comma separating it from the
+// previous one, data[key:end] the member and data[value:end] its value.
+type memberSpan struct {
+	start, key, value, end int
+	matches                bool
+}
+
+// removals returns the ranges to cut to remove the matching members of an
+// object. Members after the first take their preceding comma along. When
+// the object starts with matching members, they are cut up to the first
+// kept member, which takes over their indentation.
+func removals(members []memberSpan) [][2]int {
+	var cuts [][2]int
+	i := 0
+	if len(members) > 0 && members[0].matches {
+		for i < len(members) && members[i].matches {
+			i++
+		}
+		end := members[len(members)-1].end
+		if i < len(members) {
+			end = members[i].key
+		}
+		cuts = append(cuts, [2]int{members[0].key, end})
+	}
+	for ; i < len(members); i++ {
+		if members[i].matches {
+			cuts = append(cuts, [2]int{members[i].start, members[i].end})
+		}
+	}
+	return cuts
+}
+
+// scanMembers returns the spans of the members of every element of data, a
+// JSON array of objects, marking those named key. Duplicate keys are all
+// marked.
+func scanMembers(data []byte, key string) ([][]memberSpan, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := expectDelim(dec, '['); err != nil {
+		return nil, err
+	}
+	var elements [][]memberSpan
+	for dec.More() {
+		if err := expectDelim(dec, '{'); err != nil {
+			return nil, err
+		}
+		var members []memberSpan
+		for dec.More() {
+			// More skips the whitespace up to the comma or, for the first
+			// member, up to the key.
+			start := int(dec.InputOffset())
+			name, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			var value json.RawMessage
+			if err := dec.Decode(&value); err != nil {
+				return nil, err
+			}
+			end := int(dec.InputOffset())
+			m := memberSpan{start: start, key: start, value: end - len(value), end: end, matches: name == key}
+			if data[start] == ',' {
+				m.key = len(data) - len(bytes.TrimLeft(data[start+1:], " \t\r\n"))
+			}
+			members = append(members, m)
+		}
+		if err := expectDelim(dec, '}'); err != nil {
+			return nil, err
+		}
+		elements = append(elements, members)
+	}
+	return elements, expectDelim(dec, ']')
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected %v, got %v", delim, token)
+	}
+	return nil
+}
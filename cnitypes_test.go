@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	cnitypes "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/cni/types"
+)
+
+func TestLostFields(t *testing.T) {
+	dropMAC := func(annotation []byte) ([]byte, error) {
+		var elements []map[string]interface{}
+		json.Unmarshal(annotation, &elements)
+		for _, element := range elements {
+			delete(element, "mac")
+			element["interface"] = "eth0"
+		}
+		return json.Marshal(elements)
+	}
+	lost, err := lostFields(referenceNetworks, dropMAC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"interface", "mac"}; !reflect.DeepEqual(lost, want) {
+		t.Fatalf("expected lost fields %v, got %v", want, lost)
+	}
+
+	identical := func(annotation []byte) ([]byte, error) { return annotation, nil }
+	if lost, err := lostFields(referenceNetworks, identical); err != nil || len(lost) != 0 {
+		t.Fatalf("expected no lost fields, got %v %v", lost, err)
+	}
+}
+
+func TestCheckCNITypes(t *testing.T) {
+	defer func() { rawNetworks = false }()
+
+	// default-route is the field the webhook rewrites, it must survive the
+	// structs in any version.
+	if err := checkCNITypes(cnitypesSkewRaw); err != nil {
+		t.Fatal(err)
+	}
+	lost, _ := lostFields(referenceNetworks, func(annotation []byte) ([]byte, error) {
+		var networks []cnitypes.NetworkSelectionElement
+		json.Unmarshal(annotation, &networks)
+		return json.Marshal(networks)
+	})
+	if contains(lost, "default-route") || contains(lost, "name") {
+		t.Fatalf("expected cnitypes to keep name and default-route, lost %v", lost)
+	}
+	if rawNetworks != (len(lost) > 0) || testutil.ToFloat64(cnitypesRawMode) != map[bool]float64{false: 0, true: 1}[rawNetworks] {
+		t.Fatalf("expected raw mode %v for lost fields %v", len(lost) > 0, lost)
+	}
+	if len(lost) > 0 {
+		if err := checkCNITypes(cnitypesSkewFail); err == nil || !strings.Contains(err.Error(), lost[0]) {
+			t.Fatalf("expected the self-test to fail with %v, got %v", lost, err)
+		}
+	}
+}
+
+func TestMarshalNetworksRaw(t *testing.T) {
+	defer func() { rawNetworks = false }()
+	rawNetworks = true
+
+	annotation := `[{"name":"mtv-transfer","namespace":"default","interface":"net1","ips":["192.0.2.10/24"],"default-route":["192.0.2.1"]},{"name":"storage","default-route":["198.51.100.1"]}]`
+	networks, err := parseNetworks(annotation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(networks) != 2 || networks[0].Namespace != "default" || !networks[1].GatewayRequest[0].Equal(net.ParseIP("198.51.100.1")) {
+		t.Fatalf("unexpected raw parse %+v", networks)
+	}
+
+	networks[0].GatewayRequest = nil
+	out, err := marshalNetworks(annotation, networks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"name":"mtv-transfer","namespace":"default","interface":"net1","ips":["192.0.2.10/24"]},{"name":"storage","default-route":["198.51.100.1"]}]`
+	if string(out) != want {
+		t.Fatalf("expected\n%s\ngot\n%s", want, out)
+	}
+}
+
+func TestMarshalNetworksKeepsUnknownFields(t *testing.T) {
+	tests := []struct {
+		name       string
+		annotation string
+		gateways   [][]net.IP
+		want       string
+	}{
+		{
+			name:       "removed last",
+			annotation: `[{"name":"transfer","x-vendor":{"b":1, "a":[2]},"default-route":["10.0.0.1"]}]`,
+			gateways:   [][]net.IP{nil},
+			want:       `[{"name":"transfer","x-vendor":{"b":1, "a":[2]}}]`,
+		},
+		{
+			name:       "removed first",
+			annotation: "[\n  {\n    \"default-route\": [\"10.0.0.1\"],\n    \"name\": \"transfer\",\n    \"future-key\": true\n  }\n]",
+			gateways:   [][]net.IP{nil},
+			want:       "[\n  {\n    \"name\": \"transfer\",\n    \"future-key\": true\n  }\n]",
+		},
+		{
+			name:       "removed only",
+			annotation: `[{"default-route" : ["10.0.0.1"]},{"name":"storage","default-route":["10.0.1.1"]}]`,
+			gateways:   [][]net.IP{nil, {net.ParseIP("10.0.1.1")}},
+			want:       `[{},{"name":"storage","default-route":["10.0.1.1"]}]`,
+		},
+		{
+			name:       "shortened first",
+			annotation: `[{"default-route":["10.0.0.1","192.0.2.1"],"name":"transfer","mtu":9000}]`,
+			gateways:   [][]net.IP{{net.ParseIP("192.0.2.1")}},
+			want:       `[{"default-route":["192.0.2.1"],"name":"transfer","mtu":9000}]`,
+		},
+		{
+			name:       "duplicate first keys",
+			annotation: `[{"default-route":["10.0.0.1"],"default-route":["10.0.0.2"],"name":"transfer"}]`,
+			gateways:   [][]net.IP{nil},
+			want:       `[{"name":"transfer"}]`,
+		},
+		{
+			name:       "duplicate only keys",
+			annotation: `[{"default-route":["10.0.0.1"], "default-route":["10.0.0.2"]}]`,
+			gateways:   [][]net.IP{nil},
+			want:       `[{}]`,
+		},
+		{
+			name:       "duplicate keys",
+			annotation: `[{"name":"transfer","default-route":["10.0.0.2"],"default-route":["10.0.0.1"]}]`,
+			gateways:   [][]net.IP{nil},
+			want:       `[{"name":"transfer"}]`,
+		},
+	}
+	for _, tt := range tests {
+		networks, err := parseNetworks(tt.annotation)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		for i := range networks {
+			networks[i].GatewayRequest = tt.gateways[i]
+		}
+		out, err := marshalNetworks(tt.annotation, networks)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if string(out) != tt.want {
+			t.Errorf("%s: expected\n%s\ngot\n%s", tt.name, tt.want, out)
+		}
+	}
+}
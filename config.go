@@ -0,0 +1,723 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = nil
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+type config struct {
+	ListenAddress     string        `json:"listenAddress"`
+	MaxConnections    int           `json:"maxConnections"`
+	MaxHeaderBytes    int           `json:"maxHeaderBytes"`
+	ReadHeaderTimeout time.Duration `json:"readHeaderTimeout"`
+	ReadTimeout       time.Duration `json:"readTimeout"`
+	IdleTimeout       time.Duration `json:"idleTimeout"`
+	ConnRequestRate   float64       `json:"connRequestRate"`
+	ConnRequestBurst  int           `json:"connRequestBurst"`
+
+	RateLimit      float64 `json:"rateLimit"`
+	RateLimitBurst int     `json:"rateLimitBurst"`
+	MaxInFlight    int     `json:"maxInFlight"`
+	AuditLog       string  `json:"auditLog"`
+	AuditFormat    string  `json:"auditFormat"`
+	LogFormat      string  `json:"logFormat"`
+
+	ScopeNamespaces            stringList    `json:"scopeNamespaces,omitempty"`
+	ExcludeNamespaces          stringList    `json:"excludeNamespaces"`
+	IgnoreNamespaceSelector    string        `json:"ignoreNamespaceSelector,omitempty"`
+	PodContext                 stringList    `json:"podContext,omitempty"`
+	ScopePlans                 stringList    `json:"scopePlans,omitempty"`
+	HandleOVNPodNetworks       bool          `json:"handleOVNPodNetworks"`
+	OVNRoutingAnnotations      string        `json:"ovnRoutingAnnotations"`
+	CheckNamespaceRouting      bool          `json:"checkNamespaceRouting"`
+	SRIOVPolicy                string        `json:"sriovPolicy"`
+	StripIPAMRoutes            bool          `json:"stripIPAMRoutes"`
+	KeepGatewayCIDRs           stringList    `json:"keepGatewayCIDRs,omitempty"`
+	CNITypesSkew               string        `json:"cnitypesSkew"`
+	MaxAttachments             int           `json:"maxAttachments"`
+	MaxNetworksAnnotationBytes int           `json:"maxNetworksAnnotationBytes"`
+	AnnotationLimitAction      string        `json:"annotationLimitAction"`
+	InterfaceConflictAction    string        `json:"interfaceConflictAction"`
+	GatekeeperProvider         bool          `json:"gatekeeperProvider"`
+	HandleHotplug              bool          `json:"handleHotplug"`
+	Maintenance                bool          `json:"maintenance"`
+	Shadow                     bool          `json:"shadow"`
+	DryRun                     bool          `json:"dryRun"`
+	RulesFile                  string        `json:"rulesFile,omitempty"`
+	Rules                      ruleSet       `json:"rules,omitempty"`
+	RulesConfigMaps            stringList    `json:"rulesConfigMaps,omitempty"`
+	RulesPolicies              bool          `json:"rulesPolicies"`
+	RulesSourceInterval        time.Duration `json:"rulesSourceInterval"`
+	TargetPolicies             bool          `json:"targetPolicies"`
+	TargetPolicyInterval       time.Duration `json:"targetPolicyInterval"`
+	ClassificationCacheTTL     time.Duration `json:"classificationCacheTTL"`
+	ConfigFile                 string        `json:"configFile,omitempty"`
+	ConfigReloadInterval       time.Duration `json:"configReloadInterval"`
+	CompareRules               bool          `json:"compareRules"`
+	MisdirectedReportInterval  time.Duration `json:"misdirectedReportInterval"`
+
+	NamespaceMutationThreshold int           `json:"namespaceMutationThreshold"`
+	NamespaceMutationWindow    time.Duration `json:"namespaceMutationWindow"`
+
+	FaultLatency        time.Duration `json:"faultLatency,omitempty"`
+	FaultErrorRate      float64       `json:"faultErrorRate,omitempty"`
+	FaultTLSFailureRate float64       `json:"faultTLSFailureRate,omitempty"`
+
+	MaxRequestBytes      int64         `json:"maxRequestBytes"`
+	MaxPayloadDepth      int           `json:"maxPayloadDepth"`
+	SelfProbeInterval    time.Duration `json:"selfProbeInterval"`
+	WarmUp               bool          `json:"warmUp"`
+	WarmUpTimeout        time.Duration `json:"warmUpTimeout"`
+	SlowRequestThreshold time.Duration `json:"slowRequestThreshold"`
+
+	AuditHashChain          bool            `json:"auditHashChain"`
+	AuditCheckpointKey      string          `json:"auditCheckpointKey,omitempty"`
+	AuditCheckpointInterval time.Duration   `json:"auditCheckpointInterval"`
+	RecordEncryptionKey     string          `json:"recordEncryptionKey,omitempty"`
+	Redaction               redactionPolicy `json:"redaction,omitempty"`
+	RedactionKey            string          `json:"redactionKey,omitempty"`
+
+	RecentDecisions   int        `json:"recentDecisions"`
+	DecisionStore     string     `json:"decisionStore"`
+	DecisionStorePath string     `json:"decisionStorePath,omitempty"`
+	AdminViewers      stringList `json:"adminViewers,omitempty"`
+	Admins            stringList `json:"admins,omitempty"`
+	AdminClientCA     string     `json:"adminClientCA,omitempty"`
+	AdminAudiences    stringList `json:"adminAudiences,omitempty"`
+
+	ElasticsearchURL            string        `json:"elasticsearchURL,omitempty"`
+	ElasticsearchIndex          string        `json:"elasticsearchIndex"`
+	ElasticsearchAPIKeyFile     string        `json:"elasticsearchAPIKeyFile,omitempty"`
+	ElasticsearchBufferDir      string        `json:"elasticsearchBufferDir"`
+	ElasticsearchMaxBufferBytes int64         `json:"elasticsearchMaxBufferBytes"`
+	ElasticsearchBatchSize      int           `json:"elasticsearchBatchSize"`
+	ElasticsearchFlushInterval  time.Duration `json:"elasticsearchFlushInterval"`
+	ElasticsearchTLS            sinkTLS       `json:"elasticsearchTLS"`
+
+	S3Endpoint            string        `json:"s3Endpoint,omitempty"`
+	S3Bucket              string        `json:"s3Bucket,omitempty"`
+	S3Region              string        `json:"s3Region"`
+	S3Prefix              string        `json:"s3Prefix"`
+	S3AccessKeyIDFile     string        `json:"s3AccessKeyIDFile,omitempty"`
+	S3SecretAccessKeyFile string        `json:"s3SecretAccessKeyFile,omitempty"`
+	S3BufferDir           string        `json:"s3BufferDir"`
+	S3MaxBufferBytes      int64         `json:"s3MaxBufferBytes"`
+	S3BatchSize           int           `json:"s3BatchSize"`
+	S3FlushInterval       time.Duration `json:"s3FlushInterval"`
+	S3Retention           time.Duration `json:"s3Retention"`
+	S3TLS                 sinkTLS       `json:"s3TLS"`
+
+	StatsdAddress  string        `json:"statsdAddress,omitempty"`
+	StatsdPrefix   string        `json:"statsdPrefix"`
+	StatsdTags     stringList    `json:"statsdTags,omitempty"`
+	StatsdInterval time.Duration `json:"statsdInterval"`
+
+	OTLPEndpoint string        `json:"otlpEndpoint,omitempty"`
+	OTLPHeaders  stringList    `json:"-"`
+	OTLPInterval time.Duration `json:"otlpInterval"`
+	OTLPTLS      sinkTLS       `json:"otlpTLS"`
+
+	ClusterName    string        `json:"clusterName,omitempty"`
+	FleetCollector string        `json:"fleetCollector,omitempty"`
+	FleetHeaders   stringList    `json:"-"`
+	FleetInterval  time.Duration `json:"fleetInterval"`
+	FleetTLS       sinkTLS       `json:"fleetTLS"`
+
+	DenialWebhook            string     `json:"denialWebhook,omitempty"`
+	DenialWebhookHeaders     stringList `json:"-"`
+	DenialWebhookQueue       int        `json:"denialWebhookQueue"`
+	DenialWebhookTemplate    string     `json:"denialWebhookTemplate,omitempty"`
+	DenialWebhookContentType string     `json:"denialWebhookContentType"`
+	DenialWebhookTLS         sinkTLS    `json:"denialWebhookTLS"`
+
+	VerifyNetworkStatus         bool          `json:"verifyNetworkStatus"`
+	VerifyNetworkStatusInterval time.Duration `json:"verifyNetworkStatusInterval"`
+
+	CheckWebhookConflicts   bool          `json:"checkWebhookConflicts"`
+	WebhookConflictInterval time.Duration `json:"webhookConflictInterval"`
+
+	RequireWebhookRegistration bool          `json:"requireWebhookRegistration"`
+	RegistrationCheckInterval  time.Duration `json:"registrationCheckInterval"`
+	CheckServingCertName       bool          `json:"checkServingCertName"`
+	CertExpiryWindow           time.Duration `json:"certExpiryWindow"`
+
+	PlanSummaries       bool          `json:"planSummaries"`
+	PlanSummaryInterval time.Duration `json:"planSummaryInterval"`
+
+	Events             bool   `json:"events"`
+	ValidateMode       string `json:"validateMode"`
+	DetectCapabilities bool   `json:"detectCapabilities"`
+
+	FailurePolicy  string        `json:"failurePolicy"`
+	WebhookTimeout time.Duration `json:"webhookTimeout"`
+	SideEffects    string        `json:"sideEffects"`
+
+	Kubeconfig                    string `json:"kubeconfig,omitempty"`
+	NADLookupServiceAccount       string `json:"nadLookupServiceAccount,omitempty"`
+	NamespaceLookupServiceAccount string `json:"namespaceLookupServiceAccount,omitempty"`
+	PlanLookupServiceAccount      string `json:"planLookupServiceAccount,omitempty"`
+	PodLookupServiceAccount       string `json:"podLookupServiceAccount,omitempty"`
+}
+
+var cfg = defaultConfig()
+
+func defaultConfig() config {
+	return config{
+		ListenAddress:     ":8443",
+		MaxConnections:    512,
+		MaxHeaderBytes:    32 << 10,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		ConnRequestRate:   0,
+		ConnRequestBurst:  50,
+
+		RateLimit:      0,
+		RateLimitBurst: 20,
+		AuditFormat:    auditFormatNative,
+		LogFormat:      logFormatText,
+
+		MisdirectedReportInterval: time.Minute,
+		RulesSourceInterval:       30 * time.Second,
+		TargetPolicyInterval:      30 * time.Second,
+		ClassificationCacheTTL:    10 * time.Minute,
+		ConfigReloadInterval:      10 * time.Second,
+		NamespaceMutationWindow:   10 * time.Minute,
+		OVNRoutingAnnotations:     ovnRoutingIgnore,
+		SRIOVPolicy:               sriovPolicyIgnore,
+		CNITypesSkew:              cnitypesSkewRaw,
+		AnnotationLimitAction:     limitActionWarn,
+		ValidateMode:              validateModeOff,
+		DetectCapabilities:        true,
+		FailurePolicy:             failurePolicyIgnore,
+		WebhookTimeout:            5 * time.Second,
+		SideEffects:               sideEffectsNone,
+		InterfaceConflictAction:   interfaceConflictWarn,
+		ExcludeNamespaces:         stringList{"kube-system", "openshift-*"},
+		AdminAudiences:            stringList{"gateway-yeeter"},
+
+		MaxRequestBytes:      1 << 20,
+		MaxPayloadDepth:      64,
+		SlowRequestThreshold: time.Second,
+		WarmUpTimeout:        30 * time.Second,
+
+		AuditCheckpointInterval: 5 * time.Minute,
+
+		RecentDecisions: 1000,
+		DecisionStore:   decisionStoreMemory,
+
+		ElasticsearchIndex:          "gateway-yeeter-decisions",
+		ElasticsearchBufferDir:      "/tmp/gateway-yeeter-elasticsearch",
+		ElasticsearchMaxBufferBytes: 64 << 20,
+		ElasticsearchBatchSize:      500,
+		ElasticsearchFlushInterval:  10 * time.Second,
+
+		S3Region:         "us-east-1",
+		S3Prefix:         "gateway-yeeter/",
+		S3BufferDir:      "/tmp/gateway-yeeter-s3",
+		S3MaxBufferBytes: 64 << 20,
+		S3BatchSize:      10000,
+		S3FlushInterval:  5 * time.Minute,
+
+		StatsdPrefix:   "gateway_yeeter",
+		StatsdInterval: 10 * time.Second,
+
+		PlanSummaryInterval: 30 * time.Second,
+
+		VerifyNetworkStatusInterval: time.Minute,
+
+		WebhookConflictInterval: 5 * time.Minute,
+
+		RegistrationCheckInterval: 30 * time.Second,
+		CheckServingCertName:      true,
+		CertExpiryWindow:          24 * time.Hour,
+
+		OTLPInterval: 30 * time.Second,
+
+		FleetInterval: 5 * time.Minute,
+
+		DenialWebhookQueue:       100,
+		DenialWebhookContentType: "application/json",
+	}
+}
+
+// rulesFileFlag loads the rules file when the flag is set.
+type rulesFileFlag struct{ c *config }
+
+func (f rulesFileFlag) String() string {
+	if f.c == nil {
+		return ""
+	}
+	return f.c.RulesFile
+}
+
+func (f rulesFileFlag) Set(file string) error {
+	rules, err := loadRules(file)
+	if err != nil {
+		return err
+	}
+	f.c.RulesFile, f.c.Rules = file, rules
+	return nil
+}
+
+func (c *config) bindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.ListenAddress, "listen-address", c.ListenAddress, "Address the HTTPS server listens on")
+	fs.IntVar(&c.MaxConnections, "max-connections", c.MaxConnections, "Maximum number of concurrent client connections (0 for unlimited)")
+	fs.IntVar(&c.MaxHeaderBytes, "max-header-bytes", c.MaxHeaderBytes, "Maximum size of request headers in bytes")
+	fs.DurationVar(&c.ReadHeaderTimeout, "read-header-timeout", c.ReadHeaderTimeout, "Maximum time to read request headers")
+	fs.DurationVar(&c.ReadTimeout, "read-timeout", c.ReadTimeout, "Maximum time to read a full request")
+	fs.DurationVar(&c.IdleTimeout, "idle-timeout", c.IdleTimeout, "Maximum time an idle keep-alive connection is kept open")
+	fs.Float64Var(&c.ConnRequestRate, "conn-request-rate", c.ConnRequestRate, "Sustained requests per second allowed per connection (0 disables the limit)")
+	fs.IntVar(&c.ConnRequestBurst, "conn-request-burst", c.ConnRequestBurst, "Number of requests a connection may burst above the sustained rate")
+	fs.Float64Var(&c.RateLimit, "rate-limit", c.RateLimit, "Sustained admission reviews per second allowed per client (0 disables rate limiting)")
+	fs.IntVar(&c.RateLimitBurst, "rate-limit-burst", c.RateLimitBurst, "Number of admission reviews a client may burst above the sustained rate")
+	fs.IntVar(&c.MaxInFlight, "max-in-flight", c.MaxInFlight, "Maximum number of admission reviews processed concurrently, further ones wait for up to half the request deadline (0 for no limit)")
+	fs.StringVar(&c.AuditLog, "audit-log", c.AuditLog, "Path of the append-only audit log (\"-\" for stdout, empty disables)")
+	fs.StringVar(&c.LogFormat, "log-format", c.LogFormat, "Format of the webhook's logs: text (klog) or json, with namespace, pod, uid, podType and network as fields of admission review lines")
+	fs.StringVar(&c.AuditFormat, "audit-format", c.AuditFormat, "Record format of the audit log: native or kubernetes (audit.k8s.io/v1 Events)")
+	fs.Var(&c.PodContext, "pod-context", "Comma-separated pod-spec context added to decision records: nodeSelector, image (of the first container) and owners")
+	fs.Var(&c.ExcludeNamespaces, "exclude-namespaces", "Comma-separated namespace patterns whose pods are never modified, in addition to the webhook's own namespace (empty to disable)")
+	fs.StringVar(&c.IgnoreNamespaceSelector, "ignore-namespace-selector", c.IgnoreNamespaceSelector, "Label selector of namespaces whose pods are never modified, e.g. gateway-yeeter.io/ignore=true, matched against a namespace cache (empty to disable)")
+	fs.Var(&c.ScopeNamespaces, "scope-namespaces", "Comma-separated namespaces the webhook is expected to receive pods from (empty for all)")
+	fs.Var(&c.ScopePlans, "scope-plans", "Comma-separated Forklift Plan UIDs or <namespace>/<name> references; only pods traceable to these Plans are mutated (empty for all)")
+	fs.BoolVar(&c.HandleOVNPodNetworks, "handle-ovn-pod-networks", c.HandleOVNPodNetworks, "Strip gateways and default routes from non-primary (user-defined) networks in the k8s.ovn.org/pod-networks annotation")
+	fs.StringVar(&c.OVNRoutingAnnotations, "ovn-routing-annotations", c.OVNRoutingAnnotations, "Handling of k8s.ovn.org external gateway routing annotations on target pods: ignore, warn or strip")
+	fs.BoolVar(&c.CheckNamespaceRouting, "check-namespace-routing", c.CheckNamespaceRouting, "Look up the pod's namespace and warn if it routes egress via k8s.ovn.org/routing-external-gws")
+	fs.StringVar(&c.SRIOVPolicy, "sriov-policy", c.SRIOVPolicy, "Handling of default routes on SR-IOV backed attachments (NADs with k8s.v1.cni.cncf.io/resourceName): ignore (no lookup), strip, skip or deny")
+	fs.BoolVar(&c.StripIPAMRoutes, "strip-ipam-routes", c.StripIPAMRoutes, "Strip gateway and default route directives from cni-args (whereabouts/static IPAM hints) in the networks annotation")
+	fs.Var(&c.KeepGatewayCIDRs, "keep-gateway-cidrs", "Comma-separated CIDRs of legitimate gateways; default-route requests for gateways within them are preserved")
+	fs.StringVar(&c.CNITypesSkew, "cnitypes-skew", c.CNITypesSkew, "Handling of a cnitypes dependency that would lose networks annotation fields at the startup self-test: raw (rewrite the annotation as raw JSON) or fail (refuse to start)")
+	fs.IntVar(&c.MaxAttachments, "max-attachments", c.MaxAttachments, "Maximum number of elements in the networks annotation of a target pod (0 for no limit)")
+	fs.IntVar(&c.MaxNetworksAnnotationBytes, "max-networks-annotation-bytes", c.MaxNetworksAnnotationBytes, "Maximum size of the networks annotation of a target pod in bytes (0 for no limit)")
+	fs.StringVar(&c.AnnotationLimitAction, "annotation-limit-action", c.AnnotationLimitAction, "Action for target pods exceeding --max-attachments or --max-networks-annotation-bytes: warn or deny")
+	fs.StringVar(&c.InterfaceConflictAction, "interface-conflict-action", c.InterfaceConflictAction, "Action for target pods whose networks annotation requests an interface name twice: ignore, warn or deny")
+	fs.BoolVar(&c.GatekeeperProvider, "gatekeeper-provider", c.GatekeeperProvider, "Serve the OPA Gatekeeper external data provider API on /gatekeeper/provider")
+	fs.BoolVar(&c.HandleHotplug, "handle-hotplug", c.HandleHotplug, "Review pod UPDATE admissions and strip default routes from networks hotplugged into the networks annotation")
+	fs.BoolVar(&c.Maintenance, "maintenance", c.Maintenance, "Start in maintenance mode: admit every pod unmodified and only log what would have been done")
+	fs.BoolVar(&c.Shadow, "shadow", c.Shadow, "Compute, log and count patches and denials without applying them, to observe the webhook before enforcing")
+	fs.BoolVar(&c.DryRun, "dry-run", c.DryRun, "Never patch or deny: permanently observe pods and count intended mutations in the dry-run metrics")
+	fs.Var(rulesFileFlag{c}, "rules-file", "YAML file with rules selecting the action (strip, deny, inject or ignore) per namespace, pod type and time window")
+	fs.Var(&c.RulesConfigMaps, "rules-configmaps", "Comma-separated ConfigMaps (<namespace>/<name>) whose rules.yaml key holds rules; they take precedence over --rules-file")
+	fs.BoolVar(&c.RulesPolicies, "rules-policies", c.RulesPolicies, "Read rules from GatewayYeetRuleSet (gateway.yeet) objects, which take precedence over ConfigMaps and --rules-file")
+	fs.DurationVar(&c.RulesSourceInterval, "rules-source-interval", c.RulesSourceInterval, "Interval at which rule ConfigMaps and GatewayYeetRuleSets are read")
+	fs.BoolVar(&c.TargetPolicies, "target-policies", c.TargetPolicies, "Select target pods with GatewayYeetPolicy (gateway.yeet) objects instead of the built-in virt-v2v and cdi labels while at least one exists")
+	fs.DurationVar(&c.TargetPolicyInterval, "target-policy-interval", c.TargetPolicyInterval, "Resync period of the GatewayYeetPolicy watch")
+	fs.DurationVar(&c.ClassificationCacheTTL, "classification-cache-ttl", c.ClassificationCacheTTL, "How long the pod type of an owner's pods is cached by owner UID (0 disables the cache)")
+	fs.StringVar(&c.ConfigFile, "config", c.ConfigFile, "YAML file (usually a mounted ConfigMap) with the pod labels and namespaces to target, reloaded when it changes; replaces the built-in virt-v2v and cdi targets")
+	fs.DurationVar(&c.ConfigReloadInterval, "config-reload-interval", c.ConfigReloadInterval, "Interval at which --config is checked for changes")
+	fs.BoolVar(&c.CompareRules, "compare-rules", c.CompareRules, "Apply the legacy strip-everything logic and only report where the rules file would have produced a different result")
+	fs.DurationVar(&c.MisdirectedReportInterval, "misdirected-report-interval", c.MisdirectedReportInterval, "Interval of the error summary of requests received outside the configured scope")
+	fs.IntVar(&c.NamespaceMutationThreshold, "namespace-mutation-threshold", c.NamespaceMutationThreshold, "Mutations per namespace within --namespace-mutation-window above which the namespace is flagged as anomalous (0 disables)")
+	fs.DurationVar(&c.NamespaceMutationWindow, "namespace-mutation-window", c.NamespaceMutationWindow, "Sliding window of the per-namespace mutation threshold")
+	fs.DurationVar(&c.FaultLatency, "fault-latency", c.FaultLatency, "Testing only: delay every admission request by this duration")
+	fs.Float64Var(&c.FaultErrorRate, "fault-error-rate", c.FaultErrorRate, "Testing only: ratio of admission requests answered with an HTTP 500")
+	fs.Float64Var(&c.FaultTLSFailureRate, "fault-tls-failure-rate", c.FaultTLSFailureRate, "Testing only: ratio of TLS handshakes that fail")
+	fs.Int64Var(&c.MaxRequestBytes, "max-request-bytes", c.MaxRequestBytes, "Maximum size of an admission request body in bytes")
+	fs.IntVar(&c.MaxPayloadDepth, "max-payload-depth", c.MaxPayloadDepth, "Maximum JSON nesting depth of an admission request body")
+	fs.DurationVar(&c.SelfProbeInterval, "self-probe-interval", c.SelfProbeInterval, "Interval at which a synthetic admission review is sent to /mutate over loopback to detect certificate, listener or handler breakage (0 disables)")
+	fs.BoolVar(&c.WarmUp, "warm-up", c.WarmUp, "Report not ready on /readyz until rule sources and target policies are read, a review was evaluated and a self-probe succeeded")
+	fs.DurationVar(&c.WarmUpTimeout, "warm-up-timeout", c.WarmUpTimeout, "Time after which an incomplete warm-up is given up and the replica reports ready anyway")
+	fs.DurationVar(&c.SlowRequestThreshold, "slow-request-threshold", c.SlowRequestThreshold, "Admission requests taking longer are logged with their (redacted) details as a warning (0 disables)")
+	fs.BoolVar(&c.AuditHashChain, "audit-hash-chain", c.AuditHashChain, "Chain audit log entries with a rolling SHA-256 hash")
+	fs.StringVar(&c.AuditCheckpointKey, "audit-checkpoint-key", c.AuditCheckpointKey, "PEM encoded Ed25519 private key (PKCS#8) used to sign periodic audit log checkpoints")
+	fs.DurationVar(&c.AuditCheckpointInterval, "audit-checkpoint-interval", c.AuditCheckpointInterval, "Interval between signed audit log checkpoints")
+	fs.Var(&c.Redaction, "redaction-policy", "Fields masked per output channel, e.g. \"logs=gateways;audit=pod,patch\" (channels: logs, audit, admin, events, metrics, sinks; fields: namespace, pod, networks, gateways, patch)")
+	fs.StringVar(&c.RedactionKey, "redaction-key", c.RedactionKey, "File containing a secret key used to replace redacted values with an HMAC-SHA256, so they can be correlated (without it, redacted values are replaced by a constant mask)")
+	fs.StringVar(&c.RecordEncryptionKey, "record-encryption-key", c.RecordEncryptionKey, "File containing a base64 encoded AES-256 key used to encrypt persisted decision records")
+
+	fs.IntVar(&c.RecentDecisions, "recent-decisions", c.RecentDecisions, "Number of recent decisions kept for the /decisions endpoint")
+	fs.StringVar(&c.DecisionStore, "decision-store", c.DecisionStore, "Where recent decisions are kept: memory, bolt or sqlite")
+	fs.StringVar(&c.DecisionStorePath, "decision-store-path", c.DecisionStorePath, "Database file of the bolt or sqlite decision store")
+	fs.Var(&c.AdminViewers, "admin-viewers", "Comma-separated users (or group:<name>) allowed to read /decisions, /configz and /stats")
+	fs.Var(&c.Admins, "admins", "Comma-separated users (or group:<name>) allowed to use all admin endpoints including pprof")
+	fs.Var(&c.AdminAudiences, "admin-audiences", "Comma-separated audiences bearer tokens presented to admin endpoints must be issued for")
+	fs.StringVar(&c.AdminClientCA, "admin-client-ca", c.AdminClientCA, "PEM CA bundle used to verify client certificates presented to admin endpoints")
+	fs.StringVar(&c.ElasticsearchURL, "elasticsearch-url", c.ElasticsearchURL, "https URL of an Elasticsearch/OpenSearch cluster decision records are exported to (empty disables)")
+	fs.StringVar(&c.ElasticsearchIndex, "elasticsearch-index", c.ElasticsearchIndex, "Index or data stream decision records are written to")
+	fs.StringVar(&c.ElasticsearchAPIKeyFile, "elasticsearch-api-key-file", c.ElasticsearchAPIKeyFile, "File containing an encoded Elasticsearch API key")
+	fs.StringVar(&c.ElasticsearchBufferDir, "elasticsearch-buffer-dir", c.ElasticsearchBufferDir, "Directory decision records are buffered in until they are indexed")
+	fs.Int64Var(&c.ElasticsearchMaxBufferBytes, "elasticsearch-max-buffer-bytes", c.ElasticsearchMaxBufferBytes, "Maximum size of the buffer directory, the oldest records are dropped beyond it")
+	fs.IntVar(&c.ElasticsearchBatchSize, "elasticsearch-batch-size", c.ElasticsearchBatchSize, "Maximum number of decision records per bulk request")
+	fs.DurationVar(&c.ElasticsearchFlushInterval, "elasticsearch-flush-interval", c.ElasticsearchFlushInterval, "Maximum time decision records are buffered before they are sent")
+	c.ElasticsearchTLS.bindFlags(fs, "elasticsearch", "Elasticsearch cluster")
+	fs.StringVar(&c.S3Endpoint, "s3-endpoint", c.S3Endpoint, "https URL of S3-compatible object storage decision record batches are uploaded to (empty disables)")
+	fs.StringVar(&c.S3Bucket, "s3-bucket", c.S3Bucket, "Bucket decision record batches are uploaded to")
+	fs.StringVar(&c.S3Region, "s3-region", c.S3Region, "Region used to sign S3 requests")
+	fs.StringVar(&c.S3Prefix, "s3-prefix", c.S3Prefix, "Key prefix of the uploaded batches, followed by <yyyy>/<mm>/<dd>/")
+	fs.StringVar(&c.S3AccessKeyIDFile, "s3-access-key-id-file", c.S3AccessKeyIDFile, "File containing the S3 access key ID (defaults to $AWS_ACCESS_KEY_ID)")
+	fs.StringVar(&c.S3SecretAccessKeyFile, "s3-secret-access-key-file", c.S3SecretAccessKeyFile, "File containing the S3 secret access key (defaults to $AWS_SECRET_ACCESS_KEY)")
+	fs.StringVar(&c.S3BufferDir, "s3-buffer-dir", c.S3BufferDir, "Directory decision records are buffered in until they are uploaded")
+	fs.Int64Var(&c.S3MaxBufferBytes, "s3-max-buffer-bytes", c.S3MaxBufferBytes, "Maximum size of the S3 buffer directory, the oldest records are dropped beyond it")
+	fs.IntVar(&c.S3BatchSize, "s3-batch-size", c.S3BatchSize, "Maximum number of decision records per uploaded object")
+	fs.DurationVar(&c.S3FlushInterval, "s3-flush-interval", c.S3FlushInterval, "Maximum time decision records are buffered before they are uploaded")
+	fs.DurationVar(&c.S3Retention, "s3-retention", c.S3Retention, "Age after which uploaded batches below the prefix are deleted (0 keeps them)")
+	c.S3TLS.bindFlags(fs, "s3", "object storage")
+	fs.StringVar(&c.StatsdAddress, "statsd-address", c.StatsdAddress, "host:port of a DogStatsD agent metrics are sent to over UDP (empty disables)")
+	fs.StringVar(&c.StatsdPrefix, "statsd-prefix", c.StatsdPrefix, "Prefix of DogStatsD metric names")
+	fs.Var(&c.StatsdTags, "statsd-tags", "Comma-separated constant DogStatsD tags, e.g. \"env:prod,cluster:east\"")
+	fs.DurationVar(&c.StatsdInterval, "statsd-interval", c.StatsdInterval, "Interval at which the Prometheus metrics are mirrored to DogStatsD")
+	fs.StringVar(&c.OTLPEndpoint, "otlp-endpoint", c.OTLPEndpoint, "https base URL of an OTLP/HTTP collector metrics are exported to (empty disables)")
+	fs.Var(&c.OTLPHeaders, "otlp-headers", "Comma-separated key=value headers sent to the OTLP collector")
+	fs.DurationVar(&c.OTLPInterval, "otlp-interval", c.OTLPInterval, "Interval at which metrics are exported over OTLP")
+	c.OTLPTLS.bindFlags(fs, "otlp", "OTLP collector")
+	fs.StringVar(&c.ClusterName, "cluster-name", c.ClusterName, "Name identifying this cluster in fleet collector reports")
+	fs.StringVar(&c.FleetCollector, "fleet-collector", c.FleetCollector, "https URL of a central collector decision summaries are posted to (empty disables)")
+	fs.Var(&c.FleetHeaders, "fleet-headers", "Comma-separated key=value headers sent to the fleet collector")
+	fs.DurationVar(&c.FleetInterval, "fleet-interval", c.FleetInterval, "Interval at which decision summaries are posted to the fleet collector")
+	c.FleetTLS.bindFlags(fs, "fleet", "fleet collector")
+	fs.StringVar(&c.DenialWebhook, "denial-webhook", c.DenialWebhook, "https URL every pod denial is posted to, so migration tooling can retry (empty disables)")
+	fs.Var(&c.DenialWebhookHeaders, "denial-webhook-headers", "Comma-separated key=value headers sent to the denial webhook")
+	fs.IntVar(&c.DenialWebhookQueue, "denial-webhook-queue", c.DenialWebhookQueue, "Maximum number of denial notifications waiting to be sent, further ones are dropped")
+	fs.StringVar(&c.DenialWebhookTemplate, "denial-webhook-template", c.DenialWebhookTemplate, "File with a Go template rendering the denial notification body, e.g. a Slack message (empty posts the notification as JSON)")
+	fs.StringVar(&c.DenialWebhookContentType, "denial-webhook-content-type", c.DenialWebhookContentType, "Content-Type of the denial notifications")
+	c.DenialWebhookTLS.bindFlags(fs, "denial-webhook", "denial webhook")
+	fs.BoolVar(&c.VerifyNetworkStatus, "verify-network-status", c.VerifyNetworkStatus, "Periodically check the Multus network-status of running target pods for default routes on secondary attachments")
+	fs.DurationVar(&c.VerifyNetworkStatusInterval, "verify-network-status-interval", c.VerifyNetworkStatusInterval, "Interval of the network-status verification")
+	fs.BoolVar(&c.CheckWebhookConflicts, "check-webhook-conflicts", c.CheckWebhookConflicts, "Periodically look for other mutating webhooks receiving migration pods, which may rewrite the networks annotation")
+	fs.DurationVar(&c.WebhookConflictInterval, "webhook-conflict-interval", c.WebhookConflictInterval, "Interval of the conflicting webhook check")
+	fs.BoolVar(&c.CheckServingCertName, "check-serving-cert-name", c.CheckServingCertName, "Report not ready on /readyz if the serving certificate is not valid for <service>.<namespace>.svc")
+	fs.DurationVar(&c.CertExpiryWindow, "cert-expiry-window", c.CertExpiryWindow, "Report not ready on /readyz if the serving keypair cannot be loaded or the certificate expires within this window (0 only for expired certificates)")
+	fs.BoolVar(&c.RequireWebhookRegistration, "require-webhook-registration", c.RequireWebhookRegistration, "Report not ready on /readyz until a MutatingWebhookConfiguration calls /mutate on this webhook's Service")
+	fs.DurationVar(&c.RegistrationCheckInterval, "registration-check-interval", c.RegistrationCheckInterval, "Interval of the webhook registration check")
+	fs.BoolVar(&c.PlanSummaries, "plan-summaries", c.PlanSummaries, "Aggregate decisions per Forklift Plan and write them to the gateway.yeet/summary annotation of the Plan")
+	fs.DurationVar(&c.PlanSummaryInterval, "plan-summary-interval", c.PlanSummaryInterval, "Interval at which Forklift Plan summaries are updated")
+	fs.BoolVar(&c.Events, "events", c.Events, "Emit a GatewayRemoved Event on every pod whose default-route gateways were removed")
+	fs.StringVar(&c.ValidateMode, "validate-mode", c.ValidateMode, "Mode of the /validate endpoint for pods that kept their default-route gateways: off, audit (warn) or enforce (deny)")
+	fs.BoolVar(&c.DetectCapabilities, "detect-capabilities", c.DetectCapabilities, "Discover the APIs the cluster serves at startup and turn off features whose APIs are missing")
+	fs.StringVar(&c.FailurePolicy, "failure-policy", c.FailurePolicy, "failurePolicy of the webhook configuration: Ignore, or Fail to also reject pods the webhook cannot review, e.g. when rate limited")
+	fs.DurationVar(&c.WebhookTimeout, "webhook-timeout", c.WebhookTimeout, "timeoutSeconds of the webhook configuration, whole seconds from 1s to 30s; the request deadline when the API server sends none")
+	fs.StringVar(&c.SideEffects, "side-effects", c.SideEffects, "sideEffects of the webhook configuration: None, or NoneOnDryRun, required by --events and --plan-summaries")
+	fs.StringVar(&c.Kubeconfig, "kubeconfig", c.Kubeconfig, "Path to a kubeconfig for cluster lookups (defaults to the in-cluster configuration)")
+	fs.StringVar(&c.NADLookupServiceAccount, "nad-lookup-service-account", c.NADLookupServiceAccount, "Service account (<namespace>/<name>) to impersonate for NetworkAttachmentDefinition lookups")
+	fs.StringVar(&c.NamespaceLookupServiceAccount, "namespace-lookup-service-account", c.NamespaceLookupServiceAccount, "Service account (<namespace>/<name>) to impersonate for Namespace lookups")
+	fs.StringVar(&c.PlanLookupServiceAccount, "plan-lookup-service-account", c.PlanLookupServiceAccount, "Service account (<namespace>/<name>) to impersonate for Forklift Plan lookups")
+	fs.StringVar(&c.PodLookupServiceAccount, "pod-lookup-service-account", c.PodLookupServiceAccount, "Service account (<namespace>/<name>) to impersonate for Pod lookups")
+}
+
+func (c config) validate() error {
+	if c.ListenAddress == "" {
+		return fmt.Errorf("listen-address must not be empty")
+	}
+	if c.Kubeconfig != "" {
+		if _, err := clientcmd.BuildConfigFromFlags("", c.Kubeconfig); err != nil {
+			return fmt.Errorf("invalid kubeconfig %s: %w", c.Kubeconfig, err)
+		}
+	}
+	for _, field := range c.PodContext {
+		if !contains(podContextFields, field) {
+			return fmt.Errorf("invalid pod-context field %q, expected one of %s", field, strings.Join(podContextFields, ", "))
+		}
+	}
+	for _, pattern := range c.ExcludeNamespaces {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid exclude-namespaces pattern %q", pattern)
+		}
+	}
+	for _, namespace := range c.ScopeNamespaces {
+		if matchesNamespace(c.ExcludeNamespaces, namespace) {
+			return fmt.Errorf("scope-namespaces contains %s, which is excluded by exclude-namespaces", namespace)
+		}
+	}
+	for _, ref := range c.RulesConfigMaps {
+		if namespace, name, found := strings.Cut(ref, "/"); !found || namespace == "" || name == "" || strings.Contains(name, "/") {
+			return fmt.Errorf("invalid rules-configmaps reference %q, expected <namespace>/<name>", ref)
+		}
+	}
+	if (len(c.RulesConfigMaps) > 0 || c.RulesPolicies) && c.RulesSourceInterval <= 0 {
+		return fmt.Errorf("rules-source-interval must be positive, got %s", c.RulesSourceInterval)
+	}
+	if c.ClassificationCacheTTL < 0 {
+		return fmt.Errorf("classification-cache-ttl must not be negative, got %s", c.ClassificationCacheTTL)
+	}
+	if c.TargetPolicies && c.TargetPolicyInterval <= 0 {
+		return fmt.Errorf("target-policy-interval must be positive, got %s", c.TargetPolicyInterval)
+	}
+	if c.ConfigFile != "" {
+		if c.ConfigReloadInterval <= 0 {
+			return fmt.Errorf("config-reload-interval must be positive, got %s", c.ConfigReloadInterval)
+		}
+		if _, _, err := loadTargetConfig(c.ConfigFile); err != nil {
+			return err
+		}
+	}
+	if c.MaxConnections < 0 {
+		return fmt.Errorf("max-connections must not be negative, got %d", c.MaxConnections)
+	}
+	if c.MaxInFlight < 0 {
+		return fmt.Errorf("max-in-flight must not be negative, got %d", c.MaxInFlight)
+	}
+	if c.MaxHeaderBytes <= 0 {
+		return fmt.Errorf("max-header-bytes must be positive, got %d", c.MaxHeaderBytes)
+	}
+	if !contains([]string{decisionStoreMemory, decisionStoreBolt, decisionStoreSQLite}, c.DecisionStore) {
+		return fmt.Errorf("decision-store must be one of memory, bolt or sqlite, got %q", c.DecisionStore)
+	}
+	if c.DecisionStore != decisionStoreMemory && c.DecisionStorePath == "" {
+		return fmt.Errorf("decision-store %s needs decision-store-path", c.DecisionStore)
+	}
+	if !contains([]string{logFormatText, logFormatJSON}, c.LogFormat) {
+		return fmt.Errorf("log-format must be text or json, got %q", c.LogFormat)
+	}
+	if !contains([]string{auditFormatNative, auditFormatKubernetes}, c.AuditFormat) {
+		return fmt.Errorf("audit-format must be native or kubernetes, got %q", c.AuditFormat)
+	}
+	if !contains([]string{ovnRoutingIgnore, ovnRoutingWarn, ovnRoutingStrip}, c.OVNRoutingAnnotations) {
+		return fmt.Errorf("ovn-routing-annotations must be one of ignore, warn or strip, got %q", c.OVNRoutingAnnotations)
+	}
+	if !contains([]string{sriovPolicyIgnore, sriovPolicyStrip, sriovPolicySkip, sriovPolicyDeny}, c.SRIOVPolicy) {
+		return fmt.Errorf("sriov-policy must be one of ignore, strip, skip or deny, got %q", c.SRIOVPolicy)
+	}
+	if !contains([]string{cnitypesSkewRaw, cnitypesSkewFail}, c.CNITypesSkew) {
+		return fmt.Errorf("cnitypes-skew must be raw or fail, got %q", c.CNITypesSkew)
+	}
+	if c.MaxAttachments < 0 {
+		return fmt.Errorf("max-attachments must not be negative, got %d", c.MaxAttachments)
+	}
+	if c.MaxNetworksAnnotationBytes < 0 {
+		return fmt.Errorf("max-networks-annotation-bytes must not be negative, got %d", c.MaxNetworksAnnotationBytes)
+	}
+	if !contains([]string{limitActionWarn, limitActionDeny}, c.AnnotationLimitAction) {
+		return fmt.Errorf("annotation-limit-action must be warn or deny, got %q", c.AnnotationLimitAction)
+	}
+	if !contains([]string{interfaceConflictIgnore, interfaceConflictWarn, interfaceConflictDeny}, c.InterfaceConflictAction) {
+		return fmt.Errorf("interface-conflict-action must be one of ignore, warn or deny, got %q", c.InterfaceConflictAction)
+	}
+	if len(c.AdminAudiences) == 0 {
+		return fmt.Errorf("admin-audiences must not be empty")
+	}
+	if c.MaxRequestBytes <= 0 {
+		return fmt.Errorf("max-request-bytes must be positive, got %d", c.MaxRequestBytes)
+	}
+	if c.WarmUp && c.WarmUpTimeout <= 0 {
+		return fmt.Errorf("warm-up-timeout must be positive, got %s", c.WarmUpTimeout)
+	}
+	if c.SelfProbeInterval < 0 {
+		return fmt.Errorf("self-probe-interval must not be negative, got %s", c.SelfProbeInterval)
+	}
+	if c.SlowRequestThreshold < 0 {
+		return fmt.Errorf("slow-request-threshold must not be negative, got %s", c.SlowRequestThreshold)
+	}
+	if c.MaxPayloadDepth <= 0 {
+		return fmt.Errorf("max-payload-depth must be positive, got %d", c.MaxPayloadDepth)
+	}
+	if c.ElasticsearchURL != "" {
+		if err := requireHTTPS(c.ElasticsearchURL); err != nil {
+			return err
+		}
+		if c.ElasticsearchBatchSize <= 0 {
+			return fmt.Errorf("elasticsearch-batch-size must be positive, got %d", c.ElasticsearchBatchSize)
+		}
+		if c.ElasticsearchFlushInterval <= 0 {
+			return fmt.Errorf("elasticsearch-flush-interval must be positive, got %s", c.ElasticsearchFlushInterval)
+		}
+	}
+	if c.S3Endpoint != "" {
+		if err := requireHTTPS(c.S3Endpoint); err != nil {
+			return err
+		}
+		if c.S3Bucket == "" {
+			return fmt.Errorf("s3-endpoint requires s3-bucket")
+		}
+		if c.S3Prefix != "" && !strings.HasSuffix(c.S3Prefix, "/") {
+			return fmt.Errorf("s3-prefix must end with /, got %q", c.S3Prefix)
+		}
+		if c.S3BatchSize <= 0 {
+			return fmt.Errorf("s3-batch-size must be positive, got %d", c.S3BatchSize)
+		}
+		if c.S3FlushInterval <= 0 {
+			return fmt.Errorf("s3-flush-interval must be positive, got %s", c.S3FlushInterval)
+		}
+		if c.S3Retention < 0 {
+			return fmt.Errorf("s3-retention must not be negative, got %s", c.S3Retention)
+		}
+	}
+	if c.OTLPEndpoint != "" {
+		if err := requireHTTPS(c.OTLPEndpoint); err != nil {
+			return err
+		}
+		if c.OTLPInterval <= 0 {
+			return fmt.Errorf("otlp-interval must be positive, got %s", c.OTLPInterval)
+		}
+		for _, header := range c.OTLPHeaders {
+			if key, _, found := strings.Cut(header, "="); !found || key == "" {
+				return fmt.Errorf("invalid otlp-headers entry %q, expected key=value", header)
+			}
+		}
+	}
+	if c.FleetCollector != "" {
+		if err := requireHTTPS(c.FleetCollector); err != nil {
+			return err
+		}
+		if c.ClusterName == "" {
+			return fmt.Errorf("fleet-collector requires cluster-name")
+		}
+		if c.FleetInterval <= 0 {
+			return fmt.Errorf("fleet-interval must be positive, got %s", c.FleetInterval)
+		}
+		for _, header := range c.FleetHeaders {
+			if key, _, found := strings.Cut(header, "="); !found || key == "" {
+				return fmt.Errorf("invalid fleet-headers entry %q, expected key=value", header)
+			}
+		}
+	}
+	if c.DenialWebhook != "" {
+		if err := requireHTTPS(c.DenialWebhook); err != nil {
+			return err
+		}
+		if c.DenialWebhookQueue <= 0 {
+			return fmt.Errorf("denial-webhook-queue must be positive, got %d", c.DenialWebhookQueue)
+		}
+		for _, header := range c.DenialWebhookHeaders {
+			if key, _, found := strings.Cut(header, "="); !found || key == "" {
+				return fmt.Errorf("invalid denial-webhook-headers entry %q, expected key=value", header)
+			}
+		}
+	} else if c.DenialWebhookTemplate != "" {
+		return fmt.Errorf("denial-webhook-template requires denial-webhook")
+	}
+	if !contains([]string{validateModeOff, validateModeAudit, validateModeEnforce}, c.ValidateMode) {
+		return fmt.Errorf("validate-mode must be off, audit or enforce, got %q", c.ValidateMode)
+	}
+	if !contains([]string{failurePolicyIgnore, failurePolicyFail}, c.FailurePolicy) {
+		return fmt.Errorf("failure-policy must be Ignore or Fail, got %q", c.FailurePolicy)
+	}
+	if c.WebhookTimeout < time.Second || c.WebhookTimeout > 30*time.Second || c.WebhookTimeout%time.Second != 0 {
+		return fmt.Errorf("webhook-timeout must be whole seconds from 1s to 30s, got %s", c.WebhookTimeout)
+	}
+	if !contains([]string{sideEffectsNone, sideEffectsNoneOnDryRun}, c.SideEffects) {
+		return fmt.Errorf("side-effects must be None or NoneOnDryRun, got %q", c.SideEffects)
+	}
+	if c.SideEffects == sideEffectsNone && (c.Events || c.PlanSummaries) {
+		return fmt.Errorf("side-effects None is incorrect with events or plan-summaries, which write to the cluster on admission; use NoneOnDryRun")
+	}
+	if c.DryRun && c.Shadow {
+		return fmt.Errorf("dry-run and shadow are mutually exclusive")
+	}
+	if err := validateCIDRs("keep-gateway-cidrs", c.KeepGatewayCIDRs); err != nil {
+		return err
+	}
+	if _, err := labels.Parse(c.IgnoreNamespaceSelector); err != nil {
+		return fmt.Errorf("invalid ignore-namespace-selector %q: %v", c.IgnoreNamespaceSelector, err)
+	}
+	if c.CertExpiryWindow < 0 {
+		return fmt.Errorf("cert-expiry-window must not be negative, got %s", c.CertExpiryWindow)
+	}
+	if c.FaultLatency < 0 {
+		return fmt.Errorf("fault-latency must not be negative, got %s", c.FaultLatency)
+	}
+	if c.FaultErrorRate < 0 || c.FaultErrorRate > 1 || c.FaultTLSFailureRate < 0 || c.FaultTLSFailureRate > 1 {
+		return fmt.Errorf("fault-error-rate and fault-tls-failure-rate must be within [0, 1]")
+	}
+	if c.NamespaceMutationThreshold < 0 {
+		return fmt.Errorf("namespace-mutation-threshold must not be negative, got %d", c.NamespaceMutationThreshold)
+	}
+	if c.NamespaceMutationThreshold > 0 && c.NamespaceMutationWindow <= 0 {
+		return fmt.Errorf("namespace-mutation-window must be positive, got %s", c.NamespaceMutationWindow)
+	}
+	if c.VerifyNetworkStatus && c.VerifyNetworkStatusInterval <= 0 {
+		return fmt.Errorf("verify-network-status-interval must be positive, got %s", c.VerifyNetworkStatusInterval)
+	}
+	if c.CheckWebhookConflicts && c.WebhookConflictInterval <= 0 {
+		return fmt.Errorf("webhook-conflict-interval must be positive, got %s", c.WebhookConflictInterval)
+	}
+	if c.RequireWebhookRegistration && c.RegistrationCheckInterval <= 0 {
+		return fmt.Errorf("registration-check-interval must be positive, got %s", c.RegistrationCheckInterval)
+	}
+	if c.PlanSummaries && c.PlanSummaryInterval <= 0 {
+		return fmt.Errorf("plan-summary-interval must be positive, got %s", c.PlanSummaryInterval)
+	}
+	if c.StatsdAddress != "" && c.StatsdInterval <= 0 {
+		return fmt.Errorf("statsd-interval must be positive, got %s", c.StatsdInterval)
+	}
+	for _, sa := range []string{c.NADLookupServiceAccount, c.NamespaceLookupServiceAccount, c.PlanLookupServiceAccount, c.PodLookupServiceAccount} {
+		if sa == "" {
+			continue
+		}
+		if _, err := serviceAccountUsername(sa); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c config) hash() string {
+	raw, _ := json.Marshal(c)
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// loadConfigFile overlays base with the configuration file, which has
+// the layout of the configuration in /configz and validate-config. Rules are
+// read from rulesFile when the file changes it.
+func loadConfigFile(base config, file string) (config, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return base, err
+	}
+	c := base
+	if err := yaml.UnmarshalStrict(raw, &c); err != nil {
+		return base, fmt.Errorf("%s: %w", file, err)
+	}
+	if c.RulesFile != base.RulesFile && c.RulesFile != "" {
+		if c.Rules, err = loadRules(c.RulesFile); err != nil {
+			return base, err
+		}
+	} else if err := c.Rules.validate(); err != nil {
+		return base, fmt.Errorf("%s: invalid rules: %w", file, err)
+	}
+	if err := c.validate(); err != nil {
+		return base, fmt.Errorf("%s: %w", file, err)
+	}
+	return c, nil
+}
+
+func applyConfig(next config, source, actor string) {
+	old := cfg
+	cfg = next
+	activeConfigHash = cfg.hash()
+	rateLimiter = newSourceRateLimiter(cfg.RateLimit, cfg.RateLimitBurst)
+	admin = newAdminAuth(cfg.AdminViewers, cfg.Admins)
+	exportRules(cfg.Rules)
+	if err := kube.configure(cfg.Kubeconfig, map[lookupCategory]string{
+		lookupNAD:       cfg.NADLookupServiceAccount,
+		lookupNamespace: cfg.NamespaceLookupServiceAccount,
+		lookupPlan:      cfg.PlanLookupServiceAccount,
+		lookupPod:       cfg.PodLookupServiceAccount,
+	}); err != nil {
+		klog.Errorf("Kubernetes lookups are unavailable: %v", err)
+	}
+
+	if source == "startup" {
+		auditConfigChange(source, actor, nil, next)
+	} else if old.hash() != next.hash() {
+		auditConfigChange(source, actor, &old, next)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
+)
+
+const (
+	crdGroup          = "gateway.yeet"
+	crdVersionAlpha   = "v1alpha1"
+	crdVersionBeta    = "v1beta1"
+	crdStorageVersion = crdVersionBeta
+
+	conversionReviewAPIVersion = "apiextensions.k8s.io/v1"
+)
+
+var crdGVR = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+
+var conversions = newCounterVec(prometheus.CounterOpts{
+	Name: "gateway_yeeter_conversions_total",
+	Help: "Custom resources converted by the conversion webhook, by kind and result (success, error).",
+}, "kind", "result")
+
+type conversionRequest struct {
+	UID               string            `json:"uid"`
+	DesiredAPIVersion string            `json:"desiredAPIVersion"`
+	Objects           []json.RawMessage `json:"objects"`
+}
+
+type conversionResponse struct {
+	UID              string            `json:"uid"`
+	ConvertedObjects []json.RawMessage `json:"convertedObjects"`
+	Result           metav1.Status     `json:"result"`
+}
+
+type conversionReview struct {
+	APIVersion string              `json:"apiVersion"`
+	Kind       string              `json:"kind"`
+	Request    *conversionRequest  `json:"request,omitempty"`
+	Response   *conversionResponse `json:"response,omitempty"`
+}
+
+// handleConvert answers the ConversionReviews of the API server for the
+// GatewayYeetPolicy and GatewayYeetRuleSet CRDs. A request fails as a whole
+// if any object cannot be converted.
+func handleConvert(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, cfg.MaxRequestBytes+1))
+	if err != nil || int64(len(body)) > cfg.MaxRequestBytes {
+		http.Error(w, "could not read request", http.StatusBadRequest)
+		return
+	}
+	var review conversionReview
+	if err := json.Unmarshal(body, &review); err != nil || review.Request == nil {
+		http.Error(w, "malformed ConversionReview", http.StatusBadRequest)
+		return
+	}
+
+	response := &conversionResponse{UID: review.Request.UID, Result: metav1.Status{Status: metav1.StatusSuccess}}
+	for _, raw := range review.Request.Objects {
+		converted, kind, err := convertObject(raw, review.Request.DesiredAPIVersion)
+		if err != nil {
+			conversions.WithLabelValues(kind, "error").Inc()
+			klog.Errorf("Could not convert %s to %s (uid=%s): %v", kind, review.Request.DesiredAPIVersion, review.Request.UID, err)
+			response.ConvertedObjects = nil
+			response.Result = metav1.Status{Status: metav1.StatusFailure, Message: err.Error()}
+			break
+		}
+		conversions.WithLabelValues(kind, "success").Inc()
+		response.ConvertedObjects = append(response.ConvertedObjects, converted)
+	}
+	writeJSON(w, conversionReview{APIVersion: conversionReviewAPIVersion, Kind: "ConversionReview", Response: response})
+}
+
+func convertObject(raw json.RawMessage, apiVersion string) (json.RawMessage, string, error) {
+	var object map[string]interface{}
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return nil, "", err
+	}
+	kind, _ := object["kind"].(string)
+	if err := convertCustomResource(object, apiVersion); err != nil {
+		return nil, kind, err
+	}
+	converted, err := json.Marshal(object)
+	return converted, kind, err
+}
+
+// convertCustomResource converts object, a GatewayYeetPolicy or
+// GatewayYeetRuleSet, to apiVersion in place. Fields the conversion does not
+// know are kept. The versions of a GatewayYeetPolicy differ in networks,
+// which v1alpha1 writes as "[namespace/]name" patterns and v1beta1 as
+// objects with separate namespace and name patterns. Rule sets have the
+// same layout in both versions.
+func convertCustomResource(object map[string]interface{}, apiVersion string) error {
+	from, _ := object["apiVersion"].(string)
+	for _, version := range []string{from, apiVersion} {
+		if version != crdGroup+"/"+crdVersionAlpha && version != crdGroup+"/"+crdVersionBeta {
+			return fmt.Errorf("unsupported apiVersion %q", version)
+		}
+	}
+	kind, _ := object["kind"].(string)
+	switch kind {
+	case ruleSetKind:
+	case targetPolicyKind:
+		spec, _ := object["spec"].(map[string]interface{})
+		if networks, exists := spec["networks"].([]interface{}); exists && from != apiVersion {
+			converted := make([]interface{}, len(networks))
+			for i, network := range networks {
+				var err error
+				if apiVersion == crdGroup+"/"+crdVersionBeta {
+					converted[i], err = networkPatternV1beta1(network)
+				} else {
+					converted[i], err = networkPatternV1alpha1(network)
+				}
+				if err != nil {
+					return fmt.Errorf("spec.networks[%d]: %w", i, err)
+				}
+			}
+			spec["networks"] = converted
+		}
+	default:
+		return fmt.Errorf("unsupported kind %q", kind)
+	}
+	object["apiVersion"] = apiVersion
+	return nil
+}
+
+func networkPatternV1beta1(network interface{}) (interface{}, error) {
+	pattern, ok := network.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected a string, got %T", network)
+	}
+	if namespace, name, found := strings.Cut(pattern, "/"); found {
+		return map[string]interface{}{"namespace": namespace, "name": name}, nil
+	}
+	return map[string]interface{}{"name": pattern}, nil
+}
+
+func networkPatternV1alpha1(network interface{}) (interface{}, error) {
+	pattern, ok := network.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected an object, got %T", network)
+	}
+	name, _ := pattern["name"].(string)
+	if namespace, _ := pattern["namespace"].(string); namespace != "" {
+		return namespace + "/" + name, nil
+	}
+	return name, nil
+}
+
+// conversionStrategy is the spec.conversion of the CRDs, which the API
+// server sends to /convert of the webhook Service.
+func conversionStrategy(o manifestOptions) map[string]interface{} {
+	return map[string]interface{}{
+		"strategy": "Webhook",
+		"webhook": map[string]interface{}{
+			"conversionReviewVersions": []string{"v1"},
+			"clientConfig": map[string]interface{}{
+				"service": map[string]interface{}{"name": o.name, "namespace": o.namespace, "path": "/convert", "port": 443},
+			},
+		},
+	}
+}
+
+// crdVersions renders both served versions of a CRD with the schema of
+// each, storing crdStorageVersion.
+func crdVersions(schemas map[string]map[string]interface{}) []interface{} {
+	var versions []interface{}
+	for _, version := range []string{crdVersionAlpha, crdVersionBeta} {
+		versions = append(versions, map[string]interface{}{
+			"name":    version,
+			"served":  true,
+			"storage": version == crdStorageVersion,
+			"schema":  map[string]interface{}{"openAPIV3Schema": schemas[version]},
+		})
+	}
+	return versions
+}
+
+// runMigrateStorage rewrites every GatewayYeetRuleSet and GatewayYeetPolicy
+// so the API server stores it in crdStorageVersion, then drops the older
+// versions from the storedVersions of the CRDs, after which v1alpha1 can
+// stop being served.
+func runMigrateStorage(args []string) int {
+	fs := flag.NewFlagSet("migrate-storage", flag.ContinueOnError)
+	kubeconfig := fs.String("kubeconfig", "", "Kubeconfig of the cluster (defaults to the in-cluster configuration)")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := kube.configure(*kubeconfig, nil); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	failed := false
+	for _, gvr := range []schema.GroupVersionResource{ruleSetGVR, targetPolicyGVR} {
+		migrated, installed, err := migrateStorage(context.Background(), gvr)
+		switch {
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "%s: %v\n", gvr.Resource, err)
+			failed = true
+		case !installed:
+			fmt.Printf("%s: CRD not installed, skipped\n", gvr.Resource)
+		default:
+			fmt.Printf("%s: %d object(s) stored as %s\n", gvr.Resource, migrated, crdStorageVersion)
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// migrateStorage updates every object of gvr unchanged, which makes the API
+// server write it in the storage version, and then records that version as
+// the only stored version of the CRD. It reports whether the CRD is
+// installed. Objects changed concurrently fail the migration, which can be
+// run again.
+func migrateStorage(ctx context.Context, gvr schema.GroupVersionResource) (int, bool, error) {
+	client, err := kube.dynamicFor(lookupMigration)
+	if err != nil {
+		return 0, false, err
+	}
+	crd, err := client.Resource(crdGVR).Get(ctx, gvr.Resource+"."+gvr.Group, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	list, err := client.Resource(gvr).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return 0, true, err
+	}
+	for _, item := range list.Items {
+		if _, err := client.Resource(gvr).Namespace(item.GetNamespace()).Update(ctx, &item, metav1.UpdateOptions{}); err != nil {
+			return 0, true, fmt.Errorf("%s: %w", strings.TrimPrefix(item.GetNamespace()+"/"+item.GetName(), "/"), err)
+		}
+	}
+	if err := unstructured.SetNestedStringSlice(crd.Object, []string{crdStorageVersion}, "status", "storedVersions"); err != nil {
+		return 0, true, err
+	}
+	if _, err := client.Resource(crdGVR).UpdateStatus(ctx, crd, metav1.UpdateOptions{}); err != nil {
+		return 0, true, fmt.Errorf("could not update storedVersions: %w", err)
+	}
+	return len(list.Items), true, nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestConvertTargetPolicy(t *testing.T) {
+	alpha := map[string]interface{}{
+		"apiVersion": "gateway.yeet/v1alpha1",
+		"kind":       targetPolicyKind,
+		"metadata":   map[string]interface{}{"namespace": "mtv", "name": "importers"},
+		"spec": map[string]interface{}{
+			"podType":  "cdi",
+			"networks": []interface{}{"transfer", "mtv-shared/transfer-*"},
+			"future":   "kept",
+		},
+	}
+	object, _ := runtime.DeepCopyJSONValue(alpha).(map[string]interface{})
+
+	if err := convertCustomResource(object, "gateway.yeet/v1beta1"); err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{
+		map[string]interface{}{"name": "transfer"},
+		map[string]interface{}{"namespace": "mtv-shared", "name": "transfer-*"},
+	}
+	spec := object["spec"].(map[string]interface{})
+	if object["apiVersion"] != "gateway.yeet/v1beta1" || !reflect.DeepEqual(spec["networks"], want) || spec["future"] != "kept" {
+		t.Fatalf("unexpected v1beta1 object %v", object)
+	}
+
+	if err := convertCustomResource(object, "gateway.yeet/v1alpha1"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(object, alpha) {
+		t.Fatalf("expected the round trip to restore %v, got %v", alpha, object)
+	}
+}
+
+func TestConvertCustomResourceErrors(t *testing.T) {
+	for name, c := range map[string]struct {
+		object     map[string]interface{}
+		apiVersion string
+	}{
+		"unknown kind":    {map[string]interface{}{"apiVersion": "gateway.yeet/v1alpha1", "kind": "Pod"}, "gateway.yeet/v1beta1"},
+		"unknown version": {map[string]interface{}{"apiVersion": "gateway.yeet/v1alpha1", "kind": ruleSetKind}, "gateway.yeet/v2"},
+		"bad network": {map[string]interface{}{
+			"apiVersion": "gateway.yeet/v1beta1", "kind": targetPolicyKind,
+			"spec": map[string]interface{}{"networks": []interface{}{"transfer"}},
+		}, "gateway.yeet/v1alpha1"},
+	} {
+		if err := convertCustomResource(c.object, c.apiVersion); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func convertRequest(t *testing.T, apiVersion string, objects ...map[string]interface{}) conversionReview {
+	review := conversionReview{APIVersion: conversionReviewAPIVersion, Kind: "ConversionReview", Request: &conversionRequest{UID: "test", DesiredAPIVersion: apiVersion}}
+	for _, object := range objects {
+		raw, _ := json.Marshal(object)
+		review.Request.Objects = append(review.Request.Objects, raw)
+	}
+	body, _ := json.Marshal(review)
+	w := httptest.NewRecorder()
+	handleConvert(w, httptest.NewRequest("POST", "/convert", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, w.Code)
+	}
+	var response conversionReview
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.Response == nil {
+		t.Fatalf("malformed response %s: %v", w.Body, err)
+	}
+	return response
+}
+
+func TestHandleConvert(t *testing.T) {
+	response := convertRequest(t, "gateway.yeet/v1beta1",
+		map[string]interface{}{"apiVersion": "gateway.yeet/v1alpha1", "kind": ruleSetKind, "spec": map[string]interface{}{"rules": []interface{}{}}},
+		map[string]interface{}{"apiVersion": "gateway.yeet/v1alpha1", "kind": targetPolicyKind, "spec": map[string]interface{}{"networks": []interface{}{"transfer"}}},
+	)
+	if response.Response.UID != "test" || response.Response.Result.Status != metav1.StatusSuccess || len(response.Response.ConvertedObjects) != 2 {
+		t.Fatalf("unexpected response %+v", response.Response)
+	}
+	for _, raw := range response.Response.ConvertedObjects {
+		var object map[string]interface{}
+		json.Unmarshal(raw, &object)
+		if object["apiVersion"] != "gateway.yeet/v1beta1" {
+			t.Fatalf("expected v1beta1, got %v", object)
+		}
+	}
+
+	response = convertRequest(t, "gateway.yeet/v1beta1",
+		map[string]interface{}{"apiVersion": "gateway.yeet/v1alpha1", "kind": ruleSetKind},
+		map[string]interface{}{"apiVersion": "gateway.yeet/v1alpha1", "kind": "Pod"},
+	)
+	if response.Response.Result.Status != metav1.StatusFailure || len(response.Response.ConvertedObjects) != 0 {
+		t.Fatalf("expected the request to fail as a whole, got %+v", response.Response)
+	}
+}
+
+func TestParseTargetPolicyV1alpha1(t *testing.T) {
+	withTargetPolicies(t)
+	policy := testTargetPolicy("test", "p", map[string]interface{}{
+		"podType":     "cdi",
+		"podSelector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "x"}},
+		"networks":    []interface{}{"shared/storage-*"},
+	})
+	policy.SetAPIVersion("gateway.yeet/v1alpha1")
+	target, err := parseTargetPolicy(*policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(target.networks, []string{"shared/storage-*"}) {
+		t.Fatalf("unexpected networks %v", target.networks)
+	}
+}
+
+func TestRenderManifestsConversion(t *testing.T) {
+	c := defaultConfig()
+	c.RulesPolicies, c.TargetPolicies = true, true
+	for _, object := range renderedObjects(t, c) {
+		if object["kind"] != "CustomResourceDefinition" {
+			continue
+		}
+		spec := object["spec"].(map[string]interface{})
+		var storage []string
+		for _, version := range spec["versions"].([]interface{}) {
+			if version := version.(map[string]interface{}); version["storage"] == true {
+				storage = append(storage, version["name"].(string))
+			}
+		}
+		if !reflect.DeepEqual(storage, []string{crdVersionBeta}) {
+			t.Errorf("expected %s to be stored, got %v", crdVersionBeta, storage)
+		}
+		conversion := spec["conversion"].(map[string]interface{})
+		service := conversion["webhook"].(map[string]interface{})["clientConfig"].(map[string]interface{})["service"].(map[string]interface{})
+		if conversion["strategy"] != "Webhook" || service["path"] != "/convert" || service["name"] != "gateway-yeeter" {
+			t.Errorf("unexpected conversion %v", conversion)
+		}
+	}
+}
+
+func TestMigrateStorage(t *testing.T) {
+	crd := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata":   map[string]interface{}{"name": "gatewayyeetpolicies.gateway.yeet"},
+		"status":     map[string]interface{}{"storedVersions": []interface{}{crdVersionAlpha, crdVersionBeta}},
+	}}
+	policy := testTargetPolicy("mtv", "importers", map[string]interface{}{"podType": "cdi"})
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		targetPolicyGVR: targetPolicyKind + "List",
+		ruleSetGVR:      ruleSetKind + "List",
+		crdGVR:          "CustomResourceDefinitionList",
+	}, crd, policy)
+	oldKube := kube
+	kube = &kubeClients{dynamic: map[lookupCategory]dynamic.Interface{lookupMigration: client}}
+	t.Cleanup(func() { kube = oldKube })
+
+	migrated, installed, err := migrateStorage(context.Background(), targetPolicyGVR)
+	if err != nil || !installed || migrated != 1 {
+		t.Fatalf("expected 1 migrated policy, got %d %v %v", migrated, installed, err)
+	}
+	crd, _ = client.Resource(crdGVR).Get(context.Background(), "gatewayyeetpolicies.gateway.yeet", metav1.GetOptions{})
+	if versions, _, _ := unstructured.NestedStringSlice(crd.Object, "status", "storedVersions"); !reflect.DeepEqual(versions, []string{crdVersionBeta}) {
+		t.Fatalf("expected only %s to be stored, got %v", crdVersionBeta, versions)
+	}
+
+	if _, installed, err := migrateStorage(context.Background(), ruleSetGVR); err != nil || installed {
+		t.Fatalf("expected the missing rule set CRD to be skipped, got %v %v", installed, err)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	dashboardPanelWidth  = 12
+	dashboardPanelHeight = 8
+)
+
+type grafanaDashboard struct {
+	UID           string            `json:"uid"`
+	Title         string            `json:"title"`
+	Tags          []string          `json:"tags"`
+	SchemaVersion int               `json:"schemaVersion"`
+	Editable      bool              `json:"editable"`
+	Refresh       string            `json:"refresh"`
+	Time          grafanaTimeRange  `json:"time"`
+	Templating    grafanaTemplating `json:"templating"`
+	Panels        []grafanaPanel    `json:"panels"`
+}
+
+type grafanaTimeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type grafanaTemplating struct {
+	List []grafanaVariable `json:"list"`
+}
+
+type grafanaVariable struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	Type  string `json:"type"`
+	Query string `json:"query"`
+}
+
+type grafanaDatasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+type grafanaGridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type grafanaTarget struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat"`
+}
+
+type grafanaFieldConfig struct {
+	Defaults struct {
+		Unit string `json:"unit"`
+	} `json:"defaults"`
+}
+
+type grafanaPanel struct {
+	ID          int                `json:"id"`
+	Type        string             `json:"type"`
+	Title       string             `json:"title"`
+	Description string             `json:"description"`
+	Datasource  grafanaDatasource  `json:"datasource"`
+	GridPos     grafanaGridPos     `json:"gridPos"`
+	FieldConfig grafanaFieldConfig `json:"fieldConfig"`
+	Targets     []grafanaTarget    `json:"targets"`
+}
+
+// renderDashboard builds a Grafana dashboard with one panel per exported
+// metric. selector is added as label matchers to every query, for example
+// to pick a single deployment when several share a Prometheus.
+func renderDashboard(title, uid, selector string, defs []metricDefinition) grafanaDashboard {
+	defs = append([]metricDefinition(nil), defs...)
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+
+	dashboard := grafanaDashboard{
+		UID:           uid,
+		Title:         title,
+		Tags:          []string{"gateway-yeeter"},
+		SchemaVersion: 39,
+		Editable:      true,
+		Refresh:       "30s",
+		Time:          grafanaTimeRange{From: "now-6h", To: "now"},
+		Templating: grafanaTemplating{List: []grafanaVariable{
+			{Name: "datasource", Label: "Data source", Type: "datasource", Query: "prometheus"},
+		}},
+	}
+	for i, def := range defs {
+		panel := grafanaPanel{
+			ID:          i + 1,
+			Type:        "timeseries",
+			Title:       metricTitle(def.Name),
+			Description: def.Help,
+			Datasource:  grafanaDatasource{Type: "prometheus", UID: "${datasource}"},
+			GridPos: grafanaGridPos{
+				H: dashboardPanelHeight,
+				W: dashboardPanelWidth,
+				X: (i % 2) * dashboardPanelWidth,
+				Y: (i / 2) * dashboardPanelHeight,
+			},
+			Targets: metricTargets(def, selector),
+		}
+		panel.FieldConfig.Defaults.Unit = metricUnit(def)
+		dashboard.Panels = append(dashboard.Panels, panel)
+	}
+	return dashboard
+}
+
+func metricTargets(def metricDefinition, selector string) []grafanaTarget {
+	series := def.Name + "{" + selector + "}"
+	switch def.Type {
+	case metricCounter:
+		return []grafanaTarget{{
+			RefID:        "A",
+			Expr:         sumBy(def.Labels) + "(rate(" + series + "[$__rate_interval]))",
+			LegendFormat: metricLegend(def),
+		}}
+	case metricHistogram:
+		buckets := sumBy(append([]string{"le"}, def.Labels...)) + "(rate(" + def.Name + "_bucket{" + selector + "}[$__rate_interval]))"
+		var targets []grafanaTarget
+		for i, q := range []string{"0.5", "0.9", "0.99"} {
+			legend := "p" + strings.TrimPrefix(q, "0.")
+			if len(def.Labels) > 0 {
+				legend = metricLegend(def) + " " + legend
+			}
+			targets = append(targets, grafanaTarget{
+				RefID:        string(rune('A' + i)),
+				Expr:         "histogram_quantile(" + q + ", " + buckets + ")",
+				LegendFormat: legend,
+			})
+		}
+		return targets
+	default:
+		return []grafanaTarget{{
+			RefID:        "A",
+			Expr:         sumBy(def.Labels) + "(" + series + ")",
+			LegendFormat: metricLegend(def),
+		}}
+	}
+}
+
+func sumBy(labels []string) string {
+	if len(labels) == 0 {
+		return "sum "
+	}
+	return "sum by (" + strings.Join(labels, ", ") + ") "
+}
+
+func metricLegend(def metricDefinition) string {
+	if len(def.Labels) == 0 {
+		return metricTitle(def.Name)
+	}
+	parts := make([]string, len(def.Labels))
+	for i, label := range def.Labels {
+		parts[i] = "{{" + label + "}}"
+	}
+	return strings.Join(parts, " ")
+}
+
+func metricTitle(name string) string {
+	title := strings.TrimSuffix(strings.TrimPrefix(name, "gateway_yeeter_"), "_total")
+	title = strings.ReplaceAll(title, "_", " ")
+	return strings.ToUpper(title[:1]) + title[1:]
+}
+
+func metricUnit(def metricDefinition) string {
+	switch {
+	case strings.HasSuffix(def.Name, "_seconds"):
+		return "s"
+	case strings.HasSuffix(def.Name, "_bytes"):
+		return "bytes"
+	case def.Type == metricCounter:
+		return "ops"
+	}
+	return "short"
+}
+
+func runExportDashboard(args []string) int {
+	fs := flag.NewFlagSet("export-dashboard", flag.ExitOnError)
+	title := fs.String("title", "Gateway YEETer", "Dashboard title")
+	uid := fs.String("uid", "gateway-yeeter", "Dashboard UID, keep it stable so imports replace the previous version")
+	selector := fs.String("selector", "", "Label matchers added to every query, e.g. namespace=\"openshift-mtv\"")
+	fs.Parse(args)
+
+	out, err := json.MarshalIndent(renderDashboard(*title, *uid, *selector, metricDefinitions), "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFindings
+	}
+	os.Stdout.Write(append(out, '\n'))
+	return exitOK
+}
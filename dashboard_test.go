@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDashboardCoversEveryMetric(t *testing.T) {
+	code, out := captureStdout(t, func() int { return runExportDashboard([]string{"--selector", `namespace="openshift-mtv"`}) })
+	if code != exitOK {
+		t.Fatalf("expected exit code %d, got %d", exitOK, code)
+	}
+	var dashboard grafanaDashboard
+	if err := json.Unmarshal(out, &dashboard); err != nil {
+		t.Fatal(err)
+	}
+	if dashboard.UID != "gateway-yeeter" || len(dashboard.Panels) != len(metricDefinitions) {
+		t.Fatalf("unexpected dashboard %s with %d panels", dashboard.UID, len(dashboard.Panels))
+	}
+
+	exprs := map[string]bool{}
+	for _, panel := range dashboard.Panels {
+		for _, target := range panel.Targets {
+			if !strings.Contains(target.Expr, `{namespace="openshift-mtv"}`) {
+				t.Fatalf("expected selector in %s", target.Expr)
+			}
+			exprs[target.Expr] = true
+		}
+	}
+	for _, def := range metricDefinitions {
+		found := false
+		for expr := range exprs {
+			if strings.Contains(expr, def.Name+"{") || strings.Contains(expr, def.Name+"_bucket{") {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("metric %s has no panel", def.Name)
+		}
+	}
+}
+
+func TestDashboardQueries(t *testing.T) {
+	dashboard := renderDashboard("t", "u", "", []metricDefinition{
+		{Name: "gateway_yeeter_admission_reviews_total", Type: metricCounter, Labels: []string{"pod_type", "outcome"}},
+		{Name: "gateway_yeeter_admission_review_duration_seconds", Type: metricHistogram},
+		{Name: "gateway_yeeter_open_connections", Type: metricGauge},
+	})
+
+	duration := dashboard.Panels[0]
+	if duration.FieldConfig.Defaults.Unit != "s" || len(duration.Targets) != 3 {
+		t.Fatalf("unexpected histogram panel %+v", duration)
+	}
+	if expr := duration.Targets[2].Expr; expr != "histogram_quantile(0.99, sum by (le) (rate(gateway_yeeter_admission_review_duration_seconds_bucket{}[$__rate_interval])))" {
+		t.Fatalf("unexpected histogram query %s", expr)
+	}
+
+	reviews := dashboard.Panels[1]
+	if reviews.Title != "Admission reviews" || reviews.Targets[0].LegendFormat != "{{pod_type}} {{outcome}}" {
+		t.Fatalf("unexpected counter panel %+v", reviews)
+	}
+	if expr := reviews.Targets[0].Expr; expr != "sum by (pod_type, outcome) (rate(gateway_yeeter_admission_reviews_total{}[$__rate_interval]))" {
+		t.Fatalf("unexpected counter query %s", expr)
+	}
+
+	if expr := dashboard.Panels[2].Targets[0].Expr; expr != "sum (gateway_yeeter_open_connections{})" {
+		t.Fatalf("unexpected gauge query %s", expr)
+	}
+	if panel := dashboard.Panels[2]; panel.GridPos.X != 0 || panel.GridPos.Y != dashboardPanelHeight {
+		t.Fatalf("unexpected grid position %+v", panel.GridPos)
+	}
+}
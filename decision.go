@@ -0,0 +1,213 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	outcomeMutated   = "mutated"
+	outcomeUnchanged = "unchanged"
+	outcomeSkipped   = "skipped"
+	outcomeError     = "error"
+	outcomeDenied    = "denied"
+)
+
+type networkChange struct {
+	Network         string   `json:"network"`
+	RemovedGateways []string `json:"removedGateways"`
+	SRIOVResource   string   `json:"sriovResource,omitempty"`
+	AddedRoutes     []string `json:"addedRoutes,omitempty"`
+}
+
+type decision struct {
+	Kind      string          `json:"kind"`
+	Time      time.Time       `json:"time"`
+	UID       string          `json:"uid"`
+	Namespace string          `json:"namespace"`
+	Pod       string          `json:"pod"`
+	PodType   string          `json:"podType,omitempty"`
+	Rule      string          `json:"rule,omitempty"`
+	Outcome   string          `json:"outcome"`
+	Reason    string          `json:"reason,omitempty"`
+	Mode      string          `json:"mode,omitempty"`
+	Message   string          `json:"message,omitempty"`
+	Networks  []networkChange `json:"networks,omitempty"`
+
+	RemovedAnnotations []string `json:"removedAnnotations,omitempty"`
+	Patch              string   `json:"patch,omitempty"`
+	RulesOutcome       string   `json:"rulesOutcome,omitempty"`
+	SkipReason         string   `json:"skipReason,omitempty"`
+
+	// ConfigHash, RulesHash (with rule sources) and WebhookGeneration (with
+	// a webhook configuration check) identify the policy in effect.
+	ConfigHash        string `json:"configHash,omitempty"`
+	RulesHash         string `json:"rulesHash,omitempty"`
+	WebhookGeneration int64  `json:"webhookGeneration,omitempty"`
+
+	// MatchedPodTypes and MatchedRules list every match when the
+	// classification was ambiguous; the first one was applied.
+	MatchedPodTypes []string `json:"matchedPodTypes,omitempty"`
+	MatchedRules    []string `json:"matchedRules,omitempty"`
+
+	PodContext *podContext `json:"podContext,omitempty"`
+
+	owner     *podOwner
+	user      authenticationv1.UserInfo
+	operation string
+	dryRun    bool
+	stages    *stageTimer
+}
+
+// decisionStore keeps the recent decisions served by /decisions and /stats.
+// The in-memory decisionLog is the default, --decision-store selects a
+// persistent backend.
+type decisionStore interface {
+	add(d *decision) error
+	list() []*decision
+	stats() decisionStats
+	close() error
+}
+
+type decisionLog struct {
+	mu      sync.Mutex
+	records []*decision
+	next    int
+	tally   *outcomeTally
+}
+
+type decisionStats struct {
+	Started  time.Time         `json:"started"`
+	Uptime   string            `json:"uptime"`
+	Total    uint64            `json:"total"`
+	Outcomes map[string]uint64 `json:"outcomes"`
+}
+
+// outcomeTally counts the decisions recorded since the process started,
+// whatever the store keeps across restarts.
+type outcomeTally struct {
+	mu       sync.Mutex
+	outcomes map[string]uint64
+	started  time.Time
+}
+
+var recentDecisions decisionStore = newDecisionLog(1000)
+
+func newOutcomeTally() *outcomeTally {
+	return &outcomeTally{outcomes: make(map[string]uint64), started: time.Now().UTC()}
+}
+
+func (t *outcomeTally) add(outcome string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.outcomes[outcome]++
+}
+
+func (t *outcomeTally) stats() decisionStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := decisionStats{
+		Started:  t.started,
+		Uptime:   time.Since(t.started).Round(time.Second).String(),
+		Outcomes: make(map[string]uint64, len(t.outcomes)),
+	}
+	for outcome, count := range t.outcomes {
+		s.Outcomes[outcome] = count
+		s.Total += count
+	}
+	return s
+}
+
+func newDecisionLog(capacity int) *decisionLog {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &decisionLog{
+		records: make([]*decision, 0, capacity),
+		tally:   newOutcomeTally(),
+	}
+}
+
+func (l *decisionLog) add(d *decision) error {
+	l.tally.add(d.Outcome)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.records) < cap(l.records) {
+		l.records = append(l.records, d)
+		return nil
+	}
+	l.records[l.next] = d
+	l.next = (l.next + 1) % len(l.records)
+	return nil
+}
+
+func (l *decisionLog) list() []*decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	out := make([]*decision, 0, len(l.records))
+	for i := len(l.records) - 1; i >= 0; i-- {
+		out = append(out, l.records[(l.next+i)%len(l.records)])
+	}
+	return out
+}
+
+func (l *decisionLog) stats() decisionStats {
+	return l.tally.stats()
+}
+
+func (l *decisionLog) close() error {
+	return nil
+}
+
+func newDecision(ar *admissionv1.AdmissionReview) *decision {
+	return &decision{
+		Kind:      "Decision",
+		Time:      time.Now().UTC(),
+		UID:       string(ar.Request.UID),
+		Namespace: ar.Request.Namespace,
+		user:      ar.Request.UserInfo,
+		operation: string(ar.Request.Operation),
+		dryRun:    ar.Request.DryRun != nil && *ar.Request.DryRun,
+	}
+}
+
+func recordDecision(d *decision) {
+	// Pass-through reviews applied nothing and are counted by passThrough.
+	if d.Mode == "" {
+		admissionReviews.WithLabelValues(d.PodType, d.Outcome, d.Reason).Inc()
+		if d.Rule != "" {
+			ruleDecisions.WithLabelValues(d.Rule, d.Outcome).Inc()
+		}
+	}
+	if d.SkipReason = skipReason(d); d.SkipReason != "" {
+		skippedReviews.WithLabelValues(d.PodType, d.SkipReason).Inc()
+	}
+	recordAmbiguity(d)
+	admissionReviewDuration.Observe(time.Since(d.Time).Seconds())
+	if err := recentDecisions.add(d); err != nil {
+		decisionStoreErrors.WithLabelValues("add").Inc()
+		klog.Errorf("Could not store decision for uid=%s: %v", d.UID, err)
+	}
+	liveDecisions.publish(d)
+	if err := auditor.write(cfg.Redaction.decision(channelAudit, d)); err != nil {
+		klog.Errorf("Could not write decision for uid=%s to audit log: %v", d.UID, err)
+	}
+	sinkRecord := cfg.Redaction.decision(channelSinks, d)
+	decisionExporter.enqueue(sinkRecord)
+	objectExporter.enqueue(sinkRecord)
+	statsd.decision(d)
+	if d.Mode == "" {
+		planSummaries.record(d)
+	}
+	mutationRates.record(d)
+	fleet.record(d)
+	denials.notify(d)
+	podEvents.record(d)
+}
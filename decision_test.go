@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	cnitypes "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/cni/types"
+)
+
+func TestReviewPodRecordsDecision(t *testing.T) {
+	var buf bytes.Buffer
+	auditor = &auditLog{w: &buf}
+	defer func() { auditor = nil }()
+
+	networksJSON, _ := json.Marshal([]cnitypes.NetworkSelectionElement{
+		{Namespace: "default", Name: "mtv-transfer", GatewayRequest: []net.IP{net.ParseIP("192.168.1.1")}},
+	})
+	rawPod, _ := json.Marshal(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "virt-v2v-test",
+			Namespace:   "test",
+			Labels:      map[string]string{"forklift.app": "virt-v2v"},
+			Annotations: map[string]string{"k8s.v1.cni.cncf.io/networks": string(networksJSON)},
+		},
+	})
+	reviewPod(&admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{UID: "test-decision", Object: runtime.RawExtension{Raw: rawPod}},
+	})
+
+	var d decision
+	if err := json.Unmarshal(buf.Bytes(), &d); err != nil {
+		t.Fatalf("failed to unmarshal decision: %v", err)
+	}
+	if d.Kind != "Decision" || d.UID != "test-decision" || d.Outcome != outcomeMutated {
+		t.Fatalf("unexpected decision: %+v", d)
+	}
+	if d.Namespace != "test" || d.Pod != "virt-v2v-test" || d.PodType != "virt-v2v" {
+		t.Fatalf("unexpected pod identity in decision: %+v", d)
+	}
+	if len(d.Networks) != 1 || d.Networks[0].Network != "default/mtv-transfer" || d.Networks[0].RemovedGateways[0] != "192.168.1.1" {
+		t.Fatalf("unexpected network changes in decision: %+v", d.Networks)
+	}
+}
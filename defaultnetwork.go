@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+)
+
+// defaultNetworkAnnotation replaces the cluster default network of a pod.
+// Multus accepts a network name or a JSON list of selection elements, only
+// the latter can request a gateway.
+const defaultNetworkAnnotation = "v1.multus-cni.io/default-network"
+
+// yeetDefaultNetwork removes the gateway requests of the target networks in
+// the default-network annotation, except those within --keep-gateway-cidrs.
+// Annotations naming the network without selection elements are returned
+// unchanged.
+func yeetDefaultNetwork(annotation, podNamespace string, target targetPod) (string, []networkChange, error) {
+	if !strings.HasPrefix(strings.TrimSpace(annotation), "[") {
+		return annotation, nil, nil
+	}
+	networks, err := parseNetworks(annotation)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var changes []networkChange
+	for i := range networks {
+		remove, keep := splitGateways(networks[i].GatewayRequest)
+		if len(remove) == 0 || !target.targetsNetwork(attachmentNamespace(networks[i].Namespace, podNamespace), networks[i].Name) {
+			continue
+		}
+		change := networkChange{Network: networks[i].Namespace + "/" + networks[i].Name}
+		for _, gw := range remove {
+			change.RemovedGateways = append(change.RemovedGateways, gw.String())
+		}
+		changes = append(changes, change)
+		networks[i].GatewayRequest = keep
+	}
+	if len(changes) == 0 {
+		return annotation, nil, nil
+	}
+	modified, err := marshalNetworks(annotation, networks)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(modified), changes, nil
+}
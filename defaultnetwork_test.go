@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestYeetDefaultNetwork(t *testing.T) {
+	if modified, changes, err := yeetDefaultNetwork("mtv/transfer", "mtv", targetPod{}); err != nil || modified != "mtv/transfer" || changes != nil {
+		t.Fatalf("expected a network name to be left alone, got %q %v %v", modified, changes, err)
+	}
+
+	annotation := `[{"name":"transfer","namespace":"mtv","default-route":["10.0.0.1"]}]`
+	if _, changes, err := yeetDefaultNetwork(annotation, "mtv", targetPod{networks: []string{"storage"}}); err != nil || changes != nil {
+		t.Fatalf("expected networks that are not targeted to be kept, got %v %v", changes, err)
+	}
+	modified, changes, err := yeetDefaultNetwork(annotation, "mtv", targetPod{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	networks, _ := parseNetworks(modified)
+	if len(changes) != 1 || changes[0].Network != "mtv/transfer" || changes[0].RemovedGateways[0] != "10.0.0.1" || len(networks[0].GatewayRequest) != 0 {
+		t.Fatalf("unexpected result %s %+v", modified, changes)
+	}
+}
+
+func TestReviewPodDefaultNetwork(t *testing.T) {
+	raw, _ := json.Marshal(corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:        "importer-test",
+		Namespace:   "test",
+		Labels:      map[string]string{"app": "containerized-data-importer"},
+		Annotations: map[string]string{defaultNetworkAnnotation: `[{"name":"transfer","default-route":["10.0.0.1"]}]`},
+	}})
+	resp := reviewPod(&admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{
+		UID:       "default-network",
+		Operation: admissionv1.Create,
+		Object:    runtime.RawExtension{Raw: raw},
+	}})
+
+	var patches []patch
+	json.Unmarshal(resp.Patch, &patches)
+	if len(patches) != 1 || patches[0].Path != "/metadata/annotations/v1.multus-cni.io~1default-network" {
+		t.Fatalf("expected a default-network patch, got %s", resp.Patch)
+	}
+	networks, _ := parseNetworks(patches[0].Value.(string))
+	if len(networks) != 1 || len(networks[0].GatewayRequest) != 0 {
+		t.Fatalf("expected the gateway to be removed, got %v", patches[0].Value)
+	}
+}
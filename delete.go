@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/prometheus/client_golang/prometheus"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+var deletedTargetPods = newCounterVec(prometheus.CounterOpts{
+	Name: "gateway_yeeter_deleted_pods_total",
+	Help: "DELETE admissions of target pods, by pod type and whether the networks annotation still requested a default-route.",
+}, "pod_type", "default_route")
+
+// reviewDelete admits a DELETE. The API server sends no object, only the
+// deleted pod as the old object, which is used for metrics: a target pod
+// that still requests a default-route was never stripped.
+func reviewDelete(ar *admissionv1.AdmissionReview, d *decision) *admissionv1.AdmissionResponse {
+	d.Pod = ar.Request.Name
+	d.Outcome, d.Reason, d.Message = outcomeSkipped, reasonSkipDelete, "delete admission"
+
+	var pod corev1.Pod
+	if len(bytes.TrimSpace(ar.Request.OldObject.Raw)) == 0 || json.Unmarshal(ar.Request.OldObject.Raw, &pod) != nil {
+		return &admissionv1.AdmissionResponse{Allowed: true}
+	}
+	targets := podTargets(d.Namespace, pod.Labels)
+	if len(targets) == 0 {
+		return &admissionv1.AdmissionResponse{Allowed: true}
+	}
+	d.PodType = targets[0].name
+	defaultRoute := "false"
+	if annotation := pod.Annotations["k8s.v1.cni.cncf.io/networks"]; annotation != "" {
+		if networks, err := parseNetworks(annotation); err == nil {
+			for _, network := range networks {
+				if len(network.GatewayRequest) > 0 {
+					defaultRoute = "true"
+				}
+			}
+		}
+	}
+	deletedTargetPods.WithLabelValues(d.PodType, defaultRoute).Inc()
+	klog.V(2).Infof("Admitting deletion of %s pod %s/%s (uid=%s), default-route requested: %s", d.PodType, cfg.Redaction.value(channelLogs, fieldNamespace, d.Namespace), cfg.Redaction.value(channelLogs, fieldPod, d.Pod), ar.Request.UID, defaultRoute)
+	return &admissionv1.AdmissionResponse{Allowed: true}
+}
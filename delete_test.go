@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+func testDeleteReview(namespace, networks string) *admissionv1.AdmissionReview {
+	ar := testImporterReview(namespace, networks)
+	ar.Request.Operation, ar.Request.Name = admissionv1.Delete, "importer-test"
+	ar.Request.OldObject, ar.Request.Object.Raw = ar.Request.Object, nil
+	return ar
+}
+
+func evaluateReview(ar *admissionv1.AdmissionReview) (*admissionv1.AdmissionResponse, *decision) {
+	d := newDecision(ar)
+	return evaluatePod(ar, d, nil), d
+}
+
+func TestReviewDelete(t *testing.T) {
+	for _, tt := range []struct {
+		networks     string
+		defaultRoute string
+	}{
+		{`[{"name":"transfer","default-route":["10.0.0.1"]}]`, "true"},
+		{`[{"name":"transfer"}]`, "false"},
+		{`not json`, "false"},
+	} {
+		before := testutil.ToFloat64(deletedTargetPods.WithLabelValues("cdi", tt.defaultRoute))
+		resp, d := evaluateReview(testDeleteReview("test", tt.networks))
+		if !resp.Allowed || len(resp.Patch) != 0 || d.Outcome != outcomeSkipped || d.Reason != reasonSkipDelete || d.PodType != "cdi" || d.Pod != "importer-test" {
+			t.Fatalf("%s: expected the deletion to be admitted, got %+v %+v", tt.networks, resp, d)
+		}
+		if after := testutil.ToFloat64(deletedTargetPods.WithLabelValues("cdi", tt.defaultRoute)); after != before+1 {
+			t.Fatalf("%s: expected the deletion to be counted with default_route=%s", tt.networks, tt.defaultRoute)
+		}
+	}
+
+	ar := testDeleteReview("test", "")
+	ar.Request.OldObject.Raw = nil
+	if resp, d := evaluateReview(ar); !resp.Allowed || d.Reason != reasonSkipDelete || d.Pod != "importer-test" {
+		t.Fatalf("expected a deletion without old object to be admitted, got %+v %+v", resp, d)
+	}
+}
+
+func TestHandleMutateDelete(t *testing.T) {
+	ar := testDeleteReview("test", `[{"name":"transfer","default-route":["10.0.0.1"]}]`)
+	ar.Request.Kind.Kind, ar.Request.Kind.Version = "Pod", "v1"
+	body, _ := json.Marshal(ar)
+	w := httptest.NewRecorder()
+	handleMutate(w, httptest.NewRequest("POST", "/mutate", bytes.NewReader(body)))
+
+	var review admissionv1.AdmissionReview
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &review) != nil || !review.Response.Allowed || review.Response.UID != "test" {
+		t.Fatalf("expected the deletion to be admitted, got %d %s", w.Code, w.Body.String())
+	}
+}
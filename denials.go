@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+)
+
+const (
+	denialRequestTimeout = 10 * time.Second
+	denialAttempts       = 3
+	denialMinBackoff     = time.Second
+)
+
+var denialNotifications = newCounterVec(prometheus.CounterOpts{
+	Name: "gateway_yeeter_denial_notifications_total",
+	Help: "Denial notifications handled by the denial webhook, by result (sent, failed, dropped).",
+}, "result")
+
+// denialNotification is the document posted to --denial-webhook for every
+// denied pod, so migration tooling can retry with a corrected network spec.
+type denialNotification struct {
+	Kind      string          `json:"kind"`
+	Time      time.Time       `json:"time"`
+	Cluster   string          `json:"cluster,omitempty"`
+	Reporter  string          `json:"reporter"`
+	UID       string          `json:"uid"`
+	Namespace string          `json:"namespace"`
+	Pod       string          `json:"pod"`
+	PodType   string          `json:"podType,omitempty"`
+	Plan      string          `json:"plan,omitempty"`
+	Rule      string          `json:"rule,omitempty"`
+	Reason    string          `json:"reason"`
+	Message   string          `json:"message"`
+	Networks  []networkChange `json:"networks,omitempty"`
+
+	// Decision is the redacted decision record, for --denial-webhook-template.
+	Decision *decision `json:"-"`
+}
+
+// denialNotifier posts denials to a webhook from a bounded queue. Admission
+// never waits for the webhook, notifications are dropped when the queue is
+// full and given up after a few attempts.
+type denialNotifier struct {
+	url         string
+	cluster     string
+	headers     map[string]string
+	contentType string
+	template    *template.Template
+	client      *http.Client
+	queue       chan denialNotification
+	backoff     time.Duration
+}
+
+var denials *denialNotifier
+
+func newDenialNotifier(c config) (*denialNotifier, error) {
+	if c.DenialWebhook == "" {
+		return nil, nil
+	}
+	client, err := c.DenialWebhookTLS.httpClient(denialRequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	headers := make(map[string]string, len(c.DenialWebhookHeaders))
+	for _, header := range c.DenialWebhookHeaders {
+		key, value, _ := strings.Cut(header, "=")
+		headers[key] = value
+	}
+	var tmpl *template.Template
+	if c.DenialWebhookTemplate != "" {
+		if tmpl, err = loadNotificationTemplate(c.DenialWebhookTemplate); err != nil {
+			return nil, err
+		}
+	}
+	return &denialNotifier{
+		url:         c.DenialWebhook,
+		cluster:     c.ClusterName,
+		headers:     headers,
+		contentType: c.DenialWebhookContentType,
+		template:    tmpl,
+		client:      client,
+		queue:       make(chan denialNotification, c.DenialWebhookQueue),
+		backoff:     denialMinBackoff,
+	}, nil
+}
+
+// notify queues a notification for a denied pod. Pass-through decisions did
+// not deny anything and are not notified.
+func (n *denialNotifier) notify(d *decision) {
+	if n == nil || d.Outcome != outcomeDenied || d.Mode != "" {
+		return
+	}
+	r := cfg.Redaction.decision(channelSinks, d)
+	notification := denialNotification{
+		Kind:      "AdmissionDenial",
+		Time:      r.Time,
+		Cluster:   n.cluster,
+		Reporter:  identity.String(),
+		UID:       r.UID,
+		Namespace: r.Namespace,
+		Pod:       r.Pod,
+		PodType:   r.PodType,
+		Rule:      r.Rule,
+		Reason:    r.Reason,
+		Message:   r.Message,
+		Networks:  r.Networks,
+		Decision:  r,
+	}
+	if d.owner != nil {
+		notification.Plan = d.owner.planUID
+	}
+	select {
+	case n.queue <- notification:
+	default:
+		denialNotifications.WithLabelValues("dropped").Inc()
+		klog.Warningf("Denial webhook queue is full, dropping notification for uid=%s", d.UID)
+	}
+}
+
+func (n *denialNotifier) run() {
+	if n == nil {
+		return
+	}
+	for notification := range n.queue {
+		n.deliver(notification)
+	}
+}
+
+func (n *denialNotifier) deliver(notification denialNotification) {
+	body, err := n.render(notification)
+	if err != nil {
+		denialNotifications.WithLabelValues("failed").Inc()
+		klog.Errorf("Could not render denial notification for uid=%s: %v", notification.UID, err)
+		return
+	}
+	backoff := n.backoff
+	for attempt := 1; ; attempt++ {
+		err := n.send(body)
+		if err == nil {
+			denialNotifications.WithLabelValues("sent").Inc()
+			klog.V(2).Infof("Sent denial notification for uid=%s", notification.UID)
+			return
+		}
+		if attempt == denialAttempts {
+			denialNotifications.WithLabelValues("failed").Inc()
+			klog.Errorf("Could not send denial notification for uid=%s after %d attempts: %v", notification.UID, attempt, err)
+			return
+		}
+		klog.Warningf("Could not send denial notification for uid=%s, retrying in %s: %v", notification.UID, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// render returns the notification as JSON, or rendered with
+// --denial-webhook-template.
+func (n *denialNotifier) render(notification denialNotification) ([]byte, error) {
+	if n.template == nil {
+		return json.Marshal(notification)
+	}
+	return renderNotification(n.template, notification)
+}
+
+func (n *denialNotifier) send(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	contentType := n.contentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
+	for key, value := range n.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("denial webhook responded with %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDenialNotifier(t *testing.T) {
+	var notifications []denialNotification
+	var auth string
+	failures := 1
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		auth = r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		var n denialNotification
+		json.Unmarshal(body, &n)
+		notifications = append(notifications, n)
+	}))
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o600)
+	c := defaultConfig()
+	c.ClusterName = "east"
+	c.DenialWebhook = srv.URL + "/denials"
+	c.DenialWebhookHeaders = stringList{"Authorization=Bearer token"}
+	c.DenialWebhookQueue = 2
+	c.DenialWebhookTLS.CAFile = caFile
+
+	n, err := newDenialNotifier(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.backoff = time.Millisecond
+	networks := []networkChange{{Network: "mtv/transfer", RemovedGateways: []string{"10.0.0.1"}}}
+	n.notify(&decision{UID: "1", Namespace: "mtv", Pod: "importer", Outcome: outcomeMutated})
+	n.notify(&decision{UID: "2", Namespace: "mtv", Pod: "importer", Outcome: outcomeDenied, Mode: modeShadow, Reason: reasonDenyRule})
+	n.notify(&decision{UID: "3", Namespace: "mtv", Pod: "importer", Outcome: outcomeDenied, Reason: reasonDenyRule, Rule: "platform", Message: "use the transfer network without a gateway", Networks: networks, owner: &podOwner{planUID: "plan-1"}})
+	n.notify(&decision{UID: "4", Namespace: "mtv", Pod: "v2v", Outcome: outcomeDenied, Reason: reasonDenySRIOV})
+	n.notify(&decision{UID: "5", Namespace: "mtv", Pod: "v2v", Outcome: outcomeDenied, Reason: reasonDenySRIOV})
+	if len(n.queue) != 2 {
+		t.Fatalf("expected two queued notifications, got %d", len(n.queue))
+	}
+
+	close(n.queue)
+	n.run()
+	if len(notifications) != 2 || auth != "Bearer token" {
+		t.Fatalf("expected two authenticated notifications, got %+v (auth %q)", notifications, auth)
+	}
+	got := notifications[0]
+	if got.Kind != "AdmissionDenial" || got.Cluster != "east" || got.UID != "3" || got.Reason != reasonDenyRule || got.Rule != "platform" || got.Plan != "plan-1" || len(got.Networks) != 1 {
+		t.Fatalf("unexpected notification %+v", got)
+	}
+	if notifications[1].UID != "4" {
+		t.Fatalf("expected notification of uid 4, got %+v", notifications[1])
+	}
+}
+
+func TestDenialNotifierGivesUp(t *testing.T) {
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	n := &denialNotifier{url: srv.URL, client: srv.Client(), backoff: time.Millisecond}
+	n.deliver(denialNotification{UID: "1"})
+	if attempts != denialAttempts {
+		t.Fatalf("expected %d attempts, got %d", denialAttempts, attempts)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// dumpDecisions is the number of most recent decisions in a state dump,
+// newest first.
+const dumpDecisions = 100
+
+// stateDump is everything support needs to understand the webhook's
+// behavior, for environments where only logs end up in support bundles.
+type stateDump struct {
+	Time      time.Time        `json:"time"`
+	Trigger   string           `json:"trigger"`
+	Identity  instanceIdentity `json:"identity"`
+	Hash      string           `json:"hash"`
+	Config    config           `json:"config"`
+	Rules     mergedRules      `json:"rules"`
+	Targets   []string         `json:"targets"`
+	Caches    map[string]int   `json:"caches"`
+	Stats     decisionStats    `json:"stats"`
+	Decisions []*decision      `json:"decisions"`
+}
+
+func newStateDump(trigger string) stateDump {
+	dump := stateDump{
+		Time:     time.Now().UTC(),
+		Trigger:  trigger,
+		Identity: identity,
+		Hash:     cfg.hash(),
+		Config:   cfg.redacted(),
+		Rules:    ruleSources.view(),
+		Caches:   cacheSizes(),
+		Stats:    recentDecisions.stats(),
+	}
+	for _, target := range targetPolicies.current() {
+		dump.Targets = append(dump.Targets, target.name)
+	}
+	records := recentDecisions.list()
+	if len(records) > dumpDecisions {
+		records = records[:dumpDecisions]
+	}
+	for _, d := range records {
+		dump.Decisions = append(dump.Decisions, cfg.Redaction.decision(channelLogs, d))
+	}
+	return dump
+}
+
+// cacheSizes returns the number of entries of the lookup caches.
+func cacheSizes() map[string]int {
+	sizes := map[string]int{}
+
+	nads.mu.Lock()
+	sizes["nads"] = len(nads.entries)
+	nads.mu.Unlock()
+
+	admin.mu.Lock()
+	sizes["adminTokens"] = len(admin.tokens)
+	admin.mu.Unlock()
+
+	scopedPlans.mu.Lock()
+	sizes["scopedPlans"] = len(scopedPlans.uids)
+	scopedPlans.mu.Unlock()
+
+	sizes["classifications"] = classifications.size()
+	return sizes
+}
+
+// logStateDump writes the state dump as a single log line, so it cannot be
+// interleaved with other output.
+func logStateDump(trigger string) stateDump {
+	dump := newStateDump(trigger)
+	raw, err := json.Marshal(dump)
+	if err != nil {
+		klog.Errorf("Could not marshal state dump: %v", err)
+		return dump
+	}
+	klog.Infof("State dump: %s", raw)
+	return dump
+}
+
+// dumpStateOnSignal logs a state dump on every SIGQUIT. This replaces the
+// goroutine dump and exit of the Go runtime, goroutines are available from
+// /debug/pprof/goroutine instead.
+func dumpStateOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGQUIT)
+	for range signals {
+		logStateDump("SIGQUIT")
+	}
+}
+
+func handleDump(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, logStateDump("requested by "+requestPrincipal(r)))
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+)
+
+const (
+	esRequestTimeout  = 30 * time.Second
+	esMinBackoff      = time.Second
+	esMaxBackoff      = 5 * time.Minute
+	esDocumentIDBytes = 16
+)
+
+var esDocuments = newCounterVec(prometheus.CounterOpts{
+	Name: "gateway_yeeter_elasticsearch_documents_total",
+	Help: "Decision documents handled by the Elasticsearch exporter, by result (sent, rejected, dropped).",
+}, "result")
+
+var esBufferedBytes = newGauge(prometheus.GaugeOpts{
+	Name: "gateway_yeeter_elasticsearch_buffered_bytes",
+	Help: "Bytes of decision documents buffered on disk waiting to be sent to Elasticsearch.",
+})
+
+// esExporter ships decision records to an Elasticsearch or OpenSearch index
+// with the bulk API. Records are spooled first and sent segment by segment.
+type esExporter struct {
+	*spool
+	url    string
+	index  string
+	apiKey string
+	client *http.Client
+}
+
+var decisionExporter *esExporter
+
+func newESExporter(c config) (*esExporter, error) {
+	if c.ElasticsearchURL == "" {
+		return nil, nil
+	}
+	client, err := c.ElasticsearchTLS.httpClient(esRequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	e := &esExporter{
+		url:    strings.TrimSuffix(c.ElasticsearchURL, "/") + "/_bulk",
+		index:  c.ElasticsearchIndex,
+		client: client,
+	}
+	if c.ElasticsearchAPIKeyFile != "" {
+		key, err := os.ReadFile(c.ElasticsearchAPIKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		e.apiKey = strings.TrimSpace(string(key))
+	}
+	e.spool, err = newSpool("Elasticsearch", c.ElasticsearchBufferDir, c.ElasticsearchBatchSize, c.ElasticsearchMaxBufferBytes, esDocuments.WithLabelValues("dropped"), esBufferedBytes)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *esExporter) enqueue(record interface{}) {
+	if e == nil {
+		return
+	}
+	e.spool.enqueue(record)
+}
+
+func (e *esExporter) run(flushInterval time.Duration) {
+	if e == nil {
+		return
+	}
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	backoff := time.Duration(0)
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.wake:
+		}
+		if backoff > 0 {
+			time.Sleep(backoff)
+		}
+		if err := e.flush(); err != nil {
+			backoff = min(max(2*backoff, esMinBackoff), esMaxBackoff)
+			klog.Warningf("Could not export decisions to Elasticsearch, retrying in %s: %v", backoff, err)
+			continue
+		}
+		backoff = 0
+	}
+}
+
+// flush sends all spooled segments in order, stopping at the first one that
+// fails.
+func (e *esExporter) flush() error {
+	return e.drain(e.send)
+}
+
+type esBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+func (e *esExporter) send(segment string) error {
+	f, err := os.Open(segment)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var body bytes.Buffer
+	documents := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		// Deterministic IDs make resending a segment after a partial failure
+		// idempotent, already indexed documents are answered with 409.
+		sum := sha256.Sum256(line)
+		action, _ := json.Marshal(map[string]interface{}{"create": map[string]string{"_index": e.index, "_id": hex.EncodeToString(sum[:esDocumentIDBytes])}})
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(line)
+		body.WriteByte('\n')
+		documents++
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if documents == 0 {
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+e.apiKey)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bulk request failed with %s", resp.Status)
+	}
+
+	var bulk esBulkResponse
+	if err := json.Unmarshal(respBody, &bulk); err != nil {
+		return fmt.Errorf("malformed bulk response: %w", err)
+	}
+	sent, rejected := 0, 0
+	for _, item := range bulk.Items {
+		for _, result := range item {
+			switch {
+			case result.Status == http.StatusTooManyRequests || result.Status >= 500:
+				return fmt.Errorf("bulk item failed with status %d: %s", result.Status, result.Error.Reason)
+			case result.Status < 300 || result.Status == http.StatusConflict:
+				sent++
+			default:
+				rejected++
+				klog.Errorf("Elasticsearch rejected decision document with status %d: %s: %s", result.Status, result.Error.Type, result.Error.Reason)
+			}
+		}
+	}
+	esDocuments.WithLabelValues("sent").Add(float64(sent))
+	esDocuments.WithLabelValues("rejected").Add(float64(rejected))
+	return nil
+}
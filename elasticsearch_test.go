@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type fakeBulkServer struct {
+	mu        sync.Mutex
+	status    int
+	itemCode  int
+	requests  int
+	documents []map[string]interface{}
+	actions   []map[string]map[string]string
+	auth      string
+}
+
+func (f *fakeBulkServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests++
+	f.auth = r.Header.Get("Authorization")
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+		return
+	}
+	var items []interface{}
+	scanner := bufio.NewScanner(r.Body)
+	for scanner.Scan() {
+		var action map[string]map[string]string
+		json.Unmarshal(scanner.Bytes(), &action)
+		scanner.Scan()
+		var doc map[string]interface{}
+		json.Unmarshal(scanner.Bytes(), &doc)
+		f.actions = append(f.actions, action)
+		f.documents = append(f.documents, doc)
+		code := 201
+		if f.itemCode != 0 {
+			code = f.itemCode
+		}
+		items = append(items, map[string]interface{}{"create": map[string]interface{}{"status": code}})
+	}
+	writeJSON(w, map[string]interface{}{"errors": f.itemCode != 0, "items": items})
+}
+
+func newTestESExporter(t *testing.T, server *fakeBulkServer) *esExporter {
+	srv := httptest.NewTLSServer(server)
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o600)
+	keyFile := filepath.Join(dir, "api-key")
+	os.WriteFile(keyFile, []byte("c2VjcmV0\n"), 0o600)
+
+	c := defaultConfig()
+	c.ElasticsearchURL = srv.URL
+	c.ElasticsearchAPIKeyFile = keyFile
+	c.ElasticsearchBufferDir = filepath.Join(dir, "spool")
+	c.ElasticsearchBatchSize = 2
+	c.ElasticsearchTLS.CAFile = caFile
+
+	e, err := newESExporter(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestESExporterDisabled(t *testing.T) {
+	e, err := newESExporter(defaultConfig())
+	if err != nil || e != nil {
+		t.Fatalf("expected no exporter, got %v, %v", e, err)
+	}
+	e.enqueue(&decision{})
+}
+
+func TestESExporterFlush(t *testing.T) {
+	server := &fakeBulkServer{}
+	e := newTestESExporter(t, server)
+
+	for _, uid := range []string{"a", "b", "c"} {
+		e.enqueue(&decision{Kind: "Decision", UID: uid, Outcome: outcomeMutated})
+	}
+	if segments, _ := e.segments(); len(segments) != 1 {
+		t.Fatalf("expected one full segment, got %v", segments)
+	}
+	if err := e.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if server.requests != 2 || len(server.documents) != 3 {
+		t.Fatalf("expected 3 documents in 2 requests, got %d in %d", len(server.documents), server.requests)
+	}
+	if server.documents[2]["uid"] != "c" || server.actions[0]["create"]["_index"] != "gateway-yeeter-decisions" || server.actions[0]["create"]["_id"] == "" {
+		t.Fatalf("unexpected bulk request %+v %+v", server.actions, server.documents)
+	}
+	if server.auth != "ApiKey c2VjcmV0" {
+		t.Fatalf("unexpected authorization %q", server.auth)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(e.dir, "*")); len(matches) != 0 {
+		t.Fatalf("expected an empty spool, got %v", matches)
+	}
+}
+
+func TestESExporterRetainsOnFailure(t *testing.T) {
+	for _, server := range []*fakeBulkServer{{status: http.StatusServiceUnavailable}, {itemCode: http.StatusTooManyRequests}} {
+		e := newTestESExporter(t, server)
+		e.enqueue(&decision{UID: "a"})
+		if err := e.flush(); err == nil {
+			t.Fatal("expected the flush to fail")
+		}
+		if segments, _ := e.segments(); len(segments) != 1 {
+			t.Fatalf("expected the segment to be kept, got %v", segments)
+		}
+
+		server.status, server.itemCode = 0, 0
+		if err := e.flush(); err != nil {
+			t.Fatal(err)
+		}
+		if segments, _ := e.segments(); len(segments) != 0 {
+			t.Fatalf("expected the segment to be sent, got %v", segments)
+		}
+	}
+}
+
+func TestESExporterResumesSpool(t *testing.T) {
+	server := &fakeBulkServer{}
+	e := newTestESExporter(t, server)
+	e.enqueue(&decision{UID: "left-behind"})
+
+	c := defaultConfig()
+	c.ElasticsearchURL = strings.TrimSuffix(e.url, "/_bulk")
+	c.ElasticsearchBufferDir = e.dir
+	c.ElasticsearchBatchSize = 2
+	resumed, err := newESExporter(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if segments, _ := resumed.segments(); len(segments) != 1 {
+		t.Fatalf("expected the previous spool to become a segment, got %v", segments)
+	}
+}
+
+func TestESExporterBufferLimit(t *testing.T) {
+	e := newTestESExporter(t, &fakeBulkServer{})
+	e.maxBufferBytes = 1
+	for _, uid := range []string{"a", "b", "c", "d"} {
+		e.enqueue(&decision{UID: uid})
+	}
+	e.enforceBufferLimit()
+	if segments, _ := e.segments(); len(segments) != 0 {
+		t.Fatalf("expected segments beyond the limit to be dropped, got %v", segments)
+	}
+}
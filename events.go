@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+const (
+	eventReasonGatewayRemoved = "GatewayRemoved"
+	eventQueueSize            = 1000
+	eventWriteTimeout         = 10 * time.Second
+
+	// podEventDelay gives the API server time to persist the pod after
+	// admission, its UID is only known then.
+	podEventDelay = 2 * time.Second
+	// podEventMatchWindow bounds how long after admission a pod with a
+	// generated name may have been created to match.
+	podEventMatchWindow = time.Minute
+	podEventClockSkew   = 5 * time.Second
+
+	eventAggregateMaxEvents = 10
+	eventAggregateInterval  = 10 * time.Minute
+)
+
+// eventCorrelation aggregates GatewayRemoved Events across the pods of a
+// namespace. The client-go default keys aggregation and rate limiting on the
+// involved object, while a migration wave mutates hundreds of pods once
+// each. Once eventAggregateMaxEvents pods of a namespace got an Event within
+// eventAggregateInterval, further pods only increment the count of one
+// combined Event.
+var eventCorrelation = record.CorrelatorOptions{
+	KeyFunc: func(event *corev1.Event) (string, string) {
+		return strings.Join([]string{event.Source.Component, event.InvolvedObject.Namespace, event.InvolvedObject.Kind, event.Type, event.Reason}, "/"), string(event.InvolvedObject.UID)
+	},
+	MessageFunc: func(event *corev1.Event) string {
+		return "(combined from similar events): removed default-route gateways from more pods in this namespace"
+	},
+	MaxEvents:            eventAggregateMaxEvents,
+	MaxIntervalInSeconds: int(eventAggregateInterval / time.Second),
+}
+
+var podEventsDropped = newCounterVec(prometheus.CounterOpts{
+	Name: "gateway_yeeter_pod_events_dropped_total",
+	Help: "GatewayRemoved Events that were not emitted, by reason (queue_full, pod_not_found, error).",
+}, "reason")
+
+type pendingEvent struct {
+	time      time.Time
+	namespace string
+	// pod is the name of the pod, or the generateName prefix with
+	// generated set, in which case owner is the UID of its controller.
+	pod       string
+	generated bool
+	owner     types.UID
+	message   string
+}
+
+// eventEmitter posts a GatewayRemoved Event on every mutated pod, so
+// kubectl describe pod explains the missing default route. Events are
+// emitted in the background after admission through an EventBroadcaster
+// using eventCorrelation.
+type eventEmitter struct {
+	queue    chan pendingEvent
+	recorder record.EventRecorder
+	delay    time.Duration
+
+	// emitted remembers the pods that got an Event, so a pod with a
+	// generated name is not matched by two of them.
+	emitted map[types.UID]time.Time
+}
+
+var podEvents *eventEmitter
+
+func newEventEmitter() (*eventEmitter, error) {
+	client, err := kube.typedFor(lookupEvent)
+	if err != nil {
+		return nil, err
+	}
+	broadcaster := record.NewBroadcaster(record.WithCorrelatorOptions(eventCorrelation))
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	return &eventEmitter{
+		queue:    make(chan pendingEvent, eventQueueSize),
+		recorder: broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "gateway-yeeter"}),
+		delay:    podEventDelay,
+		emitted:  make(map[types.UID]time.Time),
+	}, nil
+}
+
+func (e *eventEmitter) record(d *decision) {
+	if e == nil || d.Outcome != outcomeMutated || d.Mode != "" || d.dryRun || d.operation != string(admissionv1.Create) {
+		return
+	}
+	var removed []string
+	for _, network := range d.Networks {
+		if len(network.RemovedGateways) > 0 {
+			removed = append(removed, fmt.Sprintf("%s from network %s", cfg.Redaction.value(channelEvents, fieldGateways, strings.Join(network.RemovedGateways, ", ")), cfg.Redaction.value(channelEvents, fieldNetworks, network.Network)))
+		}
+	}
+	if len(removed) == 0 {
+		return
+	}
+	event := pendingEvent{time: d.Time, namespace: d.Namespace, pod: d.Pod, message: "Removed default-route gateway " + strings.Join(removed, "; ")}
+	if prefix, generated := strings.CutSuffix(d.Pod, "<generated>"); generated {
+		event.pod, event.generated = prefix, true
+		if d.owner != nil {
+			event.owner = controllerUID(d.owner.refs)
+		}
+	}
+	select {
+	case e.queue <- event:
+	default:
+		podEventsDropped.WithLabelValues("queue_full").Inc()
+	}
+}
+
+func (e *eventEmitter) run() {
+	if e == nil {
+		return
+	}
+	for event := range e.queue {
+		time.Sleep(time.Until(event.time.Add(e.delay)))
+		// Everything admitted by now is emitted together, with one pod
+		// list per namespace.
+		batch := map[string][]pendingEvent{event.namespace: {event}}
+	drain:
+		for {
+			select {
+			case next := <-e.queue:
+				time.Sleep(time.Until(next.time.Add(e.delay)))
+				batch[next.namespace] = append(batch[next.namespace], next)
+			default:
+				break drain
+			}
+		}
+		for namespace, events := range batch {
+			if err := e.emit(namespace, events); err != nil {
+				podEventsDropped.WithLabelValues("error").Add(float64(len(events)))
+				klog.Warningf("Could not emit %d %s Event(s) in namespace %s: %v", len(events), eventReasonGatewayRemoved, cfg.Redaction.value(channelLogs, fieldNamespace, namespace), err)
+			}
+		}
+	}
+}
+
+// emit resolves the pods of events, which Events need the UID of to show up
+// in kubectl describe, and records the Events. Pods created with
+// generateName have no name at admission; they are matched by their
+// generateName, controller and creation time, oldest first.
+func (e *eventEmitter) emit(namespace string, events []pendingEvent) error {
+	client, err := kube.typedFor(lookupEvent)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), eventWriteTimeout)
+	defer cancel()
+	// A resourceVersion of 0 is served from the watch cache of the API
+	// server.
+	list, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{ResourceVersion: "0"})
+	if err != nil {
+		return err
+	}
+	pods := list.Items
+	sort.Slice(pods, func(i, j int) bool { return pods[i].CreationTimestamp.Before(&pods[j].CreationTimestamp) })
+
+	now := time.Now()
+	for uid, at := range e.emitted {
+		if now.Sub(at) > podEventMatchWindow {
+			delete(e.emitted, uid)
+		}
+	}
+	for _, event := range events {
+		pod := e.match(pods, event)
+		if pod == nil {
+			// Denied or removed by a later admission plugin.
+			podEventsDropped.WithLabelValues("pod_not_found").Inc()
+			continue
+		}
+		e.emitted[pod.UID] = now
+		e.recorder.Event(podReference(pod.Namespace, pod.Name, pod.UID), corev1.EventTypeNormal, eventReasonGatewayRemoved, event.message)
+	}
+	return nil
+}
+
+func (e *eventEmitter) match(pods []corev1.Pod, event pendingEvent) *corev1.Pod {
+	for i := range pods {
+		pod := &pods[i]
+		if _, emitted := e.emitted[pod.UID]; emitted {
+			continue
+		}
+		if !event.generated {
+			if pod.Name == event.pod {
+				return pod
+			}
+			continue
+		}
+		// Creation timestamps have a resolution of one second and come from
+		// the clock of the API server.
+		created := pod.CreationTimestamp.Time
+		if pod.GenerateName != event.pod || controllerUID(pod.OwnerReferences) != event.owner ||
+			created.Before(event.time.Add(-podEventClockSkew)) || created.After(event.time.Add(podEventMatchWindow)) {
+			continue
+		}
+		return pod
+	}
+	return nil
+}
+
+func podReference(namespace, name string, uid types.UID) *corev1.ObjectReference {
+	return &corev1.ObjectReference{APIVersion: "v1", Kind: "Pod", Namespace: namespace, Name: name, UID: uid}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func withFakeEventEmitter(t *testing.T, objects ...*corev1.Pod) (*eventEmitter, *record.FakeRecorder) {
+	client := fake.NewClientset()
+	for _, pod := range objects {
+		if err := client.Tracker().Add(pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := kube
+	kube = &kubeClients{typed: map[lookupCategory]kubernetes.Interface{lookupEvent: client}}
+	t.Cleanup(func() { kube = old })
+
+	recorder := record.NewFakeRecorder(10)
+	return &eventEmitter{queue: make(chan pendingEvent, 10), recorder: recorder, emitted: make(map[types.UID]time.Time)}, recorder
+}
+
+func TestEventEmitterRecord(t *testing.T) {
+	e, _ := withFakeEventEmitter(t)
+	mutated := func() *decision {
+		return &decision{Outcome: outcomeMutated, Namespace: "mtv", Pod: "importer-test", operation: "CREATE", Networks: []networkChange{
+			{Network: "mtv/transfer", RemovedGateways: []string{"10.0.0.1"}},
+			{Network: "mtv/storage"},
+			{Network: "mtv/backup", RemovedGateways: []string{"10.0.1.1", "fd00::1"}},
+		}}
+	}
+	e.record(mutated())
+	event := <-e.queue
+	if want := "Removed default-route gateway 10.0.0.1 from network mtv/transfer; 10.0.1.1, fd00::1 from network mtv/backup"; event.message != want {
+		t.Fatalf("expected %q, got %q", want, event.message)
+	}
+
+	for name, modify := range map[string]func(d *decision){
+		"unchanged": func(d *decision) { d.Outcome = outcomeUnchanged },
+		"shadow":    func(d *decision) { d.Mode = modeShadow },
+		"dry-run":   func(d *decision) { d.dryRun = true },
+		"update":    func(d *decision) { d.operation = "UPDATE" },
+		"no gws":    func(d *decision) { d.Networks = nil },
+	} {
+		d := mutated()
+		modify(d)
+		e.record(d)
+		if len(e.queue) != 0 {
+			t.Fatalf("%s: expected no Event", name)
+		}
+	}
+	var disabled *eventEmitter
+	disabled.record(mutated())
+}
+
+func TestEventEmitterRecordGeneratedName(t *testing.T) {
+	e, _ := withFakeEventEmitter(t)
+	controller := true
+	e.record(&decision{Outcome: outcomeMutated, Namespace: "mtv", Pod: "importer-<generated>", operation: "CREATE",
+		owner:    &podOwner{refs: []metav1.OwnerReference{{UID: "other"}, {UID: "pvc-uid", Controller: &controller}}},
+		Networks: []networkChange{{Network: "mtv/transfer", RemovedGateways: []string{"10.0.0.1"}}},
+	})
+	if event := <-e.queue; event.pod != "importer-" || !event.generated || event.owner != "pvc-uid" {
+		t.Fatalf("unexpected pending Event %+v", event)
+	}
+}
+
+func TestEventEmitterEmit(t *testing.T) {
+	now := time.Now()
+	controller := true
+	generatedPod := func(name string, owner types.UID, created time.Time) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "mtv", Name: name, GenerateName: "importer-", UID: types.UID(name + "-uid"),
+			CreationTimestamp: metav1.NewTime(created),
+			OwnerReferences:   []metav1.OwnerReference{{UID: owner, Controller: &controller}},
+		}}
+	}
+	e, recorder := withFakeEventEmitter(t,
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "mtv", Name: "virt-v2v-test", UID: "pod-uid", CreationTimestamp: metav1.NewTime(now)}},
+		generatedPod("importer-old", "pvc-uid", now.Add(-time.Hour)),
+		generatedPod("importer-other", "other-pvc", now),
+		generatedPod("importer-abcde", "pvc-uid", now.Add(time.Second)),
+	)
+	message := "Removed default-route gateway 10.0.0.1 from network mtv/transfer"
+
+	err := e.emit("mtv", []pendingEvent{
+		{time: now, namespace: "mtv", pod: "virt-v2v-test", message: message},
+		{time: now, namespace: "mtv", pod: "importer-", generated: true, owner: "pvc-uid", message: message},
+		// A second pod of the same owner was not created.
+		{time: now, namespace: "mtv", pod: "importer-", generated: true, owner: "pvc-uid", message: message},
+		{time: now, namespace: "mtv", pod: "denied", message: message},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if got := <-recorder.Events; got != "Normal GatewayRemoved "+message {
+			t.Fatalf("unexpected Event %q", got)
+		}
+	}
+	if len(recorder.Events) != 0 {
+		t.Fatalf("expected two Events, got %d more", len(recorder.Events))
+	}
+	if _, matched := e.emitted["importer-abcde-uid"]; !matched {
+		t.Fatalf("expected the generated pod of the owner to be matched, got %v", e.emitted)
+	}
+}
+
+func TestEventCorrelationAcrossPods(t *testing.T) {
+	correlator := record.NewEventCorrelatorWithOptions(eventCorrelation)
+	var created, patched int
+	for i := 0; i < 500; i++ {
+		name := fmt.Sprintf("importer-%d", i)
+		event := &corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: name + ".event", Namespace: "mtv"},
+			InvolvedObject: *podReference("mtv", name, types.UID(name)),
+			Source:         corev1.EventSource{Component: "gateway-yeeter"},
+			Type:           corev1.EventTypeNormal,
+			Reason:         eventReasonGatewayRemoved,
+			Message:        "Removed default-route gateway 10.0.0.1 from network mtv/transfer",
+		}
+		result, err := correlator.EventCorrelate(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Skip {
+			continue
+		}
+		if result.Patch != nil {
+			patched++
+		} else {
+			created++
+		}
+		correlator.UpdateState(result.Event)
+	}
+	if created != eventAggregateMaxEvents || patched != 500-eventAggregateMaxEvents {
+		t.Fatalf("expected %d Events and the rest counted on the combined one, got %d created, %d patched", eventAggregateMaxEvents, created, patched)
+	}
+}
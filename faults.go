@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+)
+
+const (
+	faultLatency    = "latency"
+	faultError      = "error"
+	faultTLSFailure = "tls"
+)
+
+var injectedFaults = newCounterVec(prometheus.CounterOpts{
+	Name: "gateway_yeeter_injected_faults_total",
+	Help: "Faults injected to test the failurePolicy and timeout of the webhook configuration, by fault.",
+}, "fault")
+
+type faultState struct {
+	Latency        string     `json:"latency,omitempty"`
+	ErrorRate      float64    `json:"errorRate,omitempty"`
+	TLSFailureRate float64    `json:"tlsFailureRate,omitempty"`
+	Actor          string     `json:"actor,omitempty"`
+	Until          *time.Time `json:"until,omitempty"`
+
+	latency time.Duration
+}
+
+func (s faultState) enabled() bool {
+	return s.latency > 0 || s.ErrorRate > 0 || s.TLSFailureRate > 0
+}
+
+type faultRecord struct {
+	Kind string    `json:"kind"`
+	Time time.Time `json:"time"`
+	faultState
+}
+
+// faultInjector delays or fails admission requests and TLS handshakes on
+// purpose, so admins can see how the API server reacts before relying on
+// the failurePolicy in production.
+type faultInjector struct {
+	mu     sync.Mutex
+	state  faultState
+	now    func() time.Time
+	random func() float64
+}
+
+var faults = &faultInjector{now: time.Now, random: rand.Float64}
+
+func (f *faultInjector) set(latency time.Duration, errorRate, tlsFailureRate float64, actor string, duration time.Duration) faultState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now().UTC()
+	f.state = faultState{ErrorRate: errorRate, TLSFailureRate: tlsFailureRate, Actor: actor, latency: latency}
+	if latency > 0 {
+		f.state.Latency = latency.String()
+	}
+	if f.state.enabled() && duration > 0 {
+		until := now.Add(duration)
+		f.state.Until = &until
+	}
+	f.changed(now)
+	return f.state
+}
+
+// current returns the state, ending fault injection once its duration passed.
+func (f *faultInjector) current() faultState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if now := f.now().UTC(); f.state.Until != nil && !now.Before(*f.state.Until) {
+		f.state = faultState{Actor: "gateway-yeeter"}
+		f.changed(now)
+	}
+	return f.state
+}
+
+func (f *faultInjector) changed(now time.Time) {
+	if f.state.enabled() {
+		until := "restart"
+		if f.state.Until != nil {
+			until = f.state.Until.Format(time.RFC3339)
+		}
+		klog.Warningf("Fault injection enabled by %s until %s: latency %s, error rate %v, TLS failure rate %v", f.state.Actor, until, f.state.latency, f.state.ErrorRate, f.state.TLSFailureRate)
+	} else {
+		klog.Warningf("Fault injection disabled by %s", f.state.Actor)
+	}
+	if err := auditor.write(faultRecord{Kind: "FaultInjectionChange", Time: now, faultState: f.state}); err != nil {
+		klog.Errorf("Could not write fault injection change to audit log: %v", err)
+	}
+}
+
+func (f *faultInjector) hit(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.random() < rate
+}
+
+// wrap injects latency and errors into admission requests.
+func (f *faultInjector) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := f.current()
+		if state.latency > 0 {
+			injectedFaults.WithLabelValues(faultLatency).Inc()
+			select {
+			case <-time.After(state.latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if f.hit(state.ErrorRate) {
+			injectedFaults.WithLabelValues(faultError).Inc()
+			klog.Warningf("Injecting an error into the admission request from %s", r.RemoteAddr)
+			http.Error(w, "injected fault", http.StatusInternalServerError)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// getConfigForClient fails TLS handshakes at the configured rate.
+func (f *faultInjector) getConfigForClient(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	if f.hit(f.current().TLSFailureRate) {
+		injectedFaults.WithLabelValues(faultTLSFailure).Inc()
+		return nil, errors.New("injected TLS handshake failure")
+	}
+	return nil, nil
+}
+
+type faultRequest struct {
+	Latency        string  `json:"latency,omitempty"`
+	ErrorRate      float64 `json:"errorRate,omitempty"`
+	TLSFailureRate float64 `json:"tlsFailureRate,omitempty"`
+	Duration       string  `json:"duration,omitempty"`
+}
+
+func handleFaults(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, faults.current())
+	case http.MethodPost:
+		var req faultRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+			http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		var latency, duration time.Duration
+		var err error
+		if req.Latency != "" {
+			if latency, err = time.ParseDuration(req.Latency); err != nil || latency < 0 {
+				http.Error(w, "invalid latency", http.StatusBadRequest)
+				return
+			}
+		}
+		if req.Duration != "" {
+			if duration, err = time.ParseDuration(req.Duration); err != nil || duration < 0 {
+				http.Error(w, "invalid duration", http.StatusBadRequest)
+				return
+			}
+		}
+		if req.ErrorRate < 0 || req.ErrorRate > 1 || req.TLSFailureRate < 0 || req.TLSFailureRate > 1 {
+			http.Error(w, "rates must be within [0, 1]", http.StatusBadRequest)
+			return
+		}
+		// TLS failures also lock out this endpoint, so faults set at runtime
+		// always end on their own.
+		if (latency > 0 || req.ErrorRate > 0 || req.TLSFailureRate > 0) && duration == 0 {
+			http.Error(w, "a duration is required to inject faults", http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, faults.set(latency, req.ErrorRate, req.TLSFailureRate, requestPrincipal(r), duration))
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func withFaults(t *testing.T, f *faultInjector) {
+	old := faults
+	faults = f
+	t.Cleanup(func() { faults = old })
+}
+
+func TestFaultInjection(t *testing.T) {
+	now := time.Now()
+	f := &faultInjector{now: func() time.Time { return now }, random: func() float64 { return 0.5 }}
+	handler := f.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	request := func() int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("POST", "/mutate", nil))
+		return w.Code
+	}
+
+	if code := request(); code != http.StatusOK {
+		t.Fatalf("expected no fault by default, got %d", code)
+	}
+	if _, err := f.getConfigForClient(nil); err != nil {
+		t.Fatalf("expected no TLS fault by default, got %v", err)
+	}
+
+	f.set(0, 0.6, 0.4, "ops", time.Minute)
+	if code := request(); code != http.StatusInternalServerError {
+		t.Fatalf("expected an injected error, got %d", code)
+	}
+	if _, err := f.getConfigForClient(nil); err != nil {
+		t.Fatalf("expected the TLS failure rate to be below the draw, got %v", err)
+	}
+
+	f.set(0, 0, 1, "ops", time.Minute)
+	if _, err := f.getConfigForClient(nil); err == nil {
+		t.Fatal("expected an injected TLS failure")
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := f.getConfigForClient(nil); err != nil || f.current().enabled() {
+		t.Fatalf("expected faults to expire, got %v", err)
+	}
+}
+
+func TestFaultLatency(t *testing.T) {
+	f := &faultInjector{now: time.Now, random: func() float64 { return 0 }}
+	f.set(50*time.Millisecond, 0, 0, "ops", time.Minute)
+	handler := f.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	start := time.Now()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/mutate", nil))
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("expected the request to be delayed, took %s", elapsed)
+	}
+}
+
+func TestFaultsEndpoint(t *testing.T) {
+	withFaults(t, &faultInjector{now: time.Now, random: func() float64 { return 0 }})
+	a := newAdminAuth(nil, []string{"ops"})
+	a.reviewToken = fakeTokenReview(map[string]*principal{"ops-token": {User: "ops"}})
+	withAdminAuth(t, a)
+	mux := http.NewServeMux()
+	registerAdminHandlers(mux)
+
+	post := func(body string) int {
+		req := httptest.NewRequest("POST", "/debug/faults", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer ops-token")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for _, body := range []string{`{"tlsFailureRate":0.5}`, `{"errorRate":2,"duration":"5m"}`, `{"latency":"soon","duration":"5m"}`} {
+		if code := post(body); code != http.StatusBadRequest {
+			t.Errorf("%s: expected bad request, got %d", body, code)
+		}
+	}
+	if code := post(`{"latency":"4s","errorRate":0.1,"duration":"5m"}`); code != http.StatusOK {
+		t.Fatalf("expected faults to be set, got %d", code)
+	}
+	if state := faults.current(); state.Latency != "4s" || state.ErrorRate != 0.1 || state.Actor != "ops" || state.Until == nil {
+		t.Fatalf("unexpected fault state %+v", state)
+	}
+	if code := post(`{}`); code != http.StatusOK || faults.current().enabled() {
+		t.Fatalf("expected faults to be cleared, got %d", code)
+	}
+}
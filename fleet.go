@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const fleetRequestTimeout = 10 * time.Second
+
+type namespaceSummary struct {
+	Namespace       string            `json:"namespace"`
+	Decisions       map[string]uint64 `json:"decisions"`
+	GatewaysRemoved uint64            `json:"gatewaysRemoved"`
+}
+
+// fleetReport is the document posted to the fleet collector. It covers the
+// decisions made between Start and End.
+type fleetReport struct {
+	Kind       string              `json:"kind"`
+	Cluster    string              `json:"cluster"`
+	Reporter   string              `json:"reporter"`
+	Start      time.Time           `json:"start"`
+	End        time.Time           `json:"end"`
+	Decisions  map[string]uint64   `json:"decisions"`
+	Namespaces []*namespaceSummary `json:"namespaces"`
+}
+
+// fleetExporter aggregates decisions per namespace and periodically ships
+// the summary to a central collector. Summaries that could not be delivered
+// are merged into the next report.
+type fleetExporter struct {
+	url     string
+	cluster string
+	headers map[string]string
+	client  *http.Client
+	now     func() time.Time
+
+	mu         sync.Mutex
+	start      time.Time
+	namespaces map[string]*namespaceSummary
+}
+
+var fleet *fleetExporter
+
+func newFleetExporter(c config) (*fleetExporter, error) {
+	if c.FleetCollector == "" {
+		return nil, nil
+	}
+	client, err := c.FleetTLS.httpClient(fleetRequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	headers := make(map[string]string, len(c.FleetHeaders))
+	for _, header := range c.FleetHeaders {
+		key, value, _ := strings.Cut(header, "=")
+		headers[key] = value
+	}
+	return &fleetExporter{
+		url:        c.FleetCollector,
+		cluster:    c.ClusterName,
+		headers:    headers,
+		client:     client,
+		now:        time.Now,
+		start:      time.Now().UTC(),
+		namespaces: make(map[string]*namespaceSummary),
+	}, nil
+}
+
+func (f *fleetExporter) record(d *decision) {
+	if f == nil || d.Mode != "" {
+		return
+	}
+	namespace := cfg.Redaction.value(channelSinks, fieldNamespace, d.Namespace)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, exists := f.namespaces[namespace]
+	if !exists {
+		s = &namespaceSummary{Namespace: namespace, Decisions: make(map[string]uint64)}
+		f.namespaces[namespace] = s
+	}
+	s.Decisions[d.Outcome]++
+	for _, n := range d.Networks {
+		s.GatewaysRemoved += uint64(len(n.RemovedGateways))
+	}
+}
+
+// take returns the report of the current period and starts a new one.
+func (f *fleetExporter) take() *fleetReport {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now().UTC()
+	report := &fleetReport{Kind: "GatewayEnforcementSummary", Cluster: f.cluster, Reporter: identity.String(), Start: f.start, End: now, Decisions: make(map[string]uint64), Namespaces: []*namespaceSummary{}}
+	for _, s := range f.namespaces {
+		report.Namespaces = append(report.Namespaces, s)
+		for outcome, count := range s.Decisions {
+			report.Decisions[outcome] += count
+		}
+	}
+	sort.Slice(report.Namespaces, func(i, j int) bool { return report.Namespaces[i].Namespace < report.Namespaces[j].Namespace })
+	f.start = now
+	f.namespaces = make(map[string]*namespaceSummary)
+	return report
+}
+
+// restore merges an undelivered report back into the current period.
+func (f *fleetExporter) restore(report *fleetReport) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.start = report.Start
+	for _, old := range report.Namespaces {
+		s, exists := f.namespaces[old.Namespace]
+		if !exists {
+			f.namespaces[old.Namespace] = old
+			continue
+		}
+		for outcome, count := range old.Decisions {
+			s.Decisions[outcome] += count
+		}
+		s.GatewaysRemoved += old.GatewaysRemoved
+	}
+}
+
+func (f *fleetExporter) run(interval time.Duration) {
+	if f == nil {
+		return
+	}
+	for range time.Tick(interval) {
+		if err := f.export(); err != nil {
+			klog.Warningf("Could not export decision summary to fleet collector: %v", err)
+		}
+	}
+}
+
+func (f *fleetExporter) export() error {
+	report := f.take()
+	if err := f.send(report); err != nil {
+		f.restore(report)
+		return err
+	}
+	klog.V(2).Infof("Exported decision summary of %d namespaces to fleet collector", len(report.Namespaces))
+	return nil
+}
+
+func (f *fleetExporter) send(report *fleetReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, f.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range f.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector responded with %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFleetExport(t *testing.T) {
+	var reports []fleetReport
+	var auth string
+	fail := true
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		auth = r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		var report fleetReport
+		json.Unmarshal(body, &report)
+		reports = append(reports, report)
+	}))
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o600)
+	c := defaultConfig()
+	c.ClusterName = "east"
+	c.FleetCollector = srv.URL + "/summaries"
+	c.FleetHeaders = stringList{"Authorization=Bearer token"}
+	c.FleetTLS.CAFile = caFile
+
+	f, err := newFleetExporter(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed := []networkChange{{Network: "transfer", RemovedGateways: []string{"10.0.0.1"}}}
+	f.record(&decision{Namespace: "mtv", Outcome: outcomeMutated, Networks: removed})
+	f.record(&decision{Namespace: "mtv", Outcome: outcomeMutated, Mode: modeShadow, Networks: removed})
+	if err := f.export(); err == nil {
+		t.Fatal("expected the export to fail")
+	}
+
+	fail = false
+	f.record(&decision{Namespace: "mtv", Outcome: outcomeMutated, Networks: removed})
+	f.record(&decision{Namespace: "other", Outcome: outcomeUnchanged})
+	if err := f.export(); err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || auth != "Bearer token" {
+		t.Fatalf("expected one authenticated report, got %+v (auth %q)", reports, auth)
+	}
+	r := reports[0]
+	if r.Cluster != "east" || r.Decisions[outcomeMutated] != 2 || r.Decisions[outcomeUnchanged] != 1 || len(r.Namespaces) != 2 {
+		t.Fatalf("expected undelivered decisions to be merged, got %+v", r)
+	}
+	if s := r.Namespaces[0]; s.Namespace != "mtv" || s.GatewaysRemoved != 2 {
+		t.Fatalf("unexpected namespace summary %+v", s)
+	}
+
+	if err := f.export(); err != nil || len(reports[1].Namespaces) != 0 || !reports[1].Start.Equal(r.End) {
+		t.Fatalf("expected an empty report for the next period, got %+v (%v)", reports[1], err)
+	}
+}
+
+func TestFleetExportRequiresClusterName(t *testing.T) {
+	c := defaultConfig()
+	c.FleetCollector = "https://collector.example.com"
+	if err := c.validate(); err == nil {
+		t.Fatal("expected a missing cluster name to be rejected")
+	}
+}
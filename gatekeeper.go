@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"k8s.io/klog/v2"
+)
+
+const gatekeeperAPIVersion = "externaldata.gatekeeper.sh/v1beta1"
+
+type providerRequest struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Request    struct {
+		Keys []string `json:"keys"`
+	} `json:"request"`
+}
+
+type providerItem struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value,omitempty"`
+	Error string      `json:"error,omitempty"`
+}
+
+type providerResult struct {
+	Idempotent  bool           `json:"idempotent"`
+	Items       []providerItem `json:"items"`
+	SystemError string         `json:"systemError,omitempty"`
+}
+
+type providerResponse struct {
+	APIVersion string         `json:"apiVersion"`
+	Kind       string         `json:"kind"`
+	Response   providerResult `json:"response"`
+}
+
+// defaultRouteLookup is the value returned for every key, a networks
+// annotation, so constraints can inspect the result with Rego.
+type defaultRouteLookup struct {
+	DefaultRoute bool     `json:"defaultRoute"`
+	Networks     []string `json:"networks,omitempty"`
+}
+
+func lookupDefaultRoutes(annotation string) (defaultRouteLookup, error) {
+	networks, err := parseNetworks(annotation)
+	if err != nil {
+		return defaultRouteLookup{}, err
+	}
+	var result defaultRouteLookup
+	for _, network := range networks {
+		if len(network.GatewayRequest) > 0 {
+			result.DefaultRoute = true
+			result.Networks = append(result.Networks, network.Namespace+"/"+network.Name)
+		}
+	}
+	return result, nil
+}
+
+func handleGatekeeperProvider(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := providerResponse{APIVersion: gatekeeperAPIVersion, Kind: "ProviderResponse"}
+	response.Response.Idempotent = true
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, cfg.MaxRequestBytes+1))
+	if err != nil {
+		klog.Errorf("Could not read external data request: %v", err)
+		http.Error(w, "could not read request", http.StatusBadRequest)
+		return
+	}
+	if int64(len(body)) > cfg.MaxRequestBytes {
+		response.Response.SystemError = "request body too large"
+		writeJSON(w, response)
+		return
+	}
+
+	var request providerRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		response.Response.SystemError = "malformed ProviderRequest: " + err.Error()
+		writeJSON(w, response)
+		return
+	}
+	if request.APIVersion != gatekeeperAPIVersion || request.Kind != "ProviderRequest" {
+		response.Response.SystemError = "expected " + gatekeeperAPIVersion + " ProviderRequest"
+		writeJSON(w, response)
+		return
+	}
+
+	response.Response.Items = make([]providerItem, 0, len(request.Request.Keys))
+	for _, key := range request.Request.Keys {
+		item := providerItem{Key: key}
+		if result, err := lookupDefaultRoutes(key); err != nil {
+			item.Error = "cannot parse networks annotation: " + err.Error()
+		} else {
+			item.Value = result
+		}
+		response.Response.Items = append(response.Response.Items, item)
+	}
+	klog.V(2).Infof("Answered external data request for %d key(s)", len(request.Request.Keys))
+	writeJSON(w, response)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func postProviderRequest(t *testing.T, body string) providerResponse {
+	rec := httptest.NewRecorder()
+	handleGatekeeperProvider(rec, httptest.NewRequest(http.MethodPost, "/gatekeeper/provider", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var response providerResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func TestGatekeeperProvider(t *testing.T) {
+	request, _ := json.Marshal(map[string]interface{}{
+		"apiVersion": gatekeeperAPIVersion,
+		"kind":       "ProviderRequest",
+		"request": map[string]interface{}{"keys": []string{
+			`[{"name":"transfer","namespace":"mtv","default-route":["10.0.0.1"]}]`,
+			`[{"name":"transfer"}]`,
+			`not json`,
+		}},
+	})
+
+	response := postProviderRequest(t, string(request))
+	if response.Kind != "ProviderResponse" || !response.Response.Idempotent || response.Response.SystemError != "" {
+		t.Fatalf("unexpected response %+v", response)
+	}
+	items := response.Response.Items
+	if len(items) != 3 {
+		t.Fatalf("expected 3 items, got %+v", items)
+	}
+	if value, _ := json.Marshal(items[0].Value); string(value) != `{"defaultRoute":true,"networks":["mtv/transfer"]}` {
+		t.Fatalf("unexpected value %s", value)
+	}
+	if value, _ := json.Marshal(items[1].Value); string(value) != `{"defaultRoute":false}` {
+		t.Fatalf("unexpected value %s", value)
+	}
+	if items[2].Error == "" || items[2].Value != nil {
+		t.Fatalf("expected an item error, got %+v", items[2])
+	}
+}
+
+func TestGatekeeperProviderRejectsWrongKind(t *testing.T) {
+	response := postProviderRequest(t, `{"apiVersion":"v1","kind":"Pod"}`)
+	if response.Response.SystemError == "" {
+		t.Fatal("expected a system error")
+	}
+}
+
+func TestGatekeeperProviderMethod(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleGatekeeperProvider(rec, httptest.NewRequest(http.MethodGet, "/gatekeeper/provider", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", rec.Code)
+	}
+}
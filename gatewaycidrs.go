@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+// splitGateways separates the gateway requests within --keep-gateway-cidrs,
+// which are legitimate and preserved, from those to remove.
+func splitGateways(gateways []net.IP) (remove, keep []net.IP) {
+	for _, gw := range gateways {
+		if gatewayKept(gw) {
+			keep = append(keep, gw)
+		} else {
+			remove = append(remove, gw)
+		}
+	}
+	return remove, keep
+}
+
+func gatewayKept(gw net.IP) bool {
+	for _, cidr := range cfg.KeepGatewayCIDRs {
+		if _, ipNet, err := net.ParseCIDR(cidr); err == nil && ipNet.Contains(gw) {
+			return true
+		}
+	}
+	return false
+}
+
+func validateCIDRs(flag string, cidrs []string) error {
+	for _, cidr := range cidrs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid %s entry %q: %v", flag, cidr, err)
+		}
+	}
+	return nil
+}
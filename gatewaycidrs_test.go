@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestKeepGatewayCIDRs(t *testing.T) {
+	old := cfg
+	defer func() { cfg, rawNetworks = old, false }()
+	cfg.KeepGatewayCIDRs = stringList{"10.0.0.0/24"}
+
+	review := func(gateways string) *admissionv1.AdmissionResponse {
+		raw, _ := json.Marshal(corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:        "importer-test",
+			Namespace:   "test",
+			Labels:      map[string]string{"app": "containerized-data-importer"},
+			Annotations: map[string]string{"k8s.v1.cni.cncf.io/networks": `[{"name":"transfer","default-route":` + gateways + `}]`},
+		}})
+		return reviewPod(&admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{
+			UID:       "keep-gateway",
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		}})
+	}
+
+	if resp := review(`["10.0.0.1"]`); len(resp.Patch) != 0 {
+		t.Fatalf("expected a gateway within the allowlist to be kept, got %s", resp.Patch)
+	}
+	for _, raw := range []bool{false, true} {
+		rawNetworks = raw
+		var patches []patch
+		json.Unmarshal(review(`["10.0.0.1","192.168.1.1"]`).Patch, &patches)
+		if len(patches) != 1 {
+			t.Fatalf("expected one patch in raw mode %t, got %v", raw, patches)
+		}
+		networks, _ := parseNetworks(patches[0].Value.(string))
+		if len(networks[0].GatewayRequest) != 1 || networks[0].GatewayRequest[0].String() != "10.0.0.1" {
+			t.Fatalf("expected only the gateway outside the allowlist to be removed in raw mode %t, got %s", raw, patches[0].Value)
+		}
+	}
+
+	cfg.KeepGatewayCIDRs = stringList{"10.0.0.1"}
+	if err := cfg.validate(); err == nil {
+		t.Fatal("expected an address without prefix length to be invalid")
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// existingAttachments returns the indices of the elements of annotation that
+// were already present in oldAnnotation. Elements are matched like the Multus
+// dynamic networks controller does, by namespace, name and interface, so only
+// attachments hotplugged by this update are considered new. An element whose
+// default-route changed is considered new as well, so a gateway added to an
+// existing attachment is stripped too.
+func existingAttachments(annotation, oldAnnotation, podNamespace string) (map[int]bool, error) {
+	keys := func(value string) ([]string, error) {
+		if value == "" {
+			return nil, nil
+		}
+		value, _ = normalizeAnnotation(value)
+		value, _, err := expandNetworks(value)
+		if err != nil {
+			return nil, err
+		}
+		var networks []map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(value), &networks); err != nil {
+			return nil, err
+		}
+		result := make([]string, len(networks))
+		for i, network := range networks {
+			var namespace, name, iface string
+			var gateways []string
+			json.Unmarshal(network["namespace"], &namespace)
+			json.Unmarshal(network["name"], &name)
+			json.Unmarshal(network["interface"], &iface)
+			json.Unmarshal(network["default-route"], &gateways)
+			if namespace == "" {
+				namespace = podNamespace
+			}
+			result[i] = namespace + "/" + name + "/" + iface + "/" + strings.Join(gateways, ",")
+		}
+		return result, nil
+	}
+
+	current, err := keys(annotation)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := keys(oldAnnotation)
+	if err != nil {
+		return nil, err
+	}
+	old := make(map[string]int, len(previous))
+	for _, key := range previous {
+		old[key]++
+	}
+
+	existing := make(map[int]bool)
+	for i, key := range current {
+		if old[key] > 0 {
+			old[key]--
+			existing[i] = true
+		}
+	}
+	return existing, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestExistingAttachments(t *testing.T) {
+	existing, err := existingAttachments(
+		`[{"name":"a","default-route":["10.0.0.1"]},{"name":"b","namespace":"test"},{"name":"a","interface":"net2"},{"name":"c"},{"name":"d","default-route":["10.0.0.1"]}]`,
+		`[{"name":"a","default-route":["10.0.0.1"]},{"name":"b"},{"name":"a","namespace":"other","interface":"net2"},{"name":"d"}]`,
+		"test",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[int]bool{0: true, 1: true}; !reflect.DeepEqual(existing, expected) {
+		t.Fatalf("expected %v, got %v", expected, existing)
+	}
+}
+
+func TestExistingAttachmentsDuplicates(t *testing.T) {
+	existing, err := existingAttachments(`[{"name":"a"},{"name":"a"}]`, `[{"name":"a"}]`, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[int]bool{0: true}; !reflect.DeepEqual(existing, expected) {
+		t.Fatalf("expected %v, got %v", expected, existing)
+	}
+}
+
+func reviewPodUpdate(t *testing.T, oldNetworks, newNetworks string) *admissionv1.AdmissionResponse {
+	return reviewPod(podUpdateReview("virt-v2v-test", map[string]string{"forklift.app": "virt-v2v"}, oldNetworks, newNetworks))
+}
+
+func podUpdateReview(name string, labels map[string]string, oldNetworks, newNetworks string) *admissionv1.AdmissionReview {
+	pod := func(networks string) []byte {
+		raw, _ := json.Marshal(corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "test",
+				Labels:      labels,
+				Annotations: map[string]string{"k8s.v1.cni.cncf.io/networks": networks},
+			},
+		})
+		return raw
+	}
+	return &admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{
+			UID:       "test",
+			Namespace: "test",
+			Operation: admissionv1.Update,
+			Object:    runtime.RawExtension{Raw: pod(newNetworks)},
+			OldObject: runtime.RawExtension{Raw: pod(oldNetworks)},
+		},
+	}
+}
+
+func TestReviewPodHotplug(t *testing.T) {
+	old := cfg
+	cfg.HandleHotplug = true
+	defer func() { cfg = old }()
+
+	resp := reviewPodUpdate(t,
+		`[{"name":"transfer","default-route":["10.0.0.1"]}]`,
+		`[{"name":"transfer","default-route":["10.0.0.1"]},{"name":"hotplugged","default-route":["10.1.0.1"]}]`,
+	)
+	var patches []patch
+	json.Unmarshal(resp.Patch, &patches)
+	if len(patches) != 1 || patches[0].Value != `[{"name":"transfer","default-route":["10.0.0.1"]},{"name":"hotplugged"}]` {
+		t.Fatalf("expected only the hotplugged network to be changed, got %s", resp.Patch)
+	}
+}
+
+func TestReviewPodHotplugUnchanged(t *testing.T) {
+	old := cfg
+	cfg.HandleHotplug = true
+	defer func() { cfg = old }()
+
+	networks := `[{"name":"transfer","default-route":["10.0.0.1"]}]`
+	if resp := reviewPodUpdate(t, networks, networks); !resp.Allowed || resp.Patch != nil {
+		t.Fatalf("expected existing networks to be left alone, got %+v", resp)
+	}
+}
+
+func TestReviewPodHotplugDefaultRouteAdded(t *testing.T) {
+	old := cfg
+	cfg.HandleHotplug = true
+	defer func() { cfg = old }()
+
+	resp := reviewPodUpdate(t,
+		`[{"name":"transfer"},{"name":"storage"}]`,
+		`[{"name":"transfer","default-route":["10.0.0.1"]},{"name":"storage"}]`,
+	)
+	var patches []patch
+	json.Unmarshal(resp.Patch, &patches)
+	if len(patches) != 1 || patches[0].Value != `[{"name":"transfer"},{"name":"storage"}]` {
+		t.Fatalf("expected the added default-route to be stripped, got %s", resp.Patch)
+	}
+}
+
+func TestReviewPodUpdateWithoutHotplug(t *testing.T) {
+	resp := reviewPodUpdate(t, `[]`, `[{"name":"hotplugged","default-route":["10.1.0.1"]}]`)
+	if !resp.Allowed || resp.Patch != nil {
+		t.Fatalf("expected updates to be passed through, got %+v", resp)
+	}
+}
+
+// KubeVirt hotplugs an interface by adding it to the VMI, after which
+// virt-controller updates the networks annotation of the virt-launcher pod.
+func TestReviewVirtLauncherHotplug(t *testing.T) {
+	withTargetPolicies(t, testTargetPolicy("test", "migrated-vms", map[string]interface{}{
+		"podType":     "virt-launcher",
+		"podSelector": map[string]interface{}{"matchLabels": map[string]interface{}{"kubevirt.io": "virt-launcher"}},
+	}))
+	targetPolicies.refresh("test")
+	old := cfg
+	cfg.HandleHotplug = true
+	defer func() { cfg = old }()
+
+	ar := podUpdateReview("virt-launcher-vm-1-x2xkq", map[string]string{"kubevirt.io": "virt-launcher", "vm.kubevirt.io/name": "vm-1"},
+		`[{"name":"transfer","namespace":"test","interface":"pod16367aacb67"}]`,
+		`[{"name":"transfer","namespace":"test","interface":"pod16367aacb67"},{"name":"storage","namespace":"test","interface":"podb1f51a511f1","default-route":["10.1.0.1"]}]`,
+	)
+	d := newDecision(ar)
+	resp := evaluatePod(ar, d, cfg.Rules)
+	if !resp.Allowed || d.PodType != "virt-launcher" || d.Outcome != outcomeMutated {
+		t.Fatalf("expected the virt-launcher pod to be mutated as a target, got %+v %+v", resp, d)
+	}
+	if len(d.Networks) != 1 || d.Networks[0].Network != "test/storage" {
+		t.Fatalf("expected only the hotplugged interface to be stripped, got %+v", d.Networks)
+	}
+}
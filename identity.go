@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+var instanceInfo = newGaugeVec(prometheus.GaugeOpts{
+	Name: "gateway_yeeter_instance_info",
+	Help: "Always 1, labelled with the namespace, pod, service and node of this webhook replica.",
+}, "namespace", "pod", "service", "node")
+
+// instanceIdentity names the running replica. It is read from the
+// POD_NAMESPACE, POD_NAME, SERVICE_NAME and NODE_NAME environment variables,
+// which the rendered manifests fill from the downward API.
+type instanceIdentity struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Service   string `json:"service"`
+	Node      string `json:"node,omitempty"`
+}
+
+var identity = loadIdentity(os.Getenv, os.ReadFile, os.Hostname)
+
+func loadIdentity(getenv func(string) string, readFile func(string) ([]byte, error), hostname func() (string, error)) instanceIdentity {
+	id := instanceIdentity{
+		Namespace: getenv("POD_NAMESPACE"),
+		Pod:       getenv("POD_NAME"),
+		Service:   getenv("SERVICE_NAME"),
+		Node:      getenv("NODE_NAME"),
+	}
+	if id.Namespace == "" {
+		if raw, err := readFile(serviceAccountNamespaceFile); err == nil {
+			id.Namespace = strings.TrimSpace(string(raw))
+		}
+	}
+	if id.Pod == "" {
+		id.Pod, _ = hostname()
+	}
+	if id.Service == "" {
+		id.Service = "gateway-yeeter"
+	}
+	return id
+}
+
+func (id instanceIdentity) String() string {
+	if id.Namespace == "" {
+		return id.Pod
+	}
+	return id.Namespace + "/" + id.Pod
+}
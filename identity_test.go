@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLoadIdentity(t *testing.T) {
+	env := map[string]string{}
+	getenv := func(key string) string { return env[key] }
+	readFile := func(string) ([]byte, error) { return []byte("openshift-mtv\n"), nil }
+	hostname := func() (string, error) { return "gateway-yeeter-abc", nil }
+
+	id := loadIdentity(getenv, readFile, hostname)
+	want := instanceIdentity{Namespace: "openshift-mtv", Pod: "gateway-yeeter-abc", Service: "gateway-yeeter"}
+	if id != want {
+		t.Fatalf("expected fallback identity %+v, got %+v", want, id)
+	}
+	if got := id.String(); got != "openshift-mtv/gateway-yeeter-abc" {
+		t.Fatalf("unexpected string %q", got)
+	}
+
+	env = map[string]string{"POD_NAMESPACE": "mtv", "POD_NAME": "webhook-0", "SERVICE_NAME": "yeeter", "NODE_NAME": "worker-1"}
+	id = loadIdentity(getenv, readFile, hostname)
+	want = instanceIdentity{Namespace: "mtv", Pod: "webhook-0", Service: "yeeter", Node: "worker-1"}
+	if id != want {
+		t.Fatalf("expected downward API identity %+v, got %+v", want, id)
+	}
+
+	env = map[string]string{}
+	id = loadIdentity(getenv, func(string) ([]byte, error) { return nil, errors.New("not in a pod") }, hostname)
+	if id.Namespace != "" || id.String() != "gateway-yeeter-abc" {
+		t.Fatalf("expected identity without namespace outside a pod, got %+v", id)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+)
+
+var (
+	admissionInFlight = newGauge(prometheus.GaugeOpts{
+		Name: "gateway_yeeter_admission_in_flight",
+		Help: "Admission reviews being processed, with --max-in-flight.",
+	})
+	admissionUtilization = newGauge(prometheus.GaugeOpts{
+		Name: "gateway_yeeter_admission_utilization",
+		Help: "Admission reviews being processed or waiting for a slot, relative to --max-in-flight. Above 1 reviews queue; shaped as a per-pod HPA target.",
+	})
+	admissionQueueWait = newHistogram(prometheus.HistogramOpts{
+		Name:    "gateway_yeeter_admission_queue_wait_seconds",
+		Help:    "Time admission reviews waited for a slot, with --max-in-flight.",
+		Buckets: []float64{.0001, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	})
+	admissionQueueTimeouts = newCounter(prometheus.CounterOpts{
+		Name: "gateway_yeeter_admission_queue_timeouts_total",
+		Help: "Admission reviews rejected because no slot became free within half the request deadline.",
+	})
+)
+
+// inFlightLimiter bounds the admission reviews processed concurrently by
+// one replica. Reviews beyond the limit wait for a slot for up to half the
+// request deadline, leaving the other half to review the pod; after that
+// the API server applies the failurePolicy, like for an unreachable webhook.
+type inFlightLimiter struct {
+	slots chan struct{}
+
+	mu      sync.Mutex
+	running int
+	waiting int
+}
+
+var inFlight *inFlightLimiter
+
+func newInFlightLimiter(max int) *inFlightLimiter {
+	return &inFlightLimiter{slots: make(chan struct{}, max)}
+}
+
+func (l *inFlightLimiter) wrap(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !l.acquire(r, requestDeadline(r)/2) {
+			admissionQueueTimeouts.Inc()
+			klog.Warningf("No admission review slot free for the request from %s, %d reviews in flight", r.RemoteAddr, cap(l.slots))
+			http.Error(w, "too many admission reviews in flight", http.StatusServiceUnavailable)
+			return
+		}
+		defer l.release()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *inFlightLimiter) acquire(r *http.Request, maxWait time.Duration) bool {
+	start := time.Now()
+	l.update(0, 1)
+
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		admissionQueueWait.Observe(time.Since(start).Seconds())
+		l.update(1, -1)
+		return true
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+	l.update(0, -1)
+	return false
+}
+
+func (l *inFlightLimiter) release() {
+	<-l.slots
+	l.update(-1, 0)
+}
+
+func (l *inFlightLimiter) update(running, waiting int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running += running
+	l.waiting += waiting
+	admissionInFlight.Set(float64(l.running))
+	admissionUtilization.Set(float64(l.running+l.waiting) / float64(cap(l.slots)))
+}
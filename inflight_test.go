@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInFlightLimiter(t *testing.T) {
+	l := newInFlightLimiter(1)
+	entered, unblock := make(chan struct{}), make(chan struct{})
+	handler := l.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-unblock
+	}))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/mutate?timeout=10s", nil))
+	}()
+	<-entered
+	if got := testutil.ToFloat64(admissionInFlight); got != 1 {
+		t.Fatalf("expected one review in flight, got %v", got)
+	}
+	if got := testutil.ToFloat64(admissionUtilization); got != 1 {
+		t.Fatalf("expected full utilization, got %v", got)
+	}
+
+	// The slot is taken, so the second review waits half its deadline and is
+	// rejected.
+	timeouts := testutil.ToFloat64(admissionQueueTimeouts)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/mutate?timeout=20ms", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected a queued review to time out with 503, got %d", rec.Code)
+	}
+	if got := testutil.ToFloat64(admissionQueueTimeouts); got != timeouts+1 {
+		t.Fatalf("expected the timeout to be counted, got %v", got)
+	}
+
+	// A waiting review counts towards utilization and gets the slot once it
+	// is released.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/mutate?timeout=10s", nil))
+	}()
+	for deadline := time.Now().Add(time.Second); testutil.ToFloat64(admissionUtilization) != 2; {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected a waiting review to raise utilization to 2, got %v", testutil.ToFloat64(admissionUtilization))
+		}
+		time.Sleep(time.Millisecond)
+	}
+	unblock <- struct{}{}
+	<-entered
+	unblock <- struct{}{}
+	wg.Wait()
+
+	if got := testutil.ToFloat64(admissionUtilization); got != 0 {
+		t.Fatalf("expected no utilization once idle, got %v", got)
+	}
+	if mux := http.NewServeMux(); (*inFlightLimiter)(nil).wrap(mux) != mux {
+		t.Fatal("expected no limit without --max-in-flight")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// injectRoutes adds the static routes and approved gateway of an inject
+// rule to the rule's attachment. It works on raw elements like
+// yeetIPAMRoutes so cni-args of the attachment are kept. Attachments in
+// skip are left alone; a nil change means the attachment is not requested
+// or already carries everything.
+func injectRoutes(annotation, podNamespace string, r *rule, skip map[int]bool) (string, *networkChange, error) {
+	var networks []map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(annotation), &networks); err != nil {
+		return "", nil, err
+	}
+
+	wantNamespace, wantName, found := strings.Cut(r.Attachment, "/")
+	if !found {
+		wantNamespace, wantName = podNamespace, r.Attachment
+	}
+
+	for i, network := range networks {
+		var name, namespace string
+		json.Unmarshal(network["name"], &name)
+		json.Unmarshal(network["namespace"], &namespace)
+		if namespace == "" {
+			namespace = podNamespace
+		}
+		if name != wantName || namespace != wantNamespace || skip[i] {
+			continue
+		}
+
+		change := networkChange{Network: namespace + "/" + name}
+		if r.Gateway != "" {
+			var gateways []string
+			json.Unmarshal(network["default-route"], &gateways)
+			if len(gateways) != 1 || gateways[0] != r.Gateway {
+				network["default-route"], _ = json.Marshal([]string{r.Gateway})
+				change.AddedRoutes = append(change.AddedRoutes, "default via "+r.Gateway)
+			}
+		}
+
+		if len(r.Routes) > 0 {
+			cniArgs := map[string]json.RawMessage{}
+			if raw, exists := network["cni-args"]; exists {
+				if err := json.Unmarshal(raw, &cniArgs); err != nil {
+					return "", nil, fmt.Errorf("network %d: cni-args: %w", i, err)
+				}
+			}
+			var routes []ipamRoute
+			if raw, exists := cniArgs["routes"]; exists {
+				if err := json.Unmarshal(raw, &routes); err != nil {
+					return "", nil, fmt.Errorf("network %d: cni-args routes: %w", i, err)
+				}
+			}
+			added := false
+			for _, route := range r.Routes {
+				if containsRoute(routes, route) {
+					continue
+				}
+				routes = append(routes, route)
+				change.AddedRoutes = append(change.AddedRoutes, formatRoute(route))
+				added = true
+			}
+			if added {
+				cniArgs["routes"], _ = json.Marshal(routes)
+				network["cni-args"], _ = json.Marshal(cniArgs)
+			}
+		}
+
+		if len(change.AddedRoutes) == 0 {
+			return annotation, nil, nil
+		}
+		modified, err := json.Marshal(networks)
+		if err != nil {
+			return "", nil, err
+		}
+		return string(modified), &change, nil
+	}
+	return annotation, nil, nil
+}
+
+func containsRoute(routes []ipamRoute, route ipamRoute) bool {
+	for _, r := range routes {
+		if r == route {
+			return true
+		}
+	}
+	return false
+}
+
+func formatRoute(route ipamRoute) string {
+	if route.GW == "" {
+		return route.Dst
+	}
+	return route.Dst + " via " + route.GW
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestInjectRoutes(t *testing.T) {
+	r := &rule{
+		Name:       "transfer",
+		Action:     actionInject,
+		Attachment: "transfer",
+		Routes:     []ipamRoute{{Dst: "10.20.0.0/16", GW: "192.168.5.1"}},
+		Gateway:    "192.168.5.1",
+	}
+	annotation := `[{"name":"storage","default-route":["10.0.0.1"]},{"name":"transfer","cni-args":{"ips":["192.168.5.10/24"]}}]`
+
+	modified, change, err := injectRoutes(annotation, "test", r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change == nil || change.Network != "test/transfer" || len(change.AddedRoutes) != 2 {
+		t.Fatalf("unexpected change %+v", change)
+	}
+	want := `[{"default-route":["10.0.0.1"],"name":"storage"},{"cni-args":{"ips":["192.168.5.10/24"],"routes":[{"dst":"10.20.0.0/16","gw":"192.168.5.1"}]},"default-route":["192.168.5.1"],"name":"transfer"}]`
+	if modified != want {
+		t.Fatalf("unexpected annotation %s", modified)
+	}
+
+	if again, change, _ := injectRoutes(modified, "test", r, nil); change != nil || again != modified {
+		t.Fatalf("expected injection to be idempotent, got %+v", change)
+	}
+	if _, change, _ := injectRoutes(annotation, "test", &rule{Attachment: "test/transfer", Gateway: "192.168.5.1"}, nil); change == nil {
+		t.Fatal("expected namespaced attachment to match elements defaulting to the pod namespace")
+	}
+	if _, change, _ := injectRoutes(annotation, "other", &rule{Attachment: "test/transfer", Gateway: "192.168.5.1"}, nil); change != nil {
+		t.Fatal("expected attachments of other namespaces to be left alone")
+	}
+	if _, change, _ := injectRoutes(annotation, "test", r, map[int]bool{1: true}); change != nil {
+		t.Fatal("expected skipped attachments to be left alone")
+	}
+}
+
+func TestReviewPodInjectRule(t *testing.T) {
+	old := cfg
+	cfg.Rules = ruleSet{{Name: "transfer", Action: actionInject, Attachment: "transfer", Gateway: "192.168.5.1"}}
+	defer func() { cfg = old }()
+
+	resp, d := reviewRulesPod(t, "test", `[{"name":"storage","default-route":["10.0.0.1"]},{"name":"transfer","default-route":["10.9.9.9"]}]`)
+	if !resp.Allowed || d.Outcome != outcomeMutated {
+		t.Fatalf("expected pod to be mutated, got %+v", d)
+	}
+	var patches []patch
+	json.Unmarshal(resp.Patch, &patches)
+	if len(patches) != 1 || patches[0].Value != `[{"name":"storage"},{"default-route":["192.168.5.1"],"name":"transfer"}]` {
+		t.Fatalf("unexpected patch %s", resp.Patch)
+	}
+	if len(d.Networks) != 3 || d.Networks[2].AddedRoutes[0] != "default via 192.168.5.1" {
+		t.Fatalf("unexpected network changes %+v", d.Networks)
+	}
+}
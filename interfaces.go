@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	interfaceConflictIgnore = "ignore"
+	interfaceConflictWarn   = "warn"
+	interfaceConflictDeny   = "deny"
+
+	// primaryInterface is the interface of the cluster default network.
+	primaryInterface = "eth0"
+)
+
+var interfaceConflicts = newCounterVec(prometheus.CounterOpts{
+	Name: "gateway_yeeter_interface_conflicts_total",
+	Help: "Target pods whose networks annotation requests the same interface name more than once, by action.",
+}, "action")
+
+// interfaceConflict returns why annotation requests an interface name more
+// than once, or an empty string. Attachments without an interface get the
+// name Multus gives them, net<position>, and eth0 is taken by the cluster
+// default network. Conflicts only among attachments in existing, which were
+// already admitted, are not reported.
+func interfaceConflict(annotation, podNamespace string, existing map[int]bool) string {
+	var networks []map[string]json.RawMessage
+	if json.Unmarshal([]byte(annotation), &networks) != nil {
+		return ""
+	}
+	requested := map[string][]int{primaryInterface: {-1}}
+	for i, network := range networks {
+		iface := fmt.Sprintf("net%d", i+1)
+		json.Unmarshal(network["interface"], &iface)
+		requested[iface] = append(requested[iface], i)
+	}
+
+	var conflicts []string
+	for iface, indices := range requested {
+		if len(indices) < 2 {
+			continue
+		}
+		var names []string
+		isNew := false
+		for _, i := range indices {
+			if i < 0 {
+				names = append(names, "the cluster default network")
+				continue
+			}
+			var namespace, name string
+			json.Unmarshal(networks[i]["namespace"], &namespace)
+			json.Unmarshal(networks[i]["name"], &name)
+			names = append(names, attachmentNamespace(namespace, podNamespace)+"/"+name)
+			isNew = isNew || !existing[i]
+		}
+		if isNew {
+			conflicts = append(conflicts, fmt.Sprintf("interface %s is requested by %s", iface, strings.Join(names, " and ")))
+		}
+	}
+	if len(conflicts) == 0 {
+		return ""
+	}
+	sort.Strings(conflicts)
+	interfaceConflicts.WithLabelValues(cfg.InterfaceConflictAction).Inc()
+	return strings.Join(conflicts, ", ") + ", Multus would fail to attach the pod"
+}
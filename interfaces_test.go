@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInterfaceConflict(t *testing.T) {
+	cases := []struct {
+		annotation string
+		existing   map[int]bool
+		want       string
+	}{
+		{`[{"name":"a"},{"name":"b"}]`, nil, ""},
+		{`[{"name":"a","interface":"net1"},{"name":"b","interface":"net1"}]`, nil, "interface net1 is requested by test/a and test/b"},
+		{`[{"name":"a"},{"name":"b","namespace":"other","interface":"net1"}]`, nil, "interface net1 is requested by test/a and other/b"},
+		{`[{"name":"a","interface":"eth0"}]`, nil, "interface eth0 is requested by the cluster default network and test/a"},
+		{`[{"name":"a","interface":"net1"},{"name":"b","interface":"net1"}]`, map[int]bool{0: true, 1: true}, ""},
+		{`[{"name":"a","interface":"net1"},{"name":"b","interface":"net1"}]`, map[int]bool{0: true}, "interface net1"},
+		{`not json`, nil, ""},
+	}
+	for _, c := range cases {
+		got := interfaceConflict(c.annotation, "test", c.existing)
+		if (c.want == "") != (got == "") || !strings.Contains(got, c.want) {
+			t.Errorf("%s %v: expected %q, got %q", c.annotation, c.existing, c.want, got)
+		}
+	}
+}
+
+func TestInterfaceConflictAction(t *testing.T) {
+	old := cfg
+	defer func() { cfg, rawNetworks = old, false }()
+	// The cnitypes structs drop the interface, the self-test switches to raw
+	// mode in that case.
+	rawNetworks = true
+	networks := `[{"name":"transfer","interface":"net2","default-route":["10.0.0.1"]},{"name":"storage"}]`
+
+	cfg.InterfaceConflictAction = interfaceConflictWarn
+	resp, d := reviewRulesPod(t, "test", networks)
+	if d.Outcome != outcomeMutated || len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], reasonWarnInterfaceConflict+": interface net2 is requested by test/transfer and test/storage") {
+		t.Fatalf("expected a mutation with an interface conflict warning, got %s %v", d.Outcome, resp.Warnings)
+	}
+
+	cfg.InterfaceConflictAction = interfaceConflictDeny
+	resp, d = reviewRulesPod(t, "test", networks)
+	if resp.Allowed || d.Reason != reasonDenyInterfaceConflict {
+		t.Fatalf("expected a denial, got %+v %+v", resp, d)
+	}
+
+	cfg.InterfaceConflictAction = interfaceConflictIgnore
+	resp, d = reviewRulesPod(t, "test", networks)
+	if d.Outcome != outcomeMutated || len(resp.Warnings) != 0 {
+		t.Fatalf("expected a mutation without warnings, got %s %v", d.Outcome, resp.Warnings)
+	}
+}
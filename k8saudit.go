@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+)
+
+const (
+	auditFormatNative     = "native"
+	auditFormatKubernetes = "kubernetes"
+
+	auditAnnotationPrefix = "gateway.yeet/"
+)
+
+// toAuditEvent converts decision and configuration change records to
+// audit.k8s.io/v1 Events. Other records, such as checkpoints that only
+// carry hash chain metadata, are returned unchanged.
+func toAuditEvent(record interface{}) interface{} {
+	switch r := record.(type) {
+	case *decision:
+		return decisionAuditEvent(r)
+	case configChangeRecord:
+		return configChangeAuditEvent(r)
+	}
+	return record
+}
+
+func decisionAuditEvent(d *decision) *auditv1.Event {
+	status := &metav1.Status{Status: metav1.StatusSuccess, Code: http.StatusOK, Message: d.Message}
+	if d.Outcome == outcomeDenied {
+		status.Status, status.Code = metav1.StatusFailure, http.StatusForbidden
+	}
+	status.Reason = metav1.StatusReason(d.Reason)
+
+	verb := strings.ToLower(d.operation)
+	if verb == "" {
+		verb = "create"
+	}
+	event := &auditv1.Event{
+		TypeMeta:                 metav1.TypeMeta{APIVersion: auditv1.SchemeGroupVersion.String(), Kind: "Event"},
+		Level:                    auditv1.LevelMetadata,
+		AuditID:                  types.UID(d.UID),
+		Stage:                    auditv1.StageResponseComplete,
+		RequestURI:               "/mutate",
+		Verb:                     verb,
+		User:                     d.user,
+		ObjectRef:                &auditv1.ObjectReference{Resource: "pods", Namespace: d.Namespace, Name: d.Pod, APIVersion: "v1"},
+		ResponseStatus:           status,
+		RequestReceivedTimestamp: metav1.NewMicroTime(d.Time),
+		StageTimestamp:           metav1.NewMicroTime(d.Time),
+		Annotations: map[string]string{
+			auditAnnotationPrefix + "outcome": d.Outcome,
+			auditAnnotationPrefix + "reason":  d.Reason,
+		},
+	}
+	if d.PodType != "" {
+		event.Annotations[auditAnnotationPrefix+"pod-type"] = d.PodType
+	}
+	if d.SkipReason != "" {
+		event.Annotations[auditAnnotationPrefix+"skip-reason"] = d.SkipReason
+	}
+	if d.ConfigHash != "" {
+		event.Annotations[auditAnnotationPrefix+"config-hash"] = d.ConfigHash
+	}
+	if d.RulesHash != "" {
+		event.Annotations[auditAnnotationPrefix+"rules-hash"] = d.RulesHash
+	}
+	if d.WebhookGeneration != 0 {
+		event.Annotations[auditAnnotationPrefix+"webhook-generation"] = strconv.FormatInt(d.WebhookGeneration, 10)
+	}
+	if len(d.Networks) > 0 {
+		networks, _ := json.Marshal(d.Networks)
+		event.Annotations[auditAnnotationPrefix+"networks"] = string(networks)
+	}
+	if len(d.MatchedPodTypes) > 0 {
+		event.Annotations[auditAnnotationPrefix+"matched-pod-types"] = strings.Join(d.MatchedPodTypes, ",")
+	}
+	if len(d.MatchedRules) > 0 {
+		event.Annotations[auditAnnotationPrefix+"matched-rules"] = strings.Join(d.MatchedRules, ",")
+	}
+	if len(d.RemovedAnnotations) > 0 {
+		event.Annotations[auditAnnotationPrefix+"removed-annotations"] = strings.Join(d.RemovedAnnotations, ",")
+	}
+	if d.Patch != "" {
+		event.Annotations[auditAnnotationPrefix+"patch"] = d.Patch
+	}
+	return event
+}
+
+// admissionAuditAnnotations records the mutation of d in the audit log of
+// the API server, which stores them as <webhook name>/<key> on the audit
+// event of the pod creation. Values follow the audit redaction policy.
+func admissionAuditAnnotations(d *decision) map[string]string {
+	d = cfg.Redaction.decision(channelAudit, d)
+	var networks []string
+	gateways := make(map[string][]string)
+	for _, n := range d.Networks {
+		networks = append(networks, n.Network)
+		if len(n.RemovedGateways) > 0 {
+			gateways[n.Network] = n.RemovedGateways
+		}
+	}
+	annotations := make(map[string]string)
+	if len(networks) > 0 {
+		annotations["modified-networks"] = strings.Join(networks, ",")
+	}
+	if len(gateways) > 0 {
+		raw, _ := json.Marshal(gateways)
+		annotations["removed-gateways"] = string(raw)
+	}
+	if len(d.RemovedAnnotations) > 0 {
+		annotations["removed-annotations"] = strings.Join(d.RemovedAnnotations, ",")
+	}
+	if len(annotations) == 0 {
+		return nil
+	}
+	return annotations
+}
+
+func configChangeAuditEvent(r configChangeRecord) *auditv1.Event {
+	config, _ := json.Marshal(r.Config)
+	return &auditv1.Event{
+		TypeMeta:                 metav1.TypeMeta{APIVersion: auditv1.SchemeGroupVersion.String(), Kind: "Event"},
+		Level:                    auditv1.LevelRequest,
+		AuditID:                  types.UID(r.NewHash),
+		Stage:                    auditv1.StageResponseComplete,
+		RequestURI:               r.Source,
+		Verb:                     "update",
+		User:                     authenticationv1.UserInfo{Username: r.Actor},
+		ObjectRef:                &auditv1.ObjectReference{Resource: "configurations", APIGroup: "gateway.yeet", Name: "gateway-yeeter"},
+		RequestObject:            &runtime.Unknown{Raw: config, ContentType: runtime.ContentTypeJSON},
+		ResponseStatus:           &metav1.Status{Status: metav1.StatusSuccess, Code: http.StatusOK},
+		RequestReceivedTimestamp: metav1.NewMicroTime(r.Time),
+		StageTimestamp:           metav1.NewMicroTime(r.Time),
+		Annotations: map[string]string{
+			auditAnnotationPrefix + "source":   r.Source,
+			auditAnnotationPrefix + "old-hash": r.OldHash,
+			auditAnnotationPrefix + "new-hash": r.NewHash,
+		},
+	}
+}
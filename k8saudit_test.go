@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+)
+
+func TestDecisionAuditEvent(t *testing.T) {
+	d := &decision{
+		Kind:      "Decision",
+		Time:      time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		UID:       "705ab4f5-6393-11e8-b7cc-42010a800002",
+		Namespace: "mtv",
+		Pod:       "importer-test",
+		PodType:   "cdi",
+		Outcome:   outcomeMutated,
+		Networks:  []networkChange{{Network: "mtv/transfer", RemovedGateways: []string{"10.0.0.1"}}},
+		Patch:     `[{"op":"replace"}]`,
+		user:      authenticationv1.UserInfo{Username: "system:serviceaccount:cdi:cdi-sa"},
+		operation: "CREATE",
+	}
+
+	event := decisionAuditEvent(d)
+	if event.Kind != "Event" || event.APIVersion != "audit.k8s.io/v1" || event.Level != auditv1.LevelMetadata || event.Stage != auditv1.StageResponseComplete {
+		t.Fatalf("unexpected event metadata %+v", event)
+	}
+	if event.AuditID != "705ab4f5-6393-11e8-b7cc-42010a800002" || event.Verb != "create" || event.User.Username != "system:serviceaccount:cdi:cdi-sa" {
+		t.Fatalf("unexpected request fields %+v", event)
+	}
+	if ref := event.ObjectRef; ref.Resource != "pods" || ref.Namespace != "mtv" || ref.Name != "importer-test" {
+		t.Fatalf("unexpected object reference %+v", ref)
+	}
+	if event.ResponseStatus.Code != 200 || !event.StageTimestamp.Time.Equal(d.Time) {
+		t.Fatalf("unexpected response %+v", event.ResponseStatus)
+	}
+	if event.Annotations["gateway.yeet/outcome"] != outcomeMutated || event.Annotations["gateway.yeet/networks"] != `[{"network":"mtv/transfer","removedGateways":["10.0.0.1"]}]` || event.Annotations["gateway.yeet/patch"] != d.Patch {
+		t.Fatalf("unexpected annotations %v", event.Annotations)
+	}
+
+	d.Outcome = outcomeDenied
+	if event := decisionAuditEvent(d); event.ResponseStatus.Code != 403 {
+		t.Fatalf("expected a 403 for denied pods, got %+v", event.ResponseStatus)
+	}
+}
+
+func TestAdmissionAuditAnnotations(t *testing.T) {
+	resp, _ := reviewRulesPod(t, "mtv", `[{"name":"transfer","default-route":["10.0.0.1"]},{"name":"backup","default-route":["10.0.1.1","fd00::1"]},{"name":"storage"}]`)
+	want := map[string]string{
+		"modified-networks": "/transfer,/backup",
+		"removed-gateways":  `{"/backup":["10.0.1.1","fd00::1"],"/transfer":["10.0.0.1"]}`,
+	}
+	if len(resp.AuditAnnotations) != len(want) {
+		t.Fatalf("expected %v, got %v", want, resp.AuditAnnotations)
+	}
+	for key, value := range want {
+		if resp.AuditAnnotations[key] != value {
+			t.Errorf("expected %s=%s, got %s", key, value, resp.AuditAnnotations[key])
+		}
+	}
+
+	if resp, _ := reviewRulesPod(t, "mtv", `[{"name":"storage"}]`); resp.AuditAnnotations != nil {
+		t.Fatalf("expected no audit annotations for unchanged pods, got %v", resp.AuditAnnotations)
+	}
+
+	old := cfg
+	defer func() { cfg = old }()
+	cfg.Redaction = redactionPolicy{channelAudit: {fieldGateways}}
+	resp, _ = reviewRulesPod(t, "mtv", `[{"name":"transfer","default-route":["10.0.0.1"]}]`)
+	if gateways := resp.AuditAnnotations["removed-gateways"]; strings.Contains(gateways, "10.0.0.1") {
+		t.Fatalf("expected gateways to be redacted, got %s", gateways)
+	}
+}
+
+func TestAuditLogKubernetesFormat(t *testing.T) {
+	var buf bytes.Buffer
+	a := &auditLog{w: &buf, format: auditFormatKubernetes}
+	a.write(&decision{Kind: "Decision", UID: "a", Outcome: outcomeUnchanged})
+	a.write(configChangeRecord{Kind: "ConfigChange", Source: "startup", Actor: "command-line", NewHash: "abc", Config: defaultConfig()})
+	a.write(checkpointRecord{Kind: "Checkpoint"})
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 records, got %s", buf.String())
+	}
+	var event auditv1.Event
+	json.Unmarshal(lines[1], &event)
+	if event.Kind != "Event" || event.Verb != "update" || event.User.Username != "command-line" || event.Annotations["gateway.yeet/new-hash"] != "abc" || event.RequestObject == nil {
+		t.Fatalf("unexpected config change event %s", lines[1])
+	}
+	var checkpoint checkpointRecord
+	json.Unmarshal(lines[2], &checkpoint)
+	if checkpoint.Kind != "Checkpoint" {
+		t.Fatalf("expected checkpoints to stay native, got %s", lines[2])
+	}
+}
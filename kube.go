@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+type lookupCategory string
+
+const (
+	lookupNAD       lookupCategory = "nad"
+	lookupNamespace lookupCategory = "namespace"
+	lookupPlan      lookupCategory = "plan"
+	lookupAuth      lookupCategory = "auth"
+	lookupPod       lookupCategory = "pod"
+	lookupWebhook   lookupCategory = "webhook"
+	lookupRules     lookupCategory = "rules"
+	lookupEvent     lookupCategory = "event"
+	lookupDiscovery lookupCategory = "discovery"
+	lookupMigration lookupCategory = "migration"
+)
+
+type kubeClients struct {
+	mu          sync.Mutex
+	base        *rest.Config
+	baseErr     error
+	impersonate map[lookupCategory]string
+	typed       map[lookupCategory]kubernetes.Interface
+	dynamic     map[lookupCategory]dynamic.Interface
+}
+
+var kube = &kubeClients{}
+
+func (k *kubeClients) configure(kubeconfig string, impersonate map[lookupCategory]string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.base = nil
+	k.impersonate = impersonate
+	k.typed = make(map[lookupCategory]kubernetes.Interface)
+	k.dynamic = make(map[lookupCategory]dynamic.Interface)
+
+	if kubeconfig != "" {
+		if k.base, k.baseErr = clientcmd.BuildConfigFromFlags("", kubeconfig); k.baseErr != nil {
+			k.baseErr = fmt.Errorf("cannot load kubeconfig %s: %w", kubeconfig, k.baseErr)
+		}
+	} else {
+		if k.base, k.baseErr = rest.InClusterConfig(); k.baseErr != nil {
+			k.baseErr = fmt.Errorf("cannot load in-cluster configuration: %w", k.baseErr)
+		}
+	}
+	if k.baseErr != nil {
+		k.base = nil
+	}
+	return k.baseErr
+}
+
+func (k *kubeClients) restConfig(category lookupCategory) (*rest.Config, error) {
+	if k.base == nil {
+		if k.baseErr != nil {
+			return nil, fmt.Errorf("no Kubernetes client configuration available for %s lookups: %w", category, k.baseErr)
+		}
+		return nil, fmt.Errorf("no Kubernetes client configuration available for %s lookups", category)
+	}
+
+	restConfig := rest.CopyConfig(k.base)
+	restConfig.UserAgent = "gateway-yeeter/" + string(category)
+	if sa := k.impersonate[category]; sa != "" {
+		username, err := serviceAccountUsername(sa)
+		if err != nil {
+			return nil, err
+		}
+		restConfig.Impersonate = rest.ImpersonationConfig{UserName: username}
+	}
+	return restConfig, nil
+}
+
+func (k *kubeClients) typedFor(category lookupCategory) (kubernetes.Interface, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if client, exists := k.typed[category]; exists {
+		return client, nil
+	}
+	restConfig, err := k.restConfig(category)
+	if err != nil {
+		return nil, err
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	k.typed[category] = client
+	return client, nil
+}
+
+func (k *kubeClients) dynamicFor(category lookupCategory) (dynamic.Interface, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if client, exists := k.dynamic[category]; exists {
+		return client, nil
+	}
+	restConfig, err := k.restConfig(category)
+	if err != nil {
+		return nil, err
+	}
+	client, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	k.dynamic[category] = client
+	return client, nil
+}
+
+func serviceAccountUsername(sa string) (string, error) {
+	namespace, name, found := strings.Cut(sa, "/")
+	if !found || namespace == "" || name == "" || strings.Contains(name, "/") {
+		return "", fmt.Errorf("invalid service account %q, expected <namespace>/<name>", sa)
+	}
+	return "system:serviceaccount:" + namespace + ":" + name, nil
+}
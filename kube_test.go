@@ -0,0 +1,72 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestLookupRestConfigImpersonation(t *testing.T) {
+	k := &kubeClients{
+		base: &rest.Config{Host: "https://kubernetes.default.svc"},
+		impersonate: map[lookupCategory]string{
+			lookupNAD: "openshift-mtv/gateway-yeeter-nad-reader",
+		},
+	}
+
+	restConfig, err := k.restConfig(lookupNAD)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if restConfig.Impersonate.UserName != "system:serviceaccount:openshift-mtv:gateway-yeeter-nad-reader" {
+		t.Fatalf("unexpected impersonated user %q", restConfig.Impersonate.UserName)
+	}
+	if k.base.Impersonate.UserName != "" {
+		t.Fatal("expected base configuration to stay unmodified")
+	}
+
+	restConfig, err = k.restConfig(lookupNamespace)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if restConfig.Impersonate.UserName != "" {
+		t.Fatal("expected no impersonation for unconfigured category")
+	}
+}
+
+func TestServiceAccountUsernameInvalid(t *testing.T) {
+	for _, sa := range []string{"", "name-only", "/name", "ns/", "a/b/c"} {
+		if _, err := serviceAccountUsername(sa); err == nil {
+			t.Fatalf("expected %q to be rejected", sa)
+		}
+	}
+}
+
+func TestLookupWithoutClusterConfig(t *testing.T) {
+	k := &kubeClients{}
+	if _, err := k.restConfig(lookupPlan); err == nil {
+		t.Fatal("expected error without base configuration")
+	}
+}
+
+func TestConfigureReportsKubeconfigError(t *testing.T) {
+	k := &kubeClients{}
+	kubeconfig := filepath.Join(t.TempDir(), "missing")
+	if err := k.configure(kubeconfig, nil); err == nil || !strings.Contains(err.Error(), kubeconfig) {
+		t.Fatalf("expected error naming %s, got %v", kubeconfig, err)
+	}
+	_, err := k.restConfig(lookupNAD)
+	if err == nil || !strings.Contains(err.Error(), kubeconfig) {
+		t.Fatalf("expected lookup error to carry the configuration error, got %v", err)
+	}
+}
+
+func TestConfigValidateKubeconfig(t *testing.T) {
+	c := defaultConfig()
+	c.Kubeconfig = filepath.Join(t.TempDir(), "missing")
+	if err := c.validate(); err == nil {
+		t.Fatal("expected missing kubeconfig to be rejected")
+	}
+}
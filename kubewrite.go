@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/klog/v2"
+)
+
+const (
+	kubeWriteAttempts   = 5
+	kubeWriteMinBackoff = 100 * time.Millisecond
+	kubeWriteMaxBackoff = 5 * time.Second
+
+	kubeWriteSuccess   = "success"
+	kubeWriteTransient = "transient"
+	kubeWritePermanent = "permanent"
+)
+
+var (
+	kubeWrites = newCounterVec(prometheus.CounterOpts{
+		Name: "gateway_yeeter_kube_writes_total",
+		Help: "Writes to the Kubernetes API by kind and result (success, transient: retries exhausted, permanent: not retryable).",
+	}, "kind", "result")
+	kubeWriteRetries = newCounterVec(prometheus.CounterOpts{
+		Name: "gateway_yeeter_kube_write_retries_total",
+		Help: "Retried attempts of writes to the Kubernetes API, by kind.",
+	}, "kind")
+)
+
+// retryKubeWrite calls write until it succeeds, fails permanently, ran
+// kubeWriteAttempts times or ctx is done, backing off exponentially between
+// attempts. write is retried as a whole, so a compare-and-swap that
+// conflicts reads the object again. Every outbound Kubernetes write goes
+// through here, kind names it in the metrics.
+func retryKubeWrite(ctx context.Context, kind string, write func(ctx context.Context) error) error {
+	backoff := kubeWriteMinBackoff
+	for attempt := 1; ; attempt++ {
+		err := write(ctx)
+		if err == nil {
+			kubeWrites.WithLabelValues(kind, kubeWriteSuccess).Inc()
+			return nil
+		}
+		if !retryableKubeError(err) {
+			kubeWrites.WithLabelValues(kind, kubeWritePermanent).Inc()
+			return err
+		}
+		if attempt == kubeWriteAttempts {
+			kubeWrites.WithLabelValues(kind, kubeWriteTransient).Inc()
+			return err
+		}
+
+		delay := backoff
+		if seconds, ok := apierrors.SuggestsClientDelay(err); ok {
+			delay = max(delay, time.Duration(seconds)*time.Second)
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			kubeWrites.WithLabelValues(kind, kubeWriteTransient).Inc()
+			return err
+		}
+		klog.V(2).Infof("Retrying %s write in %s after attempt %d failed: %v", kind, delay, attempt, err)
+		kubeWriteRetries.WithLabelValues(kind).Inc()
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			kubeWrites.WithLabelValues(kind, kubeWriteTransient).Inc()
+			return err
+		case <-timer.C:
+		}
+		backoff = min(2*backoff, kubeWriteMaxBackoff)
+	}
+}
+
+// retryableKubeError reports whether err is worth another attempt: stale
+// resourceVersions, throttling, overloaded or restarting API servers and
+// broken connections. Everything else, like missing RBAC or an invalid
+// object, fails the same way on every attempt.
+func retryableKubeError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		return apierrors.IsConflict(err) ||
+			apierrors.IsTooManyRequests(err) ||
+			apierrors.IsServerTimeout(err) ||
+			apierrors.IsTimeout(err) ||
+			apierrors.IsInternalError(err) ||
+			apierrors.IsServiceUnavailable(err) ||
+			apierrors.IsUnexpectedServerError(err)
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || utilnet.IsConnectionReset(err) || utilnet.IsConnectionRefused(err) || utilnet.IsProbableEOF(err)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+var planResource = schema.GroupResource{Group: planGVR.Group, Resource: planGVR.Resource}
+
+func TestRetryableKubeError(t *testing.T) {
+	for err, want := range map[error]bool{
+		apierrors.NewConflict(planResource, "migrate-db", errors.New("stale")): true,
+		apierrors.NewTooManyRequests("slow down", 1):                           true,
+		apierrors.NewServiceUnavailable("restarting"):                          true,
+		apierrors.NewInternalError(errors.New("etcd")):                         true,
+		io.ErrUnexpectedEOF: true,
+		apierrors.NewForbidden(planResource, "migrate-db", errors.New("rbac")): false,
+		apierrors.NewNotFound(planResource, "migrate-db"):                      false,
+		apierrors.NewBadRequest("invalid patch"):                               false,
+		context.DeadlineExceeded:                                               false,
+		errors.New("no Kubernetes client configuration"):                       false,
+	} {
+		if got := retryableKubeError(err); got != want {
+			t.Errorf("%v: expected retryable=%t, got %t", err, want, got)
+		}
+	}
+}
+
+func TestRetryKubeWrite(t *testing.T) {
+	success := testutil.ToFloat64(kubeWrites.WithLabelValues("test", kubeWriteSuccess))
+	permanent := testutil.ToFloat64(kubeWrites.WithLabelValues("test", kubeWritePermanent))
+	transient := testutil.ToFloat64(kubeWrites.WithLabelValues("test", kubeWriteTransient))
+
+	attempts := 0
+	err := retryKubeWrite(t.Context(), "test", func(ctx context.Context) error {
+		if attempts++; attempts < 3 {
+			return apierrors.NewConflict(planResource, "migrate-db", errors.New("stale"))
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Fatalf("expected success after 3 attempts, got %d: %v", attempts, err)
+	}
+
+	attempts = 0
+	err = retryKubeWrite(t.Context(), "test", func(ctx context.Context) error {
+		attempts++
+		return apierrors.NewForbidden(planResource, "migrate-db", errors.New("rbac"))
+	})
+	if !apierrors.IsForbidden(err) || attempts != 1 {
+		t.Fatalf("expected a single attempt for a permanent error, got %d: %v", attempts, err)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), kubeWriteMinBackoff/2)
+	defer cancel()
+	attempts = 0
+	err = retryKubeWrite(ctx, "test", func(ctx context.Context) error {
+		attempts++
+		return apierrors.NewServiceUnavailable("restarting")
+	})
+	if !apierrors.IsServiceUnavailable(err) || attempts != 1 {
+		t.Fatalf("expected to give up before the deadline, got %d: %v", attempts, err)
+	}
+
+	for result, before := range map[string]float64{kubeWriteSuccess: success, kubeWritePermanent: permanent, kubeWriteTransient: transient} {
+		if got := testutil.ToFloat64(kubeWrites.WithLabelValues("test", result)); got != before+1 {
+			t.Errorf("expected one %s write, got %v", result, got-before)
+		}
+	}
+}
+
+func TestPlanControllerRetriesConflicts(t *testing.T) {
+	client := withFakePlanObjects(t, map[schema.GroupVersionResource][]*unstructured.Unstructured{
+		planGVR: {testObject("forklift.konveyor.io/v1beta1", "Plan", "openshift-mtv", "migrate-db", "plan-uid")},
+	})
+	conflicts := 1
+	client.PrependReactor("patch", "plans", func(clienttesting.Action) (bool, runtime.Object, error) {
+		if conflicts > 0 {
+			conflicts--
+			return true, nil, apierrors.NewConflict(planResource, "migrate-db", errors.New("stale"))
+		}
+		return false, nil, nil
+	})
+
+	p := newPlanController()
+	p.record(&decision{UID: "a", Outcome: outcomeMutated, Time: time.Now(), owner: &podOwner{planUID: "plan-uid"}})
+	p.sync()
+	if summary := planSummaryOf(t, client); summary.Decisions[outcomeMutated] != 1 || len(p.deltas) != 0 {
+		t.Fatalf("expected the conflict to be retried within the sync, got %+v", summary)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	limitActionWarn = "warn"
+	limitActionDeny = "deny"
+
+	limitAttachments     = "attachments"
+	limitAnnotationBytes = "annotation_bytes"
+)
+
+var annotationLimitsExceeded = newCounterVec(prometheus.CounterOpts{
+	Name: "gateway_yeeter_annotation_limits_exceeded_total",
+	Help: "Target pods whose networks annotation exceeded --max-attachments or --max-networks-annotation-bytes, by limit and action.",
+}, "limit", "action")
+
+// annotationLimitViolation returns why annotation exceeds the configured
+// limits, or an empty string. The size is that of the annotation as written,
+// shorthand is counted in attachments like the JSON form. An annotation that
+// cannot be parsed is only checked for its size, parsing reports it later.
+func annotationLimitViolation(annotation string) string {
+	if cfg.MaxNetworksAnnotationBytes > 0 && len(annotation) > cfg.MaxNetworksAnnotationBytes {
+		annotationLimitsExceeded.WithLabelValues(limitAnnotationBytes, cfg.AnnotationLimitAction).Inc()
+		return fmt.Sprintf("networks annotation has %d bytes, more than the limit of %d", len(annotation), cfg.MaxNetworksAnnotationBytes)
+	}
+	if cfg.MaxAttachments > 0 {
+		var elements []json.RawMessage
+		expanded, _, err := expandNetworks(annotation)
+		if err == nil && json.Unmarshal([]byte(expanded), &elements) == nil && len(elements) > cfg.MaxAttachments {
+			annotationLimitsExceeded.WithLabelValues(limitAttachments, cfg.AnnotationLimitAction).Inc()
+			return fmt.Sprintf("networks annotation requests %d attachments, more than the limit of %d", len(elements), cfg.MaxAttachments)
+		}
+	}
+	return ""
+}
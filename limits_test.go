@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnnotationLimits(t *testing.T) {
+	old := cfg
+	defer func() { cfg = old }()
+	networks := `[{"name":"transfer","default-route":["10.0.0.1"]},{"name":"storage"},{"name":"backup"}]`
+
+	cases := []struct {
+		attachments int
+		bytes       int
+		action      string
+		outcome     string
+		reason      string
+		warning     string
+	}{
+		{0, 0, limitActionDeny, outcomeMutated, reasonMutated, ""},
+		{3, len(networks), limitActionDeny, outcomeMutated, reasonMutated, ""},
+		{2, 0, limitActionDeny, outcomeDenied, reasonDenyAnnotationLimit, ""},
+		{0, 64, limitActionDeny, outcomeDenied, reasonDenyAnnotationLimit, ""},
+		{2, 0, limitActionWarn, outcomeMutated, reasonMutated, "3 attachments, more than the limit of 2"},
+		{0, 64, limitActionWarn, outcomeMutated, reasonMutated, "more than the limit of 64"},
+	}
+	for _, c := range cases {
+		cfg.MaxAttachments, cfg.MaxNetworksAnnotationBytes, cfg.AnnotationLimitAction = c.attachments, c.bytes, c.action
+		resp, d := reviewRulesPod(t, "test", networks)
+		if d.Outcome != c.outcome || d.Reason != c.reason {
+			t.Errorf("%+v: expected %s/%s, got %s/%s", c, c.outcome, c.reason, d.Outcome, d.Reason)
+		}
+		if c.outcome == outcomeDenied && (resp.Allowed || string(resp.Result.Reason) != c.reason) {
+			t.Errorf("%+v: expected denial with reason %s, got %+v", c, c.reason, resp.Result)
+		}
+		var warned bool
+		for _, w := range resp.Warnings {
+			warned = warned || strings.Contains(w, reasonWarnAnnotationLimit)
+			if c.warning != "" && strings.Contains(w, reasonWarnAnnotationLimit) && !strings.Contains(w, c.warning) {
+				t.Errorf("%+v: expected warning containing %q, got %q", c, c.warning, w)
+			}
+		}
+		if warned != (c.warning != "") {
+			t.Errorf("%+v: unexpected warnings %v", c, resp.Warnings)
+		}
+	}
+}
+
+func TestAnnotationLimitsIgnoreUnparsable(t *testing.T) {
+	old := cfg
+	defer func() { cfg = old }()
+	cfg.MaxAttachments = 1
+	if msg := annotationLimitViolation("transfer,Storage@"); msg != "" {
+		t.Fatalf("expected no violation for an unparsable annotation, got %q", msg)
+	}
+	if msg := annotationLimitViolation("transfer,storage"); msg == "" {
+		t.Fatal("expected shorthand attachments to be counted")
+	}
+}
+
+func TestAnnotationLimitWarningSurvivesPatchValidation(t *testing.T) {
+	old := cfg
+	defer func() { cfg = old }()
+	cfg.MaxAttachments, cfg.AnnotationLimitAction = 1, limitActionWarn
+
+	resp, d := reviewRulesPod(t, "test", `[{"name":"transfer","default-route":["10.0.0.1"],"mac":"not-a-mac"},{"name":"storage"}]`)
+	if d.Reason != reasonErrPatchValidation {
+		t.Fatalf("expected %s, got %s/%s", reasonErrPatchValidation, d.Outcome, d.Reason)
+	}
+	var limit, validation bool
+	for _, w := range resp.Warnings {
+		limit = limit || strings.Contains(w, reasonWarnAnnotationLimit)
+		validation = validation || strings.Contains(w, reasonErrPatchValidation)
+	}
+	if !limit || !validation {
+		t.Errorf("expected both the limit and the validation warning, got %v", resp.Warnings)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// structuredLogs is set with --log-format=json, reviewLogger then attaches
+// its fields to every line instead of relying on the printf message.
+var structuredLogs bool
+
+// setupLogFormat routes klog through a JSON slog handler with
+// --log-format=json. klog still applies -v, so the handler accepts every
+// level.
+func setupLogFormat(format string, w io.Writer) {
+	if format != logFormatJSON {
+		return
+	}
+	klog.SetSlogLogger(slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: slog.Level(-128)})))
+	structuredLogs = true
+}
+
+// reviewLogger logs the lines of one admission review. In text mode the
+// lines are exactly those of klog, in JSON mode they carry the namespace,
+// pod, uid, podType and network of the review as fields.
+type reviewLogger struct {
+	values []interface{}
+}
+
+func newReviewLogger(namespace, pod, uid string) reviewLogger {
+	return reviewLogger{values: []interface{}{"namespace", namespace, "pod", pod, "uid", uid}}
+}
+
+// with returns a logger with the additional key/value pairs.
+func (l reviewLogger) with(keysAndValues ...interface{}) reviewLogger {
+	return reviewLogger{values: append(append([]interface{}(nil), l.values...), keysAndValues...)}
+}
+
+// network returns a logger for lines about the attachment name.
+func (l reviewLogger) network(name string) reviewLogger {
+	return l.with("network", cfg.Redaction.value(channelLogs, fieldNetworks, name))
+}
+
+func (l reviewLogger) Infof(format string, args ...interface{}) {
+	if !structuredLogs {
+		klog.InfofDepth(1, format, args...)
+		return
+	}
+	klog.Background().WithCallDepth(1).Info(fmt.Sprintf(format, args...), l.values...)
+}
+
+func (l reviewLogger) Warningf(format string, args ...interface{}) {
+	if !structuredLogs {
+		klog.WarningfDepth(1, format, args...)
+		return
+	}
+	klog.Background().WithCallDepth(1).Info(fmt.Sprintf(format, args...), append([]interface{}{"severity", "warning"}, l.values...)...)
+}
+
+func (l reviewLogger) Errorf(format string, args ...interface{}) {
+	if !structuredLogs {
+		klog.ErrorfDepth(1, format, args...)
+		return
+	}
+	klog.Background().WithCallDepth(1).Error(nil, fmt.Sprintf(format, args...), l.values...)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"k8s.io/klog/v2"
+)
+
+func withJSONLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	setupLogFormat(logFormatJSON, &buf)
+	t.Cleanup(func() {
+		klog.ClearLogger()
+		structuredLogs = false
+	})
+	return &buf
+}
+
+func TestReviewLoggerJSON(t *testing.T) {
+	buf := withJSONLogs(t)
+	log := newReviewLogger("mtv", "importer-test", "test").with("podType", "cdi")
+	log.network("mtv/transfer").Infof("YEETING default-route from network %s", "mtv/transfer")
+	log.Warningf("something odd")
+	log.Errorf("something broken")
+	klog.Flush()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %q", buf.String())
+	}
+	var line map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &line); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{"msg": "YEETING default-route from network mtv/transfer", "namespace": "mtv", "pod": "importer-test", "uid": "test", "podType": "cdi", "network": "mtv/transfer"} {
+		if line[key] != want {
+			t.Errorf("expected %s=%q, got %v", key, want, line[key])
+		}
+	}
+	if !strings.Contains(lines[1], `"severity":"warning"`) || !strings.Contains(lines[2], `"level":"ERROR"`) {
+		t.Fatalf("expected a warning and an error, got %q", lines[1:])
+	}
+}
+
+func TestReviewJSONLogs(t *testing.T) {
+	buf := withJSONLogs(t)
+	reviewRulesPod(t, "test", `[{"name":"transfer","default-route":["10.0.0.1"]}]`)
+	klog.Flush()
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) < 3 {
+		t.Fatalf("expected the review to be logged, got %q", buf.String())
+	}
+	for _, raw := range lines {
+		var line map[string]interface{}
+		if err := json.Unmarshal([]byte(raw), &line); err != nil {
+			t.Fatalf("expected JSON, got %q", raw)
+		}
+		if line["uid"] != "test" || line["pod"] != "importer-test" {
+			t.Errorf("expected the review fields, got %q", raw)
+		}
+	}
+}
@@ -2,189 +2,806 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
+	"gateway-yeeter/pkg/jsonpatch6902"
+	"gateway-yeeter/pkg/podtemplate"
 	admissionv1 "k8s.io/api/admission/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/klog/v2"
-
-	cnitypes "github.com/ovn-org/ovn-kubernetes/go-controller/pkg/cni/types"
 )
 
-type patch struct {
-	Op    string      `json:"op"`
-	Path  string      `json:"path"`
-	Value interface{} `json:"value,omitempty"`
+type patch = jsonpatch6902.Operation
+
+func deniedResponse(reason, msg string) *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{
+		Allowed: false,
+		Result: &metav1.Status{
+			Message: "gateway-yeeter: " + msg,
+			Reason:  metav1.StatusReason(reason),
+			Code:    http.StatusForbidden,
+		},
+	}
+}
+
+func errorResponse(reason string, err error) *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{
+		Result: &metav1.Status{
+			Message: err.Error(),
+			Reason:  metav1.StatusReason(reason),
+		},
+	}
 }
 
 func reviewPod(ar *admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
-	var pod corev1.Pod
+	return reviewPodWithStages(ar, nil)
+}
 
-	if err := json.Unmarshal(ar.Request.Object.Raw, &pod); err != nil {
+// reviewPodWithStages is reviewPod attributing its time to the stages of
+// the request.
+func reviewPodWithStages(ar *admissionv1.AdmissionReview, stages *stageTimer) *admissionv1.AdmissionResponse {
+	d := newDecision(ar)
+	d.stages = stages
+	stampPolicyVersion(d)
+	defer recordDecision(d)
+	var resp *admissionv1.AdmissionResponse
+	var ruleDryRun bool
+	if cfg.CompareRules {
+		resp = evaluatePod(ar, d, nil)
+		compareRuleEngine(ar, d)
+	} else {
+		rules := ruleSources.current()
+		resp = evaluatePod(ar, d, rules)
+		ruleDryRun = rules.dryRun(d.Rule)
+	}
+	if maintenance.current().Enabled {
+		return passThrough(modeMaintenance, d, resp)
+	}
+	if cfg.DryRun || ruleDryRun {
+		return passThrough(modeDryRun, d, resp)
+	}
+	if cfg.Shadow {
+		return passThrough(modeShadow, d, resp)
+	}
+	return resp
+}
+
+// evaluatePod reviews the pod of ar and fills in d without recording it, so
+// offline tooling can evaluate pods exactly like the webhook does. Without
+// rules every target pod is stripped.
+func evaluatePod(ar *admissionv1.AdmissionReview, d *decision, rules ruleSet) *admissionv1.AdmissionResponse {
+	if ar.Request.Operation == admissionv1.Delete {
+		return reviewDelete(ar, d)
+	}
+
+	kind := ar.Request.Kind.Kind
+	if kind == "" {
+		kind = "Pod"
+	}
+	template, err := podtemplate.Extract(kind, ar.Request.Object.Raw)
+	if err != nil {
 		klog.Errorf("Could not unmarshal pod: %v", err)
-		return &admissionv1.AdmissionResponse{
-			Result: &metav1.Status{
-				Message: err.Error(),
-			},
-		}
+		d.Outcome, d.Reason, d.Message = outcomeError, reasonErrPodUnmarshal, err.Error()
+		return errorResponse(d.Reason, err)
 	}
+	pod := template.Pod
 
 	podName := pod.Name
 	if pod.Name == "" {
 		podName = pod.GenerateName + "<generated>"
 	}
+	if pod.Namespace != "" {
+		d.Namespace = pod.Namespace
+	}
+	d.Pod = podName
+	logNS := cfg.Redaction.value(channelLogs, fieldNamespace, d.Namespace)
+	logPod := cfg.Redaction.value(channelLogs, fieldPod, podName)
+	log := newReviewLogger(logNS, logPod, string(ar.Request.UID))
 
-	podType := ""
-	if pod.Labels["forklift.app"] == "virt-v2v" {
-		podType = "virt-v2v"
-	} else if pod.Labels["app"] == "containerized-data-importer" {
-		podType = "cdi"
+	if !namespaceInScope(d.Namespace) {
+		log.Warningf("Reviewing pod %s/%s outside the configured namespace scope - This should not happen, skipping the pod.", logNS, logPod)
+		misdirected.observe(misdirectedNamespace, d.Namespace)
+		d.Outcome, d.Reason, d.Message = outcomeSkipped, reasonSkipNamespaceScope, "namespace outside configured scope"
+		return &admissionv1.AdmissionResponse{
+			Allowed: true,
+		}
+	}
+
+	if namespaceExcluded(d.Namespace) {
+		log.Infof("Leaving pod %s/%s unmodified, its namespace is excluded", logNS, logPod)
+		d.Outcome, d.Reason, d.Message = outcomeSkipped, reasonSkipNamespaceExcluded, "namespace excluded"
+		return &admissionv1.AdmissionResponse{
+			Allowed: true,
+		}
+	}
+
+	if ignored, err := namespaceLabels.ignored(cfg.IgnoreNamespaceSelector, d.Namespace); err != nil {
+		log.Warningf("Cannot match the namespace of pod %s/%s against --ignore-namespace-selector, reviewing it: %v", logNS, logPod, err)
+	} else if ignored {
+		log.Infof("Leaving pod %s/%s unmodified, its namespace matches --ignore-namespace-selector", logNS, logPod)
+		d.Outcome, d.Reason, d.Message = outcomeSkipped, reasonSkipNamespaceIgnored, "namespace labels match ignore-namespace-selector"
+		return &admissionv1.AdmissionResponse{
+			Allowed: true,
+		}
+	}
+
+	var target targetPod
+	if targets := classifications.classify(d.Namespace, pod.Labels, pod.OwnerReferences); len(targets) > 0 {
+		target = targets[0]
+		if len(targets) > 1 {
+			var types []string
+			for _, t := range targets {
+				types = append(types, t.name)
+			}
+			log.Warningf("Pod %s/%s matches pod types %v, treating it as %s", logNS, logPod, types, target.name)
+			d.MatchedPodTypes = types
+		}
+	} else if targetPolicies != nil {
+		// The webhook receives every pod in scope when policies select them.
+		klog.V(2).Infof("Leaving pod %s/%s unmodified, no %s selects it", logNS, logPod, targetPolicyKind)
+		d.Outcome, d.Reason, d.Message = outcomeSkipped, reasonSkipNotTarget, "not selected by a "+targetPolicyKind
+		return &admissionv1.AdmissionResponse{
+			Allowed: true,
+		}
 	} else {
-		klog.Warningf("Reviewing non virt-v2v or non cdi pod: %s/%s - This should not happen, skipping the pod.", pod.Namespace, podName)
+		log.Warningf("Reviewing non virt-v2v or non cdi pod: %s/%s - This should not happen, skipping the pod.", logNS, logPod)
+		misdirected.observe(misdirectedPod, d.Namespace)
+		d.Outcome, d.Reason, d.Message = outcomeSkipped, reasonSkipNotTarget, "not a virt-v2v or cdi pod"
 		return &admissionv1.AdmissionResponse{
 			Allowed: true,
 		}
 	}
 
+	podType := target.name
+	d.PodType = podType
+	log = log.with("podType", podType)
+	d.PodContext = podContextFor(&pod, cfg.PodContext)
+	update := ar.Request.Operation == admissionv1.Update
+	if update && !cfg.HandleHotplug {
+		d.Outcome, d.Reason, d.Message = outcomeSkipped, reasonSkipUpdate, "update admission, hotplug handling disabled"
+		return &admissionv1.AdmissionResponse{
+			Allowed: true,
+		}
+	}
+	var matched *rule
+	if matches := rules.matchAll(d.Namespace, podType, d.Time); len(matches) > 0 {
+		matched = matches[0]
+		d.Rule = matched.Name
+		if names := ambiguousRuleNames(matches); names != nil {
+			log.Infof("Rules %v with different actions match %s pod %s/%s (uid=%s), applying %s", names, podType, logNS, logPod, ar.Request.UID, matched.Name)
+			d.MatchedRules = names
+		}
+		if matched.Action == actionIgnore {
+			log.Infof("Leaving %s pod %s/%s (uid=%s) unmodified, ignored by rule %s", podType, logNS, logPod, ar.Request.UID, matched.Name)
+			d.Outcome, d.Reason, d.Message = outcomeSkipped, reasonSkipOptOut, "ignored by rule "+matched.Name
+			return &admissionv1.AdmissionResponse{
+				Allowed: true,
+			}
+		}
+	}
+	owner := &podOwner{planUID: pod.Labels[forkliftPlanLabel], namespace: d.Namespace, refs: pod.OwnerReferences}
+	if len(cfg.ScopePlans) > 0 {
+		previous := d.stages.enter(stageEnrich)
+		inScope, planUID, err := scopedPlans.allows(cfg.ScopePlans, owner)
+		d.stages.enter(previous)
+		if err != nil {
+			log.Warningf("Cannot trace %s pod %s/%s (uid=%s) to a Forklift Plan, leaving it unmodified: %v", podType, logNS, logPod, ar.Request.UID, err)
+			d.Outcome, d.Reason, d.Message = outcomeSkipped, reasonErrPlanLookup, "cannot trace pod to a Forklift Plan: "+err.Error()
+			return &admissionv1.AdmissionResponse{
+				Allowed: true,
+			}
+		}
+		if !inScope {
+			log.Infof("Leaving %s pod %s/%s (uid=%s) unmodified, Forklift Plan %q is not in --scope-plans", podType, logNS, logPod, ar.Request.UID, planUID)
+			d.Outcome, d.Reason, d.Message = outcomeSkipped, reasonSkipPlanScope, "forklift plan outside configured scope"
+			return &admissionv1.AdmissionResponse{
+				Allowed: true,
+			}
+		}
+	}
+	if ar.Request.DryRun == nil || !*ar.Request.DryRun {
+		d.owner = owner
+	}
+	d.stages.enter(stagePatch)
 	uid := string(ar.Request.UID)
-	klog.Infof("Reviewing %s pod: %s/%s (uid=%s)", podType, pod.Namespace, podName, uid)
+	log.Infof("Reviewing %s pod: %s/%s (uid=%s)", podType, logNS, logPod, uid)
 
 	var patches []patch
+	var warnings []string
 	if networksAnnotation, exists := pod.Annotations["k8s.v1.cni.cncf.io/networks"]; exists {
-		klog.Infof("Found networks annotation on %s pod %s/%s (uid=%s): %s", podType, pod.Namespace, podName, uid, networksAnnotation)
+		log.Infof("Found networks annotation on %s pod %s/%s (uid=%s): %s", podType, logNS, logPod, uid, cfg.Redaction.annotation(channelLogs, networksAnnotation))
+		if normalized, changed := normalizeAnnotation(networksAnnotation); changed {
+			log.Infof("Stripped whitespace or byte order marks around k8s.v1.cni.cncf.io/networks on %s pod %s/%s (uid=%s)", podType, logNS, logPod, uid)
+			networksAnnotation = normalized
+		}
+
+		if msg := annotationLimitViolation(networksAnnotation); msg != "" {
+			if cfg.AnnotationLimitAction == limitActionDeny {
+				log.Infof("Denying %s pod %s/%s (uid=%s): %s", podType, logNS, logPod, uid, msg)
+				d.Outcome, d.Reason, d.Message = outcomeDenied, reasonDenyAnnotationLimit, msg
+				return deniedResponse(d.Reason, msg)
+			}
+			log.Warningf("Limit exceeded by %s pod %s/%s (uid=%s): %s", podType, logNS, logPod, uid, msg)
+			warnings = append(warnings, warning(reasonWarnAnnotationLimit, msg))
+		}
 
-		var networks []cnitypes.NetworkSelectionElement
-		if err := json.Unmarshal([]byte(networksAnnotation), &networks); err != nil {
-			klog.Warningf("Cannot parse k8s.v1.cni.cncf.io/networks on %s pod %s/%s (uid=%s): %v", podType, pod.Namespace, podName, uid, err)
+		expanded, shorthand, err := expandNetworks(networksAnnotation)
+		if err != nil {
+			log.Warningf("Cannot parse k8s.v1.cni.cncf.io/networks on %s pod %s/%s (uid=%s): %v", podType, logNS, logPod, uid, err)
+			d.Outcome, d.Reason, d.Message = outcomeSkipped, reasonErrAnnotationParse, "cannot parse networks annotation: "+err.Error()
 			return &admissionv1.AdmissionResponse{
-				Allowed: true,
+				Allowed:  true,
+				Warnings: append(warnings, warning(reasonWarnAnnotationParse, d.Message)),
+			}
+		}
+		if shorthand {
+			log.Infof("Networks annotation on %s pod %s/%s (uid=%s) uses the shorthand form, which cannot request a gateway", podType, logNS, logPod, uid)
+			networksAnnotation = expanded
+		}
+
+		var existing map[int]bool
+		if update {
+			var oldPod corev1.Pod
+			err := json.Unmarshal(ar.Request.OldObject.Raw, &oldPod)
+			if err == nil {
+				existing, err = existingAttachments(networksAnnotation, oldPod.Annotations["k8s.v1.cni.cncf.io/networks"], d.Namespace)
+			}
+			if err != nil {
+				log.Warningf("Cannot compare networks annotation of %s pod %s/%s (uid=%s) with its previous version, leaving it unmodified: %v", podType, logNS, logPod, uid, err)
+				d.Outcome, d.Reason, d.Message = outcomeSkipped, reasonErrHotplugCompare, "cannot determine hotplugged networks: "+err.Error()
+				return &admissionv1.AdmissionResponse{
+					Allowed: true,
+				}
+			}
+		}
+
+		ipamYeeted := false
+		if cfg.StripIPAMRoutes {
+			modified, changes, err := yeetIPAMRoutes(networksAnnotation, existing)
+			if err != nil {
+				log.Warningf("Cannot parse cni-args in k8s.v1.cni.cncf.io/networks on %s pod %s/%s (uid=%s): %v", podType, logNS, logPod, uid, err)
+			} else if len(changes) > 0 {
+				for _, change := range changes {
+					log.network(change.Network).Infof("YEETING IPAM gateway(s) from cni-args of network %s on %s pod %s/%s (uid=%s)!", cfg.Redaction.value(channelLogs, fieldNetworks, change.Network), podType, logNS, logPod, uid)
+				}
+				d.Networks = append(d.Networks, changes...)
+				networksAnnotation = modified
+				ipamYeeted = true
+			}
+		}
+
+		networks, err := parseNetworks(networksAnnotation)
+		if err != nil {
+			log.Warningf("Cannot parse k8s.v1.cni.cncf.io/networks on %s pod %s/%s (uid=%s): %v", podType, logNS, logPod, uid, err)
+			d.Outcome, d.Reason, d.Message = outcomeSkipped, reasonErrAnnotationParse, "cannot parse networks annotation: "+err.Error()
+			return &admissionv1.AdmissionResponse{
+				Allowed:  true,
+				Warnings: append(warnings, warning(reasonWarnAnnotationParse, d.Message)),
+			}
+		}
+
+		if matched != nil && matched.Action == actionDeny {
+			requested := d.Networks
+			for i := range networks {
+				remove, _ := splitGateways(networks[i].GatewayRequest)
+				if len(remove) > 0 && !existing[i] && target.targetsNetwork(attachmentNamespace(networks[i].Namespace, d.Namespace), networks[i].Name) {
+					change := networkChange{Network: networks[i].Namespace + "/" + networks[i].Name}
+					for _, gw := range remove {
+						change.RemovedGateways = append(change.RemovedGateways, gw.String())
+					}
+					requested = append(requested, change)
+				}
+			}
+			if len(requested) > 0 {
+				var names []string
+				for _, change := range requested {
+					names = append(names, change.Network)
+				}
+				msg := denyMessage(matched, names)
+				log.Infof("Denying %s pod %s/%s (uid=%s): %s", podType, logNS, logPod, uid, cfg.Redaction.value(channelLogs, fieldNetworks, msg))
+				d.Outcome, d.Reason, d.Message, d.Networks = outcomeDenied, reasonDenyRule, msg, requested
+				return deniedResponse(d.Reason, msg)
 			}
 		}
 
 		yeeted := false
 		for i := range networks {
-			if len(networks[i].GatewayRequest) > 0 {
-				klog.Infof("YEETING default-route %v from network %s/%s on %s pod %s/%s (uid=%s)!", networks[i].GatewayRequest, networks[i].Namespace, networks[i].Name, podType, pod.Namespace, podName, uid)
-				networks[i].GatewayRequest = nil
+			if len(networks[i].GatewayRequest) > 0 && !existing[i] {
+				if !target.targetsNetwork(attachmentNamespace(networks[i].Namespace, d.Namespace), networks[i].Name) {
+					log.network(networks[i].Namespace+"/"+networks[i].Name).Infof("Keeping default-route on network %s of %s pod %s/%s (uid=%s), it is not a target network of %s %s", cfg.Redaction.value(channelLogs, fieldNetworks, networks[i].Namespace+"/"+networks[i].Name), podType, logNS, logPod, uid, targetPolicyKind, target.origin)
+					continue
+				}
+				remove, keep := splitGateways(networks[i].GatewayRequest)
+				if len(remove) == 0 {
+					log.network(networks[i].Namespace+"/"+networks[i].Name).Infof("Keeping default-route on network %s of %s pod %s/%s (uid=%s), its gateways are within --keep-gateway-cidrs", cfg.Redaction.value(channelLogs, fieldNetworks, networks[i].Namespace+"/"+networks[i].Name), podType, logNS, logPod, uid)
+					continue
+				}
+				change := networkChange{Network: networks[i].Namespace + "/" + networks[i].Name}
+				if cfg.SRIOVPolicy != sriovPolicyIgnore {
+					nadNamespace := attachmentNamespace(networks[i].Namespace, d.Namespace)
+					previous := d.stages.enter(stageEnrich)
+					resourceName, err := nads.resourceName(nadNamespace, networks[i].Name)
+					d.stages.enter(previous)
+					if err != nil {
+						log.Warningf("Cannot look up NetworkAttachmentDefinition %s/%s for %s pod %s/%s (uid=%s), treating it as non-SR-IOV: %v", nadNamespace, networks[i].Name, podType, logNS, logPod, uid, err)
+					} else if resourceName != "" {
+						sriovAttachments.WithLabelValues(cfg.SRIOVPolicy).Inc()
+						change.SRIOVResource = resourceName
+						switch cfg.SRIOVPolicy {
+						case sriovPolicySkip:
+							log.network(change.Network).Infof("Keeping default-route on SR-IOV network %s (%s) of %s pod %s/%s (uid=%s)", cfg.Redaction.value(channelLogs, fieldNetworks, change.Network), resourceName, podType, logNS, logPod, uid)
+							continue
+						case sriovPolicyDeny:
+							msg := fmt.Sprintf("default-route requested on SR-IOV network %s (%s) is not allowed", change.Network, resourceName)
+							log.Infof("Denying %s pod %s/%s (uid=%s): %s", podType, logNS, logPod, uid, msg)
+							d.Outcome, d.Reason, d.Message = outcomeDenied, reasonDenySRIOV, msg
+							return deniedResponse(d.Reason, msg)
+						}
+					}
+				}
+				var logGateways []string
+				for _, gw := range remove {
+					change.RemovedGateways = append(change.RemovedGateways, gw.String())
+					logGateways = append(logGateways, cfg.Redaction.value(channelLogs, fieldGateways, gw.String()))
+				}
+				log.network(change.Network).Infof("YEETING default-route %v from network %s on %s pod %s/%s (uid=%s)!", logGateways, cfg.Redaction.value(channelLogs, fieldNetworks, change.Network), podType, logNS, logPod, uid)
+				d.Networks = append(d.Networks, change)
+				networks[i].GatewayRequest = keep
 				yeeted = true
 			}
 		}
 
+		modifiedNetworks := []byte(networksAnnotation)
 		if yeeted {
-			modifiedNetworks, err := json.Marshal(networks)
+			modifiedNetworks, err = marshalNetworks(networksAnnotation, networks)
+			if err != nil {
+				log.Errorf("Could not marshal modified networks: %v", err)
+				d.Outcome, d.Reason, d.Message = outcomeError, reasonErrPatchMarshal, err.Error()
+				return errorResponse(d.Reason, err)
+			}
+		}
+
+		injected := false
+		if matched != nil && matched.Action == actionInject {
+			modified, change, err := injectRoutes(string(modifiedNetworks), d.Namespace, matched, existing)
 			if err != nil {
-				klog.Errorf("Could not marshal modified networks: %v", err)
+				log.Warningf("Cannot inject routes of rule %s into %s pod %s/%s (uid=%s): %v", matched.Name, podType, logNS, logPod, uid, err)
+			} else if change != nil {
+				log.network(change.Network).Infof("Injecting %v into network %s on %s pod %s/%s (uid=%s)", change.AddedRoutes, cfg.Redaction.value(channelLogs, fieldNetworks, change.Network), podType, logNS, logPod, uid)
+				d.Networks = append(d.Networks, *change)
+				modifiedNetworks = []byte(modified)
+				injected = true
+			}
+		}
+
+		if cfg.InterfaceConflictAction != interfaceConflictIgnore {
+			if msg := interfaceConflict(string(modifiedNetworks), d.Namespace, existing); msg != "" {
+				if cfg.InterfaceConflictAction == interfaceConflictDeny {
+					log.Infof("Denying %s pod %s/%s (uid=%s): %s", podType, logNS, logPod, uid, cfg.Redaction.value(channelLogs, fieldNetworks, msg))
+					d.Outcome, d.Reason, d.Message = outcomeDenied, reasonDenyInterfaceConflict, msg
+					return deniedResponse(d.Reason, msg)
+				}
+				log.Warningf("Interface conflict on %s pod %s/%s (uid=%s): %s", podType, logNS, logPod, uid, cfg.Redaction.value(channelLogs, fieldNetworks, msg))
+				warnings = append(warnings, warning(reasonWarnInterfaceConflict, msg))
+			}
+		}
+
+		if yeeted || ipamYeeted || injected {
+			if err := validateNetworkSelectionElements(modifiedNetworks); err != nil {
+				var serr *schemaError
+				if errors.As(err, &serr) {
+					patchValidationFailures.WithLabelValues(serr.field).Inc()
+				}
+				log.Errorf("Refusing to patch %s pod %s/%s (uid=%s), Multus would reject the rewritten networks annotation: %v", podType, logNS, logPod, uid, err)
+				d.Outcome, d.Reason, d.Message = outcomeError, reasonErrPatchValidation, "rewritten networks annotation failed validation: "+err.Error()
 				return &admissionv1.AdmissionResponse{
-					Result: &metav1.Status{
-						Message: err.Error(),
-					},
+					Allowed:  true,
+					Warnings: append(warnings, warning(d.Reason, "networks annotation left unmodified, rewritten annotation failed validation: "+err.Error())),
 				}
 			}
 
-			klog.Infof("New networks annotation for %s pod %s/%s (uid=%s): %s", podType, pod.Namespace, podName, uid, modifiedNetworks)
-			patches = append(patches, patch{
-				Op:    "replace",
-				Path:  "/metadata/annotations/k8s.v1.cni.cncf.io~1networks",
-				Value: string(modifiedNetworks),
-			})
+			// At -v=2 the changes are easier to review as a diff than as the
+			// full annotation, which was already logged above.
+			var diff string
+			if klog.V(2).Enabled() {
+				diff, _ = networksDiff(networksAnnotation, string(modifiedNetworks), channelLogs)
+			}
+			if diff != "" {
+				log.Infof("Changed networks annotation of %s pod %s/%s (uid=%s): %s", podType, logNS, logPod, uid, diff)
+			} else {
+				log.Infof("New networks annotation for %s pod %s/%s (uid=%s): %s", podType, logNS, logPod, uid, cfg.Redaction.annotation(channelLogs, string(modifiedNetworks)))
+			}
+			patches = append(patches, jsonpatch6902.ReplaceAnnotation("k8s.v1.cni.cncf.io/networks", string(modifiedNetworks)))
+		}
+	}
+
+	if defaultNetwork, exists := pod.Annotations[defaultNetworkAnnotation]; exists && !update {
+		if normalized, changed := normalizeAnnotation(defaultNetwork); changed {
+			log.Infof("Stripped whitespace or byte order marks around %s on %s pod %s/%s (uid=%s)", defaultNetworkAnnotation, podType, logNS, logPod, uid)
+			defaultNetwork = normalized
+		}
+		modified, changes, err := yeetDefaultNetwork(defaultNetwork, d.Namespace, target)
+		if err == nil && len(changes) > 0 {
+			err = validateNetworkSelectionElements([]byte(modified))
+		}
+		if err != nil {
+			log.Warningf("Cannot strip %s on %s pod %s/%s (uid=%s), leaving it unmodified: %v", defaultNetworkAnnotation, podType, logNS, logPod, uid, err)
+		} else if len(changes) > 0 {
+			if matched != nil && matched.Action == actionDeny {
+				var names []string
+				for _, change := range changes {
+					names = append(names, change.Network)
+				}
+				msg := denyMessage(matched, names)
+				log.Infof("Denying %s pod %s/%s (uid=%s): %s", podType, logNS, logPod, uid, cfg.Redaction.value(channelLogs, fieldNetworks, msg))
+				d.Outcome, d.Reason, d.Message, d.Networks = outcomeDenied, reasonDenyRule, msg, append(d.Networks, changes...)
+				return deniedResponse(d.Reason, msg)
+			}
+			for _, change := range changes {
+				log.network(change.Network).Infof("YEETING default-route %v from default network %s on %s pod %s/%s (uid=%s)!", cfg.Redaction.value(channelLogs, fieldGateways, strings.Join(change.RemovedGateways, ",")), cfg.Redaction.value(channelLogs, fieldNetworks, change.Network), podType, logNS, logPod, uid)
+			}
+			d.Networks = append(d.Networks, changes...)
+			patches = append(patches, jsonpatch6902.ReplaceAnnotation(defaultNetworkAnnotation, modified))
+		}
+	}
+
+	if podNetworks, exists := pod.Annotations[ovnPodNetworksAnnotation]; exists && cfg.HandleOVNPodNetworks && !update {
+		modified, changes, err := yeetOVNPodNetworks(podNetworks)
+		if err != nil {
+			log.Warningf("Cannot parse %s on %s pod %s/%s (uid=%s): %v", ovnPodNetworksAnnotation, podType, logNS, logPod, uid, err)
+		} else if len(changes) > 0 {
+			for _, change := range changes {
+				log.network(change.Network).Infof("YEETING OVN gateway(s) from non-primary network %s on %s pod %s/%s (uid=%s)!", cfg.Redaction.value(channelLogs, fieldNetworks, change.Network), podType, logNS, logPod, uid)
+			}
+			d.Networks = append(d.Networks, changes...)
+			patches = append(patches, jsonpatch6902.ReplaceAnnotation(ovnPodNetworksAnnotation, modified))
+		}
+	}
+
+	if cfg.OVNRoutingAnnotations != ovnRoutingIgnore && !update {
+		for _, key := range ovnRoutingPodAnnotations(pod.Annotations) {
+			ovnRoutingAnnotationsSeen.WithLabelValues("pod", cfg.OVNRoutingAnnotations).Inc()
+			if cfg.OVNRoutingAnnotations == ovnRoutingStrip {
+				log.Infof("YEETING OVN routing annotation %s from %s pod %s/%s (uid=%s)!", key, podType, logNS, logPod, uid)
+				d.RemovedAnnotations = append(d.RemovedAnnotations, key)
+				patches = append(patches, jsonpatch6902.RemoveAnnotation(key))
+			} else {
+				log.Warningf("Found OVN routing annotation %s on %s pod %s/%s (uid=%s), it may reintroduce external gateway routing", key, podType, logNS, logPod, uid)
+				warnings = append(warnings, warning(reasonWarnOVNRouting, fmt.Sprintf("pod carries %s which may reintroduce external gateway routing", key)))
+			}
+		}
+
+		if cfg.CheckNamespaceRouting {
+			previous := d.stages.enter(stageEnrich)
+			gws, err := namespaceExternalGateways(d.Namespace)
+			d.stages.enter(previous)
+			if err != nil {
+				log.Warningf("Cannot check namespace routing annotations for %s pod %s/%s (uid=%s): %v", podType, logNS, logPod, uid, err)
+			} else if gws != "" {
+				ovnRoutingAnnotationsSeen.WithLabelValues("namespace", ovnRoutingWarn).Inc()
+				log.Warningf("Namespace %s of %s pod %s (uid=%s) has %s=%s, egress of the pod is routed via external gateways", logNS, podType, logPod, uid, ovnRoutingExternalGWsAnnotation, cfg.Redaction.value(channelLogs, fieldGateways, gws))
+				warnings = append(warnings, warning(reasonWarnNamespaceRoutes, fmt.Sprintf("namespace carries %s, pod egress is routed via external gateways", ovnRoutingExternalGWsAnnotation)))
+			}
+		}
+	}
+
+	if matched != nil && !update {
+		for _, key := range matched.annotationsToRemove(pod.Annotations) {
+			if contains(d.RemovedAnnotations, key) {
+				continue
+			}
+			log.Infof("Removing annotation %s from %s pod %s/%s (uid=%s) by rule %s", key, podType, logNS, logPod, uid, matched.Name)
+			d.RemovedAnnotations = append(d.RemovedAnnotations, key)
+			patches = append(patches, jsonpatch6902.RemoveAnnotation(key))
 		}
 	}
 
 	if len(patches) == 0 {
-		klog.Infof("No networks annotation or no default-route(s) found on %s pod %s/%s (uid=%s)", podType, pod.Namespace, podName, uid)
+		log.Infof("No networks annotation or no default-route(s) found on %s pod %s/%s (uid=%s)", podType, logNS, logPod, uid)
+		d.Outcome, d.Reason = outcomeUnchanged, reasonUnchanged
 		return &admissionv1.AdmissionResponse{
-			Allowed: true,
+			Allowed:  true,
+			Warnings: warnings,
 		}
 	}
 
-	patchBytes, err := json.Marshal(patches)
+	patchBytes, err := jsonpatch6902.Marshal(template.Rebase(patches))
 	if err != nil {
-		klog.Errorf("Could not marshal patches: %v", err)
-		return &admissionv1.AdmissionResponse{
-			Result: &metav1.Status{
-				Message: err.Error(),
-			},
-		}
+		log.Errorf("Could not marshal patches: %v", err)
+		d.Outcome, d.Reason, d.Message = outcomeError, reasonErrPatchMarshal, err.Error()
+		return errorResponse(d.Reason, err)
 	}
 
-	klog.Infof("Patching %s pod %s/%s (uid=%s): %s", podType, pod.Namespace, podName, uid, string(patchBytes))
+	log.Infof("Patching %s pod %s/%s (uid=%s): %s", podType, logNS, logPod, uid, cfg.Redaction.value(channelLogs, fieldPatch, string(patchBytes)))
+	d.Outcome, d.Reason, d.Patch = outcomeMutated, reasonMutated, string(patchBytes)
+	if conflicts := webhookConflicts.current(); len(conflicts) > 0 {
+		warnings = append(warnings, warning(reasonWarnConflictingWebhooks, fmt.Sprintf("mutating webhook(s) %s also receive this pod and may rewrite the networks annotation", strings.Join(conflicts, ", "))))
+	}
 
 	pt := admissionv1.PatchTypeJSONPatch
 	return &admissionv1.AdmissionResponse{
-		Allowed:   true,
-		Patch:     patchBytes,
-		PatchType: &pt,
+		Allowed:          true,
+		Patch:            patchBytes,
+		PatchType:        &pt,
+		Warnings:         warnings,
+		AuditAnnotations: admissionAuditAnnotations(d),
 	}
 }
 
-func handleMutate(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+// readAdmissionReview reads and validates the admission review of r. On
+// failure it has already answered the request.
+func readAdmissionReview(w http.ResponseWriter, r *http.Request) (admissionv1.AdmissionReview, bool) {
+	var admissionReview admissionv1.AdmissionReview
+	body, err := io.ReadAll(io.LimitReader(r.Body, cfg.MaxRequestBytes+1))
 	if err != nil {
 		klog.Errorf("Could not read request body: %v", err)
 		http.Error(w, "could not read request body", http.StatusBadRequest)
-		return
+		return admissionReview, false
+	}
+
+	if perr := validatePayloadShape(body, cfg.MaxRequestBytes, cfg.MaxPayloadDepth); perr != nil {
+		klog.Errorf("Rejecting admission payload from %s (%s): %v", requestSource(r), perr.reason, perr)
+		http.Error(w, perr.Error(), http.StatusBadRequest)
+		return admissionReview, false
 	}
 
-	var admissionReview admissionv1.AdmissionReview
 	if err := json.Unmarshal(body, &admissionReview); err != nil {
+		rejectPayload(rejectMalformed, "%v", err)
 		klog.Errorf("Could not unmarshal admission review: %v", err)
 		http.Error(w, "could not unmarshal admission review", http.StatusBadRequest)
+		return admissionReview, false
+	}
+
+	if perr := validateAdmissionReview(&admissionReview); perr != nil {
+		klog.Errorf("Rejecting admission payload from %s (%s): %v", requestSource(r), perr.reason, perr)
+		http.Error(w, perr.Error(), http.StatusBadRequest)
+		return admissionReview, false
+	}
+	return admissionReview, true
+}
+
+func handleMutate(w http.ResponseWriter, r *http.Request) {
+	stages := newStageTimer(time.Now(), requestDeadline(r))
+	admissionReview, ok := readAdmissionReview(w, r)
+	if !ok {
 		return
 	}
 
-	if admissionReview.Request == nil {
-		klog.Errorf("Missing admission request")
-		http.Error(w, "missing admission request", http.StatusBadRequest)
+	if selfProbe.matches(r) {
+		admissionReview.Response = evaluatePod(&admissionReview, newDecision(&admissionReview), ruleSources.current())
+		admissionReview.Response.UID = admissionReview.Request.UID
+		if err := writeAdmissionReviewResponse(w, r, &admissionReview); err != nil {
+			http.Error(w, "could not marshal response", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if source := admissionSource(admissionReview.Request); !rateLimiter.allow(source) {
+		klog.Warningf("Rate limit exceeded for %s, allowing %s (uid=%s) without review", source, admissionReview.Request.Kind.String(), admissionReview.Request.UID)
+		admissionReview.Response = &admissionv1.AdmissionResponse{
+			Allowed:  true,
+			Warnings: []string{warning(reasonWarnRateLimited, "rate limit exceeded, admitted without review")},
+		}
+		admissionReview.Response.UID = admissionReview.Request.UID
+		if err := writeAdmissionReviewResponse(w, r, &admissionReview); err != nil {
+			http.Error(w, "could not marshal response", http.StatusInternalServerError)
+		}
 		return
 	}
 
 	if admissionReview.Request.Kind.Group != "" || admissionReview.Request.Kind.Kind != "Pod" {
 		klog.Warningf("Unsupported GVK %s - This should not happen, skipping.", admissionReview.Request.Kind.String())
+		misdirected.observe(misdirectedGVK, admissionReview.Request.Kind.String())
 		admissionReview.Response = &admissionv1.AdmissionResponse{
 			Allowed: true,
 		}
-		if err := writeAdmissionReviewResponse(w, &admissionReview); err != nil {
+		if err := writeAdmissionReviewResponse(w, r, &admissionReview); err != nil {
 			http.Error(w, "could not marshal response", http.StatusInternalServerError)
 		}
 		return
 	}
 
-	admissionReview.Response = reviewPod(&admissionReview)
+	stages.enter(stageClassify)
+	admissionReview.Response = reviewPodWithStages(&admissionReview, stages)
 	if admissionReview.Response != nil {
 		admissionReview.Response.UID = admissionReview.Request.UID
 	}
 
-	if err := writeAdmissionReviewResponse(w, &admissionReview); err != nil {
+	if err := writeAdmissionReviewResponse(w, r, &admissionReview); err != nil {
 		http.Error(w, "could not marshal response", http.StatusInternalServerError)
 	}
+	stages.finish(string(admissionReview.Request.UID))
+}
+
+const (
+	servingCertFile = "/etc/server/certs/tls.crt"
+	servingKeyFile  = "/etc/server/certs/tls.key"
+)
+
+var subcommands = map[string]func(args []string) int{
+	"verify-audit-log":  runVerifyAuditLog,
+	"decrypt-audit-log": runDecryptAuditLog,
+	"export-policy":     runExportPolicy,
+	"validate-config":   runValidateConfig,
+	"check":             runCheck,
+	"replay":            runReplay,
+	"doctor":            runDoctor,
+	"export-dashboard":  runExportDashboard,
+	"export-alerts":     runExportAlerts,
+	"manifests":         runManifests,
+	"migrate-storage":   runMigrateStorage,
 }
 
-func writeAdmissionReviewResponse(w http.ResponseWriter, review *admissionv1.AdmissionReview) error {
-	resp, err := json.Marshal(review)
+func main() {
+	if len(os.Args) > 1 {
+		if run, exists := subcommands[os.Args[1]]; exists {
+			os.Exit(run(os.Args[2:]))
+		}
+	}
+
+	klog.InitFlags(nil)
+	conf := defaultConfig()
+	conf.bindFlags(flag.CommandLine)
+	flag.Parse()
+
+	if err := conf.validate(); err != nil {
+		klog.Fatalf("Invalid configuration: %v", err)
+	}
+	setupLogFormat(conf.LogFormat, os.Stderr)
+	if err := checkCNITypes(conf.CNITypesSkew); err != nil {
+		klog.Fatalf("cnitypes self-test failed: %v", err)
+	}
+
+	sealer, err := loadRecordCipher(conf.RecordEncryptionKey)
 	if err != nil {
-		klog.Errorf("Could not marshal response: %v", err)
-		return err
+		klog.Fatalf("Failed to load record encryption key: %v", err)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	if _, err := w.Write(resp); err != nil {
-		klog.Errorf("Could not write response: %v", err)
-		return err
+	if redactionKey, err = loadRedactionKey(conf.RedactionKey); err != nil {
+		klog.Fatalf("Failed to load redaction key: %v", err)
+	}
+	if conf.DetectCapabilities {
+		if err := kube.configure(conf.Kubeconfig, nil); err != nil {
+			klog.Fatalf("Cluster capability check failed: %v", err)
+		}
+		if conf, err = preflight(conf); err != nil {
+			klog.Fatalf("Cluster capability check failed: %v", err)
+		}
+	}
+	if auditor, err = openAuditLog(conf.AuditLog, conf.AuditFormat, conf.AuditHashChain, conf.AuditCheckpointKey, sealer); err != nil {
+		klog.Fatalf("Failed to open audit log: %v", err)
+	}
+	go auditor.runCheckpoints(conf.AuditCheckpointInterval)
+	if recentDecisions, err = openDecisionStore(conf, sealer); err != nil {
+		klog.Fatalf("Failed to open decision store: %v", err)
+	}
+	go misdirected.run(conf.MisdirectedReportInterval)
+	if decisionExporter, err = newESExporter(conf); err != nil {
+		klog.Fatalf("Failed to set up Elasticsearch exporter: %v", err)
+	}
+	go decisionExporter.run(conf.ElasticsearchFlushInterval)
+	if objectExporter, err = newS3Exporter(conf); err != nil {
+		klog.Fatalf("Failed to set up S3 exporter: %v", err)
+	}
+	go objectExporter.run(conf.S3FlushInterval)
+	if statsd, err = newStatsdEmitter(conf.StatsdAddress, conf.StatsdPrefix, conf.StatsdTags); err != nil {
+		klog.Fatalf("Failed to set up DogStatsD emitter: %v", err)
+	}
+	go statsd.run(conf.StatsdInterval)
+	if metricsExporter, err = newOTLPExporter(conf); err != nil {
+		klog.Fatalf("Failed to set up OTLP exporter: %v", err)
+	}
+	go metricsExporter.run(conf.OTLPInterval)
+	if fleet, err = newFleetExporter(conf); err != nil {
+		klog.Fatalf("Failed to set up fleet collector export: %v", err)
+	}
+	go fleet.run(conf.FleetInterval)
+	if denials, err = newDenialNotifier(conf); err != nil {
+		klog.Fatalf("Failed to set up denial webhook: %v", err)
+	}
+	go denials.run()
+	if conf.PlanSummaries {
+		planSummaries = newPlanController()
+	}
+	go planSummaries.run(conf.PlanSummaryInterval)
+	if conf.Events {
+		if podEvents, err = newEventEmitter(); err != nil {
+			klog.Fatalf("Failed to set up Events: %v", err)
+		}
+	}
+	go podEvents.run()
+	if conf.VerifyNetworkStatus {
+		networkStatus = newNetworkStatusVerifier()
+	}
+	go networkStatus.run(conf.VerifyNetworkStatusInterval)
+	if conf.CheckWebhookConflicts {
+		webhookConflicts = newWebhookConflictChecker()
+	}
+	go webhookConflicts.run(conf.WebhookConflictInterval)
+	if conf.RequireWebhookRegistration {
+		registration = newRegistrationChecker()
+	}
+	go registration.run(conf.RegistrationCheckInterval)
+	if conf.NamespaceMutationThreshold > 0 {
+		mutationRates = newMutationRateTracker(conf.NamespaceMutationThreshold, conf.NamespaceMutationWindow)
+	}
+	go mutationRates.run(time.Minute)
+	applyConfig(conf, "startup", "command-line")
+	if len(conf.RulesConfigMaps) > 0 || conf.RulesPolicies {
+		ruleSources = newRuleSourceWatcher(conf)
+	}
+	go ruleSources.run(conf.RulesSourceInterval)
+	if conf.TargetPolicies {
+		targetPolicies = newTargetWatcher()
+	}
+	go targetPolicies.run(conf.TargetPolicyInterval, wait.NeverStop)
+	if conf.IgnoreNamespaceSelector != "" {
+		if namespaceLabels, err = newNamespaceLabelWatcher(); err != nil {
+			klog.Fatalf("Failed to set up the namespace cache: %v", err)
+		}
+	}
+	go namespaceLabels.run(wait.NeverStop)
+	if targetConfig, err = newTargetConfigWatcher(conf.ConfigFile); err != nil {
+		klog.Fatalf("Failed to load %s: %v", conf.ConfigFile, err)
+	}
+	go targetConfig.run(conf.ConfigReloadInterval)
+	if conf.ClassificationCacheTTL > 0 {
+		classifications = newClassificationCache(conf.ClassificationCacheTTL)
+	}
+	if conf.Maintenance {
+		maintenance.set(true, "--maintenance", "command-line", 0)
+	}
+	if conf.FaultLatency > 0 || conf.FaultErrorRate > 0 || conf.FaultTLSFailureRate > 0 {
+		faults.set(conf.FaultLatency, conf.FaultErrorRate, conf.FaultTLSFailureRate, "command-line", 0)
 	}
-	return nil
-}
 
-func main() {
-	klog.Info("Starting Gateway Yeeter on :8443")
+	if conf.SelfProbeInterval > 0 || conf.WarmUp {
+		if selfProbe, err = newSelfProber(conf); err != nil {
+			klog.Fatalf("Failed to set up self-probe: %v", err)
+		}
+	}
+	if conf.SelfProbeInterval > 0 {
+		go selfProbe.run(conf.SelfProbeInterval)
+	}
+	if conf.MaxInFlight > 0 {
+		inFlight = newInFlightLimiter(conf.MaxInFlight)
+	}
+	if conf.WarmUp {
+		warmUp = newWarmUp()
+	}
+	go warmUp.run(conf.WarmUpTimeout)
+
+	go dumpStateOnSignal()
 
-	http.HandleFunc("/mutate", handleMutate)
-	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+	instanceInfo.WithLabelValues(identity.Namespace, identity.Pod, identity.Service, identity.Node).Set(1)
+	klog.Infof("Starting Gateway Yeeter %s (service %s) on %s", identity, identity.Service, cfg.ListenAddress)
+
+	mux := http.NewServeMux()
+	mux.Handle("/mutate", faults.wrap(inFlight.wrap(http.HandlerFunc(handleMutate))))
+	if cfg.ValidateMode != validateModeOff {
+		mux.Handle("/validate", inFlight.wrap(http.HandlerFunc(handleValidate)))
+	}
+	mux.HandleFunc("/convert", handleConvert)
+	mux.Handle("/metrics", metricsHandler())
+	if cfg.GatekeeperProvider {
+		mux.HandleFunc("/gatekeeper/provider", handleGatekeeperProvider)
+	}
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	})
+	mux.HandleFunc("/readyz", handleReadyz)
+	registerAdminHandlers(mux)
 
-	if err := http.ListenAndServeTLS(":8443", "/etc/server/certs/tls.crt", "/etc/server/certs/tls.key", nil); err != nil {
+	if err := serveTLS(cfg, mux, servingCertFile, servingKeyFile); err != nil {
 		klog.Fatalf("Failed to start server: %v", err)
 	}
 
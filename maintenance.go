@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	modeMaintenance = "maintenance"
+	modeShadow      = "shadow"
+	modeDryRun      = "dry-run"
+)
+
+var maintenanceActive = newGauge(prometheus.GaugeOpts{
+	Name: "gateway_yeeter_maintenance_mode",
+	Help: "1 while maintenance mode admits every pod unmodified, 0 otherwise.",
+})
+
+var passthroughReviews = newCounterVec(prometheus.CounterOpts{
+	Name: "gateway_yeeter_passthrough_reviews_total",
+	Help: "Admission reviews whose result was not applied, by mode and the outcome that would have been applied.",
+}, "mode", "outcome")
+
+var (
+	dryRunReviews = newCounterVec(prometheus.CounterOpts{
+		Name: "gateway_yeeter_dry_run_reviews_total",
+		Help: "Admission reviews in dry-run mode, by pod type and the outcome and reason code that would have been applied.",
+	}, "pod_type", "outcome", "reason")
+	dryRunGateways = newCounter(prometheus.CounterOpts{
+		Name: "gateway_yeeter_dry_run_gateways_total",
+		Help: "Gateways that would have been removed in dry-run mode.",
+	})
+)
+
+type maintenanceState struct {
+	Enabled bool       `json:"enabled"`
+	Reason  string     `json:"reason,omitempty"`
+	Actor   string     `json:"actor,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+	Until   *time.Time `json:"until,omitempty"`
+}
+
+type maintenanceRecord struct {
+	Kind string    `json:"kind"`
+	Time time.Time `json:"time"`
+	maintenanceState
+}
+
+// maintenanceMode switches the webhook into pass-through at runtime,
+// without touching the MutatingWebhookConfiguration.
+type maintenanceMode struct {
+	mu    sync.Mutex
+	state maintenanceState
+	now   func() time.Time
+}
+
+var maintenance = &maintenanceMode{now: time.Now}
+
+func (m *maintenanceMode) set(enabled bool, reason, actor string, duration time.Duration) maintenanceState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now().UTC()
+	m.state = maintenanceState{Enabled: enabled, Reason: reason, Actor: actor}
+	if enabled {
+		m.state.Since = &now
+		if duration > 0 {
+			until := now.Add(duration)
+			m.state.Until = &until
+		}
+	}
+	m.changed(now)
+	return m.state
+}
+
+// current returns the state, ending maintenance once its duration passed.
+func (m *maintenanceMode) current() maintenanceState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now := m.now().UTC(); m.state.Enabled && m.state.Until != nil && !now.Before(*m.state.Until) {
+		m.state = maintenanceState{Reason: "duration expired", Actor: "gateway-yeeter"}
+		m.changed(now)
+	}
+	return m.state
+}
+
+func (m *maintenanceMode) changed(now time.Time) {
+	if m.state.Enabled {
+		maintenanceActive.Set(1)
+		until := "disabled"
+		if m.state.Until != nil {
+			until = m.state.Until.Format(time.RFC3339)
+		}
+		klog.Warningf("Maintenance mode enabled by %s until %s: %s - pods are admitted unmodified", m.state.Actor, until, m.state.Reason)
+	} else {
+		maintenanceActive.Set(0)
+		klog.Warningf("Maintenance mode disabled by %s: %s", m.state.Actor, m.state.Reason)
+	}
+	if err := auditor.write(maintenanceRecord{Kind: "MaintenanceChange", Time: now, maintenanceState: m.state}); err != nil {
+		klog.Errorf("Could not write maintenance change to audit log: %v", err)
+	}
+}
+
+// passThrough replaces the response with an unconditional allow and marks
+// the decision as not applied.
+func passThrough(mode string, d *decision, resp *admissionv1.AdmissionResponse) *admissionv1.AdmissionResponse {
+	d.Mode = mode
+	if mode == modeDryRun {
+		dryRunReviews.WithLabelValues(d.PodType, d.Outcome, d.Reason).Inc()
+		for _, n := range d.Networks {
+			dryRunGateways.Add(float64(len(n.RemovedGateways)))
+		}
+	} else {
+		passthroughReviews.WithLabelValues(mode, d.Outcome).Inc()
+	}
+	logNS := cfg.Redaction.value(channelLogs, fieldNamespace, d.Namespace)
+	logPod := cfg.Redaction.value(channelLogs, fieldPod, d.Pod)
+	switch d.Outcome {
+	case outcomeMutated:
+		klog.Infof("Admitting %s pod %s/%s (uid=%s) unmodified in %s mode, would have patched: %s", d.PodType, logNS, logPod, d.UID, mode, cfg.Redaction.value(channelLogs, fieldPatch, d.Patch))
+	case outcomeDenied:
+		klog.Infof("Admitting %s pod %s/%s (uid=%s) in %s mode, would have denied: %s", d.PodType, logNS, logPod, d.UID, mode, cfg.Redaction.value(channelLogs, fieldNetworks, d.Message))
+	}
+	return &admissionv1.AdmissionResponse{Allowed: true, Warnings: resp.Warnings}
+}
+
+type maintenanceRequest struct {
+	Enabled  bool   `json:"enabled"`
+	Reason   string `json:"reason"`
+	Duration string `json:"duration,omitempty"`
+}
+
+func handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, maintenance.current())
+	case http.MethodPost:
+		var req maintenanceRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+			http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		var duration time.Duration
+		if req.Duration != "" {
+			var err error
+			if duration, err = time.ParseDuration(req.Duration); err != nil || duration < 0 {
+				http.Error(w, "invalid duration", http.StatusBadRequest)
+				return
+			}
+		}
+		if req.Enabled && req.Reason == "" {
+			http.Error(w, "a reason is required to enable maintenance mode", http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, maintenance.set(req.Enabled, req.Reason, requestPrincipal(r), duration))
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
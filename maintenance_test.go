@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func withMaintenance(t *testing.T, m *maintenanceMode) {
+	old := maintenance
+	maintenance = m
+	t.Cleanup(func() { maintenance = old })
+}
+
+func TestMaintenanceModeExpires(t *testing.T) {
+	now := time.Now()
+	m := &maintenanceMode{now: func() time.Time { return now }}
+	withMaintenance(t, m)
+
+	m.set(true, "incident", "ops", time.Hour)
+	if !m.current().Enabled {
+		t.Fatal("expected maintenance mode to be enabled")
+	}
+	now = now.Add(time.Hour)
+	if state := m.current(); state.Enabled || state.Reason != "duration expired" {
+		t.Fatalf("expected maintenance mode to expire, got %+v", state)
+	}
+}
+
+func TestReviewPodMaintenancePassThrough(t *testing.T) {
+	withMaintenance(t, &maintenanceMode{now: time.Now})
+	maintenance.set(true, "incident", "ops", 0)
+
+	old, oldDecisions := cfg, recentDecisions
+	cfg.Rules = ruleSet{{Name: "platform", Action: actionDeny}}
+	recentDecisions = newDecisionLog(10)
+	defer func() { cfg, recentDecisions = old, oldDecisions }()
+
+	for _, networks := range []string{`[{"name":"transfer","default-route":["10.0.0.1"]}]`, `[{"name":"storage"}]`} {
+		resp := reviewPod(testImporterReview("test", networks))
+		if !resp.Allowed || len(resp.Patch) != 0 || resp.Result != nil {
+			t.Fatalf("expected pod to be admitted unmodified, got %+v", resp)
+		}
+	}
+
+	records := recentDecisions.list()
+	if len(records) != 2 || records[1].Mode != modeMaintenance || records[1].Outcome != outcomeDenied {
+		t.Fatalf("expected decision to record the outcome that would have been applied, got %+v", records)
+	}
+}
+
+func TestMaintenanceEndpoint(t *testing.T) {
+	withMaintenance(t, &maintenanceMode{now: time.Now})
+	a := newAdminAuth(nil, []string{"ops"})
+	a.reviewToken = fakeTokenReview(map[string]*principal{"ops-token": {User: "ops"}})
+	withAdminAuth(t, a)
+	mux := http.NewServeMux()
+	registerAdminHandlers(mux)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/maintenance", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer ops-token")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post(`{"enabled":true}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected a reason to be required, got %d", w.Code)
+	}
+	w := post(`{"enabled":true,"reason":"stuck migration","duration":"30m"}`)
+	var state maintenanceState
+	json.Unmarshal(w.Body.Bytes(), &state)
+	if w.Code != http.StatusOK || !state.Enabled || state.Actor != "ops" || state.Until == nil {
+		t.Fatalf("unexpected response %d: %s", w.Code, w.Body)
+	}
+	if !maintenance.current().Enabled {
+		t.Fatal("expected maintenance mode to be enabled")
+	}
+	if code := adminRequest(mux, "/maintenance", ""); code != http.StatusUnauthorized {
+		t.Fatalf("expected unauthenticated request to be rejected, got %d", code)
+	}
+}
+
+func TestReviewPodShadowMode(t *testing.T) {
+	old, oldDecisions := cfg, recentDecisions
+	cfg.Shadow = true
+	recentDecisions = newDecisionLog(10)
+	defer func() { cfg, recentDecisions = old, oldDecisions }()
+
+	resp := reviewPod(testImporterReview("test", `[{"name":"transfer","default-route":["10.0.0.1"]}]`))
+	if !resp.Allowed || len(resp.Patch) != 0 || resp.PatchType != nil {
+		t.Fatalf("expected no patch in shadow mode, got %+v", resp)
+	}
+	d := recentDecisions.list()[0]
+	if d.Mode != modeShadow || d.Outcome != outcomeMutated || d.Patch == "" {
+		t.Fatalf("expected the computed patch to be recorded, got %+v", d)
+	}
+}
+
+func TestReviewPodDryRun(t *testing.T) {
+	old, oldDecisions := cfg, recentDecisions
+	cfg.DryRun = true
+	recentDecisions = newDecisionLog(10)
+	defer func() { cfg, recentDecisions = old, oldDecisions }()
+
+	reviews := testutil.ToFloat64(dryRunReviews.WithLabelValues("cdi", outcomeMutated, reasonMutated))
+	enforced := testutil.ToFloat64(admissionReviews.WithLabelValues("cdi", outcomeMutated, reasonMutated))
+	gateways := testutil.ToFloat64(dryRunGateways)
+	resp := reviewPod(testImporterReview("test", `[{"name":"transfer","default-route":["10.0.0.1","10.0.0.2"]}]`))
+	if !resp.Allowed || len(resp.Patch) != 0 {
+		t.Fatalf("expected no patch in dry-run mode, got %+v", resp)
+	}
+	if d := recentDecisions.list()[0]; d.Mode != modeDryRun || d.Outcome != outcomeMutated {
+		t.Fatalf("expected the intended mutation to be recorded, got %+v", d)
+	}
+	if got := testutil.ToFloat64(dryRunReviews.WithLabelValues("cdi", outcomeMutated, reasonMutated)) - reviews; got != 1 {
+		t.Fatalf("expected one dry-run review, got %v", got)
+	}
+	if got := testutil.ToFloat64(dryRunGateways) - gateways; got != 2 {
+		t.Fatalf("expected two intended gateway removals, got %v", got)
+	}
+	if got := testutil.ToFloat64(admissionReviews.WithLabelValues("cdi", outcomeMutated, reasonMutated)); got != enforced {
+		t.Fatalf("expected dry-run reviews not to be counted as mutated, got %v more", got-enforced)
+	}
+}
+
+func TestReviewPodRuleDryRun(t *testing.T) {
+	old, oldDecisions := cfg, recentDecisions
+	cfg.Rules = ruleSet{
+		{Name: "new-team", Namespaces: []string{"team-*"}, Action: actionDeny, DryRun: true},
+		{Name: "default", Action: actionStrip},
+	}
+	recentDecisions = newDecisionLog(10)
+	defer func() { cfg, recentDecisions = old, oldDecisions }()
+
+	networks := `[{"name":"transfer","default-route":["10.0.0.1"]}]`
+	resp := reviewPod(testImporterReview("team-a", networks))
+	if !resp.Allowed || len(resp.Patch) != 0 {
+		t.Fatalf("expected the dry-run rule to admit the pod unmodified, got %+v", resp)
+	}
+	if d := recentDecisions.list()[0]; d.Mode != modeDryRun || d.Outcome != outcomeDenied || d.Rule != "new-team" {
+		t.Fatalf("expected the intended denial to be recorded, got %+v", d)
+	}
+
+	resp = reviewPod(testImporterReview("test", networks))
+	if len(resp.Patch) == 0 {
+		t.Fatalf("expected other rules to be enforced, got %+v", resp)
+	}
+	if d := recentDecisions.list()[0]; d.Mode != "" {
+		t.Fatalf("expected an enforced decision, got %+v", d)
+	}
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+type manifestOptions struct {
+	name         string
+	namespace    string
+	image        string
+	replicas     int
+	antiAffinity string
+	zoneKey      string
+	// hpaMaxReplicas renders a HorizontalPodAutoscaler scaling from replicas
+	// up to it on gateway_yeeter_admission_utilization, 0 disables it.
+	hpaMaxReplicas       int
+	hpaTargetUtilization float64
+}
+
+const (
+	antiAffinityRequired  = "required"
+	antiAffinityPreferred = "preferred"
+
+	failurePolicyIgnore     = "Ignore"
+	failurePolicyFail       = "Fail"
+	sideEffectsNone         = "None"
+	sideEffectsNoneOnDryRun = "NoneOnDryRun"
+)
+
+// serverArgs returns the explicitly set configuration flags of fs as
+// container arguments, so the deployed webhook runs the rendered config.
+func serverArgs(fs *flag.FlagSet, skip map[string]bool) []string {
+	var args []string
+	fs.Visit(func(f *flag.Flag) {
+		if !skip[f.Name] {
+			args = append(args, "--"+f.Name+"="+f.Value.String())
+		}
+	})
+	return args
+}
+
+func fieldEnv(name, fieldPath string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":      name,
+		"valueFrom": map[string]interface{}{"fieldRef": map[string]string{"fieldPath": fieldPath}},
+	}
+}
+
+// excludedNamespaceNames returns the own namespace and the exclude-namespaces
+// without wildcards, which is all a namespaceSelector can express. Patterns
+// are only enforced by the webhook itself.
+func excludedNamespaceNames(c config, own string) []string {
+	names := []string{own}
+	for _, pattern := range c.ExcludeNamespaces {
+		if !strings.ContainsAny(pattern, `*?[\`) && !contains(names, pattern) {
+			names = append(names, pattern)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// renderManifests renders the ServiceAccount and RBAC, Deployment, Service,
+// PodDisruptionBudget (with more than one replica), HorizontalPodAutoscaler
+// (with --hpa-max-replicas) and MutatingWebhookConfiguration of a webhook running
+// with c and args, preceded by the GatewayYeetRuleSet CRD with
+// --rules-policies.
+func renderManifests(c config, o manifestOptions, args []string) ([]byte, error) {
+	labels := map[string]string{"app": o.name}
+	if c.DryRun {
+		labels["gateway.yeet/mode"] = modeDryRun
+	}
+	metadata := func(extra map[string]interface{}) map[string]interface{} {
+		m := map[string]interface{}{"name": o.name, "namespace": o.namespace, "labels": labels}
+		for k, v := range extra {
+			m[k] = v
+		}
+		return m
+	}
+	selector := map[string]string{"app": o.name}
+	certSecret := o.name + "-certs"
+	probe := func(path string, initialDelay int) map[string]interface{} {
+		return map[string]interface{}{
+			"httpGet":             map[string]interface{}{"path": path, "port": 8443, "scheme": "HTTPS"},
+			"initialDelaySeconds": initialDelay,
+			"periodSeconds":       initialDelay,
+		}
+	}
+
+	container := map[string]interface{}{
+		"name":            "gateway-yeeter",
+		"image":           o.image,
+		"imagePullPolicy": "Always",
+		"env": []interface{}{
+			map[string]interface{}{"name": "GOMEMLIMIT", "value": "50MiB"},
+			fieldEnv("POD_NAMESPACE", "metadata.namespace"),
+			fieldEnv("POD_NAME", "metadata.name"),
+			fieldEnv("NODE_NAME", "spec.nodeName"),
+			map[string]interface{}{"name": "SERVICE_NAME", "value": o.name},
+		},
+		"ports":        []interface{}{map[string]interface{}{"containerPort": 8443, "name": "gateway-yeeter", "protocol": "TCP"}},
+		"volumeMounts": []interface{}{map[string]interface{}{"name": "gateway-yeeter-certs", "mountPath": "/etc/server/certs", "readOnly": true}},
+		"resources": map[string]interface{}{
+			"requests": map[string]string{"cpu": "50m", "memory": "64Mi"},
+			"limits":   map[string]string{"cpu": "250m", "memory": "64Mi"},
+		},
+		"securityContext": map[string]interface{}{
+			"allowPrivilegeEscalation": false,
+			"capabilities":             map[string]interface{}{"drop": []string{"ALL"}},
+			"readOnlyRootFilesystem":   true,
+		},
+		"livenessProbe":  probe("/healthz", 10),
+		"readinessProbe": probe("/readyz", 5),
+	}
+	if len(args) > 0 {
+		container["args"] = args
+	}
+
+	// Replicas on one node would all go down with it, so they are kept on
+	// distinct nodes, strictly by default or as a preference when the
+	// cluster may have fewer nodes than replicas.
+	onOtherNodes := map[string]interface{}{
+		"labelSelector": map[string]interface{}{"matchLabels": selector},
+		"topologyKey":   "kubernetes.io/hostname",
+	}
+	podAntiAffinity := map[string]interface{}{
+		"requiredDuringSchedulingIgnoredDuringExecution": []interface{}{onOtherNodes},
+	}
+	if o.antiAffinity == antiAffinityPreferred {
+		podAntiAffinity = map[string]interface{}{
+			"preferredDuringSchedulingIgnoredDuringExecution": []interface{}{map[string]interface{}{
+				"weight":          100,
+				"podAffinityTerm": onOtherNodes,
+			}},
+		}
+	}
+
+	podSpec := map[string]interface{}{
+		"affinity":           map[string]interface{}{"podAntiAffinity": podAntiAffinity},
+		"serviceAccountName": o.name,
+		"securityContext": map[string]interface{}{
+			"runAsNonRoot":   true,
+			"seccompProfile": map[string]string{"type": "RuntimeDefault"},
+		},
+		"containers": []interface{}{container},
+		"volumes": []interface{}{map[string]interface{}{
+			"name":   "gateway-yeeter-certs",
+			"secret": map[string]string{"secretName": certSecret},
+		}},
+	}
+	// The --config file is read from a ConfigMap mounted as a directory, a
+	// subPath mount would never see updates.
+	if c.ConfigFile != "" {
+		container["volumeMounts"] = append(container["volumeMounts"].([]interface{}), map[string]interface{}{"name": "gateway-yeeter-config", "mountPath": path.Dir(c.ConfigFile), "readOnly": true})
+		podSpec["volumes"] = append(podSpec["volumes"].([]interface{}), map[string]interface{}{
+			"name":      "gateway-yeeter-config",
+			"configMap": map[string]string{"name": o.name + "-config"},
+		})
+	}
+	// Spreading over zones is best effort, so clusters with a single zone
+	// or without zone labels still schedule every replica.
+	if o.zoneKey != "" {
+		podSpec["topologySpreadConstraints"] = []interface{}{map[string]interface{}{
+			"maxSkew":           1,
+			"topologyKey":       o.zoneKey,
+			"whenUnsatisfiable": "ScheduleAnyway",
+			"labelSelector":     map[string]interface{}{"matchLabels": selector},
+		}}
+	}
+
+	deployment := map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   metadata(nil),
+		"spec": map[string]interface{}{
+			"replicas": o.replicas,
+			"selector": map[string]interface{}{"matchLabels": selector},
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": labels},
+				"spec":     podSpec,
+			},
+		},
+	}
+
+	// The autoscaler owns the replica count, a fixed one would be reset on
+	// every apply.
+	if o.hpaMaxReplicas > 0 {
+		delete(deployment["spec"].(map[string]interface{}), "replicas")
+	}
+
+	service := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata": metadata(map[string]interface{}{
+			"annotations": map[string]string{"service.beta.openshift.io/serving-cert-secret-name": certSecret},
+		}),
+		"spec": map[string]interface{}{
+			"ports":    []interface{}{map[string]interface{}{"port": 443, "targetPort": 8443, "protocol": "TCP", "name": "https"}},
+			"selector": selector,
+		},
+	}
+
+	pdb := map[string]interface{}{
+		"apiVersion": "policy/v1",
+		"kind":       "PodDisruptionBudget",
+		"metadata":   metadata(nil),
+		"spec": map[string]interface{}{
+			"minAvailable": 1,
+			"selector":     map[string]interface{}{"matchLabels": selector},
+		},
+	}
+
+	operations := []string{"CREATE"}
+	if c.HandleHotplug {
+		operations = append(operations, "UPDATE")
+	}
+	namespaceSelector := map[string]interface{}{}
+	if len(c.ScopeNamespaces) > 0 {
+		namespaceSelector["matchExpressions"] = []interface{}{map[string]interface{}{
+			"key":      "kubernetes.io/metadata.name",
+			"operator": "In",
+			"values":   []string(c.ScopeNamespaces),
+		}}
+	} else if excluded := excludedNamespaceNames(c, o.namespace); len(excluded) > 0 {
+		namespaceSelector["matchExpressions"] = []interface{}{map[string]interface{}{
+			"key":      "kubernetes.io/metadata.name",
+			"operator": "NotIn",
+			"values":   excluded,
+		}}
+	}
+	// GatewayYeetPolicies and the --config file select pods by arbitrary
+	// labels that change at runtime, so the webhook has to receive every pod
+	// and classifies them itself.
+	targets := targetPods
+	if c.TargetPolicies || c.ConfigFile != "" {
+		targets = []targetPod{{name: "pods"}}
+	}
+	webhooksFor := func(path string) []interface{} {
+		var webhooks []interface{}
+		for _, target := range targets {
+			webhooks = append(webhooks, admissionWebhook(c, target, path, operations, namespaceSelector, o))
+		}
+		return webhooks
+	}
+	webhook := map[string]interface{}{
+		"apiVersion": "admissionregistration.k8s.io/v1",
+		"kind":       "MutatingWebhookConfiguration",
+		"metadata": map[string]interface{}{
+			"name":        o.name,
+			"labels":      labels,
+			"annotations": map[string]string{"service.beta.openshift.io/inject-cabundle": "true"},
+		},
+		"webhooks": webhooksFor("/mutate"),
+	}
+
+	var out bytes.Buffer
+	objects := append(rbacObjects(c, o, labels), deployment, service)
+	// A budget for a single replica would block every node drain.
+	if o.replicas > 1 {
+		objects = append(objects, pdb)
+	}
+	if o.hpaMaxReplicas > 0 {
+		objects = append(objects, horizontalPodAutoscaler(o, metadata(nil)))
+	}
+	objects = append(objects, webhook)
+	if c.ValidateMode != validateModeOff {
+		objects = append(objects, map[string]interface{}{
+			"apiVersion": "admissionregistration.k8s.io/v1",
+			"kind":       "ValidatingWebhookConfiguration",
+			"metadata": map[string]interface{}{
+				"name":        o.name,
+				"labels":      labels,
+				"annotations": map[string]string{"service.beta.openshift.io/inject-cabundle": "true"},
+			},
+			"webhooks": webhooksFor("/validate"),
+		})
+	}
+	if c.RulesPolicies {
+		objects = append([]interface{}{ruleSetCRD(labels, o)}, objects...)
+	}
+	if c.TargetPolicies {
+		objects = append([]interface{}{targetPolicyCRD(labels, o)}, objects...)
+	}
+	for i, object := range objects {
+		raw, err := yaml.Marshal(object)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			out.WriteString("---\n")
+		}
+		out.Write(raw)
+	}
+	return out.Bytes(), nil
+}
+
+// horizontalPodAutoscaler scales the Deployment on the per-pod
+// gateway_yeeter_admission_utilization, which a metrics adapter (e.g.
+// prometheus-adapter) has to serve through the custom metrics API. Scaling
+// down is delayed, migration waves come in bursts.
+func horizontalPodAutoscaler(o manifestOptions, metadata map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": "autoscaling/v2",
+		"kind":       "HorizontalPodAutoscaler",
+		"metadata":   metadata,
+		"spec": map[string]interface{}{
+			"scaleTargetRef": map[string]interface{}{"apiVersion": "apps/v1", "kind": "Deployment", "name": o.name},
+			"minReplicas":    o.replicas,
+			"maxReplicas":    o.hpaMaxReplicas,
+			"metrics": []interface{}{map[string]interface{}{
+				"type": "Pods",
+				"pods": map[string]interface{}{
+					"metric": map[string]interface{}{"name": "gateway_yeeter_admission_utilization"},
+					"target": map[string]interface{}{"type": "AverageValue", "averageValue": fmt.Sprintf("%dm", int(o.hpaTargetUtilization*1000))},
+				},
+			}},
+			"behavior": map[string]interface{}{
+				"scaleDown": map[string]interface{}{"stabilizationWindowSeconds": 300},
+			},
+		},
+	}
+}
+
+// admissionWebhook renders the webhook of one target pod type calling path.
+func admissionWebhook(c config, target targetPod, path string, operations []string, namespaceSelector map[string]interface{}, o manifestOptions) map[string]interface{} {
+	webhook := map[string]interface{}{
+		"name":                    target.name + ".gateway.yeet",
+		"admissionReviewVersions": []string{"v1", "v1beta1"},
+		"clientConfig": map[string]interface{}{
+			"service": map[string]interface{}{"name": o.name, "namespace": o.namespace, "path": path},
+		},
+		"rules": []interface{}{map[string]interface{}{
+			"operations":  operations,
+			"apiGroups":   []string{""},
+			"apiVersions": []string{"v1"},
+			"resources":   []string{"pods"},
+			"scope":       "Namespaced",
+		}},
+		"namespaceSelector": namespaceSelector,
+		"failurePolicy":     c.FailurePolicy,
+		"sideEffects":       c.SideEffects,
+		"timeoutSeconds":    int(c.WebhookTimeout / time.Second),
+	}
+	if len(target.labels) > 0 {
+		webhook["objectSelector"] = map[string]interface{}{"matchLabels": target.labels}
+	}
+	return webhook
+}
+
+func runManifests(args []string) int {
+	fs := flag.NewFlagSet("manifests", flag.ContinueOnError)
+	var o manifestOptions
+	fs.StringVar(&o.name, "name", "", "Name of the rendered objects (default gateway-yeeter, gateway-yeeter-dry-run with --dry-run)")
+	fs.StringVar(&o.namespace, "namespace", "openshift-mtv", "Namespace the webhook is deployed to")
+	fs.StringVar(&o.image, "image", "ghcr.io/grandeit/gateway-yeeter:latest", "Container image of the webhook")
+	fs.IntVar(&o.replicas, "replicas", 2, "Number of webhook replicas")
+	fs.StringVar(&o.antiAffinity, "anti-affinity", antiAffinityRequired, "Keep replicas on distinct nodes: required, or preferred when there may be fewer nodes than replicas")
+	fs.StringVar(&o.zoneKey, "zone-key", "topology.kubernetes.io/zone", "Node label replicas are spread over as evenly as possible (empty disables)")
+	fs.IntVar(&o.hpaMaxReplicas, "hpa-max-replicas", 0, "Render a HorizontalPodAutoscaler scaling up to this many replicas on admission utilization, requires --max-in-flight (0 disables)")
+	fs.Float64Var(&o.hpaTargetUtilization, "hpa-target-utilization", 0.7, "Average gateway_yeeter_admission_utilization per replica the HorizontalPodAutoscaler aims for")
+	conf := defaultConfig()
+	conf.bindFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := conf.validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if o.replicas < 1 {
+		fmt.Fprintln(os.Stderr, "--replicas must be at least 1")
+		return exitUsage
+	}
+	if o.antiAffinity != antiAffinityRequired && o.antiAffinity != antiAffinityPreferred {
+		fmt.Fprintln(os.Stderr, "--anti-affinity must be required or preferred")
+		return exitUsage
+	}
+	if o.hpaMaxReplicas != 0 {
+		if conf.MaxInFlight == 0 {
+			fmt.Fprintln(os.Stderr, "--hpa-max-replicas requires --max-in-flight, utilization is relative to it")
+			return exitUsage
+		}
+		if o.hpaMaxReplicas < o.replicas {
+			fmt.Fprintln(os.Stderr, "--hpa-max-replicas must not be less than --replicas")
+			return exitUsage
+		}
+		if o.hpaTargetUtilization <= 0 {
+			fmt.Fprintln(os.Stderr, "--hpa-target-utilization must be positive")
+			return exitUsage
+		}
+	}
+	if o.name == "" {
+		o.name = "gateway-yeeter"
+		if conf.DryRun {
+			o.name += "-" + modeDryRun
+		}
+	}
+
+	skip := map[string]bool{"name": true, "namespace": true, "image": true, "replicas": true, "anti-affinity": true, "zone-key": true, "hpa-max-replicas": true, "hpa-target-utilization": true}
+	out, err := renderManifests(conf, o, serverArgs(fs, skip))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFindings
+	}
+	os.Stdout.Write(out)
+	return exitOK
+}
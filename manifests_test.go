@@ -0,0 +1,196 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func splitManifests(t *testing.T, raw []byte) map[string]interface{} {
+	objects := make(map[string]interface{})
+	for _, doc := range strings.Split(string(raw), "---\n") {
+		var object map[string]interface{}
+		if err := yaml.Unmarshal([]byte(doc), &object); err != nil {
+			t.Fatal(err)
+		}
+		objects[object["kind"].(string)] = object
+	}
+	return objects
+}
+
+func TestRenderManifestsMatchesDeployDirectory(t *testing.T) {
+	out, err := renderManifests(defaultConfig(), manifestOptions{name: "gateway-yeeter", namespace: "openshift-mtv", image: "ghcr.io/grandeit/gateway-yeeter:latest", replicas: 2, antiAffinity: antiAffinityRequired, zoneKey: "topology.kubernetes.io/zone"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rendered := splitManifests(t, out)
+
+	files, _ := filepath.Glob("deploy/*.yaml")
+	for _, file := range files {
+		if filepath.Base(file) == "kustomization.yaml" {
+			continue
+		}
+		raw, _ := os.ReadFile(file)
+		var want map[string]interface{}
+		if err := yaml.Unmarshal(raw, &want); err != nil {
+			t.Fatal(err)
+		}
+		kind := want["kind"].(string)
+		if !reflect.DeepEqual(rendered[kind], want) {
+			got, _ := yaml.Marshal(rendered[kind])
+			t.Errorf("rendered %s differs from %s:\n%s", kind, file, got)
+		}
+	}
+}
+
+func TestRenderManifestsDryRun(t *testing.T) {
+	c := defaultConfig()
+	fs := flag.NewFlagSet("manifests", flag.ContinueOnError)
+	c.bindFlags(fs)
+	if err := fs.Parse([]string{"--dry-run", "--scope-namespaces=mtv-a,mtv-b", "--handle-hotplug"}); err != nil {
+		t.Fatal(err)
+	}
+	args := serverArgs(fs, nil)
+	if want := []string{"--dry-run=true", "--handle-hotplug=true", "--scope-namespaces=mtv-a,mtv-b"}; !reflect.DeepEqual(args, want) {
+		t.Fatalf("expected args %v, got %v", want, args)
+	}
+
+	out, err := renderManifests(c, manifestOptions{name: "gateway-yeeter-dry-run", namespace: "mtv", image: "test", replicas: 1}, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := strings.Join(strings.Fields(string(out)), " ")
+	for _, want := range []string{"gateway.yeet/mode: dry-run", "- --dry-run=true", "secretName: gateway-yeeter-dry-run-certs", "- UPDATE", "operator: In values: - mtv-a - mtv-b"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("expected manifests to contain %q:\n%s", want, s)
+		}
+	}
+}
+
+func TestRenderManifestsExcludedNamespaces(t *testing.T) {
+	c := defaultConfig()
+	c.ExcludeNamespaces = stringList{"kube-*", "openshift-monitoring", "mtv"}
+	out, err := renderManifests(c, manifestOptions{name: "gateway-yeeter", namespace: "mtv", image: "test", replicas: 1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "operator: NotIn values: - mtv - openshift-monitoring objectSelector"; !strings.Contains(strings.Join(strings.Fields(string(out)), " "), want) {
+		t.Fatalf("expected exact names and the own namespace to be excluded once:\n%s", out)
+	}
+}
+
+func TestRenderManifestsHighAvailability(t *testing.T) {
+	o := manifestOptions{name: "gateway-yeeter", namespace: "mtv", image: "test", replicas: 3, antiAffinity: antiAffinityPreferred, zoneKey: "topology.kubernetes.io/zone"}
+	out, err := renderManifests(defaultConfig(), o, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := strings.Join(strings.Fields(string(out)), " ")
+	for _, want := range []string{
+		"preferredDuringSchedulingIgnoredDuringExecution: - podAffinityTerm: labelSelector: matchLabels: app: gateway-yeeter topologyKey: kubernetes.io/hostname weight: 100",
+		"topologySpreadConstraints: - labelSelector: matchLabels: app: gateway-yeeter maxSkew: 1 topologyKey: topology.kubernetes.io/zone whenUnsatisfiable: ScheduleAnyway",
+		"name: NODE_NAME valueFrom: fieldRef: fieldPath: spec.nodeName",
+		"kind: PodDisruptionBudget",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("expected manifests to contain %q:\n%s", want, out)
+		}
+	}
+
+	o.replicas, o.zoneKey = 1, ""
+	out, err = renderManifests(defaultConfig(), o, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "PodDisruptionBudget") || strings.Contains(string(out), "topologySpreadConstraints") {
+		t.Fatalf("expected neither a budget for a single replica nor zone spreading:\n%s", out)
+	}
+}
+
+func TestRenderManifestsValidatingWebhook(t *testing.T) {
+	c := defaultConfig()
+	c.ValidateMode = validateModeEnforce
+	out, err := renderManifests(c, manifestOptions{name: "gateway-yeeter", namespace: "mtv", image: "test", replicas: 1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validating, ok := splitManifests(t, out)["ValidatingWebhookConfiguration"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected a ValidatingWebhookConfiguration:\n%s", out)
+	}
+	webhooks := validating["webhooks"].([]interface{})
+	if len(webhooks) != len(targetPods) || !strings.Contains(string(out), "path: /validate") {
+		t.Fatalf("expected a validating webhook per target calling /validate:\n%s", out)
+	}
+}
+
+func TestRenderManifestsWebhookPolicy(t *testing.T) {
+	c := defaultConfig()
+	fs := flag.NewFlagSet("manifests", flag.ContinueOnError)
+	c.bindFlags(fs)
+	if err := fs.Parse([]string{"--failure-policy=Fail", "--webhook-timeout=10s", "--events", "--side-effects=NoneOnDryRun"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.validate(); err != nil {
+		t.Fatal(err)
+	}
+	out, err := renderManifests(c, manifestOptions{name: "gateway-yeeter", namespace: "mtv", image: "test", replicas: 1}, serverArgs(fs, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := strings.Join(strings.Fields(string(out)), " ")
+	for _, want := range []string{"failurePolicy: Fail", "sideEffects: NoneOnDryRun", "timeoutSeconds: 10", "- --failure-policy=Fail", "- --webhook-timeout=10s"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("expected manifests to contain %q:\n%s", want, s)
+		}
+	}
+
+	for _, args := range [][]string{{"--events"}, {"--plan-summaries"}, {"--failure-policy=fail"}, {"--webhook-timeout=1500ms"}, {"--webhook-timeout=60s"}, {"--side-effects=Some"}} {
+		c := defaultConfig()
+		fs := flag.NewFlagSet("manifests", flag.ContinueOnError)
+		c.bindFlags(fs)
+		if err := fs.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.validate(); err == nil {
+			t.Errorf("expected %v to be invalid", args)
+		}
+	}
+}
+
+func TestRenderManifestsAutoscaler(t *testing.T) {
+	c := defaultConfig()
+	c.MaxInFlight = 20
+	o := manifestOptions{name: "gateway-yeeter", namespace: "mtv", image: "test", replicas: 2, hpaMaxReplicas: 6, hpaTargetUtilization: 0.5}
+	out, err := renderManifests(c, o, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := splitManifests(t, out)
+	hpa, ok := objects["HorizontalPodAutoscaler"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected a HorizontalPodAutoscaler:\n%s", out)
+	}
+	s := strings.Join(strings.Fields(string(out)), " ")
+	for _, want := range []string{"maxReplicas: 6", "minReplicas: 2", "name: gateway_yeeter_admission_utilization target: averageValue: 500m type: AverageValue", "kind: Deployment name: gateway-yeeter"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("expected manifests to contain %q:\n%s", want, s)
+		}
+	}
+	if hpa["metadata"].(map[string]interface{})["namespace"] != "mtv" {
+		t.Errorf("expected the autoscaler in the webhook namespace, got %v", hpa["metadata"])
+	}
+	if _, exists := objects["Deployment"].(map[string]interface{})["spec"].(map[string]interface{})["replicas"]; exists {
+		t.Error("expected the Deployment to leave the replica count to the autoscaler")
+	}
+
+	o.hpaMaxReplicas = 0
+	if out, err = renderManifests(c, o, nil); err != nil || strings.Contains(string(out), "HorizontalPodAutoscaler") {
+		t.Fatalf("expected no autoscaler by default, got %v:\n%s", err, out)
+	}
+}
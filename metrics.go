@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var metricsRegistry = prometheus.NewRegistry()
+
+const (
+	metricCounter   = "counter"
+	metricGauge     = "gauge"
+	metricHistogram = "histogram"
+)
+
+// metricDefinition describes a metric exported by gateway-yeeter. The
+// registry only exposes series that have been observed, so generated
+// dashboards and alerts are built from these instead.
+type metricDefinition struct {
+	Name   string
+	Help   string
+	Type   string
+	Labels []string
+}
+
+var metricDefinitions []metricDefinition
+
+func defineMetric(c prometheus.Collector, name, help, typ string, labels []string) {
+	metricsRegistry.MustRegister(c)
+	metricDefinitions = append(metricDefinitions, metricDefinition{Name: name, Help: help, Type: typ, Labels: labels})
+}
+
+func newCounter(opts prometheus.CounterOpts) prometheus.Counter {
+	c := prometheus.NewCounter(opts)
+	defineMetric(c, opts.Name, opts.Help, metricCounter, nil)
+	return c
+}
+
+func newCounterVec(opts prometheus.CounterOpts, labels ...string) *prometheus.CounterVec {
+	c := prometheus.NewCounterVec(opts, labels)
+	defineMetric(c, opts.Name, opts.Help, metricCounter, labels)
+	return c
+}
+
+func newGauge(opts prometheus.GaugeOpts) prometheus.Gauge {
+	g := prometheus.NewGauge(opts)
+	defineMetric(g, opts.Name, opts.Help, metricGauge, nil)
+	return g
+}
+
+func newGaugeVec(opts prometheus.GaugeOpts, labels ...string) *prometheus.GaugeVec {
+	g := prometheus.NewGaugeVec(opts, labels)
+	defineMetric(g, opts.Name, opts.Help, metricGauge, labels)
+	return g
+}
+
+func newHistogram(opts prometheus.HistogramOpts) prometheus.Histogram {
+	h := prometheus.NewHistogram(opts)
+	defineMetric(h, opts.Name, opts.Help, metricHistogram, nil)
+	return h
+}
+
+func newHistogramVec(opts prometheus.HistogramOpts, labels ...string) *prometheus.HistogramVec {
+	h := prometheus.NewHistogramVec(opts, labels)
+	defineMetric(h, opts.Name, opts.Help, metricHistogram, labels)
+	return h
+}
+
+var (
+	rejectedPayloads = newCounterVec(prometheus.CounterOpts{
+		Name: "gateway_yeeter_rejected_payloads_total",
+		Help: "Admission payloads rejected before decoding, by reason.",
+	}, "reason")
+	admissionReviews = newCounterVec(prometheus.CounterOpts{
+		Name: "gateway_yeeter_admission_reviews_total",
+		Help: "Pod admission reviews handled, by pod type, outcome and reason code.",
+	}, "pod_type", "outcome", "reason")
+	admissionReviewDuration = newHistogram(prometheus.HistogramOpts{
+		Name:    "gateway_yeeter_admission_review_duration_seconds",
+		Help:    "Time spent reviewing a pod admission request.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	})
+	servingCertificateExpiry = newGauge(prometheus.GaugeOpts{
+		Name: "gateway_yeeter_serving_certificate_expiry_timestamp_seconds",
+		Help: "Expiry of the serving certificate being served, as a Unix timestamp.",
+	})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+func metricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
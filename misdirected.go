@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+)
+
+const (
+	misdirectedGVK       = "gvk"
+	misdirectedNamespace = "namespace"
+	misdirectedPod       = "non-target-pod"
+)
+
+var misdirectedRequests = newCounterVec(prometheus.CounterOpts{
+	Name: "gateway_yeeter_misdirected_requests_total",
+	Help: "Admission requests outside the configured scope, indicating a broken webhook registration.",
+}, "kind")
+
+type misdirectedTracker struct {
+	mu     sync.Mutex
+	counts map[string]map[string]int
+}
+
+var misdirected = &misdirectedTracker{counts: make(map[string]map[string]int)}
+
+func (t *misdirectedTracker) observe(kind, detail string) {
+	misdirectedRequests.WithLabelValues(kind).Inc()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.counts[kind] == nil {
+		t.counts[kind] = make(map[string]int)
+	}
+	t.counts[kind][detail]++
+}
+
+func (t *misdirectedTracker) flush() string {
+	t.mu.Lock()
+	counts := t.counts
+	t.counts = make(map[string]map[string]int)
+	t.mu.Unlock()
+
+	var parts []string
+	for kind, details := range counts {
+		var items []string
+		for detail, count := range details {
+			items = append(items, fmt.Sprintf("%s=%d", detail, count))
+		}
+		sort.Strings(items)
+		parts = append(parts, kind+": "+strings.Join(items, ", "))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "; ")
+}
+
+func (t *misdirectedTracker) run(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	for range time.Tick(interval) {
+		if summary := t.flush(); summary != "" {
+			klog.Errorf("Received admission requests outside the configured scope in the last %s (%s) - the MutatingWebhookConfiguration rules, namespaceSelector or objectSelector are probably broken", interval, summary)
+		}
+	}
+}
+
+func namespaceInScope(namespace string) bool {
+	if len(cfg.ScopeNamespaces) == 0 {
+		return true
+	}
+	for _, ns := range cfg.ScopeNamespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesNamespace(patterns []string, namespace string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, namespace); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// namespaceExcluded reports whether pods of namespace must never be
+// modified. This repeats the namespaceSelector of the rendered manifests,
+// which cannot express patterns, and protects the webhook's own namespace
+// against admission deadlocks.
+func namespaceExcluded(namespace string) bool {
+	return (identity.Namespace != "" && namespace == identity.Namespace) || matchesNamespace(cfg.ExcludeNamespaces, namespace)
+}
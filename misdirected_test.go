@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestMisdirectedTrackerFlush(t *testing.T) {
+	tracker := &misdirectedTracker{counts: make(map[string]map[string]int)}
+	tracker.observe(misdirectedGVK, "/v1, Kind=ConfigMap")
+	tracker.observe(misdirectedGVK, "/v1, Kind=ConfigMap")
+	tracker.observe(misdirectedNamespace, "kube-system")
+
+	if summary := tracker.flush(); summary != "gvk: /v1, Kind=ConfigMap=2; namespace: kube-system=1" {
+		t.Fatalf("unexpected summary %q", summary)
+	}
+	if summary := tracker.flush(); summary != "" {
+		t.Fatalf("expected empty summary after flush, got %q", summary)
+	}
+}
+
+func TestReviewPodOutsideNamespaceScope(t *testing.T) {
+	old := cfg
+	cfg.ScopeNamespaces = stringList{"migrations"}
+	defer func() { cfg = old }()
+
+	before := testutil.ToFloat64(misdirectedRequests.WithLabelValues(misdirectedNamespace))
+
+	rawPod, _ := json.Marshal(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "virt-v2v-test",
+			Namespace:   "other",
+			Labels:      map[string]string{"forklift.app": "virt-v2v"},
+			Annotations: map[string]string{"k8s.v1.cni.cncf.io/networks": `[{"name":"net","default-route":["10.0.0.1"]}]`},
+		},
+	})
+	resp := reviewPod(&admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{UID: "test", Namespace: "other", Object: runtime.RawExtension{Raw: rawPod}},
+	})
+
+	if !resp.Allowed || len(resp.Patch) != 0 {
+		t.Fatal("expected out-of-scope pod to be allowed without patch")
+	}
+	if after := testutil.ToFloat64(misdirectedRequests.WithLabelValues(misdirectedNamespace)); after != before+1 {
+		t.Fatal("expected out-of-scope namespace to be counted")
+	}
+}
+
+func TestNamespaceExcluded(t *testing.T) {
+	old, oldIdentity := cfg, identity
+	defer func() { cfg, identity = old, oldIdentity }()
+	cfg = defaultConfig()
+	identity = instanceIdentity{Namespace: "gateway-yeeter", Pod: "gateway-yeeter-0"}
+
+	for namespace, want := range map[string]bool{
+		"kube-system":    true,
+		"openshift-mtv":  true,
+		"gateway-yeeter": true,
+		"mtv-prod":       false,
+		"kube-public":    false,
+	} {
+		if got := namespaceExcluded(namespace); got != want {
+			t.Errorf("namespace %s: expected excluded=%v, got %v", namespace, want, got)
+		}
+	}
+
+	rawPod, _ := json.Marshal(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "virt-v2v-test",
+			Namespace:   "openshift-mtv",
+			Labels:      map[string]string{"forklift.app": "virt-v2v"},
+			Annotations: map[string]string{"k8s.v1.cni.cncf.io/networks": `[{"name":"net","default-route":["10.0.0.1"]}]`},
+		},
+	})
+	ar := &admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{UID: "test", Namespace: "openshift-mtv", Object: runtime.RawExtension{Raw: rawPod}},
+	}
+	d := newDecision(ar)
+	if resp := evaluatePod(ar, d, nil); !resp.Allowed || len(resp.Patch) != 0 || d.Reason != reasonSkipNamespaceExcluded {
+		t.Fatalf("expected pod in an excluded namespace to be skipped, got %+v", d)
+	}
+
+	cfg.ExcludeNamespaces = nil
+	if namespaceExcluded("openshift-mtv") || !namespaceExcluded("gateway-yeeter") {
+		t.Fatal("expected only the own namespace to be excluded without exclude-namespaces")
+	}
+
+	c := defaultConfig()
+	c.ScopeNamespaces = stringList{"openshift-mtv"}
+	if err := c.validate(); err == nil {
+		t.Fatal("expected a scoped namespace that is excluded to be rejected")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// namespaceLabelWatcher caches the namespaces with an informer, so matching
+// --ignore-namespace-selector does not add an API round trip per admission.
+type namespaceLabelWatcher struct {
+	factory informers.SharedInformerFactory
+	lister  listersv1.NamespaceLister
+	synced  cache.InformerSynced
+}
+
+var namespaceLabels *namespaceLabelWatcher
+
+func newNamespaceLabelWatcher() (*namespaceLabelWatcher, error) {
+	client, err := kube.typedFor(lookupNamespace)
+	if err != nil {
+		return nil, err
+	}
+	factory := informers.NewSharedInformerFactory(client, 0)
+	informer := factory.Core().V1().Namespaces()
+	return &namespaceLabelWatcher{factory: factory, lister: informer.Lister(), synced: informer.Informer().HasSynced}, nil
+}
+
+func (w *namespaceLabelWatcher) run(stop <-chan struct{}) {
+	if w == nil {
+		return
+	}
+	w.factory.Start(stop)
+	if cache.WaitForCacheSync(stop, w.synced) {
+		klog.Infof("Namespace cache synced, pods of namespaces matching --ignore-namespace-selector are left unmodified")
+	}
+}
+
+// hasSynced reports whether the namespaces were listed at least once.
+func (w *namespaceLabelWatcher) hasSynced() bool {
+	return w == nil || w.synced()
+}
+
+// ignored reports whether the labels of namespace match selector. Unknown
+// namespaces and an unsynced cache are not ignored, the webhook fails open
+// towards stripping like it does for every other lookup.
+func (w *namespaceLabelWatcher) ignored(selector, namespace string) (bool, error) {
+	if w == nil || selector == "" {
+		return false, nil
+	}
+	if !w.synced() {
+		return false, fmt.Errorf("namespace cache not synced yet")
+	}
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return false, err
+	}
+	ns, err := w.lister.Get(namespace)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return parsed.Matches(labels.Set(ns.Labels)), nil
+}
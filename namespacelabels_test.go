@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func withNamespaceLabels(t *testing.T, namespaces ...*corev1.Namespace) {
+	objects := make([]runtime.Object, len(namespaces))
+	for i, ns := range namespaces {
+		objects[i] = ns
+	}
+	withFakeKube(t, lookupNamespace, fake.NewSimpleClientset(objects...))
+	old := namespaceLabels
+	t.Cleanup(func() { namespaceLabels = old })
+
+	w, err := newNamespaceLabelWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	w.run(stop)
+	if !w.hasSynced() {
+		t.Fatal("expected the namespace cache to be synced")
+	}
+	namespaceLabels = w
+}
+
+func TestNamespaceLabelsIgnored(t *testing.T) {
+	withNamespaceLabels(t,
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "legacy", Labels: map[string]string{"gateway-yeeter.io/ignore": "true"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "mtv-prod", Labels: map[string]string{"gateway-yeeter.io/ignore": "false"}}},
+	)
+
+	for namespace, want := range map[string]bool{"legacy": true, "mtv-prod": false, "unknown": false} {
+		got, err := namespaceLabels.ignored("gateway-yeeter.io/ignore=true", namespace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("namespace %s: expected ignored=%v, got %v", namespace, want, got)
+		}
+	}
+	if ignored, err := namespaceLabels.ignored("", "legacy"); ignored || err != nil {
+		t.Errorf("expected no namespace to be ignored without a selector, got %v, %v", ignored, err)
+	}
+	if ignored, err := (*namespaceLabelWatcher)(nil).ignored("gateway-yeeter.io/ignore=true", "legacy"); ignored || err != nil {
+		t.Errorf("expected no namespace to be ignored without the cache, got %v, %v", ignored, err)
+	}
+}
+
+func TestReviewPodInIgnoredNamespace(t *testing.T) {
+	old := cfg
+	defer func() { cfg = old }()
+	cfg = defaultConfig()
+	cfg.IgnoreNamespaceSelector = "gateway-yeeter.io/ignore=true"
+	withNamespaceLabels(t, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "legacy", Labels: map[string]string{"gateway-yeeter.io/ignore": "true"}}})
+
+	for namespace, reason := range map[string]string{"legacy": reasonSkipNamespaceIgnored, "mtv-prod": reasonMutated} {
+		rawPod, _ := json.Marshal(corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "virt-v2v-test",
+				Namespace:   namespace,
+				Labels:      map[string]string{"forklift.app": "virt-v2v"},
+				Annotations: map[string]string{"k8s.v1.cni.cncf.io/networks": `[{"name":"net","default-route":["10.0.0.1"]}]`},
+			},
+		})
+		ar := &admissionv1.AdmissionReview{
+			Request: &admissionv1.AdmissionRequest{UID: "test", Namespace: namespace, Operation: admissionv1.Create, Object: runtime.RawExtension{Raw: rawPod}},
+		}
+		d := newDecision(ar)
+		if resp := evaluatePod(ar, d, nil); !resp.Allowed || d.Reason != reason {
+			t.Errorf("namespace %s: expected %s, got %+v", namespace, reason, d)
+		}
+	}
+}
+
+func TestNamespaceLabelsRBAC(t *testing.T) {
+	c := defaultConfig()
+	c.IgnoreNamespaceSelector = "gateway-yeeter.io/ignore=true"
+	grants := rbacGrants(c)
+	if len(grants) != 1 || grants[0].category != lookupNamespace || !reflect.DeepEqual(grants[0].rules[0].Verbs, []string{"list", "watch"}) {
+		t.Fatalf("expected list and watch on namespaces, got %+v", grants)
+	}
+
+	c.CheckNamespaceRouting = true
+	if grants := rbacGrants(c); len(grants) != 1 || !reflect.DeepEqual(grants[0].rules[0].Verbs, []string{"get", "list", "watch"}) {
+		t.Fatalf("expected a single namespace grant, got %+v", grants)
+	}
+
+	c.IgnoreNamespaceSelector = "gateway-yeeter.io/ignore in ("
+	if err := c.validate(); err == nil {
+		t.Fatal("expected an invalid selector to be rejected")
+	}
+}
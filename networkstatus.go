@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const (
+	networkStatusAnnotation = "k8s.v1.cni.cncf.io/network-status"
+	verifyListTimeout       = 30 * time.Second
+)
+
+var targetPodSelectors = []string{"forklift.app=virt-v2v", "app=containerized-data-importer"}
+
+var networkStatusViolationPods = newGauge(prometheus.GaugeOpts{
+	Name: "gateway_yeeter_network_status_violations",
+	Help: "Target pods whose Multus network-status reports a default route on a secondary attachment.",
+})
+
+var networkStatusChecks = newCounterVec(prometheus.CounterOpts{
+	Name: "gateway_yeeter_network_status_checks_total",
+	Help: "Target pods verified against their Multus network-status, by result.",
+}, "result")
+
+type networkStatusEntry struct {
+	Name      string `json:"name"`
+	Interface string `json:"interface"`
+	Default   bool   `json:"default"`
+}
+
+// networkStatusViolations returns the attachments of the networks annotation
+// that Multus reports as the default route of the pod.
+func networkStatusViolations(pod *corev1.Pod) ([]string, error) {
+	status, exists := pod.Annotations[networkStatusAnnotation]
+	if !exists {
+		return nil, nil
+	}
+	var networks []map[string]json.RawMessage
+	if annotation := pod.Annotations["k8s.v1.cni.cncf.io/networks"]; annotation != "" {
+		if err := json.Unmarshal([]byte(annotation), &networks); err != nil {
+			return nil, err
+		}
+	}
+	attached := make(map[string]bool, len(networks))
+	for _, network := range networks {
+		var namespace, name string
+		json.Unmarshal(network["namespace"], &namespace)
+		json.Unmarshal(network["name"], &name)
+		if namespace == "" {
+			namespace = pod.Namespace
+		}
+		attached[namespace+"/"+name] = true
+	}
+
+	var entries []networkStatusEntry
+	if err := json.Unmarshal([]byte(status), &entries); err != nil {
+		return nil, err
+	}
+	var violations []string
+	for _, entry := range entries {
+		if entry.Default && attached[entry.Name] {
+			violations = append(violations, entry.Name+" ("+entry.Interface+")")
+		}
+	}
+	return violations, nil
+}
+
+// networkStatusVerifier periodically compares running target pods with the
+// network-status Multus wrote after attaching their networks, catching
+// default routes that reached a pod despite admission, e.g. because the
+// webhook was bypassed or a CNI plugin installed the route on its own.
+type networkStatusVerifier struct {
+	mu       sync.Mutex
+	reported map[types.UID]bool
+}
+
+var networkStatus *networkStatusVerifier
+
+func newNetworkStatusVerifier() *networkStatusVerifier {
+	return &networkStatusVerifier{reported: make(map[types.UID]bool)}
+}
+
+func (v *networkStatusVerifier) run(interval time.Duration) {
+	if v == nil {
+		return
+	}
+	for range time.Tick(interval) {
+		if err := v.verify(); err != nil {
+			klog.Warningf("Could not verify network-status of target pods: %v", err)
+		}
+	}
+}
+
+func (v *networkStatusVerifier) verify() error {
+	client, err := kube.typedFor(lookupPod)
+	if err != nil {
+		return err
+	}
+	namespaces := []string(cfg.ScopeNamespaces)
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), verifyListTimeout)
+	defer cancel()
+	violating := make(map[types.UID]bool)
+	for _, namespace := range namespaces {
+		for _, selector := range targetPodSelectors {
+			pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+			if err != nil {
+				return err
+			}
+			for i := range pods.Items {
+				pod := &pods.Items[i]
+				violations, err := networkStatusViolations(pod)
+				switch {
+				case err != nil:
+					networkStatusChecks.WithLabelValues("error").Inc()
+					klog.Warningf("Cannot verify network-status of pod %s/%s: %v", pod.Namespace, pod.Name, err)
+				case len(violations) > 0:
+					networkStatusChecks.WithLabelValues("violation").Inc()
+					violating[pod.UID] = true
+					v.report(pod, violations)
+				default:
+					networkStatusChecks.WithLabelValues("ok").Inc()
+				}
+			}
+		}
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for uid := range v.reported {
+		if !violating[uid] {
+			delete(v.reported, uid)
+		}
+	}
+	networkStatusViolationPods.Set(float64(len(violating)))
+	return nil
+}
+
+func (v *networkStatusVerifier) report(pod *corev1.Pod, violations []string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.reported[pod.UID] {
+		return
+	}
+	v.reported[pod.UID] = true
+	sort.Strings(violations)
+	klog.Errorf("Pod %s/%s (uid=%s) received a default route on %v according to %s despite admission", cfg.Redaction.value(channelLogs, fieldNamespace, pod.Namespace), cfg.Redaction.value(channelLogs, fieldPod, pod.Name), pod.UID, violations, networkStatusAnnotation)
+}
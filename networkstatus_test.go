@@ -0,0 +1,66 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const defaultRouteStatus = `[{"name":"ovn-kubernetes","interface":"eth0","default":true},{"name":"test/transfer","interface":"net1","default":true}]`
+
+func statusPod(name, networks, status string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "test",
+			UID:       types.UID("uid-" + name),
+			Labels:    map[string]string{"forklift.app": "virt-v2v"},
+			Annotations: map[string]string{
+				"k8s.v1.cni.cncf.io/networks": networks,
+				networkStatusAnnotation:       status,
+			},
+		},
+	}
+}
+
+func TestNetworkStatusViolations(t *testing.T) {
+	violations, err := networkStatusViolations(statusPod("a", `[{"name":"transfer"}]`, defaultRouteStatus))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"test/transfer (net1)"}; !reflect.DeepEqual(violations, expected) {
+		t.Fatalf("expected %v, got %v", expected, violations)
+	}
+
+	violations, err = networkStatusViolations(statusPod("b", `[{"name":"transfer"}]`, `[{"name":"ovn-kubernetes","interface":"eth0","default":true},{"name":"test/transfer","interface":"net1"}]`))
+	if err != nil || len(violations) != 0 {
+		t.Fatalf("expected no violations, got %v, %v", violations, err)
+	}
+
+	if _, err := networkStatusViolations(statusPod("c", `[{"name":"transfer"}]`, `{`)); err == nil {
+		t.Fatal("expected an error for a malformed network-status")
+	}
+}
+
+func TestNetworkStatusVerifier(t *testing.T) {
+	withFakeKube(t, lookupPod, fake.NewClientset(
+		statusPod("violating", `[{"name":"transfer"}]`, defaultRouteStatus),
+		statusPod("fine", `[{"name":"transfer"}]`, `[{"name":"test/transfer","interface":"net1"}]`),
+	))
+
+	v := newNetworkStatusVerifier()
+	if err := v.verify(); err != nil {
+		t.Fatal(err)
+	}
+	if !v.reported["uid-violating"] || len(v.reported) != 1 {
+		t.Fatalf("unexpected reported pods %v", v.reported)
+	}
+	if got := testutil.ToFloat64(networkStatusViolationPods); got != 1 {
+		t.Fatalf("expected 1 violating pod, got %v", got)
+	}
+}
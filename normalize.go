@@ -0,0 +1,16 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// normalizeAnnotation strips the whitespace and UTF-8 byte order marks some
+// templating tools emit around an annotation value, which would otherwise
+// fail to parse and skip enforcement, and reports whether there were any.
+func normalizeAnnotation(annotation string) (string, bool) {
+	normalized := strings.TrimFunc(annotation, func(r rune) bool {
+		return r == '\uFEFF' || unicode.IsSpace(r)
+	})
+	return normalized, normalized != annotation
+}
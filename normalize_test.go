@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeAnnotation(t *testing.T) {
+	cases := []struct {
+		annotation, expected string
+		changed              bool
+	}{
+		{`[{"name":"transfer"}]`, `[{"name":"transfer"}]`, false},
+		{"[{\"name\":\"transfer\"}]\n", `[{"name":"transfer"}]`, true},
+		{"\ufeff[{\"name\":\"transfer\"}]", `[{"name":"transfer"}]`, true},
+		{"\ufeff \t mtv/transfer \r\n", "mtv/transfer", true},
+		{"", "", false},
+	}
+	for _, c := range cases {
+		normalized, changed := normalizeAnnotation(c.annotation)
+		if normalized != c.expected || changed != c.changed {
+			t.Errorf("%q: expected %q (changed %v), got %q (changed %v)", c.annotation, c.expected, c.changed, normalized, changed)
+		}
+	}
+}
+
+func TestReviewPodNormalizesAnnotation(t *testing.T) {
+	resp, d := reviewRulesPod(t, "mtv", "\ufeff[{\"name\":\"transfer\",\"default-route\":[\"10.0.0.1\"]}]\n")
+	if d.Outcome != outcomeMutated {
+		t.Fatalf("expected the pod to be mutated, got %s (%s)", d.Outcome, d.Message)
+	}
+	if patch := string(resp.Patch); strings.Contains(patch, "default-route") || !strings.Contains(patch, `[{\"name\":\"transfer\"}]"`) {
+		t.Fatalf("expected the normalized annotation without default-route, got %s", patch)
+	}
+
+	_, d = reviewRulesPod(t, "mtv", "\ufefftransfer\n")
+	if d.Outcome != outcomeUnchanged {
+		t.Fatalf("expected the normalized shorthand annotation to be parsed, got %s (%s)", d.Outcome, d.Message)
+	}
+}
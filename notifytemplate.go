@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// notificationFuncs are available to notification templates in addition to
+// the text/template builtins. json quotes a value for a JSON document, so
+// messages with quotes or newlines cannot break the payload.
+var notificationFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		raw, err := json.Marshal(v)
+		return string(raw), err
+	},
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// loadNotificationTemplate parses the Go template in file. Missing keys are
+// errors instead of rendering "<no value>" into a message.
+func loadNotificationTemplate(file string) (*template.Template, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(file).Funcs(notificationFuncs).Option("missingkey=error").Parse(string(raw))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse template %s: %w", file, err)
+	}
+	return tmpl, nil
+}
+
+func renderNotification(tmpl *template.Template, data interface{}) ([]byte, error) {
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
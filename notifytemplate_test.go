@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTemplate(t *testing.T, text string) string {
+	file := filepath.Join(t.TempDir(), "notification.tmpl")
+	if err := os.WriteFile(file, []byte(text), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestDenialNotifierTemplate(t *testing.T) {
+	var body, contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		body, contentType = string(raw), r.Header.Get("Content-Type")
+	}))
+	defer srv.Close()
+
+	tmpl, err := loadNotificationTemplate(writeTemplate(t, `{"text": {{ printf "%s denied %s/%s (%s): %s" .Cluster .Namespace .Pod .Decision.Reason .Message | json }}, "gateways": {{ range .Networks }}{{ join .RemovedGateways "," | json }}{{ end }}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &denialNotifier{url: srv.URL, cluster: "east", contentType: "application/json", template: tmpl, client: srv.Client(), queue: make(chan denialNotification, 1)}
+	n.notify(&decision{UID: "1", Namespace: "mtv", Pod: "importer", Outcome: outcomeDenied, Reason: reasonDenyRule, Message: `use "transfer"`, Networks: []networkChange{{Network: "mtv/transfer", RemovedGateways: []string{"10.0.0.1", "10.0.0.2"}}}})
+	close(n.queue)
+	n.run()
+
+	var message struct{ Text, Gateways string }
+	if err := json.Unmarshal([]byte(body), &message); err != nil {
+		t.Fatalf("expected a JSON body, got %q: %v", body, err)
+	}
+	if message.Text != `east denied mtv/importer (DENY_RULE): use "transfer"` || message.Gateways != "10.0.0.1,10.0.0.2" || contentType != "application/json" {
+		t.Fatalf("unexpected message %+v (content type %q)", message, contentType)
+	}
+}
+
+func TestNotificationTemplateErrors(t *testing.T) {
+	if _, err := loadNotificationTemplate(writeTemplate(t, "{{ .Pod")); err == nil {
+		t.Fatal("expected an unparsable template to be rejected")
+	}
+	if _, err := loadNotificationTemplate(filepath.Join(t.TempDir(), "missing.tmpl")); err == nil {
+		t.Fatal("expected a missing template to be rejected")
+	}
+
+	tmpl, err := loadNotificationTemplate(writeTemplate(t, "{{ .labels.team }}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := renderNotification(tmpl, map[string]interface{}{"labels": map[string]string{}}); err == nil || !strings.Contains(err.Error(), "team") {
+		t.Fatalf("expected a missing key to fail rendering, got %v", err)
+	}
+
+	c := defaultConfig()
+	c.DenialWebhookTemplate = "slack.tmpl"
+	if err := c.validate(); err == nil {
+		t.Fatal("expected a template without denial-webhook to be rejected")
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const maxInterfaceNameLength = 15
+
+var patchValidationFailures = newCounterVec(prometheus.CounterOpts{
+	Name: "gateway_yeeter_patch_validation_failures_total",
+	Help: "Rewritten networks annotations that failed Multus NetworkSelectionElement validation, by field.",
+}, "field")
+
+type schemaError struct {
+	index int
+	field string
+	msg   string
+}
+
+func (e *schemaError) Error() string {
+	return fmt.Sprintf("element %d: %s: %s", e.index, e.field, e.msg)
+}
+
+func validateNetworkSelectionElements(annotation []byte) error {
+	var elements []map[string]json.RawMessage
+	if err := json.Unmarshal(annotation, &elements); err != nil {
+		return &schemaError{index: -1, field: "annotation", msg: err.Error()}
+	}
+
+	for i, element := range elements {
+		if err := validateNetworkSelectionElement(element); err != nil {
+			err.index = i
+			return err
+		}
+	}
+	return nil
+}
+
+func validateNetworkSelectionElement(element map[string]json.RawMessage) *schemaError {
+	var name string
+	if err := unmarshalField(element, "name", &name); err != nil {
+		return err
+	}
+	if name == "" {
+		return &schemaError{field: "name", msg: "is required"}
+	}
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return &schemaError{field: "name", msg: strings.Join(errs, "; ")}
+	}
+
+	var namespace string
+	if err := unmarshalField(element, "namespace", &namespace); err != nil {
+		return err
+	}
+	if namespace != "" {
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return &schemaError{field: "namespace", msg: strings.Join(errs, "; ")}
+		}
+	}
+
+	var iface string
+	if err := unmarshalField(element, "interface", &iface); err != nil {
+		return err
+	}
+	if iface != "" {
+		if len(iface) > maxInterfaceNameLength {
+			return &schemaError{field: "interface", msg: fmt.Sprintf("%q is longer than %d characters", iface, maxInterfaceNameLength)}
+		}
+		if iface == "." || iface == ".." || strings.ContainsAny(iface, "/: \t\n") {
+			return &schemaError{field: "interface", msg: fmt.Sprintf("%q is not a valid interface name", iface)}
+		}
+	}
+
+	var mac string
+	if err := unmarshalField(element, "mac", &mac); err != nil {
+		return err
+	}
+	if mac != "" {
+		if _, err := net.ParseMAC(mac); err != nil {
+			return &schemaError{field: "mac", msg: err.Error()}
+		}
+	}
+
+	var ips []string
+	if err := unmarshalField(element, "ips", &ips); err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		if net.ParseIP(ip) == nil {
+			if _, _, err := net.ParseCIDR(ip); err != nil {
+				return &schemaError{field: "ips", msg: fmt.Sprintf("%q is neither an IP nor a CIDR", ip)}
+			}
+		}
+	}
+
+	var gateways []string
+	if err := unmarshalField(element, "default-route", &gateways); err != nil {
+		return err
+	}
+	for _, gw := range gateways {
+		if net.ParseIP(gw) == nil {
+			return &schemaError{field: "default-route", msg: fmt.Sprintf("%q is not an IP", gw)}
+		}
+	}
+
+	return nil
+}
+
+func unmarshalField(element map[string]json.RawMessage, field string, v interface{}) *schemaError {
+	raw, exists := element[field]
+	if !exists || string(raw) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return &schemaError{field: field, msg: "has the wrong type: " + err.Error()}
+	}
+	return nil
+}
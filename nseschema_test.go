@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestValidateNetworkSelectionElements(t *testing.T) {
+	valid := []string{
+		`[]`,
+		`[{"name":"mtv-transfer"}]`,
+		`[{"name":"mtv-transfer","namespace":"default","interface":"net1","mac":"02:00:00:00:00:01","ips":["10.0.0.5/24","fd00::5"],"default-route":["10.0.0.1"]}]`,
+	}
+	for _, annotation := range valid {
+		if err := validateNetworkSelectionElements([]byte(annotation)); err != nil {
+			t.Errorf("expected %s to be valid, got %v", annotation, err)
+		}
+	}
+
+	invalid := map[string]string{
+		`{"name":"x"}`:                                     "annotation",
+		`[{"namespace":"default"}]`:                        "name",
+		`[{"name":"Not_Valid"}]`:                           "name",
+		`[{"name":"net","namespace":"a.b"}]`:               "namespace",
+		`[{"name":"net","interface":"much-too-long-if0"}]`: "interface",
+		`[{"name":"net","interface":"net/1"}]`:             "interface",
+		`[{"name":"net","mac":"not-a-mac"}]`:               "mac",
+		`[{"name":"net","ips":["10.0.0.300"]}]`:            "ips",
+		`[{"name":"net","default-route":["gw"]}]`:          "default-route",
+		`[{"name":"net","ips":"10.0.0.1"}]`:                "ips",
+	}
+	for annotation, field := range invalid {
+		err := validateNetworkSelectionElements([]byte(annotation))
+		serr, ok := err.(*schemaError)
+		if !ok || serr.field != field {
+			t.Errorf("expected %s to fail on %s, got %v", annotation, field, err)
+		}
+	}
+}
+
+func TestReviewPodRefusesInvalidPatch(t *testing.T) {
+	before := testutil.ToFloat64(patchValidationFailures.WithLabelValues("name"))
+
+	rawPod, _ := json.Marshal(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "importer-test",
+			Namespace:   "test",
+			Labels:      map[string]string{"app": "containerized-data-importer"},
+			Annotations: map[string]string{"k8s.v1.cni.cncf.io/networks": `[{"name":"Not_Valid","default-route":["10.0.0.1"]}]`},
+		},
+	})
+	resp := reviewPod(&admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{UID: "test", Object: runtime.RawExtension{Raw: rawPod}},
+	})
+
+	if !resp.Allowed || len(resp.Patch) != 0 {
+		t.Fatal("expected pod to be allowed without patch")
+	}
+	if len(resp.Warnings) == 0 {
+		t.Fatal("expected a warning about the refused patch")
+	}
+	if after := testutil.ToFloat64(patchValidationFailures.WithLabelValues("name")); after != before+1 {
+		t.Fatal("expected validation failure to be counted")
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/klog/v2"
+)
+
+const otlpRequestTimeout = 10 * time.Second
+
+// OTLP uses cumulative temporality for Prometheus style counters and
+// histograms, AGGREGATION_TEMPORALITY_CUMULATIVE in the protocol.
+const otlpCumulative = 2
+
+type otlpExporter struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+	start   time.Time
+	service string
+	id      instanceIdentity
+}
+
+var metricsExporter *otlpExporter
+
+func newOTLPExporter(c config) (*otlpExporter, error) {
+	if c.OTLPEndpoint == "" {
+		return nil, nil
+	}
+	client, err := c.OTLPTLS.httpClient(otlpRequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	headers := make(map[string]string, len(c.OTLPHeaders))
+	for _, header := range c.OTLPHeaders {
+		key, value, _ := strings.Cut(header, "=")
+		headers[key] = value
+	}
+	service := "gateway-yeeter"
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		service = name
+	}
+	return &otlpExporter{
+		url:     strings.TrimSuffix(c.OTLPEndpoint, "/") + "/v1/metrics",
+		headers: headers,
+		client:  client,
+		start:   time.Now(),
+		service: service,
+		id:      identity,
+	}, nil
+}
+
+func (o *otlpExporter) run(interval time.Duration) {
+	if o == nil {
+		return
+	}
+	for range time.Tick(interval) {
+		if err := o.export(); err != nil {
+			klog.Warningf("Could not export metrics over OTLP: %v", err)
+		}
+	}
+}
+
+func (o *otlpExporter) export() error {
+	families, err := metricsRegistry.Gather()
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(o.request(families, time.Now()))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, o.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range o.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector responded with %s", resp.Status)
+	}
+	return nil
+}
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpDataPoint struct {
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	AsDouble          *float64        `json:"asDouble,omitempty"`
+	Count             string          `json:"count,omitempty"`
+	Sum               *float64        `json:"sum,omitempty"`
+	BucketCounts      []string        `json:"bucketCounts,omitempty"`
+	ExplicitBounds    []float64       `json:"explicitBounds,omitempty"`
+	QuantileValues    []otlpQuantile  `json:"quantileValues,omitempty"`
+}
+
+type otlpQuantile struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+type otlpPoints struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality,omitempty"`
+	IsMonotonic            bool            `json:"isMonotonic,omitempty"`
+}
+
+type otlpMetric struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Sum         *otlpPoints `json:"sum,omitempty"`
+	Gauge       *otlpPoints `json:"gauge,omitempty"`
+	Histogram   *otlpPoints `json:"histogram,omitempty"`
+	Summary     *otlpPoints `json:"summary,omitempty"`
+}
+
+// request converts gathered Prometheus metric families to an OTLP
+// ExportMetricsServiceRequest in its JSON encoding, which carries 64 bit
+// integers as strings.
+func (o *otlpExporter) request(families []*dto.MetricFamily, now time.Time) map[string]interface{} {
+	start := strconv.FormatInt(o.start.UnixNano(), 10)
+	timestamp := strconv.FormatInt(now.UnixNano(), 10)
+
+	metrics := make([]otlpMetric, 0, len(families))
+	for _, family := range families {
+		metric := otlpMetric{Name: family.GetName(), Description: family.GetHelp()}
+		points := &otlpPoints{}
+		for _, m := range family.GetMetric() {
+			point := otlpDataPoint{Attributes: otlpAttributes(m.GetLabel()), TimeUnixNano: timestamp}
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				point.StartTimeUnixNano = start
+				point.AsDouble = float64Ptr(m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				point.AsDouble = float64Ptr(m.GetGauge().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				point.StartTimeUnixNano = start
+				point.Count = strconv.FormatUint(h.GetSampleCount(), 10)
+				point.Sum = float64Ptr(h.GetSampleSum())
+				// Prometheus buckets are cumulative, OTLP bucket counts are not
+				// and carry an extra overflow bucket.
+				var previous uint64
+				for _, bucket := range h.GetBucket() {
+					point.ExplicitBounds = append(point.ExplicitBounds, bucket.GetUpperBound())
+					point.BucketCounts = append(point.BucketCounts, strconv.FormatUint(bucket.GetCumulativeCount()-previous, 10))
+					previous = bucket.GetCumulativeCount()
+				}
+				point.BucketCounts = append(point.BucketCounts, strconv.FormatUint(h.GetSampleCount()-previous, 10))
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				point.StartTimeUnixNano = start
+				point.Count = strconv.FormatUint(s.GetSampleCount(), 10)
+				point.Sum = float64Ptr(s.GetSampleSum())
+				for _, q := range s.GetQuantile() {
+					point.QuantileValues = append(point.QuantileValues, otlpQuantile{Quantile: q.GetQuantile(), Value: q.GetValue()})
+				}
+			default:
+				continue
+			}
+			points.DataPoints = append(points.DataPoints, point)
+		}
+		if len(points.DataPoints) == 0 {
+			continue
+		}
+		switch family.GetType() {
+		case dto.MetricType_COUNTER:
+			points.AggregationTemporality, points.IsMonotonic = otlpCumulative, true
+			metric.Sum = points
+		case dto.MetricType_GAUGE:
+			metric.Gauge = points
+		case dto.MetricType_HISTOGRAM:
+			points.AggregationTemporality = otlpCumulative
+			metric.Histogram = points
+		case dto.MetricType_SUMMARY:
+			metric.Summary = points
+		}
+		metrics = append(metrics, metric)
+	}
+
+	return map[string]interface{}{
+		"resourceMetrics": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes(o.resourceLabels()),
+			},
+			"scopeMetrics": []interface{}{map[string]interface{}{
+				"scope":   map[string]string{"name": "gateway-yeeter"},
+				"metrics": metrics,
+			}},
+		}},
+	}
+}
+
+// resourceLabels identifies the replica with the OpenTelemetry semantic
+// conventions for Kubernetes.
+func (o *otlpExporter) resourceLabels() []*dto.LabelPair {
+	labels := []*dto.LabelPair{{Name: stringPtr("service.name"), Value: stringPtr(o.service)}}
+	for _, attr := range [][2]string{
+		{"service.instance.id", o.id.Pod},
+		{"k8s.pod.name", o.id.Pod},
+		{"k8s.namespace.name", o.id.Namespace},
+		{"k8s.node.name", o.id.Node},
+	} {
+		if attr[1] != "" {
+			labels = append(labels, &dto.LabelPair{Name: stringPtr(attr[0]), Value: stringPtr(attr[1])})
+		}
+	}
+	return labels
+}
+
+func otlpAttributes(labels []*dto.LabelPair) []otlpAttribute {
+	attributes := make([]otlpAttribute, 0, len(labels))
+	for _, label := range labels {
+		attribute := otlpAttribute{Key: label.GetName()}
+		attribute.Value.StringValue = label.GetValue()
+		attributes = append(attributes, attribute)
+	}
+	return attributes
+}
+
+func float64Ptr(v float64) *float64 {
+	return &v
+}
+
+func stringPtr(v string) *string {
+	return &v
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestOTLPRequest(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_total", Help: "Test counter."}, []string{"kind"})
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_seconds", Help: "Test histogram.", Buckets: []float64{1, 5}})
+	registry.MustRegister(counter, histogram)
+	counter.WithLabelValues("a").Add(2)
+	histogram.Observe(0.5)
+	histogram.Observe(3)
+	histogram.Observe(10)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := &otlpExporter{start: time.Unix(1, 0), service: "gateway-yeeter", id: instanceIdentity{Namespace: "mtv", Pod: "webhook-0"}}
+	raw, _ := json.Marshal(o.request(families, time.Unix(2, 0)))
+
+	var request struct {
+		ResourceMetrics []struct {
+			Resource struct {
+				Attributes []otlpAttribute `json:"attributes"`
+			} `json:"resource"`
+			ScopeMetrics []struct {
+				Metrics []otlpMetric `json:"metrics"`
+			} `json:"scopeMetrics"`
+		} `json:"resourceMetrics"`
+	}
+	if err := json.Unmarshal(raw, &request); err != nil {
+		t.Fatal(err)
+	}
+	resource := map[string]string{}
+	for _, attr := range request.ResourceMetrics[0].Resource.Attributes {
+		resource[attr.Key] = attr.Value.StringValue
+	}
+	if resource["service.name"] != "gateway-yeeter" || resource["k8s.namespace.name"] != "mtv" || resource["k8s.pod.name"] != "webhook-0" {
+		t.Fatalf("unexpected resource attributes %v", resource)
+	}
+	metrics := request.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	if len(metrics) != 2 {
+		t.Fatalf("expected 2 metrics, got %s", raw)
+	}
+
+	h := metrics[0]
+	if h.Name != "test_seconds" || h.Histogram == nil || h.Histogram.AggregationTemporality != otlpCumulative {
+		t.Fatalf("unexpected histogram %+v", h)
+	}
+	point := h.Histogram.DataPoints[0]
+	if point.Count != "3" || *point.Sum != 13.5 || len(point.ExplicitBounds) != 2 {
+		t.Fatalf("unexpected histogram point %+v", point)
+	}
+	if buckets := point.BucketCounts; len(buckets) != 3 || buckets[0] != "1" || buckets[1] != "1" || buckets[2] != "1" {
+		t.Fatalf("expected non-cumulative bucket counts with overflow, got %v", buckets)
+	}
+
+	c := metrics[1]
+	if c.Name != "test_total" || c.Sum == nil || !c.Sum.IsMonotonic || *c.Sum.DataPoints[0].AsDouble != 2 {
+		t.Fatalf("unexpected counter %+v", c)
+	}
+	if attr := c.Sum.DataPoints[0].Attributes[0]; attr.Key != "kind" || attr.Value.StringValue != "a" {
+		t.Fatalf("unexpected attribute %+v", attr)
+	}
+	if c.Sum.DataPoints[0].StartTimeUnixNano != "1000000000" || c.Sum.DataPoints[0].TimeUnixNano != "2000000000" {
+		t.Fatalf("unexpected timestamps %+v", c.Sum.DataPoints[0])
+	}
+}
+
+func TestOTLPExport(t *testing.T) {
+	var path, auth, contentType string
+	var body []byte
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, auth, contentType = r.URL.Path, r.Header.Get("Authorization"), r.Header.Get("Content-Type")
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o600)
+	c := defaultConfig()
+	c.OTLPEndpoint = srv.URL + "/"
+	c.OTLPHeaders = stringList{"Authorization=Bearer token"}
+	c.OTLPTLS.CAFile = caFile
+
+	o, err := newOTLPExporter(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.export(); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/v1/metrics" || auth != "Bearer token" || contentType != "application/json" || !json.Valid(body) {
+		t.Fatalf("unexpected request to %s (auth %q, type %q)", path, auth, contentType)
+	}
+}
+
+func TestOTLPDisabled(t *testing.T) {
+	if o, err := newOTLPExporter(defaultConfig()); o != nil || err != nil {
+		t.Fatalf("expected no exporter, got %v, %v", o, err)
+	}
+}
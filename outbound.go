@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type sinkTLS struct {
+	CAFile     string     `json:"caFile,omitempty"`
+	SPKIPins   stringList `json:"spkiPins,omitempty"`
+	ClientCert string     `json:"clientCert,omitempty"`
+	ClientKey  string     `json:"clientKey,omitempty"`
+	ServerName string     `json:"serverName,omitempty"`
+}
+
+func (s *sinkTLS) bindFlags(fs *flag.FlagSet, prefix, sink string) {
+	fs.StringVar(&s.CAFile, prefix+"-ca-file", s.CAFile, "PEM CA bundle used to verify the "+sink+" (defaults to the system roots)")
+	fs.Var(&s.SPKIPins, prefix+"-spki-pins", "Comma-separated base64 SHA-256 SubjectPublicKeyInfo pins; one certificate of the "+sink+" chain must match")
+	fs.StringVar(&s.ClientCert, prefix+"-client-cert", s.ClientCert, "PEM client certificate presented to the "+sink+" for mutual TLS (reloaded when rotated)")
+	fs.StringVar(&s.ClientKey, prefix+"-client-key", s.ClientKey, "PEM client key presented to the "+sink+" for mutual TLS (reloaded when rotated)")
+	fs.StringVar(&s.ServerName, prefix+"-server-name", s.ServerName, "Server name expected in the certificate of the "+sink+" (defaults to the URL host)")
+}
+
+func (s sinkTLS) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: s.ServerName,
+	}
+
+	if s.CAFile != "" {
+		pool, err := loadCertPool(s.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if (s.ClientCert == "") != (s.ClientKey == "") {
+		return nil, errors.New("client certificate and key must be configured together")
+	}
+	if s.ClientCert != "" {
+		reloader, err := newCertReloader(s.ClientCert, s.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %w", err)
+		}
+		tlsConfig.GetClientCertificate = reloader.getClientCertificate
+	}
+
+	if len(s.SPKIPins) > 0 {
+		pins := make(map[string]bool, len(s.SPKIPins))
+		for _, pin := range s.SPKIPins {
+			if raw, err := base64.StdEncoding.DecodeString(pin); err != nil || len(raw) != sha256.Size {
+				return nil, fmt.Errorf("invalid SPKI pin %q, expected base64 encoded SHA-256", pin)
+			}
+			pins[pin] = true
+		}
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			for _, chain := range cs.VerifiedChains {
+				for _, cert := range chain {
+					if pins[spkiPin(cert)] {
+						return nil
+					}
+				}
+			}
+			return errors.New("no certificate in the verified chain matches the configured SPKI pins")
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+func (s sinkTLS) httpClient(timeout time.Duration) (*http.Client, error) {
+	tlsConfig, err := s.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
+func spkiPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func requireHTTPS(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid sink URL %q: %w", endpoint, err)
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("sink URL %q must use https", endpoint)
+	}
+	return nil
+}
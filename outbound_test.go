@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newPinnedTestServer(t *testing.T) (*httptest.Server, string) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(ts.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := os.WriteFile(caFile, pemBytes, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return ts, caFile
+}
+
+func TestSinkTLSCustomCA(t *testing.T) {
+	ts, caFile := newPinnedTestServer(t)
+
+	if _, err := (&http.Client{Timeout: time.Second}).Get(ts.URL); err == nil {
+		t.Fatal("expected system roots not to trust the test server")
+	}
+
+	client, err := sinkTLS{CAFile: caFile}.httpClient(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("expected custom CA to be trusted, got %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestSinkTLSSPKIPinning(t *testing.T) {
+	ts, caFile := newPinnedTestServer(t)
+
+	client, err := sinkTLS{CAFile: caFile, SPKIPins: stringList{spkiPin(ts.Certificate())}}.httpClient(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("expected matching pin to be accepted, got %v", err)
+	}
+	resp.Body.Close()
+
+	client, err = sinkTLS{CAFile: caFile, SPKIPins: stringList{"47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="}}.httpClient(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get(ts.URL); err == nil {
+		t.Fatal("expected mismatching pin to be rejected")
+	}
+}
+
+func TestSinkTLSInvalidSettings(t *testing.T) {
+	if _, err := (sinkTLS{SPKIPins: stringList{"not-a-pin"}}).tlsConfig(); err == nil {
+		t.Fatal("expected invalid pin to be rejected")
+	}
+	if _, err := (sinkTLS{ClientCert: "cert.pem"}).tlsConfig(); err == nil {
+		t.Fatal("expected client certificate without key to be rejected")
+	}
+	if err := requireHTTPS("http://collector.example.com"); err == nil {
+		t.Fatal("expected plain http sink URL to be rejected")
+	}
+}
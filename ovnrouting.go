@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	ovnRoutingIgnore = "ignore"
+	ovnRoutingWarn   = "warn"
+	ovnRoutingStrip  = "strip"
+
+	ovnRoutingExternalGWsAnnotation = "k8s.ovn.org/routing-external-gws"
+
+	namespaceLookupTimeout = 2 * time.Second
+)
+
+var ovnRoutingAnnotations = []string{
+	ovnRoutingExternalGWsAnnotation,
+	"k8s.ovn.org/routing-namespaces",
+	"k8s.ovn.org/routing-network",
+	"k8s.ovn.org/bfd-enabled",
+}
+
+var ovnRoutingAnnotationsSeen = newCounterVec(prometheus.CounterOpts{
+	Name: "gateway_yeeter_ovn_routing_annotations_total",
+	Help: "OVN-Kubernetes routing annotations found on target pods or their namespaces, by scope and action taken.",
+}, "scope", "action")
+
+func ovnRoutingPodAnnotations(annotations map[string]string) []string {
+	var found []string
+	for _, key := range ovnRoutingAnnotations {
+		if _, exists := annotations[key]; exists {
+			found = append(found, key)
+		}
+	}
+	return found
+}
+
+func namespaceExternalGateways(namespace string) (string, error) {
+	client, err := kube.typedFor(lookupNamespace)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), namespaceLookupTimeout)
+	defer cancel()
+
+	ns, err := client.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("could not look up namespace %s: %w", namespace, err)
+	}
+	return ns.Annotations[ovnRoutingExternalGWsAnnotation], nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func withFakeKube(t *testing.T, category lookupCategory, client kubernetes.Interface) {
+	old := kube
+	kube = &kubeClients{typed: map[lookupCategory]kubernetes.Interface{category: client}}
+	t.Cleanup(func() { kube = old })
+}
+
+func reviewRoutingPod(t *testing.T, annotations map[string]string) *admissionv1.AdmissionResponse {
+	rawPod, _ := json.Marshal(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "importer-test",
+			Namespace:   "test",
+			Labels:      map[string]string{"app": "containerized-data-importer"},
+			Annotations: annotations,
+		},
+	})
+	return reviewPod(&admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{UID: "test", Namespace: "test", Object: runtime.RawExtension{Raw: rawPod}},
+	})
+}
+
+func TestReviewPodStripsOVNRoutingAnnotations(t *testing.T) {
+	old := cfg
+	cfg.OVNRoutingAnnotations = ovnRoutingStrip
+	defer func() { cfg = old }()
+
+	resp := reviewRoutingPod(t, map[string]string{
+		"k8s.ovn.org/routing-external-gws": "172.18.0.5",
+		"k8s.ovn.org/bfd-enabled":          "",
+		"unrelated":                        "kept",
+	})
+
+	var patches []patch
+	json.Unmarshal(resp.Patch, &patches)
+	if len(patches) != 2 {
+		t.Fatalf("expected 2 patches, got %s", resp.Patch)
+	}
+	if patches[0].Op != "remove" || patches[0].Path != "/metadata/annotations/k8s.ovn.org~1routing-external-gws" {
+		t.Fatalf("unexpected patch %+v", patches[0])
+	}
+	if patches[1].Path != "/metadata/annotations/k8s.ovn.org~1bfd-enabled" {
+		t.Fatalf("unexpected patch %+v", patches[1])
+	}
+}
+
+func TestReviewPodWarnsAboutOVNRoutingAnnotations(t *testing.T) {
+	old := cfg
+	cfg.OVNRoutingAnnotations = ovnRoutingWarn
+	cfg.CheckNamespaceRouting = true
+	defer func() { cfg = old }()
+
+	withFakeKube(t, lookupNamespace, fake.NewSimpleClientset(&corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test",
+			Annotations: map[string]string{"k8s.ovn.org/routing-external-gws": "172.18.0.5"},
+		},
+	}))
+
+	resp := reviewRoutingPod(t, map[string]string{"k8s.ovn.org/routing-namespaces": "other"})
+
+	if len(resp.Patch) != 0 {
+		t.Fatal("expected no patch in warn mode")
+	}
+	if len(resp.Warnings) != 2 || !strings.Contains(resp.Warnings[1], "namespace") {
+		t.Fatalf("expected pod and namespace warnings, got %v", resp.Warnings)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+const (
+	rejectEmpty          = "empty"
+	rejectTooLarge       = "too-large"
+	rejectTooDeep        = "too-deep"
+	rejectNotObject      = "not-object"
+	rejectMalformed      = "malformed"
+	rejectMissingRequest = "missing-request"
+	rejectMissingObject  = "missing-object"
+)
+
+type payloadError struct {
+	reason string
+	msg    string
+}
+
+func (e *payloadError) Error() string {
+	return e.msg
+}
+
+func rejectPayload(reason, format string, args ...interface{}) *payloadError {
+	rejectedPayloads.WithLabelValues(reason).Inc()
+	return &payloadError{reason: reason, msg: fmt.Sprintf(format, args...)}
+}
+
+func validatePayloadShape(body []byte, maxBytes int64, maxDepth int) *payloadError {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return rejectPayload(rejectEmpty, "empty request body")
+	}
+	if int64(len(body)) > maxBytes {
+		return rejectPayload(rejectTooLarge, "request body exceeds %d bytes", maxBytes)
+	}
+	if trimmed[0] != '{' {
+		return rejectPayload(rejectNotObject, "request body is not a JSON object")
+	}
+	if depth := jsonDepth(trimmed); depth > maxDepth {
+		return rejectPayload(rejectTooDeep, "request body nesting depth exceeds %d", maxDepth)
+	}
+	return nil
+}
+
+func validateAdmissionReview(review *admissionv1.AdmissionReview) *payloadError {
+	if review.Request == nil {
+		return rejectPayload(rejectMissingRequest, "missing admission request")
+	}
+	// A DELETE carries the deleted object as the old object only.
+	if len(bytes.TrimSpace(review.Request.Object.Raw)) == 0 && review.Request.Operation != admissionv1.Delete {
+		return rejectPayload(rejectMissingObject, "admission request without object")
+	}
+	return nil
+}
+
+func jsonDepth(data []byte) int {
+	depth, maxDepth := 0, 0
+	inString, escaped := false, false
+	for _, c := range data {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+			if depth > maxDepth {
+				maxDepth = depth
+			}
+		case '}', ']':
+			depth--
+		}
+	}
+	return maxDepth
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestJSONDepth(t *testing.T) {
+	cases := map[string]int{
+		`{}`:                       1,
+		`{"a":[{"b":1}]}`:          3,
+		`{"a":"[[[[{{{{"}`:         1,
+		`{"a":"\"[[","b":{"c":1}}`: 2,
+	}
+	for input, want := range cases {
+		if got := jsonDepth([]byte(input)); got != want {
+			t.Errorf("jsonDepth(%s) = %d, want %d", input, got, want)
+		}
+	}
+}
+
+func TestValidatePayloadShape(t *testing.T) {
+	deep := strings.Repeat(`{"a":`, 10) + "1" + strings.Repeat("}", 10)
+	cases := []struct {
+		body   string
+		reason string
+	}{
+		{"", rejectEmpty},
+		{"   ", rejectEmpty},
+		{strings.Repeat("x", 101), rejectTooLarge},
+		{`[{"request":{}}]`, rejectNotObject},
+		{deep, rejectTooDeep},
+	}
+	for _, c := range cases {
+		perr := validatePayloadShape([]byte(c.body), 100, 5)
+		if perr == nil || perr.reason != c.reason {
+			t.Errorf("expected %q to be rejected with %s, got %v", c.body, c.reason, perr)
+		}
+	}
+
+	if perr := validatePayloadShape([]byte(`{"request":{}}`), 100, 5); perr != nil {
+		t.Fatalf("expected valid payload, got %v", perr)
+	}
+}
+
+func TestHandleMutateRejectsPathologicalPayloads(t *testing.T) {
+	before := testutil.ToFloat64(rejectedPayloads.WithLabelValues(rejectMissingObject))
+
+	body := `{"apiVersion":"admission.k8s.io/v1","kind":"AdmissionReview","request":{"uid":"x","kind":{"group":"","version":"v1","kind":"Pod"}}}`
+	req := httptest.NewRequest("POST", "/mutate", bytes.NewReader([]byte(body)))
+	w := httptest.NewRecorder()
+	handleMutate(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", w.Code)
+	}
+	if after := testutil.ToFloat64(rejectedPayloads.WithLabelValues(rejectMissingObject)); after != before+1 {
+		t.Fatalf("expected rejection to be counted, got %v -> %v", before, after)
+	}
+}
@@ -0,0 +1,191 @@
+// Package adminclient is a typed client for the admin endpoints of
+// gateway-yeeter, for tooling and tests that query decisions or trigger
+// reloads of a running webhook.
+package adminclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// NetworkChange is what was done to one attachment of a pod.
+type NetworkChange struct {
+	Network         string   `json:"network"`
+	RemovedGateways []string `json:"removedGateways"`
+	SRIOVResource   string   `json:"sriovResource,omitempty"`
+	AddedRoutes     []string `json:"addedRoutes,omitempty"`
+}
+
+// PodContext is the pod-spec context selected with --pod-context.
+type PodContext struct {
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	Image        string            `json:"image,omitempty"`
+	Owners       []string          `json:"owners,omitempty"`
+}
+
+// Decision is one admission review as served on /decisions, redacted with
+// the admin policy of the webhook.
+type Decision struct {
+	Kind      string          `json:"kind"`
+	Time      time.Time       `json:"time"`
+	UID       string          `json:"uid"`
+	Namespace string          `json:"namespace"`
+	Pod       string          `json:"pod"`
+	PodType   string          `json:"podType,omitempty"`
+	Rule      string          `json:"rule,omitempty"`
+	Outcome   string          `json:"outcome"`
+	Reason    string          `json:"reason,omitempty"`
+	Mode      string          `json:"mode,omitempty"`
+	Message   string          `json:"message,omitempty"`
+	Networks  []NetworkChange `json:"networks,omitempty"`
+
+	RemovedAnnotations []string `json:"removedAnnotations,omitempty"`
+	Patch              string   `json:"patch,omitempty"`
+	RulesOutcome       string   `json:"rulesOutcome,omitempty"`
+	MatchedPodTypes    []string `json:"matchedPodTypes,omitempty"`
+	MatchedRules       []string `json:"matchedRules,omitempty"`
+
+	PodContext *PodContext `json:"podContext,omitempty"`
+}
+
+// DecisionFilter selects decisions. Namespace and Pod accept glob
+// patterns, Since and Until RFC 3339 timestamps or a duration before now.
+// Empty fields do not filter.
+type DecisionFilter struct {
+	Namespace string
+	Pod       string
+	PodType   string
+	Outcome   string
+	Gateway   string
+	Since     string
+	Until     string
+}
+
+func (f DecisionFilter) query() url.Values {
+	q := url.Values{}
+	for key, value := range map[string]string{
+		"namespace": f.Namespace,
+		"pod":       f.Pod,
+		"podType":   f.PodType,
+		"outcome":   f.Outcome,
+		"gateway":   f.Gateway,
+		"since":     f.Since,
+		"until":     f.Until,
+	} {
+		if value != "" {
+			q.Set(key, value)
+		}
+	}
+	return q
+}
+
+// Stats counts the decisions since the webhook started.
+type Stats struct {
+	Started  time.Time         `json:"started"`
+	Uptime   string            `json:"uptime"`
+	Total    uint64            `json:"total"`
+	Outcomes map[string]uint64 `json:"outcomes"`
+}
+
+// Config is the effective configuration served on /configz. Config and
+// Rules are kept raw, their schema follows the flags of the webhook.
+type Config struct {
+	Hash   string          `json:"hash"`
+	Config json.RawMessage `json:"config"`
+	Rules  json.RawMessage `json:"rules"`
+}
+
+// ReloadResult is the state after a reload.
+type ReloadResult struct {
+	RulesHash string   `json:"rulesHash"`
+	Targets   []string `json:"targets"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// Error is returned for responses other than 200 OK.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Client calls the admin endpoints of one webhook replica.
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// New returns a client for the webhook at baseURL, e.g.
+// https://gateway-yeeter.openshift-mtv.svc. token is sent as a bearer token
+// and must belong to an --admin-viewers or --admins subject; httpClient
+// defaults to http.DefaultClient.
+func New(baseURL, token string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), token: token, httpClient: httpClient}
+}
+
+// Decisions returns the recent decisions matching filter, newest first.
+func (c *Client) Decisions(ctx context.Context, filter DecisionFilter) ([]Decision, error) {
+	var decisions []Decision
+	return decisions, c.do(ctx, http.MethodGet, "/decisions", filter.query(), &decisions)
+}
+
+// Stats returns the decision counts.
+func (c *Client) Stats(ctx context.Context) (Stats, error) {
+	var stats Stats
+	return stats, c.do(ctx, http.MethodGet, "/stats", nil, &stats)
+}
+
+// Config returns the effective configuration and rules.
+func (c *Client) Config(ctx context.Context) (Config, error) {
+	var config Config
+	return config, c.do(ctx, http.MethodGet, "/configz", nil, &config)
+}
+
+// Reload reloads the rule sources and targets immediately. It needs the
+// admin role.
+func (c *Client) Reload(ctx context.Context) (ReloadResult, error) {
+	var result ReloadResult
+	return result, c.do(ctx, http.MethodPost, "/reload", nil, &result)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, out interface{}) error {
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("could not decode %s response: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package adminclient
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDecisions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/decisions" || r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("unexpected request %s with %q", r.URL, r.Header.Get("Authorization"))
+		}
+		if got := r.URL.Query().Encode(); got != "namespace=mtv-%2A&since=1h" {
+			t.Errorf("unexpected query %s", got)
+		}
+		w.Write([]byte(`[{"uid":"a","namespace":"mtv-db","pod":"importer-test","outcome":"mutated","networks":[{"network":"mtv/transfer","removedGateways":["10.0.0.1"]}]}]`))
+	}))
+	defer server.Close()
+
+	decisions, err := New(server.URL+"/", "token", nil).Decisions(t.Context(), DecisionFilter{Namespace: "mtv-*", Since: "1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decisions) != 1 || decisions[0].Networks[0].RemovedGateways[0] != "10.0.0.1" {
+		t.Fatalf("unexpected decisions %+v", decisions)
+	}
+}
+
+func TestError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("expected a POST, got %s", r.Method)
+		}
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	_, err := New(server.URL, "viewer", nil).Reload(t.Context())
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden || apiErr.Message != "forbidden" {
+		t.Fatalf("expected a 403 error, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+// Package jsonpatch6902 builds RFC 6902 JSON Patch operations on the
+// metadata of Kubernetes objects.
+package jsonpatch6902
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+const (
+	OpAdd     = "add"
+	OpRemove  = "remove"
+	OpReplace = "replace"
+	OpTest    = "test"
+)
+
+const annotationsPath = "/metadata/annotations"
+
+// Operation is one JSON Patch operation. Value is omitted for remove.
+type Operation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+var (
+	escaper   = strings.NewReplacer("~", "~0", "/", "~1")
+	unescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+// Escape escapes a JSON Pointer reference token (RFC 6901 section 3), so keys
+// like k8s.v1.cni.cncf.io/networks can be used as one path segment.
+func Escape(token string) string {
+	return escaper.Replace(token)
+}
+
+// Unescape reverses Escape. "~01" unescapes to "~1", not "/".
+func Unescape(token string) string {
+	return unescaper.Replace(token)
+}
+
+// Pointer joins the escaped tokens to a JSON Pointer.
+func Pointer(tokens ...string) string {
+	var b strings.Builder
+	for _, token := range tokens {
+		b.WriteByte('/')
+		b.WriteString(Escape(token))
+	}
+	return b.String()
+}
+
+// AnnotationPath returns the JSON Pointer of the annotation key.
+func AnnotationPath(key string) string {
+	return annotationsPath + "/" + Escape(key)
+}
+
+// AddAnnotation sets the annotation key. Adding to a missing annotations map
+// fails, use AddAnnotations for objects without annotations.
+func AddAnnotation(key, value string) Operation {
+	return Operation{Op: OpAdd, Path: AnnotationPath(key), Value: value}
+}
+
+// AddAnnotations sets the whole annotations map.
+func AddAnnotations(annotations map[string]string) Operation {
+	return Operation{Op: OpAdd, Path: annotationsPath, Value: annotations}
+}
+
+// ReplaceAnnotation replaces the value of the existing annotation key.
+func ReplaceAnnotation(key, value string) Operation {
+	return Operation{Op: OpReplace, Path: AnnotationPath(key), Value: value}
+}
+
+// RemoveAnnotation removes the existing annotation key.
+func RemoveAnnotation(key string) Operation {
+	return Operation{Op: OpRemove, Path: AnnotationPath(key)}
+}
+
+// TestAnnotation makes the patch fail unless the annotation key has value.
+func TestAnnotation(key, value string) Operation {
+	return Operation{Op: OpTest, Path: AnnotationPath(key), Value: value}
+}
+
+// Marshal encodes ops as a JSON Patch document. An empty patch is "[]".
+func Marshal(ops []Operation) ([]byte, error) {
+	if ops == nil {
+		ops = []Operation{}
+	}
+	return json.Marshal(ops)
+}
@@ -0,0 +1,82 @@
+package jsonpatch6902
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEscape(t *testing.T) {
+	cases := []struct{ token, escaped string }{
+		{"", ""},
+		{"plain", "plain"},
+		{"k8s.v1.cni.cncf.io/networks", "k8s.v1.cni.cncf.io~1networks"},
+		{"a~b", "a~0b"},
+		{"a~b/c", "a~0b~1c"},
+		{"~1", "~01"},
+		{"/~", "~1~0"},
+		{"//", "~1~1"},
+		{"~~", "~0~0"},
+	}
+	for _, c := range cases {
+		if got := Escape(c.token); got != c.escaped {
+			t.Errorf("Escape(%q): expected %q, got %q", c.token, c.escaped, got)
+		}
+		if got := Unescape(c.escaped); got != c.token {
+			t.Errorf("Unescape(%q): expected %q, got %q", c.escaped, c.token, got)
+		}
+	}
+}
+
+func TestPointer(t *testing.T) {
+	if p := Pointer(); p != "" {
+		t.Errorf("expected the whole document pointer, got %q", p)
+	}
+	if p := Pointer("metadata", "labels", "app.kubernetes.io/name"); p != "/metadata/labels/app.kubernetes.io~1name" {
+		t.Errorf("unexpected pointer %q", p)
+	}
+	if p := Pointer("spec", ""); p != "/spec/" {
+		t.Errorf("expected an empty token to be kept, got %q", p)
+	}
+}
+
+func TestAnnotationOperations(t *testing.T) {
+	key := "k8s.v1.cni.cncf.io/networks"
+	cases := []struct {
+		op       Operation
+		expected string
+	}{
+		{AddAnnotation(key, "[]"), `{"op":"add","path":"/metadata/annotations/k8s.v1.cni.cncf.io~1networks","value":"[]"}`},
+		{ReplaceAnnotation(key, `[{"name":"transfer"}]`), `{"op":"replace","path":"/metadata/annotations/k8s.v1.cni.cncf.io~1networks","value":"[{\"name\":\"transfer\"}]"}`},
+		{RemoveAnnotation("a~b/c"), `{"op":"remove","path":"/metadata/annotations/a~0b~1c"}`},
+		{TestAnnotation(key, ""), `{"op":"test","path":"/metadata/annotations/k8s.v1.cni.cncf.io~1networks","value":""}`},
+		{AddAnnotation(key, ""), `{"op":"add","path":"/metadata/annotations/k8s.v1.cni.cncf.io~1networks","value":""}`},
+		{AddAnnotations(map[string]string{key: "[]"}), `{"op":"add","path":"/metadata/annotations","value":{"k8s.v1.cni.cncf.io/networks":"[]"}}`},
+	}
+	for _, c := range cases {
+		raw, err := json.Marshal(c.op)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(raw) != c.expected {
+			t.Errorf("expected %s, got %s", c.expected, raw)
+		}
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	raw, err := Marshal(nil)
+	if err != nil || string(raw) != "[]" {
+		t.Fatalf("expected an empty patch, got %s (%v)", raw, err)
+	}
+	raw, err = Marshal([]Operation{TestAnnotation("a", "1"), ReplaceAnnotation("a", "2")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ops []Operation
+	if err := json.Unmarshal(raw, &ops); err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 2 || ops[0].Op != OpTest || ops[1].Op != OpReplace || ops[1].Value != "2" {
+		t.Fatalf("unexpected round trip %+v", ops)
+	}
+}
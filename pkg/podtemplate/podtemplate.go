@@ -0,0 +1,144 @@
+// Package podtemplate locates the pod-level metadata embedded in Kubernetes
+// objects, so pods can be reviewed before their controller creates them and
+// patches for a pod can be applied to the object that embeds it.
+package podtemplate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"gateway-yeeter/pkg/jsonpatch6902"
+)
+
+// ErrUnsupportedKind is returned for objects that do not create pods.
+var ErrUnsupportedKind = errors.New("kind does not embed a pod template")
+
+var (
+	podMetadata         = []string{"metadata"}
+	templateMetadata    = []string{"spec", "template", "metadata"}
+	jobTemplateMetadata = []string{"spec", "jobTemplate", "spec", "template", "metadata"}
+)
+
+// paths are the JSON Pointer tokens of the pod metadata per kind. Pod
+// templates also carry the pod spec, VirtualMachines, VirtualMachineInstances
+// and DataVolumes pass only their annotations to the virt-launcher and
+// importer pods.
+var paths = map[string][]string{
+	"Pod":                    podMetadata,
+	"Deployment":             templateMetadata,
+	"ReplicaSet":             templateMetadata,
+	"StatefulSet":            templateMetadata,
+	"DaemonSet":              templateMetadata,
+	"Job":                    templateMetadata,
+	"ReplicationController":  templateMetadata,
+	"VirtualMachine":         templateMetadata,
+	"CronJob":                jobTemplateMetadata,
+	"VirtualMachineInstance": podMetadata,
+	"DataVolume":             podMetadata,
+}
+
+// controllerLabels are added by the controllers creating the pods of objects
+// that carry only metadata, so the pods are classified like the real ones.
+var controllerLabels = map[string]map[string]string{
+	"VirtualMachine":         {"kubevirt.io": "virt-launcher"},
+	"VirtualMachineInstance": {"kubevirt.io": "virt-launcher"},
+	"DataVolume":             {"app": "containerized-data-importer"},
+}
+
+// Supported reports whether kind embeds pod metadata.
+func Supported(kind string) bool {
+	_, exists := paths[kind]
+	return exists
+}
+
+// Template is the pod an object creates.
+type Template struct {
+	// Kind, Namespace and Name identify the object.
+	Kind      string
+	Namespace string
+	Name      string
+	// Path are the JSON Pointer tokens of the pod metadata in the object.
+	Path []string
+	// Pod has the metadata and, for pod templates, the spec of the pod.
+	// Pods created by controllers have a generated name.
+	Pod corev1.Pod
+}
+
+// Extract returns the template of raw, an object of kind in JSON.
+func Extract(kind string, raw []byte) (*Template, error) {
+	path, exists := paths[kind]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedKind, kind)
+	}
+	var object struct {
+		Metadata metav1.ObjectMeta `json:"metadata"`
+	}
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return nil, err
+	}
+	t := &Template{Kind: kind, Namespace: object.Metadata.Namespace, Name: object.Metadata.Name, Path: path}
+
+	if kind == "Pod" {
+		if err := json.Unmarshal(raw, &t.Pod); err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+
+	if len(path) == 1 {
+		t.Pod.ObjectMeta = metav1.ObjectMeta{Labels: object.Metadata.Labels, Annotations: object.Metadata.Annotations}
+	} else {
+		var fields map[string]json.RawMessage
+		value := json.RawMessage(raw)
+		for _, token := range path[:len(path)-1] {
+			if err := json.Unmarshal(value, &fields); err != nil {
+				return nil, err
+			}
+			if value = fields[token]; value == nil {
+				return nil, fmt.Errorf("%s %s has no pod template", kind, object.Metadata.Name)
+			}
+		}
+		var template corev1.PodTemplateSpec
+		if err := json.Unmarshal(value, &template); err != nil {
+			return nil, err
+		}
+		t.Pod = corev1.Pod{ObjectMeta: template.ObjectMeta, Spec: template.Spec}
+		if _, exists := controllerLabels[kind]; exists {
+			// The template is not a pod template, only its metadata applies.
+			t.Pod = corev1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: template.Labels, Annotations: template.Annotations}}
+		}
+	}
+	if labels := controllerLabels[kind]; labels != nil {
+		if t.Pod.Labels == nil {
+			t.Pod.Labels = make(map[string]string)
+		}
+		for key, value := range labels {
+			t.Pod.Labels[key] = value
+		}
+	}
+	// Pods of controllers get a generated name, like importer-7d9f4-x2k8p.
+	t.Pod.Name, t.Pod.GenerateName, t.Pod.Namespace = "", object.Metadata.Name+"-", object.Metadata.Namespace
+	return t, nil
+}
+
+// Rebase moves operations on the metadata of the pod to the metadata of
+// the template in the object. Other operations are returned unchanged.
+func (t *Template) Rebase(ops []jsonpatch6902.Operation) []jsonpatch6902.Operation {
+	prefix := jsonpatch6902.Pointer(t.Path...)
+	if prefix == "/metadata" {
+		return ops
+	}
+	rebased := make([]jsonpatch6902.Operation, len(ops))
+	for i, op := range ops {
+		if op.Path == "/metadata" || strings.HasPrefix(op.Path, "/metadata/") {
+			op.Path = prefix + strings.TrimPrefix(op.Path, "/metadata")
+		}
+		rebased[i] = op
+	}
+	return rebased
+}
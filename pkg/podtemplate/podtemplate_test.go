@@ -0,0 +1,104 @@
+package podtemplate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"gateway-yeeter/pkg/jsonpatch6902"
+)
+
+func TestExtractPod(t *testing.T) {
+	raw := `{"kind":"Pod","metadata":{"name":"importer","namespace":"openshift-mtv","annotations":{"k8s.v1.cni.cncf.io/networks":"[]"}},"spec":{"containers":[{"name":"importer"}]}}`
+	template, err := Extract("Pod", []byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if template.Pod.Name != "importer" || template.Pod.GenerateName != "" || template.Pod.Namespace != "openshift-mtv" {
+		t.Errorf("expected the pod to keep its name, got %+v", template.Pod.ObjectMeta)
+	}
+	if len(template.Pod.Spec.Containers) != 1 || template.Pod.Annotations["k8s.v1.cni.cncf.io/networks"] != "[]" {
+		t.Errorf("expected the whole pod, got %+v", template.Pod)
+	}
+}
+
+func TestExtractTemplates(t *testing.T) {
+	cases := []struct {
+		kind, raw, label string
+		containers       int
+	}{
+		{"Deployment", `{"metadata":{"name":"importer","namespace":"openshift-mtv"},"spec":{"template":{"metadata":{"labels":{"app":"importer"},"annotations":{"k8s.v1.cni.cncf.io/networks":"[]"}},"spec":{"containers":[{"name":"importer"}]}}}}`, "app=importer", 1},
+		{"CronJob", `{"metadata":{"name":"importer","namespace":"openshift-mtv"},"spec":{"jobTemplate":{"spec":{"template":{"metadata":{"annotations":{"k8s.v1.cni.cncf.io/networks":"[]"}},"spec":{"containers":[{"name":"importer"}]}}}}}}`, "", 1},
+		{"VirtualMachine", `{"metadata":{"name":"importer","namespace":"openshift-mtv"},"spec":{"template":{"metadata":{"annotations":{"k8s.v1.cni.cncf.io/networks":"[]"}},"spec":{"domain":{},"volumes":[{"name":"disk","dataVolume":{"name":"importer"}}]}}}}`, "kubevirt.io=virt-launcher", 0},
+		{"DataVolume", `{"metadata":{"name":"importer","namespace":"openshift-mtv","uid":"1234","annotations":{"k8s.v1.cni.cncf.io/networks":"[]"}},"spec":{"source":{"http":{}}}}`, "app=containerized-data-importer", 0},
+	}
+	for _, c := range cases {
+		template, err := Extract(c.kind, []byte(c.raw))
+		if err != nil {
+			t.Errorf("%s: %v", c.kind, err)
+			continue
+		}
+		pod := template.Pod
+		if pod.Name != "" || pod.GenerateName != "importer-" || pod.Namespace != "openshift-mtv" || pod.UID != "" {
+			t.Errorf("%s: expected a generated pod in the namespace of the object, got %+v", c.kind, pod.ObjectMeta)
+		}
+		if pod.Annotations["k8s.v1.cni.cncf.io/networks"] != "[]" {
+			t.Errorf("%s: expected the networks annotation, got %v", c.kind, pod.Annotations)
+		}
+		if len(pod.Spec.Containers) != c.containers {
+			t.Errorf("%s: expected %d containers, got %d", c.kind, c.containers, len(pod.Spec.Containers))
+		}
+		if c.label == "" {
+			if len(pod.Labels) != 0 {
+				t.Errorf("%s: expected no labels, got %v", c.kind, pod.Labels)
+			}
+		} else if key, value, _ := strings.Cut(c.label, "="); pod.Labels[key] != value {
+			t.Errorf("%s: expected label %s, got %v", c.kind, c.label, pod.Labels)
+		}
+	}
+}
+
+func TestExtractErrors(t *testing.T) {
+	if _, err := Extract("ConfigMap", []byte(`{}`)); !errors.Is(err, ErrUnsupportedKind) {
+		t.Errorf("expected ErrUnsupportedKind, got %v", err)
+	}
+	if _, err := Extract("Deployment", []byte(`{"metadata":{"name":"importer"},"spec":{}}`)); err == nil {
+		t.Error("expected an error for a Deployment without a template")
+	}
+	if _, err := Extract("Pod", []byte(`{"metadata":`)); err == nil {
+		t.Error("expected an error for malformed JSON")
+	}
+	if Supported("ConfigMap") || !Supported("StatefulSet") {
+		t.Error("unexpected Supported result")
+	}
+}
+
+func TestRebase(t *testing.T) {
+	ops := []jsonpatch6902.Operation{
+		jsonpatch6902.ReplaceAnnotation("k8s.v1.cni.cncf.io/networks", "[]"),
+		{Op: "add", Path: "/metadata", Value: map[string]string{}},
+		{Op: "replace", Path: "/metadataX"},
+		{Op: "replace", Path: "/spec/hostname", Value: "importer"},
+	}
+	cases := []struct {
+		kind     string
+		expected []string
+	}{
+		{"Pod", []string{"/metadata/annotations/k8s.v1.cni.cncf.io~1networks", "/metadata", "/metadataX", "/spec/hostname"}},
+		{"DataVolume", []string{"/metadata/annotations/k8s.v1.cni.cncf.io~1networks", "/metadata", "/metadataX", "/spec/hostname"}},
+		{"Deployment", []string{"/spec/template/metadata/annotations/k8s.v1.cni.cncf.io~1networks", "/spec/template/metadata", "/metadataX", "/spec/hostname"}},
+		{"CronJob", []string{"/spec/jobTemplate/spec/template/metadata/annotations/k8s.v1.cni.cncf.io~1networks", "/spec/jobTemplate/spec/template/metadata", "/metadataX", "/spec/hostname"}},
+	}
+	for _, c := range cases {
+		template := &Template{Kind: c.kind, Path: paths[c.kind]}
+		rebased := template.Rebase(ops)
+		for i, op := range rebased {
+			if op.Path != c.expected[i] {
+				t.Errorf("%s: expected path %s, got %s", c.kind, c.expected[i], op.Path)
+			}
+		}
+	}
+	if ops[0].Path != "/metadata/annotations/k8s.v1.cni.cncf.io~1networks" {
+		t.Errorf("expected the operations to be left unchanged, got %s", ops[0].Path)
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const (
+	planSummaryAnnotation = "gateway.yeet/summary"
+	forkliftPlanLabel     = "plan"
+	planOwnerDepth        = 3
+	planRequestTimeout    = 5 * time.Second
+)
+
+var planGVR = schema.GroupVersionResource{Group: "forklift.konveyor.io", Version: "v1beta1", Resource: "plans"}
+
+// ownerGVRs are the owners followed from a CDI importer pod to the objects
+// Forklift labels with the plan UID.
+var ownerGVRs = map[string]schema.GroupVersionResource{
+	"PersistentVolumeClaim": {Version: "v1", Resource: "persistentvolumeclaims"},
+	"DataVolume":            {Group: "cdi.kubevirt.io", Version: "v1beta1", Resource: "datavolumes"},
+}
+
+var planSummaryWrites = newCounterVec(prometheus.CounterOpts{
+	Name: "gateway_yeeter_plan_summary_writes_total",
+	Help: "Summary annotation updates of Forklift Plans, by result.",
+}, "result")
+
+// podOwner carries what is needed to attribute a decision to a Forklift
+// Plan after admission, without API calls on the admission path.
+type podOwner struct {
+	planUID   string
+	namespace string
+	refs      []metav1.OwnerReference
+}
+
+type planSummary struct {
+	Decisions       map[string]int `json:"decisions"`
+	GatewaysRemoved int            `json:"gatewaysRemoved"`
+	LastDecision    time.Time      `json:"lastDecision"`
+}
+
+func (s *planSummary) add(other *planSummary) {
+	if s.Decisions == nil {
+		s.Decisions = make(map[string]int)
+	}
+	for outcome, n := range other.Decisions {
+		s.Decisions[outcome] += n
+	}
+	s.GatewaysRemoved += other.GatewaysRemoved
+	if other.LastDecision.After(s.LastDecision) {
+		s.LastDecision = other.LastDecision
+	}
+}
+
+// planController aggregates decisions per Forklift Plan and periodically
+// adds them to the summary annotation of the Plan. Deltas are merged into
+// the existing annotation, so counts survive restarts and multiple replicas.
+type planController struct {
+	mu      sync.Mutex
+	pending []*decision
+	deltas  map[types.UID]*planSummary
+	plans   map[types.UID]types.NamespacedName
+}
+
+var planSummaries *planController
+
+func newPlanController() *planController {
+	return &planController{
+		deltas: make(map[types.UID]*planSummary),
+		plans:  make(map[types.UID]types.NamespacedName),
+	}
+}
+
+func (p *planController) record(d *decision) {
+	if p == nil || d.owner == nil {
+		return
+	}
+	p.mu.Lock()
+	p.pending = append(p.pending, d)
+	p.mu.Unlock()
+}
+
+func (p *planController) run(interval time.Duration) {
+	if p == nil {
+		return
+	}
+	for range time.Tick(interval) {
+		p.sync()
+	}
+}
+
+func (p *planController) sync() {
+	p.mu.Lock()
+	pending := p.pending
+	p.pending = nil
+	p.mu.Unlock()
+
+	for _, d := range pending {
+		planUID, err := resolvePlanUID(d.owner)
+		if err != nil {
+			klog.Warningf("Cannot resolve Forklift Plan of pod %s/%s (uid=%s): %v", d.Namespace, d.Pod, d.UID, err)
+			continue
+		}
+		if planUID == "" {
+			continue
+		}
+		removed := 0
+		for _, network := range d.Networks {
+			removed += len(network.RemovedGateways)
+		}
+		delta, exists := p.deltas[planUID]
+		if !exists {
+			delta = &planSummary{}
+			p.deltas[planUID] = delta
+		}
+		delta.add(&planSummary{Decisions: map[string]int{d.Outcome: 1}, GatewaysRemoved: removed, LastDecision: d.Time})
+	}
+
+	for planUID, delta := range p.deltas {
+		ctx, cancel := context.WithTimeout(context.Background(), planRequestTimeout)
+		err := retryKubeWrite(ctx, "plan-summary", func(ctx context.Context) error {
+			return p.write(ctx, planUID, delta)
+		})
+		cancel()
+		if err != nil {
+			planSummaryWrites.WithLabelValues("error").Inc()
+			klog.Warningf("Cannot update summary of Forklift Plan %s, retrying: %v", planUID, err)
+			continue
+		}
+		planSummaryWrites.WithLabelValues("success").Inc()
+		delete(p.deltas, planUID)
+	}
+}
+
+func (p *planController) write(ctx context.Context, planUID types.UID, delta *planSummary) error {
+	client, err := kube.dynamicFor(lookupPlan)
+	if err != nil {
+		return err
+	}
+
+	name, exists := p.plans[planUID]
+	if !exists {
+		list, err := client.Resource(planGVR).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+		for _, plan := range list.Items {
+			p.plans[plan.GetUID()] = types.NamespacedName{Namespace: plan.GetNamespace(), Name: plan.GetName()}
+		}
+		if name, exists = p.plans[planUID]; !exists {
+			klog.Warningf("Forklift Plan %s not found, discarding its summary", planUID)
+			return nil
+		}
+	}
+
+	plan, err := client.Resource(planGVR).Namespace(name.Namespace).Get(ctx, name.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		delete(p.plans, planUID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	summary := &planSummary{}
+	if existing := plan.GetAnnotations()[planSummaryAnnotation]; existing != "" {
+		if err := json.Unmarshal([]byte(existing), summary); err != nil {
+			klog.Warningf("Replacing malformed %s annotation on Forklift Plan %s: %v", planSummaryAnnotation, name, err)
+			summary = &planSummary{}
+		}
+	}
+	summary.add(delta)
+	value, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+
+	// The resourceVersion turns the merge patch into a compare-and-swap, so
+	// concurrent replicas cannot lose each other's counts.
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"resourceVersion": plan.GetResourceVersion(),
+			"annotations":     map[string]string{planSummaryAnnotation: string(value)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = client.Resource(planGVR).Namespace(name.Namespace).Patch(ctx, name.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// resolvePlanUID returns the plan UID label of the pod, or of the first
+// owner within planOwnerDepth that carries it.
+func resolvePlanUID(owner *podOwner) (types.UID, error) {
+	if owner.planUID != "" {
+		return types.UID(owner.planUID), nil
+	}
+	return resolveOwnerPlanUID(owner.namespace, owner.refs, planOwnerDepth)
+}
+
+func resolveOwnerPlanUID(namespace string, refs []metav1.OwnerReference, depth int) (types.UID, error) {
+	if depth == 0 {
+		return "", nil
+	}
+	for _, ref := range refs {
+		if ref.Kind == "Plan" {
+			return ref.UID, nil
+		}
+		gvr, exists := ownerGVRs[ref.Kind]
+		if !exists {
+			continue
+		}
+		client, err := kube.dynamicFor(lookupPlan)
+		if err != nil {
+			return "", err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), planRequestTimeout)
+		obj, err := client.Resource(gvr).Namespace(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		cancel()
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("%s %s/%s: %w", ref.Kind, namespace, ref.Name, err)
+		}
+		if planUID := obj.GetLabels()[forkliftPlanLabel]; planUID != "" {
+			return types.UID(planUID), nil
+		}
+		if planUID, err := resolveOwnerPlanUID(namespace, obj.GetOwnerReferences(), depth-1); err != nil || planUID != "" {
+			return planUID, err
+		}
+	}
+	return "", nil
+}
+
+const planScopeTTL = time.Minute
+
+// planScope resolves --scope-plans, which accepts Plan UIDs and
+// <namespace>/<name> references, to the set of Plan UIDs. Names are looked
+// up with one List call and cached, since Plans are renamed rarely.
+type planScope struct {
+	mu      sync.Mutex
+	uids    map[types.UID]bool
+	expires time.Time
+	now     func() time.Time
+}
+
+var scopedPlans = &planScope{now: time.Now}
+
+func (s *planScope) planUIDs(refs []string) (map[types.UID]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.uids != nil && s.now().Before(s.expires) {
+		return s.uids, nil
+	}
+	uids := make(map[types.UID]bool, len(refs))
+	names := map[types.NamespacedName]bool{}
+	for _, ref := range refs {
+		if namespace, name, found := strings.Cut(ref, "/"); found {
+			names[types.NamespacedName{Namespace: namespace, Name: name}] = true
+		} else {
+			uids[types.UID(ref)] = true
+		}
+	}
+	if len(names) > 0 {
+		client, err := kube.dynamicFor(lookupPlan)
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), planRequestTimeout)
+		defer cancel()
+		list, err := client.Resource(planGVR).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, plan := range list.Items {
+			if names[types.NamespacedName{Namespace: plan.GetNamespace(), Name: plan.GetName()}] {
+				uids[plan.GetUID()] = true
+			}
+		}
+	}
+	s.uids, s.expires = uids, s.now().Add(planScopeTTL)
+	return uids, nil
+}
+
+// allows reports whether the pod of owner belongs to one of the scoped
+// Plans, returning the Plan UID it was traced to.
+func (s *planScope) allows(refs []string, owner *podOwner) (bool, types.UID, error) {
+	uids, err := s.planUIDs(refs)
+	if err != nil {
+		return false, "", err
+	}
+	planUID, err := resolvePlanUID(owner)
+	if err != nil {
+		return false, "", err
+	}
+	return uids[planUID], planUID, nil
+}
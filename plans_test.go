@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func testObject(apiVersion, kind, namespace, name string, uid types.UID) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	obj.SetUID(uid)
+	return obj
+}
+
+func withFakePlanObjects(t *testing.T, objects map[schema.GroupVersionResource][]*unstructured.Unstructured) *dynamicfake.FakeDynamicClient {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		planGVR:                            "PlanList",
+		ownerGVRs["PersistentVolumeClaim"]: "PersistentVolumeClaimList",
+		ownerGVRs["DataVolume"]:            "DataVolumeList",
+	})
+	for gvr, list := range objects {
+		for _, obj := range list {
+			if err := client.Tracker().Create(gvr, obj, obj.GetNamespace()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	old := kube
+	kube = &kubeClients{dynamic: map[lookupCategory]dynamic.Interface{lookupPlan: client}}
+	t.Cleanup(func() { kube = old })
+	return client
+}
+
+func planSummaryOf(t *testing.T, client *dynamicfake.FakeDynamicClient) planSummary {
+	plan, err := client.Resource(planGVR).Namespace("openshift-mtv").Get(t.Context(), "migrate-db", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary planSummary
+	if err := json.Unmarshal([]byte(plan.GetAnnotations()[planSummaryAnnotation]), &summary); err != nil {
+		t.Fatalf("invalid summary annotation: %v", err)
+	}
+	return summary
+}
+
+func TestPlanControllerLabelledPod(t *testing.T) {
+	client := withFakePlanObjects(t, map[schema.GroupVersionResource][]*unstructured.Unstructured{
+		planGVR: {testObject("forklift.konveyor.io/v1beta1", "Plan", "openshift-mtv", "migrate-db", "plan-uid")},
+	})
+
+	p := newPlanController()
+	now := time.Now().UTC().Truncate(time.Second)
+	p.record(&decision{UID: "a", Outcome: outcomeMutated, Time: now, Networks: []networkChange{{RemovedGateways: []string{"10.0.0.1"}}}, owner: &podOwner{planUID: "plan-uid"}})
+	p.record(&decision{UID: "b", Outcome: outcomeUnchanged, Time: now, owner: &podOwner{planUID: "plan-uid"}})
+	p.record(&decision{UID: "c", Outcome: outcomeMutated, Time: now})
+	p.sync()
+
+	summary := planSummaryOf(t, client)
+	if summary.Decisions[outcomeMutated] != 1 || summary.Decisions[outcomeUnchanged] != 1 || summary.GatewaysRemoved != 1 || !summary.LastDecision.Equal(now) {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+
+	p.record(&decision{UID: "d", Outcome: outcomeMutated, Time: now, owner: &podOwner{planUID: "plan-uid"}})
+	p.sync()
+	if summary := planSummaryOf(t, client); summary.Decisions[outcomeMutated] != 2 {
+		t.Fatalf("expected counts to accumulate, got %+v", summary)
+	}
+}
+
+func TestPlanControllerOwnerChain(t *testing.T) {
+	dv := testObject("cdi.kubevirt.io/v1beta1", "DataVolume", "vms", "disk-0", "dv-uid")
+	dv.SetLabels(map[string]string{forkliftPlanLabel: "plan-uid"})
+	pvc := testObject("v1", "PersistentVolumeClaim", "vms", "disk-0", "pvc-uid")
+	pvc.SetOwnerReferences([]metav1.OwnerReference{{Kind: "DataVolume", Name: "disk-0", UID: "dv-uid"}})
+	client := withFakePlanObjects(t, map[schema.GroupVersionResource][]*unstructured.Unstructured{
+		planGVR:                            {testObject("forklift.konveyor.io/v1beta1", "Plan", "openshift-mtv", "migrate-db", "plan-uid")},
+		ownerGVRs["PersistentVolumeClaim"]: {pvc},
+		ownerGVRs["DataVolume"]:            {dv},
+	})
+
+	p := newPlanController()
+	p.record(&decision{UID: "a", Outcome: outcomeMutated, owner: &podOwner{
+		namespace: "vms",
+		refs:      []metav1.OwnerReference{{Kind: "PersistentVolumeClaim", Name: "disk-0", UID: "pvc-uid"}},
+	}})
+	p.sync()
+
+	if summary := planSummaryOf(t, client); summary.Decisions[outcomeMutated] != 1 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+}
+
+func TestPlanControllerRetriesWithoutClient(t *testing.T) {
+	old := kube
+	kube = &kubeClients{}
+	defer func() { kube = old }()
+
+	p := newPlanController()
+	p.record(&decision{UID: "a", Outcome: outcomeMutated, owner: &podOwner{planUID: "plan-uid"}})
+	p.sync()
+	if len(p.deltas) != 1 {
+		t.Fatalf("expected the delta to be kept for a retry, got %+v", p.deltas)
+	}
+}
+
+func TestPlanScope(t *testing.T) {
+	dv := testObject("cdi.kubevirt.io/v1beta1", "DataVolume", "vms", "disk-0", "dv-uid")
+	dv.SetLabels(map[string]string{forkliftPlanLabel: "plan-uid"})
+	withFakePlanObjects(t, map[schema.GroupVersionResource][]*unstructured.Unstructured{
+		planGVR:                 {testObject("forklift.konveyor.io/v1beta1", "Plan", "openshift-mtv", "migrate-db", "plan-uid")},
+		ownerGVRs["DataVolume"]: {dv},
+	})
+
+	for _, refs := range [][]string{{"plan-uid"}, {"openshift-mtv/migrate-db"}} {
+		s := &planScope{now: time.Now}
+		cases := []struct {
+			owner *podOwner
+			want  bool
+		}{
+			{&podOwner{planUID: "plan-uid"}, true},
+			{&podOwner{planUID: "other-plan"}, false},
+			{&podOwner{namespace: "vms", refs: []metav1.OwnerReference{{Kind: "DataVolume", Name: "disk-0"}}}, true},
+			{&podOwner{namespace: "vms"}, false},
+		}
+		for _, c := range cases {
+			allowed, _, err := s.allows(refs, c.owner)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if allowed != c.want {
+				t.Fatalf("%v: expected allowed=%v for %+v", refs, c.want, c.owner)
+			}
+		}
+	}
+}
+
+func TestReviewPodScopePlans(t *testing.T) {
+	withFakePlanObjects(t, nil)
+	old, oldScope := cfg, scopedPlans
+	cfg.ScopePlans = stringList{"plan-uid"}
+	scopedPlans = &planScope{now: time.Now}
+	defer func() { cfg, scopedPlans = old, oldScope }()
+
+	for label, want := range map[string]string{"plan-uid": outcomeMutated, "other-plan": outcomeSkipped} {
+		rawPod, _ := json.Marshal(corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:        "virt-v2v",
+			Namespace:   "vms",
+			Labels:      map[string]string{"forklift.app": "virt-v2v", forkliftPlanLabel: label},
+			Annotations: map[string]string{"k8s.v1.cni.cncf.io/networks": `[{"name":"transfer","default-route":["10.0.0.1"]}]`},
+		}})
+		ar := &admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{UID: "test", Namespace: "vms", Object: runtime.RawExtension{Raw: rawPod}}}
+		d := newDecision(ar)
+		evaluatePod(ar, d, nil)
+		if d.Outcome != want {
+			t.Fatalf("plan %s: expected %s, got %+v", label, want, d)
+		}
+	}
+}
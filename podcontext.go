@@ -0,0 +1,49 @@
+package main
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	podContextNodeSelector = "nodeSelector"
+	podContextImage        = "image"
+	podContextOwners       = "owners"
+)
+
+var podContextFields = []string{podContextNodeSelector, podContextImage, podContextOwners}
+
+// podContext describes the workload of a decision, so auditors need no
+// second lookup of a pod that may be long gone. Only the fields in
+// --pod-context are set.
+type podContext struct {
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	Image        string            `json:"image,omitempty"`
+	Owners       []string          `json:"owners,omitempty"`
+}
+
+// podContextFor returns the context of pod limited to fields, or nil
+// without fields. Owners are the owner references of the pod as
+// <kind>/<name>, the controller first.
+func podContextFor(pod *corev1.Pod, fields []string) *podContext {
+	if len(fields) == 0 {
+		return nil
+	}
+	c := &podContext{}
+	if contains(fields, podContextNodeSelector) {
+		c.NodeSelector = pod.Spec.NodeSelector
+	}
+	if contains(fields, podContextImage) && len(pod.Spec.Containers) > 0 {
+		c.Image = pod.Spec.Containers[0].Image
+	}
+	if contains(fields, podContextOwners) {
+		for _, ref := range pod.OwnerReferences {
+			owner := ref.Kind + "/" + ref.Name
+			if ref.Controller != nil && *ref.Controller {
+				c.Owners = append([]string{owner}, c.Owners...)
+			} else {
+				c.Owners = append(c.Owners, owner)
+			}
+		}
+	}
+	return c
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testContextPod() *corev1.Pod {
+	controller := true
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "ConfigMap", Name: "scratch"},
+				{Kind: "PersistentVolumeClaim", Name: "vm-disk-0", Controller: &controller},
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeSelector: map[string]string{"kubernetes.io/hostname": "worker-1"},
+			Containers:   []corev1.Container{{Image: "quay.io/kubevirt/cdi-importer:v1.58"}, {Image: "sidecar"}},
+		},
+	}
+}
+
+func TestPodContextFor(t *testing.T) {
+	if c := podContextFor(testContextPod(), nil); c != nil {
+		t.Fatalf("expected no context without fields, got %+v", c)
+	}
+	want := &podContext{
+		NodeSelector: map[string]string{"kubernetes.io/hostname": "worker-1"},
+		Image:        "quay.io/kubevirt/cdi-importer:v1.58",
+		Owners:       []string{"PersistentVolumeClaim/vm-disk-0", "ConfigMap/scratch"},
+	}
+	if got := podContextFor(testContextPod(), podContextFields); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+	if got := podContextFor(testContextPod(), []string{podContextImage}); !reflect.DeepEqual(got, &podContext{Image: want.Image}) {
+		t.Fatalf("expected only the image, got %+v", got)
+	}
+}
+
+func TestPodContextRedaction(t *testing.T) {
+	d := &decision{Pod: "importer", PodContext: podContextFor(testContextPod(), podContextFields)}
+	out := redactionPolicy{channelSinks: {fieldPod}}.decision(channelSinks, d)
+	if out.PodContext.Image != d.PodContext.Image || !strings.HasPrefix(out.PodContext.Owners[0], "PersistentVolumeClaim/redacted:") {
+		t.Fatalf("expected masked owner names, got %+v", out.PodContext)
+	}
+	if d.PodContext.Owners[0] != "PersistentVolumeClaim/vm-disk-0" {
+		t.Fatalf("expected the original decision to be unchanged, got %+v", d.PodContext)
+	}
+}
+
+func TestPodContextValidation(t *testing.T) {
+	c := defaultConfig()
+	c.PodContext = stringList{"image", "labels"}
+	if err := c.validate(); err == nil || !strings.Contains(err.Error(), "labels") {
+		t.Fatalf("expected an invalid field error, got %v", err)
+	}
+}
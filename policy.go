@@ -0,0 +1,210 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// targetPod is a kind of pod the webhook strips. The built-in targets match
+// on labels alone, targets of a GatewayYeetPolicy also on their namespaces
+// and only strip their networks.
+type targetPod struct {
+	name       string
+	labels     map[string]string
+	selector   labels.Selector
+	namespaces []string
+	networks   []string
+	origin     string
+}
+
+var targetPods = []targetPod{
+	{name: "virt-v2v", labels: map[string]string{"forklift.app": "virt-v2v"}},
+	{name: "cdi", labels: map[string]string{"app": "containerized-data-importer"}},
+}
+
+// targetView is a target pod as recorded in the audit log.
+type targetView struct {
+	PodType    string   `json:"podType"`
+	Origin     string   `json:"origin,omitempty"`
+	Selector   string   `json:"selector"`
+	Namespaces []string `json:"namespaces,omitempty"`
+	Networks   []string `json:"networks,omitempty"`
+}
+
+func viewTargets(targets []targetPod) []targetView {
+	views := make([]targetView, len(targets))
+	for i, t := range targets {
+		selector := labels.SelectorFromSet(t.labels)
+		if t.selector != nil {
+			selector = t.selector
+		}
+		views[i] = targetView{PodType: t.name, Origin: t.origin, Selector: selector.String(), Namespaces: t.namespaces, Networks: t.networks}
+	}
+	return views
+}
+
+// targetsHash identifies targets in ConfigChange records, empty without
+// targets.
+func targetsHash(targets []targetPod) string {
+	if len(targets) == 0 {
+		return ""
+	}
+	raw, _ := json.Marshal(viewTargets(targets))
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:6])
+}
+
+const networksAnnotationPath = `request.object.metadata.annotations."k8s.v1.cni.cncf.io/networks"`
+
+// renderKyvernoPolicy renders the stripping rules of c as a Kyverno
+// ClusterPolicy. Features Kyverno cannot express are returned as warnings.
+func renderKyvernoPolicy(c config) ([]byte, []string, error) {
+	var rules []interface{}
+	for _, target := range targetPods {
+		resources := map[string]interface{}{
+			"kinds":      []string{"Pod"},
+			"operations": []string{"CREATE"},
+			"selector":   map[string]interface{}{"matchLabels": target.labels},
+		}
+		if len(c.ScopeNamespaces) > 0 {
+			resources["namespaces"] = []string(c.ScopeNamespaces)
+		}
+		match := map[string]interface{}{"any": []interface{}{map[string]interface{}{"resources": resources}}}
+
+		rules = append(rules, map[string]interface{}{
+			"name":  "yeet-default-route-" + target.name,
+			"match": match,
+			"preconditions": map[string]interface{}{
+				"all": []interface{}{map[string]interface{}{
+					"key":      "{{ " + networksAnnotationPath + " || '' }}",
+					"operator": "NotEquals",
+					"value":    "",
+				}},
+			},
+			"mutate": map[string]interface{}{
+				"patchStrategicMerge": map[string]interface{}{
+					"metadata": map[string]interface{}{
+						"annotations": map[string]interface{}{
+							"k8s.v1.cni.cncf.io/networks": "{{ to_string(parse_json(" + networksAnnotationPath + ")[].merge(@, `{\"default-route\": null}`)) }}",
+						},
+					},
+				},
+			},
+		})
+
+		if c.OVNRoutingAnnotations == ovnRoutingStrip {
+			annotations := make(map[string]interface{}, len(ovnRoutingAnnotations))
+			for _, key := range ovnRoutingAnnotations {
+				annotations[key] = nil
+			}
+			rules = append(rules, map[string]interface{}{
+				"name":   "yeet-ovn-routing-annotations-" + target.name,
+				"match":  match,
+				"mutate": map[string]interface{}{"patchStrategicMerge": map[string]interface{}{"metadata": map[string]interface{}{"annotations": annotations}}},
+			})
+		}
+	}
+
+	if len(c.ExcludeNamespaces) > 0 {
+		exclude := map[string]interface{}{"any": []interface{}{map[string]interface{}{"resources": map[string]interface{}{"namespaces": []string(c.ExcludeNamespaces)}}}}
+		for _, rule := range rules {
+			rule.(map[string]interface{})["exclude"] = exclude
+		}
+	}
+
+	var warnings []string
+	if c.HandleOVNPodNetworks {
+		warnings = append(warnings, "handle-ovn-pod-networks is not exported, k8s.ovn.org/pod-networks is left untouched")
+	}
+	if c.OVNRoutingAnnotations == ovnRoutingWarn {
+		warnings = append(warnings, "ovn-routing-annotations=warn is not exported, Kyverno mutate policies cannot return admission warnings")
+	}
+	if c.CheckNamespaceRouting {
+		warnings = append(warnings, "check-namespace-routing is not exported")
+	}
+	if c.IgnoreNamespaceSelector != "" {
+		warnings = append(warnings, "ignore-namespace-selector is not exported, pods of labeled namespaces are stripped")
+	}
+	if c.SRIOVPolicy != sriovPolicyIgnore {
+		warnings = append(warnings, "sriov-policy is not exported, SR-IOV attachments are stripped like any other network")
+	}
+	if c.MaxAttachments > 0 || c.MaxNetworksAnnotationBytes > 0 {
+		warnings = append(warnings, "max-attachments and max-networks-annotation-bytes are not exported")
+	}
+	if c.HandleHotplug {
+		warnings = append(warnings, "handle-hotplug is not exported, the Kyverno policy only mutates pods on CREATE")
+	}
+	if len(c.ScopePlans) > 0 {
+		warnings = append(warnings, "scope-plans is not exported, pods of every Forklift Plan are stripped")
+	}
+	if c.Shadow {
+		warnings = append(warnings, "shadow is not exported, the Kyverno policy mutates pods")
+	}
+	if c.DryRun {
+		warnings = append(warnings, "dry-run is not exported, the Kyverno policy mutates pods")
+	}
+	if len(c.Rules) > 0 {
+		warnings = append(warnings, "rules-file is not exported, every target pod is stripped")
+	}
+	if c.StripIPAMRoutes {
+		warnings = append(warnings, "strip-ipam-routes is not exported, cni-args are left untouched")
+	}
+
+	policy := map[string]interface{}{
+		"apiVersion": "kyverno.io/v1",
+		"kind":       "ClusterPolicy",
+		"metadata": map[string]interface{}{
+			"name": "gateway-yeeter",
+			"annotations": map[string]string{
+				"policies.kyverno.io/title":       "Gateway Yeeter",
+				"policies.kyverno.io/description": "Removes default-route from the networks annotation of virt-v2v and CDI importer pods. Exported from gateway-yeeter configuration " + c.hash() + ".",
+			},
+		},
+		"spec": map[string]interface{}{
+			"background": false,
+			"rules":      rules,
+		},
+	}
+	out, err := yaml.Marshal(policy)
+	return out, warnings, err
+}
+
+func runExportPolicy(args []string) int {
+	fs := flag.NewFlagSet("export-policy", flag.ExitOnError)
+	format := fs.String("format", "kyverno", "Policy format to export: kyverno")
+	conf := defaultConfig()
+	conf.bindFlags(fs)
+	fs.Parse(args)
+
+	if err := conf.validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	var out []byte
+	var warnings []string
+	var err error
+	switch *format {
+	case "kyverno":
+		out, warnings, err = renderKyvernoPolicy(conf)
+	default:
+		fmt.Fprintf(os.Stderr, "unsupported format %q, expected kyverno\n", *format)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, warning := range warnings {
+		fmt.Fprintln(os.Stderr, "warning: "+warning)
+	}
+	os.Stdout.Write(out)
+	return 0
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestRenderKyvernoPolicy(t *testing.T) {
+	c := defaultConfig()
+	c.ScopeNamespaces = stringList{"mtv"}
+
+	out, warnings, err := renderKyvernoPolicy(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Fatalf("expected no warnings, got %v", warnings)
+	}
+
+	var policy struct {
+		Kind string `json:"kind"`
+		Spec struct {
+			Rules []struct {
+				Name  string `json:"name"`
+				Match struct {
+					Any []struct {
+						Resources struct {
+							Namespaces []string `json:"namespaces"`
+							Selector   struct {
+								MatchLabels map[string]string `json:"matchLabels"`
+							} `json:"selector"`
+						} `json:"resources"`
+					} `json:"any"`
+				} `json:"match"`
+			} `json:"rules"`
+		} `json:"spec"`
+	}
+	if err := yaml.Unmarshal(out, &policy); err != nil {
+		t.Fatal(err)
+	}
+	if policy.Kind != "ClusterPolicy" || len(policy.Spec.Rules) != 2 {
+		t.Fatalf("unexpected policy:\n%s", out)
+	}
+	resources := policy.Spec.Rules[1].Match.Any[0].Resources
+	if resources.Selector.MatchLabels["app"] != "containerized-data-importer" || len(resources.Namespaces) != 1 || resources.Namespaces[0] != "mtv" {
+		t.Fatalf("unexpected match %+v", resources)
+	}
+	var raw map[string]interface{}
+	yaml.Unmarshal(out, &raw)
+	rule := raw["spec"].(map[string]interface{})["rules"].([]interface{})[0].(map[string]interface{})
+	annotations := rule["mutate"].(map[string]interface{})["patchStrategicMerge"].(map[string]interface{})["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+	if expr, _ := annotations["k8s.v1.cni.cncf.io/networks"].(string); !strings.Contains(expr, "merge(@, `{\"default-route\": null}`)") {
+		t.Fatalf("expected a default-route merge expression, got %q", expr)
+	}
+}
+
+func TestRenderKyvernoPolicyOVNRouting(t *testing.T) {
+	c := defaultConfig()
+	c.OVNRoutingAnnotations = ovnRoutingStrip
+	c.HandleOVNPodNetworks = true
+
+	out, warnings, err := renderKyvernoPolicy(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "yeet-ovn-routing-annotations-cdi") || !strings.Contains(string(out), "k8s.ovn.org/routing-external-gws: null") {
+		t.Fatalf("expected OVN routing rules:\n%s", out)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "handle-ovn-pod-networks") {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+}
+
+func TestRenderKyvernoPolicyExcludedNamespaces(t *testing.T) {
+	out, _, err := renderKyvernoPolicy(defaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "exclude: any: - resources: namespaces: - kube-system - openshift-*"; strings.Count(strings.Join(strings.Fields(string(out)), " "), want) != len(targetPods) {
+		t.Fatalf("expected every rule to exclude the default namespaces:\n%s", out)
+	}
+
+	c := defaultConfig()
+	c.ExcludeNamespaces = nil
+	if out, _, _ := renderKyvernoPolicy(c); strings.Contains(string(out), "exclude") {
+		t.Fatalf("expected no exclude without exclude-namespaces:\n%s", out)
+	}
+}
+
+func TestRenderKyvernoPolicyHotplug(t *testing.T) {
+	c := defaultConfig()
+	c.HandleHotplug = true
+
+	out, warnings, err := renderKyvernoPolicy(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "UPDATE") {
+		t.Fatalf("expected the policy to stay limited to CREATE:\n%s", out)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "handle-hotplug") {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+}
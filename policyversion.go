@@ -0,0 +1,54 @@
+package main
+
+import (
+	"sync"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/klog/v2"
+)
+
+// activeConfigHash is the hash of the configuration applied last. It is
+// stamped on every decision, so it is computed once per change.
+var activeConfigHash string
+
+// webhookGeneration remembers the metadata.generation of the
+// MutatingWebhookConfiguration calling this webhook, as last listed by
+// --check-webhook-conflicts or --require-webhook-registration.
+type webhookGeneration struct {
+	mu         sync.Mutex
+	name       string
+	generation int64
+}
+
+var ownWebhook = &webhookGeneration{}
+
+func (g *webhookGeneration) observe(configurations []admissionregistrationv1.MutatingWebhookConfiguration) {
+	name := ownWebhookConfiguration(configurations)
+	var generation int64
+	for _, configuration := range configurations {
+		if configuration.Name == name {
+			generation = configuration.Generation
+		}
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if name != "" && (name != g.name || generation != g.generation) {
+		klog.Infof("MutatingWebhookConfiguration %s is at generation %d", name, generation)
+	}
+	g.name, g.generation = name, generation
+}
+
+func (g *webhookGeneration) current() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.generation
+}
+
+// stampPolicyVersion records the configuration, rules and webhook
+// configuration in effect on d, so auditors can tell which version of the
+// policy decided about a pod after it changed mid-migration.
+func stampPolicyVersion(d *decision) {
+	d.ConfigHash = activeConfigHash
+	d.RulesHash = ruleSources.hash()
+	d.WebhookGeneration = ownWebhook.current()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestWebhookGeneration(t *testing.T) {
+	oldIdentity := identity
+	identity = instanceIdentity{Namespace: "openshift-mtv", Pod: "gateway-yeeter-0", Service: "gateway-yeeter"}
+	defer func() { identity = oldIdentity }()
+
+	own := testMutatingWebhook("cdi.gateway.yeet", []string{"pods"}, admissionregistrationv1.Create, nil)
+	own.ClientConfig.Service = &admissionregistrationv1.ServiceReference{Namespace: "openshift-mtv", Name: "gateway-yeeter"}
+	configurations := []admissionregistrationv1.MutatingWebhookConfiguration{
+		{ObjectMeta: metav1.ObjectMeta{Name: "sidecar-injector", Generation: 7}, Webhooks: []admissionregistrationv1.MutatingWebhook{
+			testMutatingWebhook("inject.sidecar.io", []string{"pods"}, admissionregistrationv1.Create, nil),
+		}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "gateway-yeeter", Generation: 3}, Webhooks: []admissionregistrationv1.MutatingWebhook{own}},
+	}
+
+	g := &webhookGeneration{}
+	g.observe(configurations)
+	if got := g.current(); got != 3 {
+		t.Fatalf("expected generation 3, got %d", got)
+	}
+	g.observe(configurations[:1])
+	if got := g.current(); got != 0 {
+		t.Fatalf("expected no generation without own configuration, got %d", got)
+	}
+}
+
+func TestStampPolicyVersion(t *testing.T) {
+	oldHash, oldWebhook := activeConfigHash, ownWebhook
+	activeConfigHash, ownWebhook = cfg.hash(), &webhookGeneration{name: "gateway-yeeter", generation: 4}
+	defer func() { activeConfigHash, ownWebhook = oldHash, oldWebhook }()
+
+	d := newDecision(testImporterReview("mtv", `[{"name":"transfer"}]`))
+	stampPolicyVersion(d)
+	if d.ConfigHash != cfg.hash() || d.RulesHash != "" || d.WebhookGeneration != 4 {
+		t.Fatalf("expected the policy version on the decision, got %q %q %d", d.ConfigHash, d.RulesHash, d.WebhookGeneration)
+	}
+
+	event := decisionAuditEvent(d)
+	if event.Annotations[auditAnnotationPrefix+"config-hash"] != d.ConfigHash || event.Annotations[auditAnnotationPrefix+"webhook-generation"] != "4" {
+		t.Fatalf("expected policy version annotations, got %v", event.Annotations)
+	}
+	if _, exists := event.Annotations[auditAnnotationPrefix+"rules-hash"]; exists {
+		t.Fatalf("expected no rules hash without rule sources, got %v", event.Annotations)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const (
+	selfProbeHeader    = "X-Gateway-Yeeter-Probe"
+	selfProbeNamespace = "gateway-yeeter-self-probe"
+	selfProbeTimeout   = 5 * time.Second
+)
+
+var (
+	selfProbes = newCounterVec(prometheus.CounterOpts{
+		Name: "gateway_yeeter_self_probes_total",
+		Help: "Synthetic admission reviews sent to the local /mutate endpoint, by result (success, failure).",
+	}, "result")
+	selfProbeDuration = newHistogram(prometheus.HistogramOpts{
+		Name:    "gateway_yeeter_self_probe_duration_seconds",
+		Help:    "Round trip time of synthetic admission reviews through the local HTTPS stack.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	})
+	selfProbeLastSuccess = newGauge(prometheus.GaugeOpts{
+		Name: "gateway_yeeter_self_probe_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful synthetic admission review.",
+	})
+)
+
+// selfProber periodically sends a canned AdmissionReview to /mutate over
+// loopback, so a broken certificate, listener or handler is noticed even
+// while no pods are created. Probes carry a per-process token and are
+// evaluated without being recorded as decisions.
+type selfProber struct {
+	url    string
+	token  string
+	host   string
+	client *http.Client
+	now    func() time.Time
+}
+
+var selfProbe *selfProber
+
+func newSelfProber(c config) (*selfProber, error) {
+	host, port, err := net.SplitHostPort(c.ListenAddress)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listen address %q: %w", c.ListenAddress, err)
+	}
+	if host == "" || net.ParseIP(host).IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	p := &selfProber{
+		url:   "https://" + net.JoinHostPort(host, port) + "/mutate",
+		token: hex.EncodeToString(token),
+		host:  serviceDNSName(),
+		now:   time.Now,
+	}
+	// The serving certificate is issued for the Service, so it is checked
+	// for that name and its validity instead of a CA the webhook cannot see.
+	p.client = &http.Client{Timeout: selfProbeTimeout, Transport: &http.Transport{
+		DisableKeepAlives: true,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+			VerifyConnection:   p.verifyCertificate,
+		},
+	}}
+	return p, nil
+}
+
+func (p *selfProber) verifyCertificate(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("no serving certificate presented")
+	}
+	leaf := cs.PeerCertificates[0]
+	if now := p.now(); now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+		return fmt.Errorf("serving certificate is valid from %s to %s", leaf.NotBefore.UTC().Format(time.RFC3339), leaf.NotAfter.UTC().Format(time.RFC3339))
+	}
+	return leaf.VerifyHostname(p.host)
+}
+
+// matches reports whether r is a probe of this process.
+func (p *selfProber) matches(r *http.Request) bool {
+	if p == nil {
+		return false
+	}
+	token := r.Header.Get(selfProbeHeader)
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(p.token)) == 1
+}
+
+func (p *selfProber) run(interval time.Duration) {
+	if p == nil {
+		return
+	}
+	for range time.Tick(interval) {
+		p.probe()
+	}
+}
+
+func (p *selfProber) probe() {
+	start := time.Now()
+	err := p.send()
+	selfProbeDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		selfProbes.WithLabelValues("failure").Inc()
+		klog.Errorf("Self-probe of %s failed: %v", p.url, err)
+		return
+	}
+	selfProbes.WithLabelValues("success").Inc()
+	selfProbeLastSuccess.Set(float64(p.now().Unix()))
+	klog.V(2).Infof("Self-probe of %s succeeded in %s", p.url, time.Since(start))
+}
+
+func (p *selfProber) send() error {
+	review := selfProbeReview()
+	body, err := json.Marshal(review)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(selfProbeHeader, p.token)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("/mutate responded with %s", resp.Status)
+	}
+	var answer admissionv1.AdmissionReview
+	if err := json.Unmarshal(respBody, &answer); err != nil {
+		return fmt.Errorf("malformed response: %w", err)
+	}
+	if answer.Response == nil || answer.Response.UID != review.Request.UID {
+		return fmt.Errorf("response does not answer request %s", review.Request.UID)
+	}
+	// Rules may deny the probe pod, only errors of the review fail the probe.
+	if result := answer.Response.Result; !answer.Response.Allowed && result != nil && strings.HasPrefix(string(result.Reason), "ERR_") {
+		return fmt.Errorf("review failed with %s: %s", result.Reason, result.Message)
+	}
+	return nil
+}
+
+// selfProbeReview returns the canned review: a CDI importer pod requesting a
+// default route, in the first scoped namespace so it is not misdirected.
+func selfProbeReview() *admissionv1.AdmissionReview {
+	namespace := selfProbeNamespace
+	if len(cfg.ScopeNamespaces) > 0 {
+		namespace = cfg.ScopeNamespaces[0]
+	}
+	pod := corev1.Pod{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "gateway-yeeter-self-probe",
+			Namespace:   namespace,
+			Labels:      map[string]string{"app": "containerized-data-importer"},
+			Annotations: map[string]string{"k8s.v1.cni.cncf.io/networks": `[{"name":"transfer","namespace":"` + namespace + `","default-route":["192.0.2.1"]}]`},
+		},
+	}
+	raw, _ := json.Marshal(pod)
+	uid := make([]byte, 8)
+	rand.Read(uid)
+	return &admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request: &admissionv1.AdmissionRequest{
+			UID:       types.UID("self-probe-" + hex.EncodeToString(uid)),
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Resource:  metav1.GroupVersionResource{Version: "v1", Resource: "pods"},
+			Namespace: namespace,
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newTestSelfProber(t *testing.T, handler http.Handler) (*selfProber, func()) {
+	srv := httptest.NewTLSServer(handler)
+	c := defaultConfig()
+	c.ListenAddress = srv.Listener.Addr().String()
+	p, err := newSelfProber(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The test server's certificate is issued for example.com.
+	p.host = "example.com"
+	return p, srv.Close
+}
+
+func TestSelfProbe(t *testing.T) {
+	old, oldProbe := cfg, selfProbe
+	defer func() { cfg, selfProbe = old, oldProbe }()
+
+	p, stop := newTestSelfProber(t, http.HandlerFunc(handleMutate))
+	defer stop()
+	selfProbe = p
+
+	reviews := testutil.ToFloat64(admissionReviews.WithLabelValues("cdi", outcomeMutated, reasonMutated))
+	successes := testutil.ToFloat64(selfProbes.WithLabelValues("success"))
+	p.probe()
+	if got := testutil.ToFloat64(selfProbes.WithLabelValues("success")); got != successes+1 {
+		t.Fatalf("expected a successful probe, got %v successes", got-successes)
+	}
+	if got := testutil.ToFloat64(admissionReviews.WithLabelValues("cdi", outcomeMutated, reasonMutated)); got != reviews {
+		t.Fatal("expected the probe not to be recorded as a decision")
+	}
+
+	// Rules denying the probe pod do not fail the probe.
+	cfg.Rules = ruleSet{{Name: "platform", Namespaces: []string{selfProbeNamespace}, Action: actionDeny}}
+	if err := p.send(); err != nil {
+		t.Fatalf("expected a denied probe to succeed, got %v", err)
+	}
+}
+
+func TestSelfProbeFailures(t *testing.T) {
+	old, oldProbe := cfg, selfProbe
+	defer func() { cfg, selfProbe = old, oldProbe }()
+
+	p, stop := newTestSelfProber(t, http.HandlerFunc(handleMutate))
+	defer stop()
+
+	// Without the token of this process the probe is a regular review.
+	selfProbe = &selfProber{token: "other"}
+	if p.matches(httptest.NewRequest(http.MethodPost, "/mutate", nil)) {
+		t.Fatal("expected a request without token not to match")
+	}
+
+	selfProbe = p
+	p.host = "gateway-yeeter.openshift-mtv.svc"
+	if err := p.send(); err == nil {
+		t.Fatal("expected a certificate for another name to fail the probe")
+	}
+	p.host = "example.com"
+	p.now = func() time.Time { return time.Now().AddDate(100, 0, 0) }
+	if err := p.send(); err == nil {
+		t.Fatal("expected an expired certificate to fail the probe")
+	}
+
+	broken, stop := newTestSelfProber(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "injected fault", http.StatusInternalServerError)
+	}))
+	defer stop()
+	failures := testutil.ToFloat64(selfProbes.WithLabelValues("failure"))
+	broken.probe()
+	if got := testutil.ToFloat64(selfProbes.WithLabelValues("failure")); got != failures+1 {
+		t.Fatal("expected a failed probe")
+	}
+}
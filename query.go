@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultQueryLimit = 100
+	maxQueryLimit     = 1000
+)
+
+type decisionPage struct {
+	Items    []*decision `json:"items"`
+	Continue string      `json:"continue,omitempty"`
+}
+
+// queryAuditLog returns decisions of the audit log at path matching f,
+// oldest first, starting at line start. continueAt is the line to resume
+// from, or 0 once the end of the log has been reached.
+func queryAuditLog(path string, c *recordCipher, f decisionFilter, start, limit int) (items []*decision, continueAt int, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	items = []*decision{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if line < start || len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		if len(items) == limit {
+			return items, line, nil
+		}
+
+		record := scanner.Bytes()
+		var entry chainedEntry
+		if err := json.Unmarshal(record, &entry); err == nil && entry.Hash != "" {
+			record = entry.Record
+		}
+		if c != nil {
+			if record, err = c.open(record); err != nil {
+				return nil, 0, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		// The last line may still be written to or be truncated.
+		var d decision
+		if err := json.Unmarshal(record, &d); err != nil {
+			klog.V(2).Infof("Skipping unreadable audit log line %d: %v", line, err)
+			continue
+		}
+		if d.Kind != "Decision" {
+			continue
+		}
+		if redacted := cfg.Redaction.decision(channelAdmin, &d); f.matches(redacted) {
+			items = append(items, redacted)
+		}
+	}
+	return items, 0, scanner.Err()
+}
+
+func handleDecisionQuery(w http.ResponseWriter, r *http.Request) {
+	a := auditor
+	if a == nil || a.path == "" {
+		http.Error(w, "no persistent decision store, configure --audit-log with a file", http.StatusNotFound)
+		return
+	}
+	if a.format != auditFormatNative {
+		http.Error(w, "queries require --audit-format=native", http.StatusNotImplemented)
+		return
+	}
+
+	q := r.URL.Query()
+	f, err := parseDecisionFilter(q, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, start := defaultQueryLimit, 1
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxQueryLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxQueryLimit), http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("continue"); v != "" {
+		if start, err = strconv.Atoi(v); err != nil || start < 1 {
+			http.Error(w, "invalid continue token", http.StatusBadRequest)
+			return
+		}
+	}
+
+	items, continueAt, err := queryAuditLog(a.path, a.cipher, f, start, limit)
+	if err != nil {
+		klog.Errorf("Could not query audit log %s: %v", a.path, err)
+		http.Error(w, "could not read the audit log", http.StatusInternalServerError)
+		return
+	}
+	page := decisionPage{Items: items}
+	if continueAt > 0 {
+		page.Continue = strconv.Itoa(continueAt)
+	}
+	writeJSON(w, page)
+}
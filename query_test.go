@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDecisionQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	a, err := openAuditLog(path, auditFormatNative, true, "", newTestRecordCipher(t, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldAuditor, oldCfg := auditor, cfg
+	auditor = a
+	defer func() { auditor, cfg = oldAuditor, oldCfg }()
+
+	start := time.Date(2025, 11, 20, 9, 0, 0, 0, time.UTC)
+	for i, ns := range []string{"mtv", "other", "mtv", "mtv"} {
+		a.write(&decision{Kind: "Decision", UID: string(rune('a' + i)), Time: start.Add(time.Duration(i) * time.Minute), Namespace: ns, Outcome: outcomeMutated,
+			Networks: []networkChange{{Network: "transfer", RemovedGateways: []string{"10.0.0.1"}}}})
+	}
+	a.write(maintenanceRecord{Kind: "MaintenanceChange", Time: start})
+
+	query := func(q string) (int, decisionPage) {
+		w := httptest.NewRecorder()
+		handleDecisionQuery(w, httptest.NewRequest("GET", "/decisions/query?"+q, nil))
+		var page decisionPage
+		json.Unmarshal(w.Body.Bytes(), &page)
+		return w.Code, page
+	}
+
+	code, page := query("namespace=mtv&gateway=10.0.0.1&limit=2")
+	if code != http.StatusOK || len(page.Items) != 2 || page.Items[0].UID != "a" || page.Items[1].UID != "c" || page.Continue == "" {
+		t.Fatalf("unexpected first page %d: %+v", code, page)
+	}
+	code, page = query("namespace=mtv&gateway=10.0.0.1&limit=2&continue=" + page.Continue)
+	if code != http.StatusOK || len(page.Items) != 1 || page.Items[0].UID != "d" || page.Continue != "" {
+		t.Fatalf("unexpected second page %d: %+v", code, page)
+	}
+	if _, page = query("gateway=10.0.0.2"); len(page.Items) != 0 {
+		t.Fatalf("expected no decisions for another gateway, got %+v", page)
+	}
+	if _, page = query("until=2025-11-20T09:00:30Z"); len(page.Items) != 1 {
+		t.Fatalf("expected the time range to apply, got %+v", page)
+	}
+
+	withRedactionKey(t)
+	cfg.Redaction = redactionPolicy{channelAudit: {fieldNamespace}, channelAdmin: {fieldNamespace}}
+	redacted := cfg.Redaction.value(channelAdmin, fieldNamespace, "mtv")
+	a.write(cfg.Redaction.decision(channelAudit, &decision{Kind: "Decision", UID: "e", Namespace: "mtv"}))
+	if _, page = query("namespace=" + redacted); len(page.Items) != 4 || page.Items[3].UID != "e" {
+		t.Fatalf("expected audit and admin redaction to agree, got %+v", page)
+	}
+
+	for _, q := range []string{"limit=0", "limit=5000", "continue=x", "since=never"} {
+		if code, _ := query(q); code != http.StatusBadRequest {
+			t.Errorf("%q: expected bad request, got %d", q, code)
+		}
+	}
+
+	auditor = nil
+	if code, _ := query(""); code != http.StatusNotFound {
+		t.Fatalf("expected queries without an audit log to fail, got %d", code)
+	}
+}
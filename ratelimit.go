@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+const rateLimiterIdleTimeout = 10 * time.Minute
+
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+type sourceRateLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+var rateLimiter *sourceRateLimiter
+
+func newSourceRateLimiter(rate float64, burst int) *sourceRateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &sourceRateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+func (l *sourceRateLimiter) allow(source string) bool {
+	if l == nil {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) > rateLimiterIdleTimeout {
+		for key, b := range l.buckets {
+			if now.Sub(b.lastSeen) > rateLimiterIdleTimeout {
+				delete(l.buckets, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, exists := l.buckets[source]
+	if !exists {
+		b = &tokenBucket{tokens: l.burst, lastSeen: now}
+		l.buckets[source] = b
+	}
+
+	b.tokens += now.Sub(b.lastSeen).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.lastSeen = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// admissionSource is the client a review is rate limited as: the user
+// creating the pod, or its namespace for anonymous requests. Every review
+// arrives from the API server, so the connection cannot tell tenants apart.
+func admissionSource(req *admissionv1.AdmissionRequest) string {
+	if req.UserInfo.Username != "" {
+		return "user:" + req.UserInfo.Username
+	}
+	return "namespace:" + req.Namespace
+}
+
+func requestSource(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return "cn:" + r.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "ip:" + r.RemoteAddr
+	}
+	return "ip:" + host
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestSourceRateLimiterBurstAndRefill(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := newSourceRateLimiter(1, 2)
+	limiter.now = func() time.Time { return now }
+
+	if !limiter.allow("a") || !limiter.allow("a") {
+		t.Fatal("expected burst of 2 to be allowed")
+	}
+	if limiter.allow("a") {
+		t.Fatal("expected third request to be limited")
+	}
+	if !limiter.allow("b") {
+		t.Fatal("expected other source to have its own bucket")
+	}
+
+	now = now.Add(time.Second)
+	if !limiter.allow("a") {
+		t.Fatal("expected token to be refilled after one second")
+	}
+}
+
+func TestSourceRateLimiterDisabled(t *testing.T) {
+	limiter := newSourceRateLimiter(0, 10)
+	for i := 0; i < 100; i++ {
+		if !limiter.allow("a") {
+			t.Fatal("expected disabled limiter to allow everything")
+		}
+	}
+}
+
+func TestHandleMutateRateLimitedFailsOpen(t *testing.T) {
+	rateLimiter = newSourceRateLimiter(1, 1)
+	defer func() { rateLimiter = nil }()
+
+	rawPod, _ := json.Marshal(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "random-pod", Namespace: "test"},
+	})
+	admissionReview := admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{
+			UID:    "test-ratelimit",
+			Kind:   metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "Pod"},
+			Object: runtime.RawExtension{Raw: rawPod},
+		},
+	}
+	body, _ := json.Marshal(admissionReview)
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("POST", "/mutate", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		handleMutate(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+
+		var response admissionv1.AdmissionReview
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+		if i == 1 {
+			if !response.Response.Allowed {
+				t.Fatal("expected rate limited request to be allowed")
+			}
+			if len(response.Response.Warnings) == 0 {
+				t.Fatal("expected rate limited request to carry a warning")
+			}
+			if response.Response.UID != "test-ratelimit" {
+				t.Fatal("expected response UID to match request")
+			}
+		}
+	}
+}
+
+func TestHandleMutateRateLimitedPerUser(t *testing.T) {
+	old := cfg
+	rateLimiter = newSourceRateLimiter(1, 1)
+	defer func() { cfg, rateLimiter = old, nil }()
+	cfg.FailurePolicy = failurePolicyFail
+
+	rawPod, _ := json.Marshal(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "random-pod", Namespace: "test"},
+	})
+	review := func(user string) *admissionv1.AdmissionResponse {
+		body, _ := json.Marshal(admissionv1.AdmissionReview{
+			Request: &admissionv1.AdmissionRequest{
+				UID:       "test-ratelimit",
+				Kind:      metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "Pod"},
+				Namespace: "test",
+				UserInfo:  authenticationv1.UserInfo{Username: user},
+				Object:    runtime.RawExtension{Raw: rawPod},
+			},
+		})
+		w := httptest.NewRecorder()
+		handleMutate(w, httptest.NewRequest("POST", "/mutate", bytes.NewReader(body)))
+		var response admissionv1.AdmissionReview
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		return response.Response
+	}
+
+	review("system:serviceaccount:cdi:cdi-sa")
+	if resp := review("system:serviceaccount:cdi:cdi-sa"); !resp.Allowed || len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], reasonWarnRateLimited) {
+		t.Fatalf("expected the rate limited request to be admitted with a warning, got %+v", resp)
+	}
+	if resp := review("system:serviceaccount:team-a:migrator"); !resp.Allowed || len(resp.Warnings) != 0 {
+		t.Fatalf("expected another user to have its own budget, got %+v", resp)
+	}
+}
+
+func TestAdmissionSource(t *testing.T) {
+	if got := admissionSource(&admissionv1.AdmissionRequest{Namespace: "mtv", UserInfo: authenticationv1.UserInfo{Username: "alice"}}); got != "user:alice" {
+		t.Errorf("expected the user, got %s", got)
+	}
+	if got := admissionSource(&admissionv1.AdmissionRequest{Namespace: "mtv"}); got != "namespace:mtv" {
+		t.Errorf("expected the namespace, got %s", got)
+	}
+}
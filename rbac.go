@@ -0,0 +1,199 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+type rbacRule struct {
+	APIGroups     []string `json:"apiGroups"`
+	Resources     []string `json:"resources"`
+	Verbs         []string `json:"verbs"`
+	ResourceNames []string `json:"resourceNames,omitempty"`
+}
+
+// rbacGrant are the rules one lookup category needs. Namespaced grants are
+// bound in the scoped namespaces only.
+type rbacGrant struct {
+	category   lookupCategory
+	rules      []rbacRule
+	namespaced bool
+}
+
+// rbacGrants returns the API access the features enabled in c use, so the
+// rendered manifests never grant more than the webhook calls.
+func rbacGrants(c config) []rbacGrant {
+	var grants []rbacGrant
+	if c.SRIOVPolicy != sriovPolicyIgnore {
+		// NADs can be referenced across namespaces, so this is never scoped.
+		grants = append(grants, rbacGrant{category: lookupNAD, rules: []rbacRule{
+			{APIGroups: []string{nadGVR.Group}, Resources: []string{nadGVR.Resource}, Verbs: []string{"get"}},
+		}})
+	}
+	if c.CheckNamespaceRouting || c.IgnoreNamespaceSelector != "" {
+		var namespaceVerbs []string
+		if c.CheckNamespaceRouting {
+			namespaceVerbs = append(namespaceVerbs, "get")
+		}
+		if c.IgnoreNamespaceSelector != "" {
+			namespaceVerbs = append(namespaceVerbs, "list", "watch")
+		}
+		grants = append(grants, rbacGrant{category: lookupNamespace, rules: []rbacRule{
+			{APIGroups: []string{""}, Resources: []string{"namespaces"}, Verbs: namespaceVerbs},
+		}})
+	}
+	if c.PlanSummaries || len(c.ScopePlans) > 0 {
+		planVerbs := []string{"get", "list"}
+		if c.PlanSummaries {
+			planVerbs = append(planVerbs, "patch")
+		}
+		grants = append(grants, rbacGrant{category: lookupPlan, rules: []rbacRule{
+			{APIGroups: []string{planGVR.Group}, Resources: []string{planGVR.Resource}, Verbs: planVerbs},
+			{APIGroups: []string{""}, Resources: []string{ownerGVRs["PersistentVolumeClaim"].Resource}, Verbs: []string{"get"}},
+			{APIGroups: []string{ownerGVRs["DataVolume"].Group}, Resources: []string{ownerGVRs["DataVolume"].Resource}, Verbs: []string{"get"}},
+		}})
+	}
+	if c.VerifyNetworkStatus {
+		grants = append(grants, rbacGrant{category: lookupPod, namespaced: len(c.ScopeNamespaces) > 0, rules: []rbacRule{
+			{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"list"}},
+		}})
+	}
+	if c.Events {
+		grants = append(grants, rbacGrant{category: lookupEvent, namespaced: len(c.ScopeNamespaces) > 0, rules: []rbacRule{
+			{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"list"}},
+			{APIGroups: []string{""}, Resources: []string{"events"}, Verbs: []string{"create", "patch", "update"}},
+		}})
+	}
+	if c.CheckWebhookConflicts || c.RequireWebhookRegistration {
+		grants = append(grants, rbacGrant{category: lookupWebhook, rules: []rbacRule{
+			{APIGroups: []string{"admissionregistration.k8s.io"}, Resources: []string{"mutatingwebhookconfigurations"}, Verbs: []string{"list"}},
+		}})
+	}
+	if len(c.RulesConfigMaps) > 0 || c.RulesPolicies || c.TargetPolicies {
+		var rules []rbacRule
+		if len(c.RulesConfigMaps) > 0 {
+			var names []string
+			for _, ref := range c.RulesConfigMaps {
+				_, name, _ := strings.Cut(ref, "/")
+				if !contains(names, name) {
+					names = append(names, name)
+				}
+			}
+			rules = append(rules, rbacRule{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get"}, ResourceNames: names})
+		}
+		if c.RulesPolicies {
+			rules = append(rules, rbacRule{APIGroups: []string{ruleSetGVR.Group}, Resources: []string{ruleSetGVR.Resource}, Verbs: []string{"list"}})
+		}
+		if c.TargetPolicies {
+			rules = append(rules, rbacRule{APIGroups: []string{targetPolicyGVR.Group}, Resources: []string{targetPolicyGVR.Resource}, Verbs: []string{"list", "watch"}})
+		}
+		grants = append(grants, rbacGrant{category: lookupRules, rules: rules})
+	}
+	if len(c.AdminViewers) > 0 || len(c.Admins) > 0 {
+		grants = append(grants, rbacGrant{category: lookupAuth, rules: []rbacRule{
+			{APIGroups: []string{"authentication.k8s.io"}, Resources: []string{"tokenreviews"}, Verbs: []string{"create"}},
+		}})
+	}
+	return grants
+}
+
+func lookupServiceAccounts(c config) map[lookupCategory]string {
+	return map[lookupCategory]string{
+		lookupNAD:       c.NADLookupServiceAccount,
+		lookupNamespace: c.NamespaceLookupServiceAccount,
+		lookupPlan:      c.PlanLookupServiceAccount,
+		lookupPod:       c.PodLookupServiceAccount,
+	}
+}
+
+func subject(sa string) map[string]interface{} {
+	namespace, name, _ := strings.Cut(sa, "/")
+	return map[string]interface{}{"kind": "ServiceAccount", "name": name, "namespace": namespace}
+}
+
+// rbacObjects renders the ServiceAccount of the webhook and the roles and
+// bindings of rbacGrants. Lookups done by impersonating a service account
+// are granted to that service account, while the webhook only gets the
+// permission to impersonate it.
+func rbacObjects(c config, o manifestOptions, labels map[string]string) []interface{} {
+	self := o.namespace + "/" + o.name
+	grants := rbacGrants(c)
+	impersonated := lookupServiceAccounts(c)
+
+	usesToken := false
+	impersonate := make(map[string][]string)
+	for _, grant := range grants {
+		if sa := impersonated[grant.category]; sa != "" {
+			namespace, name, _ := strings.Cut(sa, "/")
+			if !contains(impersonate[namespace], name) {
+				impersonate[namespace] = append(impersonate[namespace], name)
+			}
+		}
+		usesToken = true
+	}
+
+	objects := []interface{}{map[string]interface{}{
+		"apiVersion":                   "v1",
+		"kind":                         "ServiceAccount",
+		"metadata":                     map[string]interface{}{"name": o.name, "namespace": o.namespace, "labels": labels},
+		"automountServiceAccountToken": usesToken,
+	}}
+
+	for _, grant := range grants {
+		name := o.name + "-" + string(grant.category)
+		sa := self
+		if impersonated[grant.category] != "" {
+			sa = impersonated[grant.category]
+		}
+		roleRef := map[string]string{"apiGroup": "rbac.authorization.k8s.io", "kind": "ClusterRole", "name": name}
+		objects = append(objects, map[string]interface{}{
+			"apiVersion": "rbac.authorization.k8s.io/v1",
+			"kind":       "ClusterRole",
+			"metadata":   map[string]interface{}{"name": name, "labels": labels},
+			"rules":      grant.rules,
+		})
+		if !grant.namespaced {
+			objects = append(objects, map[string]interface{}{
+				"apiVersion": "rbac.authorization.k8s.io/v1",
+				"kind":       "ClusterRoleBinding",
+				"metadata":   map[string]interface{}{"name": name, "labels": labels},
+				"roleRef":    roleRef,
+				"subjects":   []interface{}{subject(sa)},
+			})
+			continue
+		}
+		for _, namespace := range c.ScopeNamespaces {
+			objects = append(objects, map[string]interface{}{
+				"apiVersion": "rbac.authorization.k8s.io/v1",
+				"kind":       "RoleBinding",
+				"metadata":   map[string]interface{}{"name": name, "namespace": namespace, "labels": labels},
+				"roleRef":    roleRef,
+				"subjects":   []interface{}{subject(sa)},
+			})
+		}
+	}
+
+	namespaces := make([]string, 0, len(impersonate))
+	for namespace := range impersonate {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	for _, namespace := range namespaces {
+		names := impersonate[namespace]
+		sort.Strings(names)
+		name := o.name + "-impersonate"
+		objects = append(objects, map[string]interface{}{
+			"apiVersion": "rbac.authorization.k8s.io/v1",
+			"kind":       "Role",
+			"metadata":   map[string]interface{}{"name": name, "namespace": namespace, "labels": labels},
+			"rules":      []rbacRule{{APIGroups: []string{""}, Resources: []string{"serviceaccounts"}, Verbs: []string{"impersonate"}, ResourceNames: names}},
+		}, map[string]interface{}{
+			"apiVersion": "rbac.authorization.k8s.io/v1",
+			"kind":       "RoleBinding",
+			"metadata":   map[string]interface{}{"name": name, "namespace": namespace, "labels": labels},
+			"roleRef":    map[string]string{"apiGroup": "rbac.authorization.k8s.io", "kind": "Role", "name": name},
+			"subjects":   []interface{}{subject(self)},
+		})
+	}
+	return objects
+}
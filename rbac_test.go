@@ -0,0 +1,110 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func renderedObjects(t *testing.T, c config) []map[string]interface{} {
+	out, err := renderManifests(c, manifestOptions{name: "gateway-yeeter", namespace: "openshift-mtv", image: "test", replicas: 1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var objects []map[string]interface{}
+	for _, doc := range strings.Split(string(out), "---\n") {
+		var object map[string]interface{}
+		if err := yaml.Unmarshal([]byte(doc), &object); err != nil {
+			t.Fatal(err)
+		}
+		objects = append(objects, object)
+	}
+	return objects
+}
+
+func objectNames(objects []map[string]interface{}, kinds ...string) []string {
+	var names []string
+	for _, object := range objects {
+		if !contains(kinds, object["kind"].(string)) {
+			continue
+		}
+		metadata := object["metadata"].(map[string]interface{})
+		name := object["kind"].(string) + " " + metadata["name"].(string)
+		if namespace, ok := metadata["namespace"].(string); ok {
+			name += " -n " + namespace
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestRBACGrantsDefault(t *testing.T) {
+	if grants := rbacGrants(defaultConfig()); len(grants) != 0 {
+		t.Fatalf("expected no grants by default, got %+v", grants)
+	}
+	objects := renderedObjects(t, defaultConfig())
+	if names := objectNames(objects, "ClusterRole", "ClusterRoleBinding", "Role", "RoleBinding"); len(names) != 0 {
+		t.Fatalf("expected no RBAC by default, got %v", names)
+	}
+	if sa := objects[0]; sa["kind"] != "ServiceAccount" || sa["automountServiceAccountToken"] != false {
+		t.Fatalf("expected a service account without token, got %v", sa)
+	}
+}
+
+func TestRBACGrantsForFeatures(t *testing.T) {
+	c := defaultConfig()
+	c.SRIOVPolicy = sriovPolicyStrip
+	c.CheckNamespaceRouting = true
+	c.ScopePlans = stringList{"mtv/plan"}
+	c.VerifyNetworkStatus = true
+	c.ScopeNamespaces = stringList{"mtv-a", "mtv-b"}
+	c.Admins = stringList{"alice"}
+	c.CheckWebhookConflicts = true
+	c.NamespaceLookupServiceAccount = "lookups/namespaces"
+	c.PodLookupServiceAccount = "lookups/pods"
+
+	objects := renderedObjects(t, c)
+	want := []string{
+		"ServiceAccount gateway-yeeter -n openshift-mtv",
+		"ClusterRole gateway-yeeter-nad",
+		"ClusterRoleBinding gateway-yeeter-nad",
+		"ClusterRole gateway-yeeter-namespace",
+		"ClusterRoleBinding gateway-yeeter-namespace",
+		"ClusterRole gateway-yeeter-plan",
+		"ClusterRoleBinding gateway-yeeter-plan",
+		"ClusterRole gateway-yeeter-pod",
+		"RoleBinding gateway-yeeter-pod -n mtv-a",
+		"RoleBinding gateway-yeeter-pod -n mtv-b",
+		"ClusterRole gateway-yeeter-webhook",
+		"ClusterRoleBinding gateway-yeeter-webhook",
+		"ClusterRole gateway-yeeter-auth",
+		"ClusterRoleBinding gateway-yeeter-auth",
+		"Role gateway-yeeter-impersonate -n lookups",
+		"RoleBinding gateway-yeeter-impersonate -n lookups",
+	}
+	if got := objectNames(objects, "ServiceAccount", "ClusterRole", "ClusterRoleBinding", "Role", "RoleBinding"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected objects\n%v\ngot\n%v", want, got)
+	}
+
+	byName := make(map[string]map[string]interface{})
+	for i, name := range objectNames(objects, "ServiceAccount", "ClusterRole", "ClusterRoleBinding", "Role", "RoleBinding") {
+		byName[name] = objects[i]
+	}
+	plan, _ := yaml.Marshal(byName["ClusterRole gateway-yeeter-plan"]["rules"])
+	if strings.Contains(string(plan), "patch") || !strings.Contains(string(plan), "datavolumes") {
+		t.Fatalf("expected read-only plan rules without --plan-summaries, got\n%s", plan)
+	}
+	subjects := byName["ClusterRoleBinding gateway-yeeter-namespace"]["subjects"].([]interface{})
+	if sa := subjects[0].(map[string]interface{}); sa["namespace"] != "lookups" || sa["name"] != "namespaces" {
+		t.Fatalf("expected namespace lookups granted to the impersonated service account, got %v", sa)
+	}
+	impersonate, _ := yaml.Marshal(byName["Role gateway-yeeter-impersonate -n lookups"]["rules"])
+	if !strings.Contains(string(impersonate), "- namespaces\n  - pods\n") {
+		t.Fatalf("expected impersonation of both lookup service accounts, got\n%s", impersonate)
+	}
+	if byName["ServiceAccount gateway-yeeter -n openshift-mtv"]["automountServiceAccountToken"] != true {
+		t.Fatal("expected the service account token to be mounted")
+	}
+}
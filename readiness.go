@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+var webhookRegistered = newGauge(prometheus.GaugeOpts{
+	Name: "gateway_yeeter_webhook_registered",
+	Help: "Whether a MutatingWebhookConfiguration calls /mutate on this webhook's Service (1) or not (0), with --require-webhook-registration.",
+})
+
+// registrationChecker periodically verifies that the webhook is registered,
+// so an incomplete install shows up as not ready instead of a healthy
+// deployment that never receives a pod.
+type registrationChecker struct {
+	mu      sync.Mutex
+	ready   bool
+	message string
+}
+
+var registration *registrationChecker
+
+func newRegistrationChecker() *registrationChecker {
+	return &registrationChecker{message: "webhook registration not checked yet"}
+}
+
+func (c *registrationChecker) run(interval time.Duration) {
+	if c == nil {
+		return
+	}
+	c.check()
+	for range time.Tick(interval) {
+		c.check()
+	}
+}
+
+func (c *registrationChecker) check() {
+	client, err := kube.typedFor(lookupWebhook)
+	if err != nil {
+		klog.Warningf("Could not check the webhook registration: %v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), webhookListTimeout)
+	defer cancel()
+	list, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		// Keep the last result, an API server hiccup does not unregister us.
+		klog.Warningf("Could not check the webhook registration: %v", err)
+		return
+	}
+	c.update(list.Items)
+}
+
+func (c *registrationChecker) update(configurations []admissionregistrationv1.MutatingWebhookConfiguration) {
+	ready, message := registrationStatus(configurations)
+	ownWebhook.observe(configurations)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ready != c.ready || message != c.message {
+		if ready {
+			klog.Infof("Webhook registration found: %s", message)
+		} else {
+			klog.Warningf("Webhook is not ready: %s", message)
+		}
+	}
+	c.ready, c.message = ready, message
+	if ready {
+		webhookRegistered.Set(1)
+	} else {
+		webhookRegistered.Set(0)
+	}
+}
+
+func (c *registrationChecker) status() (bool, string) {
+	if c == nil {
+		return true, "registration not required"
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ready, c.message
+}
+
+// registrationStatus reports whether a webhook of configurations calls
+// /mutate on the Service of this replica.
+func registrationStatus(configurations []admissionregistrationv1.MutatingWebhookConfiguration) (bool, string) {
+	service := identity.Namespace + "/" + identity.Service
+	for _, configuration := range configurations {
+		for _, webhook := range configuration.Webhooks {
+			ref := webhook.ClientConfig.Service
+			if ref == nil || ref.Name != identity.Service || ref.Namespace != identity.Namespace {
+				continue
+			}
+			if ref.Path == nil || *ref.Path != "/mutate" {
+				return false, fmt.Sprintf("webhook %s/%s calls service %s on a path other than /mutate", configuration.Name, webhook.Name, service)
+			}
+			return true, fmt.Sprintf("webhook %s/%s calls service %s", configuration.Name, webhook.Name, service)
+		}
+	}
+	return false, "no MutatingWebhookConfiguration references service " + service
+}
+
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	for _, check := range []func() (bool, string){warmUp.status, servingCert.status, servingCertName.status, registration.status} {
+		if ready, message := check(); !ready {
+			http.Error(w, message, http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRegistrationStatus(t *testing.T) {
+	oldIdentity := identity
+	identity = instanceIdentity{Namespace: "openshift-mtv", Pod: "gateway-yeeter-0", Service: "gateway-yeeter"}
+	defer func() { identity = oldIdentity }()
+
+	path := "/mutate"
+	webhook := admissionregistrationv1.MutatingWebhook{
+		Name:         "cdi.gateway.yeet",
+		ClientConfig: admissionregistrationv1.WebhookClientConfig{Service: &admissionregistrationv1.ServiceReference{Namespace: "openshift-mtv", Name: "gateway-yeeter", Path: &path}},
+	}
+	other := admissionregistrationv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "sidecar-injector"},
+		Webhooks: []admissionregistrationv1.MutatingWebhook{{
+			Name:         "inject.sidecar.io",
+			ClientConfig: admissionregistrationv1.WebhookClientConfig{Service: &admissionregistrationv1.ServiceReference{Namespace: "istio-system", Name: "gateway-yeeter", Path: &path}},
+		}},
+	}
+	own := admissionregistrationv1.MutatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: "gateway-yeeter"}, Webhooks: []admissionregistrationv1.MutatingWebhook{webhook}}
+
+	c := newRegistrationChecker()
+	if ready, _ := c.status(); ready {
+		t.Fatal("expected not to be ready before the first check")
+	}
+
+	c.update([]admissionregistrationv1.MutatingWebhookConfiguration{other})
+	if ready, message := c.status(); ready || !strings.Contains(message, "no MutatingWebhookConfiguration references service openshift-mtv/gateway-yeeter") {
+		t.Fatalf("expected missing registration, got %v %q", ready, message)
+	}
+	if got := testutil.ToFloat64(webhookRegistered); got != 0 {
+		t.Fatalf("expected registered gauge 0, got %v", got)
+	}
+
+	c.update([]admissionregistrationv1.MutatingWebhookConfiguration{other, own})
+	if ready, message := c.status(); !ready || !strings.Contains(message, "gateway-yeeter/cdi.gateway.yeet") {
+		t.Fatalf("expected registration to be found, got %v %q", ready, message)
+	}
+	if got := testutil.ToFloat64(webhookRegistered); got != 1 {
+		t.Fatalf("expected registered gauge 1, got %v", got)
+	}
+
+	wrongPath := "/"
+	own.Webhooks[0].ClientConfig.Service.Path = &wrongPath
+	if ready, message := registrationStatus([]admissionregistrationv1.MutatingWebhookConfiguration{own}); ready || !strings.Contains(message, "other than /mutate") {
+		t.Fatalf("expected a wrong path to be reported, got %v %q", ready, message)
+	}
+}
+
+func TestHandleReadyz(t *testing.T) {
+	old := registration
+	defer func() { registration = old }()
+
+	registration = nil
+	w := httptest.NewRecorder()
+	handleReadyz(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected ready without --require-webhook-registration, got %d", w.Code)
+	}
+
+	registration = newRegistrationChecker()
+	w = httptest.NewRecorder()
+	handleReadyz(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "not checked yet") {
+		t.Fatalf("expected not ready, got %d %q", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+// Reason codes are stable, machine-readable identifiers of why a pod was or
+// was not modified. They are used in Status.Reason, the reason label of
+// gateway_yeeter_admission_reviews_total, decision records and warnings, so
+// automation can branch on them. Existing codes must never be renamed.
+const (
+	reasonMutated   = "MUTATED"
+	reasonUnchanged = "UNCHANGED"
+
+	reasonSkipNamespaceScope    = "SKIP_NAMESPACE_SCOPE"
+	reasonSkipNamespaceExcluded = "SKIP_NAMESPACE_EXCLUDED"
+	reasonSkipNamespaceIgnored  = "SKIP_NAMESPACE_IGNORED"
+	reasonSkipNotTarget         = "SKIP_NOT_TARGET"
+	reasonSkipUpdate            = "SKIP_UPDATE"
+	reasonSkipDelete            = "SKIP_DELETE"
+	reasonSkipOptOut            = "SKIP_OPT_OUT"
+	reasonSkipPlanScope         = "SKIP_PLAN_SCOPE"
+
+	reasonDenyRule              = "DENY_RULE"
+	reasonDenySRIOV             = "DENY_SRIOV"
+	reasonDenyAnnotationLimit   = "DENY_ANNOTATION_LIMIT"
+	reasonDenyInterfaceConflict = "DENY_INTERFACE_CONFLICT"
+	reasonDenyUnmutated         = "DENY_UNMUTATED"
+
+	reasonErrPodUnmarshal    = "ERR_POD_UNMARSHAL"
+	reasonErrAnnotationParse = "ERR_ANNOTATION_PARSE"
+	reasonErrHotplugCompare  = "ERR_HOTPLUG_COMPARE"
+	reasonErrPlanLookup      = "ERR_PLAN_LOOKUP"
+	reasonErrPatchMarshal    = "ERR_PATCH_MARSHAL"
+	reasonErrPatchValidation = "ERR_PATCH_VALIDATION"
+
+	reasonWarnOVNRouting          = "WARN_OVN_ROUTING_ANNOTATION"
+	reasonWarnNamespaceRoutes     = "WARN_NAMESPACE_EXTERNAL_GATEWAYS"
+	reasonWarnRateLimited         = "WARN_RATE_LIMITED"
+	reasonWarnConflictingWebhooks = "WARN_CONFLICTING_WEBHOOKS"
+	reasonWarnAnnotationLimit     = "WARN_ANNOTATION_LIMIT"
+	reasonWarnInterfaceConflict   = "WARN_INTERFACE_CONFLICT"
+	reasonWarnUnmutated           = "WARN_UNMUTATED"
+	reasonWarnAnnotationParse     = "WARN_ANNOTATION_PARSE"
+)
+
+// warning formats an admission warning as "gateway-yeeter: <REASON>: <message>".
+func warning(reason, msg string) string {
+	return "gateway-yeeter: " + reason + ": " + msg
+}
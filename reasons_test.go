@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestReviewPodReasons(t *testing.T) {
+	old := cfg
+	defer func() { cfg = old }()
+	cfg.Rules = ruleSet{
+		{Name: "frozen", Namespaces: []string{"frozen"}, Action: actionIgnore},
+		{Name: "platform", Namespaces: []string{"platform"}, Action: actionDeny},
+	}
+
+	cases := []struct {
+		namespace string
+		networks  string
+		outcome   string
+		reason    string
+	}{
+		{"test", `[{"name":"transfer","default-route":["10.0.0.1"]}]`, outcomeMutated, reasonMutated},
+		{"test", `[{"name":"transfer"}]`, outcomeUnchanged, reasonUnchanged},
+		{"test", `not json`, outcomeSkipped, reasonErrAnnotationParse},
+		{"frozen", `[{"name":"transfer","default-route":["10.0.0.1"]}]`, outcomeSkipped, reasonSkipOptOut},
+		{"platform", `[{"name":"transfer","default-route":["10.0.0.1"]}]`, outcomeDenied, reasonDenyRule},
+	}
+	for _, c := range cases {
+		resp, d := reviewRulesPod(t, c.namespace, c.networks)
+		if d.Outcome != c.outcome || d.Reason != c.reason {
+			t.Errorf("%s %s: expected %s/%s, got %s/%s", c.namespace, c.networks, c.outcome, c.reason, d.Outcome, d.Reason)
+		}
+		if c.outcome == outcomeDenied && string(resp.Result.Reason) != c.reason {
+			t.Errorf("%s: expected Status.Reason %s, got %q", c.namespace, c.reason, resp.Result.Reason)
+		}
+	}
+
+	ar := &admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{UID: "test", Object: runtime.RawExtension{Raw: []byte(`[]`)}}}
+	d := newDecision(ar)
+	if resp := evaluatePod(ar, d, nil); d.Reason != reasonErrPodUnmarshal || string(resp.Result.Reason) != reasonErrPodUnmarshal {
+		t.Fatalf("expected %s, got %s and %+v", reasonErrPodUnmarshal, d.Reason, resp.Result)
+	}
+}
+
+func TestWarningCarriesReason(t *testing.T) {
+	w := warning(reasonWarnRateLimited, "rate limit exceeded")
+	if code, _, _ := strings.Cut(strings.TrimPrefix(w, "gateway-yeeter: "), ": "); code != reasonWarnRateLimited {
+		t.Fatalf("expected the reason to be parseable from %q", w)
+	}
+}
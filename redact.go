@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	channelLogs    = "logs"
+	channelAudit   = "audit"
+	channelAdmin   = "admin"
+	channelEvents  = "events"
+	channelMetrics = "metrics"
+	channelSinks   = "sinks"
+
+	fieldNamespace = "namespace"
+	fieldPod       = "pod"
+	fieldNetworks  = "networks"
+	fieldGateways  = "gateways"
+	fieldPatch     = "patch"
+
+	redactionMask         = "redacted:*"
+	redactionKeyMinLength = 32
+)
+
+var (
+	redactionChannels = []string{channelLogs, channelAudit, channelAdmin, channelEvents, channelMetrics, channelSinks}
+	redactionFields   = []string{fieldNamespace, fieldPod, fieldNetworks, fieldGateways, fieldPatch}
+)
+
+// redactionKey is the per-deployment secret masked values are pseudonymized
+// with. Without it values cannot be correlated and are all replaced by
+// redactionMask, as an unkeyed hash of short values like IPs and pod names
+// can be reversed by hashing candidates.
+var redactionKey []byte
+
+func loadRedactionKey(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read redaction key: %w", err)
+	}
+	key := bytes.TrimSpace(raw)
+	if len(key) < redactionKeyMinLength {
+		return nil, fmt.Errorf("redaction key %s must be at least %d bytes, got %d", path, redactionKeyMinLength, len(key))
+	}
+	return key, nil
+}
+
+type redactionPolicy map[string][]string
+
+func (p *redactionPolicy) String() string {
+	if p == nil {
+		return ""
+	}
+	var parts []string
+	for channel, fields := range *p {
+		parts = append(parts, channel+"="+strings.Join(fields, ","))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ";")
+}
+
+func (p *redactionPolicy) Set(value string) error {
+	policy := redactionPolicy{}
+	for _, rule := range strings.Split(value, ";") {
+		if rule = strings.TrimSpace(rule); rule == "" {
+			continue
+		}
+		channel, fields, found := strings.Cut(rule, "=")
+		if !found || !contains(redactionChannels, channel) {
+			return fmt.Errorf("invalid redaction rule %q, expected <channel>=<field>[,<field>] with channel one of %s", rule, strings.Join(redactionChannels, ", "))
+		}
+		for _, field := range strings.Split(fields, ",") {
+			if field = strings.TrimSpace(field); field == "" {
+				continue
+			}
+			if !contains(redactionFields, field) {
+				return fmt.Errorf("invalid redaction field %q, expected one of %s", field, strings.Join(redactionFields, ", "))
+			}
+			policy[channel] = append(policy[channel], field)
+		}
+	}
+	*p = policy
+	return nil
+}
+
+func (p redactionPolicy) masks(channel, field string) bool {
+	return contains(p[channel], field)
+}
+
+// value masks value if the channel redacts field. Values already redacted,
+// e.g. read back from the audit log, are kept as is.
+func (p redactionPolicy) value(channel, field, value string) string {
+	if value == "" || strings.HasPrefix(value, "redacted:") || !p.masks(channel, field) {
+		return value
+	}
+	if redactionKey == nil {
+		return redactionMask
+	}
+	mac := hmac.New(sha256.New, redactionKey)
+	mac.Write([]byte(value))
+	return "redacted:" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+func (p redactionPolicy) annotation(channel, value string) string {
+	if p.masks(channel, fieldNetworks) || p.masks(channel, fieldGateways) {
+		return p.value(channel, fieldNetworks, value)
+	}
+	return value
+}
+
+func (p redactionPolicy) decision(channel string, d *decision) *decision {
+	if len(p[channel]) == 0 {
+		return d
+	}
+
+	out := *d
+	out.Namespace = p.value(channel, fieldNamespace, d.Namespace)
+	out.Pod = p.value(channel, fieldPod, d.Pod)
+	out.Patch = p.value(channel, fieldPatch, d.Patch)
+	// Messages of denials name the requested networks.
+	out.Message = p.value(channel, fieldNetworks, d.Message)
+	out.Networks = make([]networkChange, len(d.Networks))
+	for i, change := range d.Networks {
+		out.Networks[i].Network = p.value(channel, fieldNetworks, change.Network)
+		for _, gw := range change.RemovedGateways {
+			out.Networks[i].RemovedGateways = append(out.Networks[i].RemovedGateways, p.value(channel, fieldGateways, gw))
+		}
+		out.Networks[i].SRIOVResource = change.SRIOVResource
+		for _, route := range change.AddedRoutes {
+			out.Networks[i].AddedRoutes = append(out.Networks[i].AddedRoutes, p.value(channel, fieldGateways, route))
+		}
+	}
+	if d.PodContext != nil && p.masks(channel, fieldPod) {
+		context := *d.PodContext
+		context.Owners = nil
+		for _, owner := range d.PodContext.Owners {
+			kind, name, _ := strings.Cut(owner, "/")
+			context.Owners = append(context.Owners, kind+"/"+p.value(channel, fieldPod, name))
+		}
+		out.PodContext = &context
+	}
+	return &out
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
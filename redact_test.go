@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactionPolicyParse(t *testing.T) {
+	var p redactionPolicy
+	if err := p.Set("audit=gateways,patch; logs=pod"); err != nil {
+		t.Fatal(err)
+	}
+	if !p.masks(channelAudit, fieldGateways) || !p.masks(channelAudit, fieldPatch) || !p.masks(channelLogs, fieldPod) {
+		t.Fatalf("unexpected policy %v", p)
+	}
+	if p.masks(channelLogs, fieldGateways) {
+		t.Fatal("expected gateways to stay visible in logs")
+	}
+	if p.String() != "audit=gateways,patch;logs=pod" {
+		t.Fatalf("unexpected string form %q", p.String())
+	}
+
+	for _, invalid := range []string{"audit", "nowhere=pod", "audit=password"} {
+		if err := p.Set(invalid); err == nil {
+			t.Fatalf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func withRedactionKey(t *testing.T) {
+	old := redactionKey
+	redactionKey = []byte(strings.Repeat("k", redactionKeyMinLength))
+	t.Cleanup(func() { redactionKey = old })
+}
+
+func TestRedactionPolicyDecision(t *testing.T) {
+	withRedactionKey(t)
+	p := redactionPolicy{channelAudit: {fieldGateways, fieldPod}}
+	d := &decision{
+		Namespace: "ns",
+		Pod:       "pod",
+		Networks:  []networkChange{{Network: "default/net", RemovedGateways: []string{"10.0.0.1"}}},
+	}
+
+	redacted := p.decision(channelAudit, d)
+	if redacted.Namespace != "ns" || redacted.Networks[0].Network != "default/net" {
+		t.Fatal("expected unmasked fields to be kept")
+	}
+	if !strings.HasPrefix(redacted.Pod, "redacted:") || !strings.HasPrefix(redacted.Networks[0].RemovedGateways[0], "redacted:") {
+		t.Fatalf("expected masked fields, got %+v", redacted)
+	}
+	if d.Pod != "pod" || d.Networks[0].RemovedGateways[0] != "10.0.0.1" {
+		t.Fatal("expected original decision to stay unmodified")
+	}
+	if p.value(channelAudit, fieldPod, "pod") != redacted.Pod {
+		t.Fatal("expected masking to be stable for correlation")
+	}
+	if p.decision(channelLogs, d) != d {
+		t.Fatal("expected channel without rules to return the decision as is")
+	}
+}
+
+func TestRedactionPolicyDeniedDecision(t *testing.T) {
+	p := redactionPolicy{channelSinks: {fieldNetworks}}
+	rule := &rule{Name: "platform", Action: actionDeny}
+	d := &decision{
+		Outcome:  outcomeDenied,
+		Reason:   reasonDenyRule,
+		Message:  denyMessage(rule, []string{"mtv/transfer"}),
+		Networks: []networkChange{{Network: "mtv/transfer", RemovedGateways: []string{"10.0.0.1"}}},
+	}
+
+	redacted := p.decision(channelSinks, d)
+	if strings.Contains(redacted.Message, "transfer") || redacted.Message != p.value(channelSinks, fieldNetworks, d.Message) {
+		t.Fatalf("expected the denial message to be masked, got %q", redacted.Message)
+	}
+	if redacted.Networks[0].RemovedGateways[0] != "10.0.0.1" || d.Message == redacted.Message {
+		t.Fatalf("expected only the networks to be masked, got %+v", redacted)
+	}
+}
+
+func TestRedactionPolicyValueKey(t *testing.T) {
+	p := redactionPolicy{channelLogs: {fieldGateways}}
+	if masked := p.value(channelLogs, fieldGateways, "10.0.0.1"); masked != redactionMask || p.value(channelLogs, fieldGateways, "10.0.0.2") != masked {
+		t.Fatalf("expected a constant mask without a redaction key, got %q", masked)
+	}
+
+	withRedactionKey(t)
+	masked := p.value(channelLogs, fieldGateways, "10.0.0.1")
+	if masked == redactionMask || p.value(channelLogs, fieldGateways, "10.0.0.2") == masked {
+		t.Fatalf("expected distinct values to be masked distinctly, got %q", masked)
+	}
+	unsalted := sha256.Sum256([]byte("10.0.0.1"))
+	if strings.Contains(masked, hex.EncodeToString(unsalted[:4])) {
+		t.Fatalf("expected the mask to depend on the key, got %q", masked)
+	}
+	redactionKey = []byte(strings.Repeat("o", redactionKeyMinLength))
+	if p.value(channelLogs, fieldGateways, "10.0.0.1") == masked {
+		t.Fatal("expected another key to mask the value differently")
+	}
+}
+
+func TestLoadRedactionKey(t *testing.T) {
+	dir := t.TempDir()
+	short, long := filepath.Join(dir, "short"), filepath.Join(dir, "long")
+	os.WriteFile(short, []byte("secret\n"), 0o600)
+	os.WriteFile(long, []byte(strings.Repeat("k", redactionKeyMinLength)+"\n"), 0o600)
+
+	if key, err := loadRedactionKey(""); key != nil || err != nil {
+		t.Fatalf("expected no key without a file, got %q %v", key, err)
+	}
+	if _, err := loadRedactionKey(short); err == nil {
+		t.Fatal("expected a short key to be rejected")
+	}
+	if key, err := loadRedactionKey(long); err != nil || len(key) != redactionKeyMinLength {
+		t.Fatalf("expected the key without the trailing newline, got %q %v", key, err)
+	}
+}
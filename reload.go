@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+
+	"k8s.io/klog/v2"
+)
+
+// reloadResult is the state after a reload requested on /reload.
+type reloadResult struct {
+	RulesHash string   `json:"rulesHash"`
+	Targets   []string `json:"targets"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// handleReload reloads the rule sources, the GatewayYeetPolicies and the
+// --config file immediately instead of on their next interval, e.g. right
+// after changing a ConfigMap. Failed sources keep their previous content,
+// like on a periodic reload.
+func handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	actor := requestPrincipal(r)
+	klog.Infof("Reload requested by %s", actor)
+	var result reloadResult
+	if ruleSources != nil {
+		ruleSources.refresh(actor)
+	}
+	if targetPolicies != nil {
+		targetPolicies.refresh(actor)
+	}
+	if err := targetConfig.refresh(actor); err != nil {
+		result.Errors = append(result.Errors, err.Error())
+	}
+	rules := ruleSources.view()
+	for _, layer := range rules.Layers {
+		if layer.Error != "" {
+			result.Errors = append(result.Errors, layer.Source+" "+layer.Origin+": "+layer.Error)
+		}
+	}
+	result.RulesHash = rules.Hash
+	for _, target := range targetPolicies.current() {
+		result.Targets = append(result.Targets, target.name)
+	}
+	writeJSON(w, result)
+}
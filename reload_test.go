@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"gateway-yeeter/pkg/adminclient"
+)
+
+func TestAdminClient(t *testing.T) {
+	oldCfg, oldDecisions, oldTargetConfig := cfg, recentDecisions, targetConfig
+	defer func() { cfg, recentDecisions, targetConfig = oldCfg, oldDecisions, oldTargetConfig }()
+	cfg = defaultConfig()
+	recentDecisions = newDecisionLog(10)
+	recentDecisions.add(&decision{Namespace: "mtv", Pod: "importer-test", Outcome: outcomeMutated, Networks: []networkChange{{Network: "mtv/transfer", RemovedGateways: []string{"10.0.0.1"}}}})
+	recentDecisions.add(&decision{Namespace: "other", Pod: "virt-v2v-test", Outcome: outcomeUnchanged})
+
+	file := writeTestFile(t, "targets.yaml", "targets:\n- podType: importer\n  podSelector: {matchLabels: {app: importer}}\n")
+	watcher, err := newTargetConfigWatcher(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetConfig = watcher
+
+	a := newAdminAuth([]string{"viewer"}, []string{"ops"})
+	a.reviewToken = fakeTokenReview(map[string]*principal{"viewer-token": {User: "viewer"}, "ops-token": {User: "ops"}})
+	withAdminAuth(t, a)
+	mux := http.NewServeMux()
+	registerAdminHandlers(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	viewer := adminclient.New(server.URL, "viewer-token", nil)
+	decisions, err := viewer.Decisions(t.Context(), adminclient.DecisionFilter{Namespace: "mtv"})
+	if err != nil || len(decisions) != 1 || decisions[0].Networks[0].RemovedGateways[0] != "10.0.0.1" {
+		t.Fatalf("unexpected decisions %+v: %v", decisions, err)
+	}
+	stats, err := viewer.Stats(t.Context())
+	if err != nil || stats.Total != 2 || stats.Outcomes[outcomeMutated] != 1 {
+		t.Fatalf("unexpected stats %+v: %v", stats, err)
+	}
+	config, err := viewer.Config(t.Context())
+	if err != nil || config.Hash != cfg.hash() {
+		t.Fatalf("unexpected config %+v: %v", config, err)
+	}
+	var apiErr *adminclient.Error
+	if _, err := viewer.Reload(t.Context()); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected viewers to be forbidden to reload, got %v", err)
+	}
+
+	if err := os.WriteFile(file, []byte("targets:\n- podType: transfer\n  podSelector: {matchLabels: {app: transfer}}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var audit bytes.Buffer
+	auditor = &auditLog{w: &audit}
+	defer func() { auditor = nil }()
+	result, err := adminclient.New(server.URL, "ops-token", nil).Reload(t.Context())
+	if err != nil || len(result.Targets) != 1 || result.Targets[0] != "transfer" || len(result.Errors) != 0 {
+		t.Fatalf("unexpected reload %+v: %v", result, err)
+	}
+	var record configChangeRecord
+	if err := json.Unmarshal(audit.Bytes(), &record); err != nil || record.Source != changeSourceConfigFile || record.Actor != "ops" || record.OldHash == "" || record.OldHash == record.NewHash {
+		t.Fatalf("expected a ConfigChange record of the reload by ops, got %+v: %v", record, err)
+	}
+
+	if err := os.WriteFile(file, []byte("targets: []\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := adminclient.New(server.URL, "ops-token", nil).Reload(t.Context()); err != nil || len(result.Errors) != 1 || result.Targets[0] != "transfer" {
+		t.Fatalf("expected the previous targets to be kept, got %+v: %v", result, err)
+	}
+}
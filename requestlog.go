@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+var slowRequests = newCounterVec(prometheus.CounterOpts{
+	Name: "gateway_yeeter_slow_requests_total",
+	Help: "Requests that took longer than --slow-request-threshold, by path.",
+}, "path")
+
+// sensitiveHeaders are masked in slow request dumps.
+var sensitiveHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization", "X-Api-Key"}
+
+// statusRecorder records the status and size of a response. Flushing and
+// hijacking are passed through for the decision stream.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	r.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// logRequests logs every request at verbosity 2 and dumps the details of
+// admission requests slower than --slow-request-threshold as a warning.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		threshold := cfg.SlowRequestThreshold
+		var body *bytes.Buffer
+		if threshold > 0 && r.URL.Path == "/mutate" && r.Body != nil {
+			body = getBuffer()
+			defer putBuffer(body)
+			r.Body = teeBody{io.TeeReader(io.LimitReader(r.Body, cfg.MaxRequestBytes+1), body), r.Body}
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		duration := time.Since(start)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		klog.V(2).Infof("%s %s %d %dB %s from %s", r.Method, r.URL.Path, rec.status, rec.bytes, duration, r.RemoteAddr)
+		if body != nil && duration >= threshold {
+			slowRequests.WithLabelValues(r.URL.Path).Inc()
+			klog.Warningf("Slow request %s %s took %s (threshold %s): %s", r.Method, r.URL.Path, duration, threshold, slowRequestDump(r, rec, duration, body.Bytes()))
+		}
+	})
+}
+
+type teeBody struct {
+	io.Reader
+	io.Closer
+}
+
+type slowRequest struct {
+	Method     string              `json:"method"`
+	Path       string              `json:"path"`
+	Proto      string              `json:"proto"`
+	Remote     string              `json:"remote"`
+	Status     int                 `json:"status"`
+	Bytes      int                 `json:"bytes"`
+	Duration   string              `json:"duration"`
+	BodyBytes  int                 `json:"bodyBytes"`
+	Headers    map[string][]string `json:"headers"`
+	Admission  *slowAdmission      `json:"admission,omitempty"`
+	ParseError string              `json:"parseError,omitempty"`
+}
+
+// slowAdmission describes the admission request of a slow request without
+// the pod itself, which may carry secrets in its environment.
+type slowAdmission struct {
+	UID         string            `json:"uid"`
+	Kind        string            `json:"kind"`
+	Operation   string            `json:"operation"`
+	Namespace   string            `json:"namespace"`
+	Name        string            `json:"name"`
+	User        string            `json:"user"`
+	DryRun      bool              `json:"dryRun,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations []string          `json:"annotations,omitempty"`
+	Networks    string            `json:"networks,omitempty"`
+}
+
+func slowRequestDump(r *http.Request, rec *statusRecorder, duration time.Duration, body []byte) string {
+	dump := slowRequest{
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Proto:     r.Proto,
+		Remote:    r.RemoteAddr,
+		Status:    rec.status,
+		Bytes:     rec.bytes,
+		Duration:  duration.String(),
+		BodyBytes: len(body),
+		Headers:   make(map[string][]string),
+	}
+	for key, values := range r.Header {
+		if contains(sensitiveHeaders, key) {
+			values = []string{"REDACTED"}
+		}
+		dump.Headers[key] = values
+	}
+
+	var review admissionv1.AdmissionReview
+	if err := json.Unmarshal(body, &review); err != nil || review.Request == nil {
+		if err == nil {
+			err = fmt.Errorf("no request")
+		}
+		dump.ParseError = err.Error()
+	} else {
+		req := review.Request
+		dump.Admission = &slowAdmission{
+			UID:       string(req.UID),
+			Kind:      req.Kind.String(),
+			Operation: string(req.Operation),
+			Namespace: cfg.Redaction.value(channelLogs, fieldNamespace, req.Namespace),
+			User:      req.UserInfo.Username,
+			DryRun:    req.DryRun != nil && *req.DryRun,
+		}
+		name := req.Name
+		var pod corev1.Pod
+		if json.Unmarshal(req.Object.Raw, &pod) == nil {
+			if name == "" {
+				name = pod.Name + pod.GenerateName
+			}
+			dump.Admission.Labels = pod.Labels
+			for key := range pod.Annotations {
+				dump.Admission.Annotations = append(dump.Admission.Annotations, key)
+			}
+			sort.Strings(dump.Admission.Annotations)
+			dump.Admission.Networks = cfg.Redaction.value(channelLogs, fieldNetworks, pod.Annotations["k8s.v1.cni.cncf.io/networks"])
+		}
+		dump.Admission.Name = cfg.Redaction.value(channelLogs, fieldPod, name)
+	}
+
+	raw, _ := json.Marshal(dump)
+	return string(raw)
+}
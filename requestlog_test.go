@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestStatusRecorder(t *testing.T) {
+	w := httptest.NewRecorder()
+	rec := &statusRecorder{ResponseWriter: w}
+	rec.Write([]byte("hello"))
+	rec.WriteHeader(http.StatusTeapot)
+	rec.Flush()
+	if rec.status != http.StatusOK || rec.bytes != 5 || !w.Flushed {
+		t.Fatalf("expected an implicit 200 of 5 bytes and a flush, got %d %d %v", rec.status, rec.bytes, w.Flushed)
+	}
+	if _, _, err := rec.Hijack(); err == nil {
+		t.Fatal("expected hijacking to fail on a recorder without support")
+	}
+}
+
+func TestSlowRequestDump(t *testing.T) {
+	oldCfg := cfg
+	defer func() { cfg = oldCfg }()
+	cfg = defaultConfig()
+	cfg.SlowRequestThreshold = time.Millisecond
+	cfg.Redaction = redactionPolicy{channelLogs: {fieldNetworks}}
+
+	rawPod, _ := json.Marshal(corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		GenerateName: "importer-",
+		Labels:       map[string]string{"app": "containerized-data-importer"},
+		Annotations:  map[string]string{"k8s.v1.cni.cncf.io/networks": `[{"name":"transfer","default-route":["198.51.100.1"]}]`},
+	}})
+	body, _ := json.Marshal(admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{
+		UID:       "slow",
+		Namespace: "mtv",
+		Operation: admissionv1.Create,
+		Object:    runtime.RawExtension{Raw: rawPod},
+	}})
+
+	before := testutil.ToFloat64(slowRequests.WithLabelValues("/mutate"))
+	handler := logRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		time.Sleep(2 * time.Millisecond)
+		w.Write([]byte("{}"))
+	}))
+	r := httptest.NewRequest("POST", "/mutate", bytes.NewReader(body))
+	r.Header.Set("Authorization", "Bearer s3cret")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if got := testutil.ToFloat64(slowRequests.WithLabelValues("/mutate")) - before; got != 1 {
+		t.Fatalf("expected one slow request, got %v", got)
+	}
+
+	dump := slowRequestDump(r, &statusRecorder{status: http.StatusOK, bytes: 2}, 2*time.Millisecond, body)
+	for _, want := range []string{`"uid":"slow"`, `"namespace":"mtv"`, `"name":"importer-"`, `"operation":"CREATE"`, `"annotations":["k8s.v1.cni.cncf.io/networks"]`, `"Authorization":["REDACTED"]`} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("expected dump to contain %s: %s", want, dump)
+		}
+	}
+	if strings.Contains(dump, "s3cret") || strings.Contains(dump, "198.51.100.1") {
+		t.Fatalf("expected the token and the redacted networks to be masked: %s", dump)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// gzipMinBytes is the smallest response worth compressing.
+	gzipMinBytes = 1024
+	// maxPooledBuffer keeps buffers of unusually large responses out of the
+	// pool, so one huge pod does not pin its memory forever.
+	maxPooledBuffer = 1 << 20
+)
+
+var (
+	responseBuffers = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+	gzipWriters     = sync.Pool{New: func() interface{} { return gzip.NewWriter(nil) }}
+)
+
+func getBuffer() *bytes.Buffer {
+	buf := responseBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		responseBuffers.Put(buf)
+	}
+}
+
+// acceptsGzip reports whether the client accepts a gzip encoded response.
+func acceptsGzip(r *http.Request) bool {
+	for _, value := range r.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(value, ",") {
+			coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			if coding = strings.TrimSpace(coding); !strings.EqualFold(coding, "gzip") && coding != "*" {
+				continue
+			}
+			if q, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+				if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// writeAdmissionReviewResponse encodes the response of review into a pooled
+// buffer, so the Content-Length is known, and gzips it when the client
+// accepts it. The API server only reads the response, so the request and
+// its pod object are not echoed back.
+func writeAdmissionReviewResponse(w http.ResponseWriter, r *http.Request, review *admissionv1.AdmissionReview) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := json.NewEncoder(buf).Encode(&admissionv1.AdmissionReview{TypeMeta: review.TypeMeta, Response: review.Response}); err != nil {
+		klog.Errorf("Could not marshal response: %v", err)
+		return err
+	}
+
+	body := buf
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Add("Vary", "Accept-Encoding")
+	if buf.Len() >= gzipMinBytes && acceptsGzip(r) {
+		compressed := getBuffer()
+		defer putBuffer(compressed)
+		zw := gzipWriters.Get().(*gzip.Writer)
+		defer gzipWriters.Put(zw)
+		zw.Reset(compressed)
+		if _, err := buf.WriteTo(zw); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body = compressed
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(body.Len()))
+	if _, err := body.WriteTo(w); err != nil {
+		klog.Errorf("Could not write response: %v", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	for header, want := range map[string]bool{
+		"":                       false,
+		"gzip":                   true,
+		"deflate, gzip;q=0.5":    true,
+		"gzip;q=0":               false,
+		"*":                      true,
+		"identity":               false,
+		"br , GZIP":              true,
+		"deflate,gzip ; q=1.0":   true,
+		"gzip;q=0, deflate;q=1":  false,
+		"deflate;q=0.1, *;q=0.2": true,
+	} {
+		r := httptest.NewRequest("POST", "/mutate", nil)
+		if header != "" {
+			r.Header.Set("Accept-Encoding", header)
+		}
+		if got := acceptsGzip(r); got != want {
+			t.Errorf("Accept-Encoding %q: expected %v, got %v", header, want, got)
+		}
+	}
+}
+
+func TestWriteAdmissionReviewResponse(t *testing.T) {
+	review := &admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request: &admissionv1.AdmissionRequest{
+			UID:    "test",
+			Object: runtime.RawExtension{Raw: []byte(`{"metadata":{"name":"large-pod"}}`)},
+		},
+		Response: &admissionv1.AdmissionResponse{UID: "test", Allowed: true},
+	}
+
+	w := httptest.NewRecorder()
+	if err := writeAdmissionReviewResponse(w, httptest.NewRequest("POST", "/mutate", nil), review); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.Header().Get("Content-Length"); got != strconv.Itoa(w.Body.Len()) {
+		t.Fatalf("expected Content-Length %d, got %s", w.Body.Len(), got)
+	}
+	if strings.Contains(w.Body.String(), "large-pod") || w.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("expected an uncompressed response without the request, got %s", w.Body)
+	}
+
+	// Small responses are not worth compressing.
+	r := httptest.NewRequest("POST", "/mutate", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	writeAdmissionReviewResponse(w, r, review)
+	if w.Header().Get("Content-Encoding") != "" {
+		t.Fatal("expected a small response to be sent uncompressed")
+	}
+
+	review.Response.Patch = []byte(`[{"op":"replace","path":"/metadata/annotations/k8s.v1.cni.cncf.io~1networks","value":"` + strings.Repeat("x", 4096) + `"}]`)
+	w = httptest.NewRecorder()
+	if err := writeAdmissionReviewResponse(w, r, review); err != nil {
+		t.Fatal(err)
+	}
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Content-Length") != strconv.Itoa(w.Body.Len()) {
+		t.Fatalf("expected a gzip response with its compressed length, got %v", w.Header())
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := io.ReadAll(zr)
+	var got admissionv1.AdmissionReview
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Kind != "AdmissionReview" || got.Request != nil || got.Response == nil || string(got.Response.Patch) != string(review.Response.Patch) {
+		t.Fatalf("unexpected decompressed response %+v", got)
+	}
+}
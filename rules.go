@@ -0,0 +1,304 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	actionStrip  = "strip"
+	actionDeny   = "deny"
+	actionInject = "inject"
+	actionIgnore = "ignore"
+)
+
+var ruleActions = []string{actionStrip, actionDeny, actionInject, actionIgnore}
+
+// rule selects the action taken on target pods. Rules are evaluated in
+// order and the first match wins; pods no rule matches are stripped.
+type rule struct {
+	Name       string   `json:"name"`
+	Namespaces []string `json:"namespaces,omitempty"`
+	PodTypes   []string `json:"podTypes,omitempty"`
+	Action     string   `json:"action"`
+	Message    string   `json:"message,omitempty"`
+
+	// ActiveFrom and ActiveUntil limit the rule to a time window, e.g. a
+	// scheduled migration; outside of it the rule does not match.
+	ActiveFrom  *time.Time `json:"activeFrom,omitempty"`
+	ActiveUntil *time.Time `json:"activeUntil,omitempty"`
+
+	// Attachment, Routes and Gateway configure the inject action: after
+	// stripping, the routes and the approved gateway are added to the
+	// named attachment ("<namespace>/<name>" or "<name>" in the pod's
+	// namespace).
+	Attachment string      `json:"attachment,omitempty"`
+	Routes     []ipamRoute `json:"routes,omitempty"`
+	Gateway    string      `json:"gateway,omitempty"`
+
+	// RemoveAnnotations are annotation key patterns removed from matching
+	// pods in addition to the network action, e.g. stale scheduling hints
+	// or forbidden sysctls.
+	RemoveAnnotations []string `json:"removeAnnotations,omitempty"`
+
+	// DryRun admits matching pods unmodified like --dry-run, so a new rule
+	// can be evaluated while the others are enforced.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+type ruleSet []rule
+
+type rulesFile struct {
+	Rules ruleSet `json:"rules"`
+}
+
+func loadRules(file string) (ruleSet, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read rules file: %w", err)
+	}
+	return parseRules(raw, "rules file "+file)
+}
+
+// parseRules parses and validates the rules document raw read from origin.
+func parseRules(raw []byte, origin string) (ruleSet, error) {
+	var f rulesFile
+	if err := yaml.UnmarshalStrict(raw, &f); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", origin, err)
+	}
+	if err := f.Rules.validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", origin, err)
+	}
+	return f.Rules, nil
+}
+
+func (rs ruleSet) validate() error {
+	names := map[string]bool{}
+	for i, r := range rs {
+		if r.Name == "" {
+			return fmt.Errorf("rule %d has no name", i)
+		}
+		if names[r.Name] {
+			return fmt.Errorf("duplicate rule name %q", r.Name)
+		}
+		names[r.Name] = true
+		if !contains(ruleActions, r.Action) {
+			return fmt.Errorf("rule %q: action must be one of %s, got %q", r.Name, strings.Join(ruleActions, ", "), r.Action)
+		}
+		if r.ActiveFrom != nil && r.ActiveUntil != nil && !r.ActiveUntil.After(*r.ActiveFrom) {
+			return fmt.Errorf("rule %q: activeUntil must be after activeFrom", r.Name)
+		}
+		if err := r.validateInjection(); err != nil {
+			return fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+		for _, pattern := range r.Namespaces {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rule %q: invalid namespace pattern %q", r.Name, pattern)
+			}
+		}
+		if err := r.validateRemoveAnnotations(); err != nil {
+			return fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+		for _, podType := range r.PodTypes {
+			if !contains([]string{"virt-v2v", "cdi"}, podType) {
+				return fmt.Errorf("rule %q: pod type must be virt-v2v or cdi, got %q", r.Name, podType)
+			}
+		}
+	}
+	return nil
+}
+
+func (r rule) validateInjection() error {
+	if r.Action != actionInject {
+		if r.Attachment != "" || len(r.Routes) > 0 || r.Gateway != "" {
+			return fmt.Errorf("attachment, routes and gateway are only valid with action inject")
+		}
+		return nil
+	}
+	if r.Attachment == "" {
+		return fmt.Errorf("action inject requires an attachment")
+	}
+	if len(r.Routes) == 0 && r.Gateway == "" {
+		return fmt.Errorf("action inject requires routes or a gateway")
+	}
+	if r.Gateway != "" && net.ParseIP(r.Gateway) == nil {
+		return fmt.Errorf("invalid gateway %q", r.Gateway)
+	}
+	for _, route := range r.Routes {
+		if _, _, err := net.ParseCIDR(route.Dst); err != nil {
+			return fmt.Errorf("invalid route destination %q", route.Dst)
+		}
+		if isDefaultRouteDest(route.Dst) {
+			return fmt.Errorf("route destination %s is a default route, use gateway instead", route.Dst)
+		}
+		if route.GW != "" && net.ParseIP(route.GW) == nil {
+			return fmt.Errorf("invalid route gateway %q", route.GW)
+		}
+	}
+	return nil
+}
+
+// protectedAnnotations are handled by the network actions and can never be
+// removed by a rule.
+var protectedAnnotations = []string{"k8s.v1.cni.cncf.io/networks", ovnPodNetworksAnnotation}
+
+func (r rule) validateRemoveAnnotations() error {
+	if len(r.RemoveAnnotations) > 0 && r.Action == actionIgnore {
+		return fmt.Errorf("removeAnnotations is not valid with action ignore")
+	}
+	for _, pattern := range r.RemoveAnnotations {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return fmt.Errorf("invalid annotation pattern %q", pattern)
+		}
+		for _, key := range protectedAnnotations {
+			if ok, _ := path.Match(pattern, key); ok {
+				return fmt.Errorf("annotation pattern %q matches %s, which is managed by the network actions", pattern, key)
+			}
+		}
+	}
+	return nil
+}
+
+// annotationsToRemove returns the sorted keys of annotations matching the
+// RemoveAnnotations patterns of r.
+func (r rule) annotationsToRemove(annotations map[string]string) []string {
+	var keys []string
+	for key := range annotations {
+		for _, pattern := range r.RemoveAnnotations {
+			if ok, _ := path.Match(pattern, key); ok {
+				keys = append(keys, key)
+				break
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (r rule) matches(namespace, podType string, now time.Time) bool {
+	if r.ActiveFrom != nil && now.Before(*r.ActiveFrom) {
+		return false
+	}
+	if r.ActiveUntil != nil && !now.Before(*r.ActiveUntil) {
+		return false
+	}
+	if len(r.PodTypes) > 0 && !contains(r.PodTypes, podType) {
+		return false
+	}
+	if len(r.Namespaces) == 0 {
+		return true
+	}
+	for _, pattern := range r.Namespaces {
+		if ok, _ := path.Match(pattern, namespace); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r rule) unconditional() bool {
+	return len(r.Namespaces) == 0 && len(r.PodTypes) == 0 && r.ActiveFrom == nil && r.ActiveUntil == nil
+}
+
+// matchAll returns every rule matching the pod at now, in order.
+func (rs ruleSet) matchAll(namespace, podType string, now time.Time) []*rule {
+	var matches []*rule
+	for i := range rs {
+		if rs[i].matches(namespace, podType, now) {
+			matches = append(matches, &rs[i])
+		}
+	}
+	return matches
+}
+
+// match returns the first rule matching the pod at now, or nil.
+func (rs ruleSet) match(namespace, podType string, now time.Time) *rule {
+	if matches := rs.matchAll(namespace, podType, now); len(matches) > 0 {
+		return matches[0]
+	}
+	return nil
+}
+
+// dryRun reports whether the rule called name is in dry-run.
+func (rs ruleSet) dryRun(name string) bool {
+	for _, r := range rs {
+		if r.Name == name {
+			return r.DryRun
+		}
+	}
+	return false
+}
+
+func denyMessage(r *rule, networks []string) string {
+	msg := fmt.Sprintf("default-route requested on network(s) %s is not allowed by rule %s", strings.Join(networks, ", "), r.Name)
+	if r.Message != "" {
+		msg += ": " + r.Message
+	}
+	return msg
+}
+
+var (
+	ruleDecisions = newCounterVec(prometheus.CounterOpts{
+		Name: "gateway_yeeter_rule_decisions_total",
+		Help: "Decisions made by a rule, by rule name and outcome.",
+	}, "rule", "outcome")
+	rulesLoaded = newGaugeVec(prometheus.GaugeOpts{
+		Name: "gateway_yeeter_rules_loaded",
+		Help: "Always 1 for every loaded rule, labelled with its name, action and a hash of its definition.",
+	}, "rule", "action", "hash")
+)
+
+func (r rule) hash() string {
+	raw, _ := json.Marshal(r)
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:6])
+}
+
+// exportRules replaces the rules_loaded series with the rules of rs.
+func exportRules(rs ruleSet) {
+	rulesLoaded.Reset()
+	for _, r := range rs {
+		rulesLoaded.WithLabelValues(r.Name, r.Action, r.hash()).Set(1)
+	}
+}
+
+var ruleDivergences = newCounterVec(prometheus.CounterOpts{
+	Name: "gateway_yeeter_rule_divergences_total",
+	Help: "Reviews where the rules would have produced a different result than the legacy strip-everything logic, by rule and outcomes.",
+}, "rule", "legacy_outcome", "rules_outcome")
+
+// compareRuleEngine evaluates the pod again with the configured rules and
+// reports where the result differs from the applied legacy decision d.
+func compareRuleEngine(ar *admissionv1.AdmissionReview, d *decision) {
+	rules := ruleSources.current()
+	if len(rules) == 0 || d.PodType == "" {
+		return
+	}
+	withRules := newDecision(ar)
+	evaluatePod(ar, withRules, rules)
+	if withRules.Outcome == d.Outcome && withRules.Patch == d.Patch {
+		return
+	}
+	ruleDivergences.WithLabelValues(withRules.Rule, d.Outcome, withRules.Outcome).Inc()
+	d.RulesOutcome = withRules.Outcome
+
+	detail := cfg.Redaction.value(channelLogs, fieldPatch, withRules.Patch)
+	if withRules.Outcome == outcomeDenied {
+		detail = cfg.Redaction.value(channelLogs, fieldNetworks, withRules.Message)
+	}
+	klog.Warningf("Rule %s diverges from the legacy logic for %s pod %s/%s (uid=%s): applied %s, rules would have %s: %s", withRules.Rule, d.PodType,
+		cfg.Redaction.value(channelLogs, fieldNamespace, d.Namespace), cfg.Redaction.value(channelLogs, fieldPod, d.Pod), d.UID, d.Outcome, withRules.Outcome, detail)
+}
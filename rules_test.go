@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func testImporterReview(namespace, networks string) *admissionv1.AdmissionReview {
+	rawPod, _ := json.Marshal(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "importer-test",
+			Namespace:   namespace,
+			Labels:      map[string]string{"app": "containerized-data-importer"},
+			Annotations: map[string]string{"k8s.v1.cni.cncf.io/networks": networks},
+		},
+	})
+	return &admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{UID: "test", Namespace: namespace, Object: runtime.RawExtension{Raw: rawPod}},
+	}
+}
+
+func reviewRulesPod(t *testing.T, namespace, networks string) (*admissionv1.AdmissionResponse, *decision) {
+	ar := testImporterReview(namespace, networks)
+	d := newDecision(ar)
+	return evaluatePod(ar, d, cfg.Rules), d
+}
+
+func TestLoadRules(t *testing.T) {
+	file := writeTestFile(t, "rules.yaml", `
+rules:
+- name: platform
+  namespaces: ["team-*"]
+  action: deny
+  message: use the transfer network without a gateway
+- name: default
+  action: strip
+`)
+	rules, err := loadRules(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := rules.match("team-a", "cdi", time.Now()); r == nil || r.Name != "platform" {
+		t.Fatalf("expected platform rule, got %+v", r)
+	}
+	if r := rules.match("openshift-mtv", "cdi", time.Now()); r == nil || r.Name != "default" {
+		t.Fatalf("expected default rule, got %+v", r)
+	}
+
+	for name, content := range map[string]string{
+		"unknown field":  "rules:\n- name: a\n  action: strip\n  namespace: x\n",
+		"unknown action": "rules:\n- name: a\n  action: yeet\n",
+		"missing name":   "rules:\n- action: deny\n",
+		"duplicate name": "rules:\n- name: a\n  action: deny\n- name: a\n  action: strip\n",
+		"bad pattern":    "rules:\n- name: a\n  action: deny\n  namespaces: [\"[\"]\n",
+		"bad pod type":   "rules:\n- name: a\n  action: deny\n  podTypes: [vm]\n",
+	} {
+		if _, err := loadRules(writeTestFile(t, "rules.yaml", content)); err == nil {
+			t.Fatalf("%s: expected rules to be rejected", name)
+		}
+	}
+}
+
+func TestRuleMatchesPodType(t *testing.T) {
+	rules := ruleSet{{Name: "v2v", PodTypes: []string{"virt-v2v"}, Action: actionDeny}}
+	if rules.match("test", "cdi", time.Now()) != nil {
+		t.Fatal("expected cdi pod not to match a virt-v2v rule")
+	}
+	if rules.match("test", "virt-v2v", time.Now()) == nil {
+		t.Fatal("expected virt-v2v pod to match")
+	}
+}
+
+func TestReviewPodDenyRule(t *testing.T) {
+	old := cfg
+	cfg.Rules = ruleSet{{Name: "platform", Namespaces: []string{"team-*"}, Action: actionDeny, Message: "see the migration guide"}}
+	defer func() { cfg = old }()
+
+	resp, d := reviewRulesPod(t, "team-a", `[{"name":"transfer","default-route":["10.0.0.1"]},{"name":"storage"}]`)
+	if resp.Allowed || resp.Result == nil || resp.Result.Code != 403 {
+		t.Fatalf("expected pod to be denied, got %+v", resp)
+	}
+	if !strings.Contains(resp.Result.Message, "/transfer") || !strings.HasSuffix(resp.Result.Message, "see the migration guide") {
+		t.Fatalf("unexpected message %q", resp.Result.Message)
+	}
+	if d.Outcome != outcomeDenied || d.Rule != "platform" || len(d.Networks) != 1 {
+		t.Fatalf("unexpected decision %+v", d)
+	}
+
+	resp, d = reviewRulesPod(t, "team-a", `[{"name":"storage"}]`)
+	if !resp.Allowed || d.Outcome != outcomeUnchanged {
+		t.Fatalf("expected pod without default routes to be allowed, got %+v", d)
+	}
+
+	resp, d = reviewRulesPod(t, "mtv-prod", `[{"name":"transfer","default-route":["10.0.0.1"]}]`)
+	if !resp.Allowed || d.Outcome != outcomeMutated || d.Rule != "" {
+		t.Fatalf("expected pod outside the rule to be stripped, got %+v", d)
+	}
+}
+
+func TestLoadRulesInjection(t *testing.T) {
+	for name, content := range map[string]string{
+		"missing attachment": "rules:\n- name: a\n  action: inject\n  gateway: 10.0.0.1\n",
+		"nothing to inject":  "rules:\n- name: a\n  action: inject\n  attachment: transfer\n",
+		"default route":      "rules:\n- name: a\n  action: inject\n  attachment: transfer\n  routes: [{dst: 0.0.0.0/0, gw: 10.0.0.1}]\n",
+		"bad gateway":        "rules:\n- name: a\n  action: inject\n  attachment: transfer\n  gateway: nope\n",
+		"not inject":         "rules:\n- name: a\n  action: strip\n  gateway: 10.0.0.1\n",
+	} {
+		if _, err := loadRules(writeTestFile(t, "rules.yaml", content)); err == nil {
+			t.Fatalf("%s: expected rules to be rejected", name)
+		}
+	}
+}
+
+func TestReviewPodCompareRules(t *testing.T) {
+	old, oldDecisions := cfg, recentDecisions
+	cfg.CompareRules = true
+	cfg.Rules = ruleSet{{Name: "platform", Namespaces: []string{"team-*"}, Action: actionDeny}}
+	recentDecisions = newDecisionLog(10)
+	defer func() { cfg, recentDecisions = old, oldDecisions }()
+
+	networks := `[{"name":"transfer","default-route":["10.0.0.1"]}]`
+	resp := reviewPod(testImporterReview("team-a", networks))
+	if !resp.Allowed || len(resp.Patch) == 0 {
+		t.Fatalf("expected the legacy result to be applied, got %+v", resp)
+	}
+	reviewPod(testImporterReview("openshift-mtv", networks))
+
+	records := recentDecisions.list()
+	if records[1].RulesOutcome != outcomeDenied || records[1].Outcome != outcomeMutated {
+		t.Fatalf("expected divergence to be recorded, got %+v", records[1])
+	}
+	if records[0].RulesOutcome != "" {
+		t.Fatalf("expected no divergence outside the rule, got %+v", records[0])
+	}
+}
+
+func TestRuleActiveWindow(t *testing.T) {
+	rules, err := loadRules(writeTestFile(t, "rules.yaml", `
+rules:
+- name: migration-window
+  action: strip
+  activeFrom: 2026-10-17T20:00:00Z
+  activeUntil: "2026-10-18T06:00:00Z"
+- name: stand-down
+  action: ignore
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for at, want := range map[string]string{
+		"2026-10-17T19:59:59Z": "stand-down",
+		"2026-10-17T20:00:00Z": "migration-window",
+		"2026-10-18T05:59:59Z": "migration-window",
+		"2026-10-18T06:00:00Z": "stand-down",
+	} {
+		now, _ := time.Parse(time.RFC3339, at)
+		if r := rules.match("test", "cdi", now); r == nil || r.Name != want {
+			t.Fatalf("at %s: expected rule %s, got %+v", at, want, r)
+		}
+	}
+
+	if _, err := loadRules(writeTestFile(t, "rules.yaml", "rules:\n- name: a\n  action: strip\n  activeFrom: 2026-10-18T06:00:00Z\n  activeUntil: 2026-10-17T20:00:00Z\n")); err == nil {
+		t.Fatal("expected an empty window to be rejected")
+	}
+}
+
+func TestReviewPodIgnoreRule(t *testing.T) {
+	rules := ruleSet{{Name: "stand-down", Action: actionIgnore}}
+	ar := testImporterReview("test", `[{"name":"transfer","default-route":["10.0.0.1"]}]`)
+	d := newDecision(ar)
+	resp := evaluatePod(ar, d, rules)
+	if !resp.Allowed || len(resp.Patch) != 0 || d.Outcome != outcomeSkipped || d.Rule != "stand-down" {
+		t.Fatalf("expected pod to be left unmodified, got %+v", d)
+	}
+}
+
+func TestRuleMetrics(t *testing.T) {
+	defer rulesLoaded.Reset()
+	defer ruleDecisions.Reset()
+	rules := ruleSet{
+		{Name: "platform", Namespaces: []string{"team-*"}, Action: actionDeny},
+		{Name: "everything-else", Action: actionStrip},
+	}
+	exportRules(rules)
+	if got := testutil.ToFloat64(rulesLoaded.WithLabelValues("platform", actionDeny, rules[0].hash())); got != 1 {
+		t.Fatalf("expected loaded rule series, got %v", got)
+	}
+	changed := rules[0]
+	changed.Message = "see the migration guide"
+	if changed.hash() == rules[0].hash() {
+		t.Fatal("expected the hash to change with the rule definition")
+	}
+	exportRules(rules[1:])
+	if got := testutil.CollectAndCount(rulesLoaded); got != 1 {
+		t.Fatalf("expected removed rules to be dropped, got %d series", got)
+	}
+
+	ruleDecisions.Reset()
+	recordDecision(&decision{Time: time.Now(), Rule: "platform", Outcome: outcomeDenied})
+	recordDecision(&decision{Time: time.Now(), Outcome: outcomeMutated})
+	if got := testutil.ToFloat64(ruleDecisions.WithLabelValues("platform", outcomeDenied)); got != 1 {
+		t.Fatalf("expected one decision for rule platform, got %v", got)
+	}
+	if got := testutil.CollectAndCount(ruleDecisions); got != 1 {
+		t.Fatalf("expected decisions without a rule not to be counted, got %d series", got)
+	}
+}
+
+func TestReviewPodRemoveAnnotationsRule(t *testing.T) {
+	rawPod, _ := json.Marshal(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "importer-test",
+			Namespace: "test",
+			Labels:    map[string]string{"app": "containerized-data-importer"},
+			Annotations: map[string]string{
+				"k8s.v1.cni.cncf.io/networks":                 `[{"name":"storage"}]`,
+				"scheduler.alpha.kubernetes.io/node-selector": "zone=a",
+				"security.alpha.kubernetes.io/unsafe-sysctls": "net.ipv4.ip_forward=1",
+				"cdi.kubevirt.io/storage.import.source":       "http",
+			},
+		},
+	})
+	ar := &admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{UID: "test", Namespace: "test", Object: runtime.RawExtension{Raw: rawPod}},
+	}
+	rules := ruleSet{{Name: "hygiene", Action: actionStrip, RemoveAnnotations: []string{"scheduler.alpha.kubernetes.io/*", "security.alpha.kubernetes.io/unsafe-sysctls"}}}
+	d := newDecision(ar)
+	resp := evaluatePod(ar, d, rules)
+	want := `[{"op":"remove","path":"/metadata/annotations/scheduler.alpha.kubernetes.io~1node-selector"},{"op":"remove","path":"/metadata/annotations/security.alpha.kubernetes.io~1unsafe-sysctls"}]`
+	if string(resp.Patch) != want || d.Outcome != outcomeMutated || len(d.RemovedAnnotations) != 2 {
+		t.Fatalf("expected annotations to be removed, got %s (%+v)", resp.Patch, d)
+	}
+
+	for _, invalid := range []rule{
+		{Name: "a", Action: actionIgnore, RemoveAnnotations: []string{"example.com/*"}},
+		{Name: "a", Action: actionStrip, RemoveAnnotations: []string{"k8s.v1.cni.cncf.io/*"}},
+		{Name: "a", Action: actionStrip, RemoveAnnotations: []string{"["}},
+	} {
+		if err := (ruleSet{invalid}).validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", invalid)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
+)
+
+const (
+	ruleSourceRuleSet   = "ruleset"
+	ruleSourceConfigMap = "configmap"
+	ruleSourceFile      = "file"
+	ruleSourceDefault   = "default"
+
+	rulesConfigMapKey = "rules.yaml"
+	ruleSourceTimeout = 5 * time.Second
+	ruleSetKind       = "GatewayYeetRuleSet"
+)
+
+var ruleSetGVR = schema.GroupVersionResource{Group: crdGroup, Version: crdStorageVersion, Resource: "gatewayyeetrulesets"}
+
+// ruleSourcePrecedence lists the rule sources from the highest to the
+// lowest precedence.
+var ruleSourcePrecedence = []string{ruleSourceRuleSet, ruleSourceConfigMap, ruleSourceFile, ruleSourceDefault}
+
+// ruleLayer holds the rules read from one origin: a GatewayYeetRuleSet, a
+// ConfigMap or the rules file.
+type ruleLayer struct {
+	Source string  `json:"source"`
+	Origin string  `json:"origin,omitempty"`
+	Rules  ruleSet `json:"rules"`
+	Error  string  `json:"error,omitempty"`
+}
+
+type overriddenRule struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	Origin string `json:"origin,omitempty"`
+	By     string `json:"by"`
+}
+
+// mergedRules is the /configz view of the rule sources and their result.
+type mergedRules struct {
+	Precedence []string         `json:"precedence"`
+	Layers     []ruleLayer      `json:"layers"`
+	Overridden []overriddenRule `json:"overridden,omitempty"`
+	Hash       string           `json:"hash"`
+	Rules      ruleSet          `json:"rules"`
+}
+
+// mergeRuleLayers concatenates the rules of layers in order of precedence,
+// keeping the order within each layer, so the first match still wins. A rule
+// named like a rule of a layer with higher precedence is overridden.
+func mergeRuleLayers(layers []ruleLayer) mergedRules {
+	rank := make(map[string]int)
+	for i, source := range ruleSourcePrecedence {
+		rank[source] = i
+	}
+	sorted := append([]ruleLayer(nil), layers...)
+	sort.SliceStable(sorted, func(i, j int) bool { return rank[sorted[i].Source] < rank[sorted[j].Source] })
+
+	m := mergedRules{Precedence: ruleSourcePrecedence, Layers: sorted, Rules: ruleSet{}}
+	from := make(map[string]ruleLayer)
+	for _, layer := range sorted {
+		for _, r := range layer.Rules {
+			if winner, exists := from[r.Name]; exists {
+				m.Overridden = append(m.Overridden, overriddenRule{Name: r.Name, Source: layer.Source, Origin: layer.Origin, By: winner.Source + " " + winner.Origin})
+				continue
+			}
+			from[r.Name] = layer
+			m.Rules = append(m.Rules, r)
+		}
+	}
+	raw, _ := json.Marshal(m.Rules)
+	sum := sha256.Sum256(raw)
+	m.Hash = hex.EncodeToString(sum[:6])
+	return m
+}
+
+func staticRuleLayers(c config) []ruleLayer {
+	layers := []ruleLayer{{Source: ruleSourceDefault, Origin: "built-in", Rules: ruleSet{}}}
+	if c.RulesFile != "" || len(c.Rules) > 0 {
+		layers = append(layers, ruleLayer{Source: ruleSourceFile, Origin: c.RulesFile, Rules: c.Rules})
+	}
+	return layers
+}
+
+// ruleSourceWatcher periodically reads the rules of the ConfigMaps and
+// GatewayYeetRuleSets and merges them with the rules file.
+type ruleSourceWatcher struct {
+	configMaps []string
+	ruleSets   bool
+
+	mu     sync.Mutex
+	layers map[string]ruleLayer
+	merged mergedRules
+	synced bool
+}
+
+var ruleSources *ruleSourceWatcher
+
+func newRuleSourceWatcher(c config) *ruleSourceWatcher {
+	w := &ruleSourceWatcher{configMaps: c.RulesConfigMaps, ruleSets: c.RulesPolicies, layers: make(map[string]ruleLayer)}
+	w.merged = mergeRuleLayers(staticRuleLayers(c))
+	return w
+}
+
+func (w *ruleSourceWatcher) run(interval time.Duration) {
+	if w == nil {
+		return
+	}
+	w.refresh(actorRefresh)
+	for range time.Tick(interval) {
+		w.refresh(actorRefresh)
+	}
+}
+
+// refresh reads the rule sources, attributing changes to actor.
+func (w *ruleSourceWatcher) refresh(actor string) {
+	next := make(map[string]ruleLayer)
+	w.mu.Lock()
+	for key, layer := range w.layers {
+		next[key] = layer
+	}
+	w.mu.Unlock()
+
+	for _, ref := range w.configMaps {
+		key := ruleSourceConfigMap + " " + ref
+		layer, err := readConfigMapRules(ref)
+		if err != nil {
+			// Keep the last valid rules, neither an API server hiccup nor a
+			// typo in the document must drop them.
+			klog.Warningf("Could not read rules from ConfigMap %s: %v", ref, err)
+			layer = keepRules(next[key], layer, err.Error())
+		}
+		next[key] = layer
+	}
+	if w.ruleSets {
+		ruleSets, err := readRuleSets()
+		if err != nil {
+			klog.Warningf("Could not list %s objects: %v", ruleSetKind, err)
+		} else {
+			previous := make(map[string]ruleLayer)
+			for key, layer := range next {
+				if layer.Source == ruleSourceRuleSet {
+					previous[key] = layer
+					delete(next, key)
+				}
+			}
+			for _, layer := range ruleSets {
+				key := ruleSourceRuleSet + " " + layer.Origin
+				if layer.Error != "" {
+					klog.Warningf("Invalid %s %s: %s", ruleSetKind, layer.Origin, layer.Error)
+					layer = keepRules(previous[key], layer, layer.Error)
+				}
+				next[key] = layer
+			}
+		}
+	}
+	w.update(next, actor)
+}
+
+// keepRules returns failed with the rules of the last read of the same
+// origin and the error message.
+func keepRules(last, failed ruleLayer, message string) ruleLayer {
+	if last.Rules != nil {
+		failed.Rules = last.Rules
+	}
+	failed.Error = message
+	return failed
+}
+
+func (w *ruleSourceWatcher) update(layers map[string]ruleLayer, actor string) {
+	all := staticRuleLayers(cfg)
+	for _, ref := range w.configMaps {
+		if layer, exists := layers[ruleSourceConfigMap+" "+ref]; exists {
+			all = append(all, layer)
+		}
+	}
+	var ruleSets []string
+	for key, layer := range layers {
+		if layer.Source == ruleSourceRuleSet {
+			ruleSets = append(ruleSets, key)
+		}
+	}
+	sort.Strings(ruleSets)
+	for _, key := range ruleSets {
+		all = append(all, layers[key])
+	}
+	merged := mergeRuleLayers(all)
+
+	w.mu.Lock()
+	old := w.merged.Hash
+	if merged.Hash != old {
+		klog.Infof("Merged rules changed to %s: %d rule(s), %d overridden", merged.Hash, len(merged.Rules), len(merged.Overridden))
+		for _, o := range merged.Overridden {
+			klog.Infof("Rule %s of %s %s is overridden by %s", o.Name, o.Source, o.Origin, o.By)
+		}
+		exportRules(merged.Rules)
+	}
+	w.layers, w.merged, w.synced = layers, merged, true
+	w.mu.Unlock()
+
+	if merged.Hash != old {
+		auditPolicyChange(changeSourceRules, actor, old, merged.Hash, merged.Rules)
+	}
+}
+
+// hash returns the hash of the merged rules. Without rule sources the rules
+// are part of the configuration hash.
+func (w *ruleSourceWatcher) hash() string {
+	if w == nil {
+		return ""
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.merged.Hash
+}
+
+// hasSynced reports whether the sources were read at least once.
+func (w *ruleSourceWatcher) hasSynced() bool {
+	if w == nil {
+		return true
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.synced
+}
+
+// current returns the merged rules, or the rules file without other sources.
+func (w *ruleSourceWatcher) current() ruleSet {
+	if w == nil {
+		return cfg.Rules
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.merged.Rules
+}
+
+func (w *ruleSourceWatcher) view() mergedRules {
+	if w == nil {
+		return mergeRuleLayers(staticRuleLayers(cfg))
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.merged
+}
+
+// readConfigMapRules reads the rules document in the rules.yaml key of the
+// ConfigMap ref. A deleted ConfigMap contributes no rules.
+func readConfigMapRules(ref string) (ruleLayer, error) {
+	layer := ruleLayer{Source: ruleSourceConfigMap, Origin: ref, Rules: ruleSet{}}
+	namespace, name, _ := strings.Cut(ref, "/")
+	client, err := kube.typedFor(lookupRules)
+	if err != nil {
+		return layer, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ruleSourceTimeout)
+	defer cancel()
+	cm, err := client.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		layer.Error = "not found"
+		return layer, nil
+	}
+	if err != nil {
+		return layer, err
+	}
+	raw, exists := cm.Data[rulesConfigMapKey]
+	if !exists {
+		layer.Error = "no " + rulesConfigMapKey + " key"
+		return layer, nil
+	}
+	rules, err := parseRules([]byte(raw), "ConfigMap "+ref)
+	if err != nil {
+		return layer, err
+	}
+	layer.Rules = rules
+	return layer, nil
+}
+
+// readRuleSets returns one layer per GatewayYeetRuleSet. The spec of a
+// rule set has the layout of the rules file.
+func readRuleSets() ([]ruleLayer, error) {
+	client, err := kube.dynamicFor(lookupRules)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ruleSourceTimeout)
+	defer cancel()
+	list, err := client.Resource(ruleSetGVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var layers []ruleLayer
+	for _, item := range list.Items {
+		layer := ruleLayer{Source: ruleSourceRuleSet, Origin: item.GetName(), Rules: ruleSet{}}
+		spec, err := json.Marshal(item.Object["spec"])
+		if err == nil {
+			var rules ruleSet
+			if rules, err = parseRules(spec, ruleSetKind+" "+item.GetName()); err == nil {
+				layer.Rules = rules
+			}
+		}
+		if err != nil {
+			layer.Error = err.Error()
+		}
+		layers = append(layers, layer)
+	}
+	return layers, nil
+}
+
+// ruleSetCRD renders the CustomResourceDefinition of GatewayYeetRuleSet. The
+// rules are validated by the webhook when it reads them, so the schema only
+// describes the layout, which is the same in every version.
+func ruleSetCRD(labels map[string]string, o manifestOptions) map[string]interface{} {
+	object := func(properties map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"type": "object", "properties": properties}
+	}
+	rule := map[string]interface{}{"type": "object", "x-kubernetes-preserve-unknown-fields": true}
+	schema := object(map[string]interface{}{
+		"spec": object(map[string]interface{}{
+			"rules": map[string]interface{}{"type": "array", "items": rule},
+		}),
+	})
+	return map[string]interface{}{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata": map[string]interface{}{
+			"name":        ruleSetGVR.Resource + "." + ruleSetGVR.Group,
+			"labels":      labels,
+			"annotations": map[string]string{"service.beta.openshift.io/inject-cabundle": "true"},
+		},
+		"spec": map[string]interface{}{
+			"group": ruleSetGVR.Group,
+			"names": map[string]interface{}{
+				"kind":     ruleSetKind,
+				"listKind": ruleSetKind + "List",
+				"plural":   ruleSetGVR.Resource,
+				"singular": strings.ToLower(ruleSetKind),
+			},
+			"scope":      "Cluster",
+			"versions":   crdVersions(map[string]map[string]interface{}{crdVersionAlpha: schema, crdVersionBeta: schema}),
+			"conversion": conversionStrategy(o),
+		},
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func ruleNames(rs ruleSet) []string {
+	names := []string{}
+	for _, r := range rs {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+func TestMergeRuleLayers(t *testing.T) {
+	merged := mergeRuleLayers([]ruleLayer{
+		{Source: ruleSourceDefault, Origin: "built-in", Rules: ruleSet{}},
+		{Source: ruleSourceFile, Origin: "/etc/rules.yaml", Rules: ruleSet{{Name: "prod", Action: actionStrip}, {Name: "lab", Action: actionIgnore}}},
+		{Source: ruleSourceConfigMap, Origin: "mtv/rules", Rules: ruleSet{{Name: "prod", Action: actionDeny}, {Name: "staging", Action: actionStrip}}},
+		{Source: ruleSourceRuleSet, Origin: "freeze", Rules: ruleSet{{Name: "freeze", Action: actionDeny}}},
+	})
+	if want := []string{"freeze", "prod", "staging", "lab"}; !reflect.DeepEqual(ruleNames(merged.Rules), want) {
+		t.Fatalf("expected merged rules %v, got %v", want, ruleNames(merged.Rules))
+	}
+	if merged.Rules[1].Action != actionDeny {
+		t.Fatalf("expected the ConfigMap rule to override the rules file, got %+v", merged.Rules[1])
+	}
+	if len(merged.Overridden) != 1 || merged.Overridden[0] != (overriddenRule{Name: "prod", Source: ruleSourceFile, Origin: "/etc/rules.yaml", By: "configmap mtv/rules"}) {
+		t.Fatalf("unexpected overridden rules %+v", merged.Overridden)
+	}
+	if merged.Layers[0].Source != ruleSourceRuleSet || merged.Layers[3].Source != ruleSourceDefault {
+		t.Fatalf("expected layers in order of precedence, got %+v", merged.Layers)
+	}
+	if merged.Hash == mergeRuleLayers(nil).Hash {
+		t.Fatal("expected the hash to depend on the rules")
+	}
+}
+
+func TestRuleSourceWatcher(t *testing.T) {
+	oldCfg := cfg
+	defer func() { cfg = oldCfg }()
+	cfg = defaultConfig()
+	cfg.RulesFile, cfg.Rules = "/etc/rules.yaml", ruleSet{{Name: "prod", Action: actionStrip}}
+
+	typed := fake.NewClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "mtv", Name: "rules"},
+		Data:       map[string]string{rulesConfigMapKey: "rules:\n- name: prod\n  action: deny\n"},
+	})
+	ruleSet := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": ruleSetGVR.GroupVersion().String(),
+		"kind":       ruleSetKind,
+		"metadata":   map[string]interface{}{"name": "freeze"},
+		"spec":       map[string]interface{}{"rules": []interface{}{map[string]interface{}{"name": "freeze", "action": "ignore", "podTypes": []interface{}{"cdi"}}}},
+	}}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{ruleSetGVR: ruleSetKind + "List"}, ruleSet)
+	old := kube
+	kube = &kubeClients{
+		typed:   map[lookupCategory]kubernetes.Interface{lookupRules: typed},
+		dynamic: map[lookupCategory]dynamic.Interface{lookupRules: dynamicClient},
+	}
+	defer func() { kube = old }()
+
+	cfg.RulesConfigMaps, cfg.RulesPolicies = stringList{"mtv/rules", "mtv/missing"}, true
+	w := newRuleSourceWatcher(cfg)
+	if got := ruleNames(w.current()); !reflect.DeepEqual(got, []string{"prod"}) {
+		t.Fatalf("expected the rules file before the first refresh, got %v", got)
+	}
+	var audit bytes.Buffer
+	auditor = &auditLog{w: &audit}
+	defer func() { auditor = nil }()
+	before := w.view().Hash
+	w.refresh("test")
+	var record configChangeRecord
+	if err := json.Unmarshal(audit.Bytes(), &record); err != nil || record.Source != changeSourceRules || record.Actor != "test" || record.OldHash != before || record.NewHash != w.view().Hash {
+		t.Fatalf("expected a ConfigChange record of the rule sources, got %+v: %v", record, err)
+	}
+	rules := w.current()
+	if got := ruleNames(rules); !reflect.DeepEqual(got, []string{"freeze", "prod"}) || rules[1].Action != actionDeny {
+		t.Fatalf("expected the rule set and the ConfigMap rule, got %+v", rules)
+	}
+	if view := w.view(); len(view.Layers) != 5 || view.Layers[2].Error != "not found" {
+		t.Fatalf("expected the missing ConfigMap to be reported, got %+v", view.Layers)
+	}
+
+	// An invalid document keeps the last valid rules of the ConfigMap.
+	cm, _ := typed.CoreV1().ConfigMaps("mtv").Get(context.Background(), "rules", metav1.GetOptions{})
+	cm.Data[rulesConfigMapKey] = "rules:\n- name: prod\n  action: yeet\n"
+	typed.CoreV1().ConfigMaps("mtv").Update(context.Background(), cm, metav1.UpdateOptions{})
+	w.refresh("test")
+	if rules := w.current(); len(rules) != 2 || rules[1].Action != actionDeny {
+		t.Fatalf("expected the last valid ConfigMap rules to be kept, got %+v", rules)
+	}
+	if view := w.view(); view.Layers[1].Error == "" {
+		t.Fatalf("expected the invalid ConfigMap to be reported, got %+v", view.Layers[1])
+	}
+
+	// Deleted rule sets no longer contribute rules.
+	dynamicClient.Resource(ruleSetGVR).Delete(context.Background(), "freeze", metav1.DeleteOptions{})
+	w.refresh("test")
+	if got := ruleNames(w.current()); !reflect.DeepEqual(got, []string{"prod"}) {
+		t.Fatalf("expected the deleted rule set to be dropped, got %v", got)
+	}
+}
+
+func TestRenderManifestsRulesPolicies(t *testing.T) {
+	c := defaultConfig()
+	c.RulesPolicies = true
+	c.RulesConfigMaps = stringList{"mtv/rules"}
+	objects := renderedObjects(t, c)
+	if objects[0]["kind"] != "CustomResourceDefinition" || objects[0]["metadata"].(map[string]interface{})["name"] != "gatewayyeetrulesets.gateway.yeet" {
+		t.Fatalf("expected the rule set CRD first, got %v", objects[0])
+	}
+	if names := objectNames(objects, "ClusterRole"); !reflect.DeepEqual(names, []string{"ClusterRole gateway-yeeter-rules"}) {
+		t.Fatalf("expected a rules ClusterRole, got %v", names)
+	}
+}
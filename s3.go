@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+)
+
+const (
+	s3RequestTimeout    = time.Minute
+	s3RetentionInterval = time.Hour
+	s3ListPageSize      = 1000
+)
+
+var s3Records = newCounterVec(prometheus.CounterOpts{
+	Name: "gateway_yeeter_s3_records_total",
+	Help: "Decision records handled by the S3 exporter, by result (uploaded, dropped).",
+}, "result")
+
+var s3BufferedBytes = newGauge(prometheus.GaugeOpts{
+	Name: "gateway_yeeter_s3_buffered_bytes",
+	Help: "Bytes of decision records buffered on disk waiting to be uploaded to S3.",
+})
+
+var s3ObjectsExpired = newCounter(prometheus.CounterOpts{
+	Name: "gateway_yeeter_s3_objects_expired_total",
+	Help: "Batch objects deleted from S3 after --s3-retention.",
+})
+
+// s3Exporter uploads spooled decision records as gzip compressed NDJSON
+// objects to S3-compatible object storage, one object per segment, and
+// deletes objects older than the retention below its prefix.
+type s3Exporter struct {
+	*spool
+	endpoint  *url.URL
+	bucket    string
+	region    string
+	prefix    string
+	retention time.Duration
+	keyID     string
+	secret    string
+	client    *http.Client
+	now       func() time.Time
+
+	lastExpiry time.Time
+}
+
+var objectExporter *s3Exporter
+
+func newS3Exporter(c config) (*s3Exporter, error) {
+	if c.S3Endpoint == "" {
+		return nil, nil
+	}
+	client, err := c.S3TLS.httpClient(s3RequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(c.S3Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	e := &s3Exporter{
+		endpoint:  endpoint,
+		bucket:    c.S3Bucket,
+		region:    c.S3Region,
+		prefix:    c.S3Prefix,
+		retention: c.S3Retention,
+		keyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secret:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		client:    client,
+		now:       time.Now,
+	}
+	for file, value := range map[string]*string{c.S3AccessKeyIDFile: &e.keyID, c.S3SecretAccessKeyFile: &e.secret} {
+		if file == "" {
+			continue
+		}
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		*value = strings.TrimSpace(string(raw))
+	}
+	if e.keyID == "" || e.secret == "" {
+		return nil, fmt.Errorf("no S3 credentials, set --s3-access-key-id-file and --s3-secret-access-key-file or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	e.spool, err = newSpool("S3", c.S3BufferDir, c.S3BatchSize, c.S3MaxBufferBytes, s3Records.WithLabelValues("dropped"), s3BufferedBytes)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *s3Exporter) enqueue(record interface{}) {
+	if e == nil {
+		return
+	}
+	e.spool.enqueue(record)
+}
+
+func (e *s3Exporter) run(flushInterval time.Duration) {
+	if e == nil {
+		return
+	}
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	backoff := time.Duration(0)
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.wake:
+		}
+		if backoff > 0 {
+			time.Sleep(backoff)
+		}
+		if err := e.flush(); err != nil {
+			backoff = min(max(2*backoff, esMinBackoff), esMaxBackoff)
+			klog.Warningf("Could not export decisions to S3, retrying in %s: %v", backoff, err)
+			continue
+		}
+		backoff = 0
+		if e.retention > 0 && e.now().Sub(e.lastExpiry) >= s3RetentionInterval {
+			if err := e.expire(); err != nil {
+				klog.Warningf("Could not delete expired S3 batches: %v", err)
+			}
+			e.lastExpiry = e.now()
+		}
+	}
+}
+
+func (e *s3Exporter) flush() error {
+	return e.drain(e.upload)
+}
+
+// objectKey names the object of a spool segment. It is derived from the
+// segment, so uploading a segment again after a failure overwrites the same
+// object. Replicas are told apart by their pod name.
+func (e *s3Exporter) objectKey(segment string) string {
+	base := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(segment), spoolSegmentPrefix), ".ndjson")
+	created := e.now()
+	var nanos, seq int64
+	if _, err := fmt.Sscanf(base, "%d-%d", &nanos, &seq); err == nil {
+		created = time.Unix(0, nanos)
+	}
+	replica := identity.Pod
+	if replica == "" {
+		replica = "gateway-yeeter"
+	}
+	return fmt.Sprintf("%s%s/%s-%s.ndjson.gz", e.prefix, created.UTC().Format("2006/01/02"), replica, base)
+}
+
+func (e *s3Exporter) upload(segment string) error {
+	raw, err := os.ReadFile(segment)
+	if err != nil {
+		return err
+	}
+	records := bytes.Count(raw, []byte{'\n'})
+	if records == 0 {
+		return nil
+	}
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	zw.Write(raw)
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	key := e.objectKey(segment)
+	header := http.Header{"Content-Type": {"application/gzip"}}
+	if _, err := e.do(http.MethodPut, key, nil, header, body.Bytes()); err != nil {
+		return fmt.Errorf("could not upload %s: %w", key, err)
+	}
+	s3Records.WithLabelValues("uploaded").Add(float64(records))
+	klog.V(2).Infof("Uploaded %d decision(s) to s3://%s/%s", records, e.bucket, key)
+	return nil
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// expire deletes the batch objects below the prefix that are older than the
+// retention.
+func (e *s3Exporter) expire() error {
+	cutoff := e.now().Add(-e.retention)
+	query := url.Values{"list-type": {"2"}, "prefix": {e.prefix}, "max-keys": {fmt.Sprint(s3ListPageSize)}}
+	for {
+		raw, err := e.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return fmt.Errorf("could not list s3://%s/%s: %w", e.bucket, e.prefix, err)
+		}
+		var page s3ListResult
+		if err := xml.Unmarshal(raw, &page); err != nil {
+			return fmt.Errorf("malformed list response: %w", err)
+		}
+		for _, object := range page.Contents {
+			if !strings.HasSuffix(object.Key, ".ndjson.gz") || !object.LastModified.Before(cutoff) {
+				continue
+			}
+			if _, err := e.do(http.MethodDelete, object.Key, nil, nil, nil); err != nil {
+				return fmt.Errorf("could not delete %s: %w", object.Key, err)
+			}
+			s3ObjectsExpired.Inc()
+			klog.V(2).Infof("Deleted expired batch s3://%s/%s", e.bucket, object.Key)
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return nil
+		}
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+}
+
+// do sends a signed path-style request for key in the bucket and returns the
+// response body.
+func (e *s3Exporter) do(method, key string, query url.Values, header http.Header, body []byte) ([]byte, error) {
+	u := *e.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + e.bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = s3URIEncode(u.Path, false)
+	u.RawQuery = s3CanonicalQuery(query)
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	signS3Request(req, body, e.keyID, e.secret, e.region, e.now())
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if resp.StatusCode/100 != 2 {
+		var s3Error struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		}
+		if xml.Unmarshal(respBody, &s3Error) == nil && s3Error.Code != "" {
+			return nil, fmt.Errorf("%s: %s: %s", resp.Status, s3Error.Code, s3Error.Message)
+		}
+		return nil, fmt.Errorf("request failed with %s", resp.Status)
+	}
+	return respBody, nil
+}
+
+// signS3Request adds an AWS Signature Version 4 Authorization header
+// covering the host and all headers already set on req.
+func signS3Request(req *http.Request, body []byte, keyID, secret, region string, now time.Time) {
+	now = now.UTC()
+	date, stamp := now.Format("20060102"), now.Format("20060102T150405Z")
+	payload := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payload[:]))
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payload[:]),
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := []byte("AWS4" + secret)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", keyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3URIEncode percent-encodes everything but the unreserved characters, as
+// Signature Version 4 requires, keeping slashes unless encodeSlash is set.
+func s3URIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, key := range keys {
+		for _, value := range query[key] {
+			parts = append(parts, s3URIEncode(key, true)+"="+s3URIEncode(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// keyWrapper encrypts the data keys of persisted records with a key
+// encryption key, which never leaves it. localKeyWrapper uses a key mounted
+// from a Secret; a KMS (Vault transit, AWS KMS, ...) implements the same
+// three methods with its encrypt and decrypt calls.
+type keyWrapper interface {
+	// keyID identifies the key encryption key in records.
+	keyID() string
+	wrap(dataKey []byte) ([]byte, error)
+	unwrap(wrapped []byte) ([]byte, error)
+}
+
+type localKeyWrapper struct {
+	aead cipher.AEAD
+	id   string
+}
+
+func newLocalKeyWrapper(key []byte) (*localKeyWrapper, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("record encryption key must be 32 bytes (AES-256), got %d", len(key))
+	}
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key)
+	return &localKeyWrapper{aead: aead, id: hex.EncodeToString(sum[:8])}, nil
+}
+
+func (w *localKeyWrapper) keyID() string {
+	return w.id
+}
+
+func (w *localKeyWrapper) wrap(dataKey []byte) ([]byte, error) {
+	nonce := make([]byte, w.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return w.aead.Seal(nonce, nonce, dataKey, []byte(w.id)), nil
+}
+
+func (w *localKeyWrapper) unwrap(wrapped []byte) ([]byte, error) {
+	if len(wrapped) < w.aead.NonceSize() {
+		return nil, errors.New("wrapped data key is too short")
+	}
+	nonce, ciphertext := wrapped[:w.aead.NonceSize()], wrapped[w.aead.NonceSize():]
+	return w.aead.Open(nil, nonce, ciphertext, []byte(w.id))
+}
+
+// recordCipher encrypts records with a data key generated at startup and
+// stores the data key, wrapped by the keyWrapper, in every record. Opening
+// records unwraps each data key once.
+type recordCipher struct {
+	wrapper    keyWrapper
+	aead       cipher.AEAD
+	wrappedKey []byte
+
+	mu       sync.Mutex
+	dataKeys map[string]cipher.AEAD
+}
+
+type encryptedRecord struct {
+	Kind       string `json:"kind"`
+	KeyID      string `json:"keyId"`
+	WrappedKey []byte `json:"wrappedKey,omitempty"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+func loadRecordCipher(path string) (*recordCipher, error) {
+	if path == "" {
+		return nil, nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read record encryption key: %w", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(raw)))
+	if err != nil {
+		return nil, fmt.Errorf("record encryption key %s is not base64 encoded: %w", path, err)
+	}
+	return newRecordCipher(key)
+}
+
+func newRecordCipher(key []byte) (*recordCipher, error) {
+	wrapper, err := newLocalKeyWrapper(key)
+	if err != nil {
+		return nil, err
+	}
+	return newEnvelopeCipher(wrapper)
+}
+
+func newEnvelopeCipher(wrapper keyWrapper) (*recordCipher, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	aead, err := newAESGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	wrappedKey, err := wrapper.wrap(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not wrap record data key with key %s: %w", wrapper.keyID(), err)
+	}
+	return &recordCipher{
+		wrapper:    wrapper,
+		aead:       aead,
+		wrappedKey: wrappedKey,
+		dataKeys:   map[string]cipher.AEAD{string(wrappedKey): aead},
+	}, nil
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (c *recordCipher) seal(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	keyID := c.wrapper.keyID()
+	return json.Marshal(encryptedRecord{
+		Kind:       "Encrypted",
+		KeyID:      keyID,
+		WrappedKey: c.wrappedKey,
+		Nonce:      nonce,
+		Ciphertext: c.aead.Seal(nil, nonce, plaintext, []byte(keyID)),
+	})
+}
+
+func (c *recordCipher) open(sealed []byte) ([]byte, error) {
+	var record encryptedRecord
+	if err := json.Unmarshal(sealed, &record); err != nil {
+		return nil, err
+	}
+	if record.Kind != "Encrypted" {
+		return sealed, nil
+	}
+	if keyID := c.wrapper.keyID(); record.KeyID != keyID {
+		return nil, fmt.Errorf("record was encrypted with key %s, have key %s", record.KeyID, keyID)
+	}
+	aead, err := c.dataKey(record.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, record.Nonce, record.Ciphertext, []byte(record.KeyID))
+}
+
+func (c *recordCipher) dataKey(wrappedKey []byte) (cipher.AEAD, error) {
+	// Records written before envelope encryption are encrypted with the
+	// local key itself.
+	if len(wrappedKey) == 0 {
+		if local, ok := c.wrapper.(*localKeyWrapper); ok {
+			return local.aead, nil
+		}
+		return nil, errors.New("record has no wrapped data key")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if aead, exists := c.dataKeys[string(wrappedKey)]; exists {
+		return aead, nil
+	}
+	dataKey, err := c.wrapper.unwrap(wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not unwrap record data key: %w", err)
+	}
+	aead, err := newAESGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	c.dataKeys[string(wrappedKey)] = aead
+	return aead, nil
+}
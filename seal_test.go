@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func newTestRecordCipher(t *testing.T, fill byte) *recordCipher {
+	c, err := newRecordCipher(bytes.Repeat([]byte{fill}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRecordCipherRoundTrip(t *testing.T) {
+	c := newTestRecordCipher(t, 1)
+	plaintext := []byte(`{"kind":"Decision","namespace":"secret-ns"}`)
+
+	sealed, err := c.seal(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("secret-ns")) {
+		t.Fatal("expected sealed record not to contain plaintext")
+	}
+
+	opened, err := c.open(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Fatalf("expected %s, got %s", plaintext, opened)
+	}
+}
+
+func TestRecordCipherWrongKey(t *testing.T) {
+	sealed, _ := newTestRecordCipher(t, 1).seal([]byte(`{}`))
+	if _, err := newTestRecordCipher(t, 2).open(sealed); err == nil {
+		t.Fatal("expected decryption with another key to fail")
+	}
+}
+
+func TestRecordCipherInvalidKeyLength(t *testing.T) {
+	if _, err := newRecordCipher([]byte("short")); err == nil {
+		t.Fatal("expected short key to be rejected")
+	}
+}
+
+func TestAuditLogEncryptsRecords(t *testing.T) {
+	var buf bytes.Buffer
+	c := newTestRecordCipher(t, 1)
+	a := &auditLog{w: &buf, chain: true, cipher: c}
+
+	a.write(&decision{Kind: "Decision", Namespace: "secret-ns"})
+
+	if bytes.Contains(buf.Bytes(), []byte("secret-ns")) {
+		t.Fatal("expected audit log not to contain plaintext")
+	}
+	if _, _, _, err := verifyAuditChain(bytes.NewReader(buf.Bytes()), nil); err != nil {
+		t.Fatalf("expected encrypted chain to verify without the key, got %v", err)
+	}
+
+	var entry chainedEntry
+	json.Unmarshal(buf.Bytes(), &entry)
+	opened, err := c.open(entry.Record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d decision
+	json.Unmarshal(opened, &d)
+	if d.Namespace != "secret-ns" {
+		t.Fatalf("unexpected decrypted record: %s", opened)
+	}
+}
+
+// testKMS wraps data keys like a KMS would, with a key it keeps to itself.
+type testKMS struct {
+	local   *localKeyWrapper
+	unwraps int
+}
+
+func (k *testKMS) keyID() string { return "kms:test" }
+
+func (k *testKMS) wrap(dataKey []byte) ([]byte, error) { return k.local.wrap(dataKey) }
+
+func (k *testKMS) unwrap(wrapped []byte) ([]byte, error) {
+	k.unwraps++
+	return k.local.unwrap(wrapped)
+}
+
+func TestRecordCipherKeyWrapper(t *testing.T) {
+	local, _ := newLocalKeyWrapper(bytes.Repeat([]byte{1}, 32))
+	kms := &testKMS{local: local}
+	writer, err := newEnvelopeCipher(kms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := writer.seal([]byte(`{"namespace":"a"}`))
+	second, _ := writer.seal([]byte(`{"namespace":"b"}`))
+
+	var record encryptedRecord
+	json.Unmarshal(first, &record)
+	if record.KeyID != "kms:test" || len(record.WrappedKey) == 0 {
+		t.Fatalf("expected the wrapped data key and the KMS key ID in the record, got %s", first)
+	}
+
+	reader, _ := newEnvelopeCipher(kms)
+	for _, sealed := range [][]byte{first, second} {
+		if _, err := reader.open(sealed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if kms.unwraps != 1 {
+		t.Fatalf("expected the data key to be unwrapped once, got %d", kms.unwraps)
+	}
+}
+
+func TestRecordCipherOpensRecordsWithoutWrappedKey(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	local, _ := newLocalKeyWrapper(key)
+	nonce := make([]byte, local.aead.NonceSize())
+	sealed, _ := json.Marshal(encryptedRecord{
+		Kind:       "Encrypted",
+		KeyID:      local.keyID(),
+		Nonce:      nonce,
+		Ciphertext: local.aead.Seal(nil, nonce, []byte(`{}`), []byte(local.keyID())),
+	})
+
+	c := newTestRecordCipher(t, 1)
+	if opened, err := c.open(sealed); err != nil || string(opened) != `{}` {
+		t.Fatalf("expected a record encrypted with the key itself to open, got %s %v", opened, err)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/netutil"
+	"k8s.io/klog/v2"
+)
+
+type connLimiterKey struct{}
+
+var (
+	openConnections = newGauge(prometheus.GaugeOpts{
+		Name: "gateway_yeeter_open_connections",
+		Help: "Number of currently open client connections.",
+	})
+	connectionRateLimited = newCounter(prometheus.CounterOpts{
+		Name: "gateway_yeeter_connection_rate_limited_total",
+		Help: "Requests rejected because their connection exceeded the per-connection request rate.",
+	})
+)
+
+func newServer(c config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           logRequests(limitConnectionRate(handler)),
+		MaxHeaderBytes:    c.MaxHeaderBytes,
+		ReadHeaderTimeout: c.ReadHeaderTimeout,
+		ReadTimeout:       c.ReadTimeout,
+		IdleTimeout:       c.IdleTimeout,
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			return context.WithValue(ctx, connLimiterKey{}, newSourceRateLimiter(c.ConnRequestRate, c.ConnRequestBurst))
+		},
+		ConnState: func(conn net.Conn, state http.ConnState) {
+			switch state {
+			case http.StateNew:
+				openConnections.Inc()
+			case http.StateClosed, http.StateHijacked:
+				openConnections.Dec()
+			}
+		},
+	}
+}
+
+func listen(addr string, maxConnections int) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if maxConnections > 0 {
+		ln = netutil.LimitListener(ln, maxConnections)
+	}
+	return ln, nil
+}
+
+func limitConnectionRate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limiter, _ := r.Context().Value(connLimiterKey{}).(*sourceRateLimiter)
+		if !limiter.allow("conn") {
+			connectionRateLimited.Inc()
+			klog.Warningf("Connection from %s exceeded the per-connection request rate, closing it", r.RemoteAddr)
+			w.Header().Set("Connection", "close")
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "too many requests on this connection", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func serveTLS(c config, handler http.Handler, certFile, keyFile string) error {
+	ln, err := listen(c.ListenAddress, c.MaxConnections)
+	if err != nil {
+		return err
+	}
+	srv := newServer(c, handler)
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	srv.TLSConfig = &tls.Config{GetCertificate: reloader.getCertificate, GetConfigForClient: faults.getConfigForClient}
+	if c.AdminClientCA != "" {
+		pool, err := loadCertPool(c.AdminClientCA)
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig.ClientCAs, srv.TLSConfig.ClientAuth = pool, tls.VerifyClientCertIfGiven
+	}
+	leaf, err := loadLeafCertificate(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	servingCertificateExpiry.Set(float64(leaf.NotAfter.Unix()))
+	servingCert = newServingCertCheck(certFile, keyFile, reloader, c.CertExpiryWindow)
+	if c.CheckServingCertName {
+		servingCertName = newServingCertNameCheck(leaf, serviceDNSName())
+	}
+	logStartupBanner(c, srv.TLSConfig, leaf)
+	klog.Infof("Listening on %s (max connections %d, max header bytes %d, read header timeout %s)", c.ListenAddress, c.MaxConnections, c.MaxHeaderBytes, c.ReadHeaderTimeout)
+	return srv.ServeTLS(ln, "", "")
+}
+
+func loadLeafCertificate(certFile, keyFile string) (*x509.Certificate, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(pair.Certificate[0])
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(raw) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// shorthandItem is the pattern Multus requires of the namespace and name in
+// a shorthand networks annotation, a DNS-1123 label.
+var shorthandItem = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+type shorthandElement struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	Interface string `json:"interface,omitempty"`
+}
+
+// expandNetworks returns the JSON list equivalent to a networks annotation
+// in the comma-separated shorthand Multus also accepts
+// ("mtv/transfer@net1, storage"), and reports whether it was shorthand. Like
+// Multus, annotations without any of [{" are shorthand. Shorthand cannot
+// request a gateway, it is expanded so limits, rules and hotplug handling
+// see its attachments. JSON annotations are returned unchanged.
+func expandNetworks(annotation string) (string, bool, error) {
+	if strings.ContainsAny(annotation, `[{"`) {
+		return annotation, false, nil
+	}
+	elements := []shorthandElement{}
+	if strings.TrimSpace(annotation) != "" {
+		for _, item := range strings.Split(annotation, ",") {
+			element, err := parseShorthandItem(strings.TrimSpace(item))
+			if err != nil {
+				return "", true, err
+			}
+			elements = append(elements, element)
+		}
+	}
+	expanded, err := json.Marshal(elements)
+	if err != nil {
+		return "", true, err
+	}
+	return string(expanded), true, nil
+}
+
+// parseShorthandItem parses one [namespace/]name[@interface] item, with the
+// checks of the Multus parsePodNetworkObjectName.
+func parseShorthandItem(item string) (shorthandElement, error) {
+	var element shorthandElement
+	name := item
+	if namespace, rest, found := strings.Cut(item, "/"); found {
+		element.Namespace, name = strings.TrimSpace(namespace), rest
+		if strings.Contains(rest, "/") {
+			return element, fmt.Errorf("invalid network %q, more than one '/'", item)
+		}
+	}
+	if network, iface, found := strings.Cut(name, "@"); found {
+		name, element.Interface = network, strings.TrimSpace(iface)
+		if strings.Contains(iface, "@") {
+			return element, fmt.Errorf("invalid network %q, more than one '@'", item)
+		}
+	}
+	element.Name = strings.TrimSpace(name)
+	if element.Name == "" {
+		return element, fmt.Errorf("invalid network %q, no network name", item)
+	}
+	for _, value := range []string{element.Namespace, element.Name} {
+		if value != "" && !shorthandItem.MatchString(value) {
+			return element, fmt.Errorf("invalid network %q, %q is not a lowercase RFC 1123 label", item, value)
+		}
+	}
+	return element, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestExpandNetworks(t *testing.T) {
+	cases := []struct {
+		annotation, expected string
+		shorthand            bool
+	}{
+		{"transfer", `[{"name":"transfer"}]`, true},
+		{"mtv/transfer@net1, storage", `[{"name":"transfer","namespace":"mtv","interface":"net1"},{"name":"storage"}]`, true},
+		{" mtv / transfer @ net1 ", `[{"name":"transfer","namespace":"mtv","interface":"net1"}]`, true},
+		{"", `[]`, true},
+		{`[{"name":"transfer","default-route":["10.0.0.1"]}]`, `[{"name":"transfer","default-route":["10.0.0.1"]}]`, false},
+		{`[{"name":"transfer"`, `[{"name":"transfer"`, false},
+	}
+	for _, c := range cases {
+		expanded, shorthand, err := expandNetworks(c.annotation)
+		if err != nil {
+			t.Errorf("%q: %v", c.annotation, err)
+			continue
+		}
+		if expanded != c.expected || shorthand != c.shorthand {
+			t.Errorf("%q: expected %s (shorthand %v), got %s (shorthand %v)", c.annotation, c.expected, c.shorthand, expanded, shorthand)
+		}
+	}
+
+	for _, annotation := range []string{"a/b/c", "net@eth0@eth1", "Transfer", "transfer,,storage", "mtv/", "-transfer", "mtv_prod/transfer"} {
+		if _, shorthand, err := expandNetworks(annotation); err == nil || !shorthand {
+			t.Errorf("%q: expected invalid shorthand", annotation)
+		}
+	}
+}
+
+func reviewShorthandPod(t *testing.T, networks string) (*admissionv1.AdmissionResponse, *decision) {
+	rawPod, _ := json.Marshal(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "importer-test",
+			Namespace:   "mtv",
+			Labels:      map[string]string{"app": "containerized-data-importer"},
+			Annotations: map[string]string{"k8s.v1.cni.cncf.io/networks": networks},
+		},
+	})
+	ar := &admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{UID: "test", Namespace: "mtv", Operation: admissionv1.Create, Object: runtime.RawExtension{Raw: rawPod}},
+	}
+	d := newDecision(ar)
+	return evaluatePod(ar, d, nil), d
+}
+
+func TestReviewPodShorthandNetworks(t *testing.T) {
+	resp, d := reviewShorthandPod(t, "mtv/transfer@net1, storage")
+	if !resp.Allowed || len(resp.Patch) != 0 || len(resp.Warnings) != 0 || d.Reason != reasonUnchanged {
+		t.Fatalf("expected shorthand to be admitted unchanged without warnings, got %+v %+v", resp, d)
+	}
+
+	resp, d = reviewShorthandPod(t, "mtv/transfer@net1@net2")
+	if !resp.Allowed || len(resp.Patch) != 0 || d.Reason != reasonErrAnnotationParse {
+		t.Fatalf("expected invalid shorthand to be skipped, got %+v %+v", resp, d)
+	}
+	if len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], reasonWarnAnnotationParse) {
+		t.Fatalf("expected a warning for invalid shorthand, got %v", resp.Warnings)
+	}
+
+	resp, _ = reviewShorthandPod(t, `[{"name":"transfer"`)
+	if len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], reasonWarnAnnotationParse) {
+		t.Fatalf("expected a warning for invalid JSON, got %v", resp.Warnings)
+	}
+}
+
+func TestExistingAttachmentsShorthand(t *testing.T) {
+	existing, err := existingAttachments(`[{"name":"transfer","namespace":"mtv","interface":"net1"},{"name":"storage","default-route":["10.0.0.1"]}]`, "transfer@net1", "mtv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !existing[0] || existing[1] {
+		t.Fatalf("expected only the shorthand attachment to exist, got %v", existing)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Skip reasons group the reason codes and modes of reviews that left the
+// pod unmodified without an error or a denial, so a rising skip count can be
+// broken down without reading logs. Unlike reason codes, a new code may join
+// an existing skip reason.
+const (
+	skipNotTarget         = "not-target"
+	skipOptOut            = "opt-out"
+	skipParseFailure      = "parse-failure"
+	skipNoGateway         = "no-gateway"
+	skipNamespaceExcluded = "namespace-excluded"
+	skipOperation         = "operation"
+	skipPlanScope         = "plan-scope"
+	skipDryRun            = "dry-run"
+	skipShadow            = "shadow"
+	skipMaintenance       = "maintenance"
+	skipOther             = "other"
+)
+
+var skipReasonsByCode = map[string]string{
+	reasonUnchanged:             skipNoGateway,
+	reasonSkipNotTarget:         skipNotTarget,
+	reasonSkipOptOut:            skipOptOut,
+	reasonErrAnnotationParse:    skipParseFailure,
+	reasonErrHotplugCompare:     skipParseFailure,
+	reasonSkipNamespaceScope:    skipNamespaceExcluded,
+	reasonSkipNamespaceExcluded: skipNamespaceExcluded,
+	reasonSkipNamespaceIgnored:  skipNamespaceExcluded,
+	reasonSkipUpdate:            skipOperation,
+	reasonSkipDelete:            skipOperation,
+	reasonSkipPlanScope:         skipPlanScope,
+	reasonErrPlanLookup:         skipPlanScope,
+}
+
+var skipReasonsByMode = map[string]string{
+	modeDryRun:      skipDryRun,
+	modeShadow:      skipShadow,
+	modeMaintenance: skipMaintenance,
+}
+
+var skippedReviews = newCounterVec(prometheus.CounterOpts{
+	Name: "gateway_yeeter_skipped_reviews_total",
+	Help: "Admission reviews that left the pod unmodified, by pod type and skip reason.",
+}, "pod_type", "skip_reason")
+
+// skipReason returns why d left the pod unmodified, or "" if it was mutated
+// or denied or the review failed. A pass-through mode only counts when the
+// pod would have been changed, a pod that is not a target in dry-run mode
+// is still not-target.
+func skipReason(d *decision) string {
+	if d.Outcome == outcomeSkipped || d.Outcome == outcomeUnchanged {
+		if reason, exists := skipReasonsByCode[d.Reason]; exists {
+			return reason
+		}
+		return skipOther
+	}
+	return skipReasonsByMode[d.Mode]
+}
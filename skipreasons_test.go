@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSkipReason(t *testing.T) {
+	cases := []struct {
+		d        decision
+		expected string
+	}{
+		{decision{Outcome: outcomeSkipped, Reason: reasonSkipNotTarget}, skipNotTarget},
+		{decision{Outcome: outcomeSkipped, Reason: reasonSkipOptOut}, skipOptOut},
+		{decision{Outcome: outcomeSkipped, Reason: reasonErrAnnotationParse}, skipParseFailure},
+		{decision{Outcome: outcomeUnchanged, Reason: reasonUnchanged}, skipNoGateway},
+		{decision{Outcome: outcomeSkipped, Reason: reasonSkipNamespaceIgnored}, skipNamespaceExcluded},
+		{decision{Outcome: outcomeSkipped, Reason: reasonSkipDelete}, skipOperation},
+		{decision{Outcome: outcomeSkipped, Reason: reasonErrPlanLookup}, skipPlanScope},
+		{decision{Outcome: outcomeSkipped, Reason: "SKIP_SOMETHING_NEW"}, skipOther},
+		{decision{Outcome: outcomeMutated, Reason: reasonMutated, Mode: modeDryRun}, skipDryRun},
+		{decision{Outcome: outcomeDenied, Reason: reasonDenyRule, Mode: modeShadow}, skipShadow},
+		{decision{Outcome: outcomeMutated, Reason: reasonMutated, Mode: modeMaintenance}, skipMaintenance},
+		{decision{Outcome: outcomeSkipped, Reason: reasonSkipNotTarget, Mode: modeDryRun}, skipNotTarget},
+		{decision{Outcome: outcomeMutated, Reason: reasonMutated}, ""},
+		{decision{Outcome: outcomeDenied, Reason: reasonDenyRule}, ""},
+		{decision{Outcome: outcomeError, Reason: reasonErrPatchMarshal}, ""},
+	}
+	for _, c := range cases {
+		if got := skipReason(&c.d); got != c.expected {
+			t.Errorf("%s/%s in mode %q: expected %q, got %q", c.d.Outcome, c.d.Reason, c.d.Mode, c.expected, got)
+		}
+	}
+}
+
+func TestRecordDecisionSkipReason(t *testing.T) {
+	skippedReviews.Reset()
+	opted := &decision{Time: time.Now(), PodType: "cdi", Outcome: outcomeSkipped, Reason: reasonSkipOptOut}
+	recordDecision(opted)
+	recordDecision(&decision{Time: time.Now(), PodType: "cdi", Outcome: outcomeMutated, Reason: reasonMutated})
+
+	if opted.SkipReason != skipOptOut {
+		t.Fatalf("expected the decision to carry its skip reason, got %q", opted.SkipReason)
+	}
+	if got := testutil.ToFloat64(skippedReviews.WithLabelValues("cdi", skipOptOut)); got != 1 {
+		t.Fatalf("expected one opt-out skip, got %v", got)
+	}
+	if got := testutil.CollectAndCount(skippedReviews); got != 1 {
+		t.Fatalf("expected mutated pods not to be counted, got %d series", got)
+	}
+	if event := decisionAuditEvent(opted); event.Annotations[auditAnnotationPrefix+"skip-reason"] != skipOptOut {
+		t.Fatalf("expected the skip reason in the audit event, got %v", event.Annotations)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+)
+
+const (
+	spoolCurrent       = "current.ndjson"
+	spoolSegmentPrefix = "segment-"
+)
+
+// spool buffers records for an exporter as NDJSON in a directory. Records
+// are appended to a current file that is rotated into numbered segments,
+// which the exporter sends oldest first, so they survive sink outages and
+// restarts.
+type spool struct {
+	sink           string
+	dir            string
+	batchSize      int
+	maxBufferBytes int64
+	dropped        prometheus.Counter
+	buffered       prometheus.Gauge
+
+	mu           sync.Mutex
+	current      *os.File
+	currentLines int
+	seq          uint64
+	wake         chan struct{}
+}
+
+func newSpool(sink, dir string, batchSize int, maxBufferBytes int64, dropped prometheus.Counter, buffered prometheus.Gauge) (*spool, error) {
+	s := &spool{
+		sink:           sink,
+		dir:            dir,
+		batchSize:      batchSize,
+		maxBufferBytes: maxBufferBytes,
+		dropped:        dropped,
+		buffered:       buffered,
+		wake:           make(chan struct{}, 1),
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	// A spool left behind by a previous process becomes the oldest segment.
+	if _, err := os.Stat(filepath.Join(dir, spoolCurrent)); err == nil {
+		if err := s.rotateLocked(); err != nil {
+			return nil, err
+		}
+	}
+	s.updateBufferedBytes()
+	return s, nil
+}
+
+func (s *spool) enqueue(record interface{}) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		klog.Errorf("Could not marshal decision for %s: %v", s.sink, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current == nil {
+		if s.current, err = os.OpenFile(filepath.Join(s.dir, spoolCurrent), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600); err != nil {
+			klog.Errorf("Could not open %s spool, dropping decision: %v", s.sink, err)
+			s.dropped.Inc()
+			return
+		}
+	}
+	if _, err := s.current.Write(append(line, '\n')); err != nil {
+		klog.Errorf("Could not write to %s spool, dropping decision: %v", s.sink, err)
+		s.dropped.Inc()
+		return
+	}
+	s.currentLines++
+	s.buffered.Add(float64(len(line) + 1))
+	if s.currentLines >= s.batchSize {
+		if err := s.rotateLocked(); err != nil {
+			klog.Errorf("Could not rotate %s spool: %v", s.sink, err)
+		}
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *spool) rotateLocked() error {
+	if s.current != nil {
+		s.current.Close()
+		s.current = nil
+	}
+	s.currentLines = 0
+	s.seq++
+	segment := fmt.Sprintf("%s%020d-%06d.ndjson", spoolSegmentPrefix, time.Now().UnixNano(), s.seq)
+	return os.Rename(filepath.Join(s.dir, spoolCurrent), filepath.Join(s.dir, segment))
+}
+
+func (s *spool) segments() ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(s.dir, spoolSegmentPrefix+"*.ndjson"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// drain rotates the current spool and passes all segments to send in
+// order, removing each one it accepted and stopping at the first failure.
+func (s *spool) drain(send func(segment string) error) error {
+	s.mu.Lock()
+	if s.currentLines > 0 {
+		if err := s.rotateLocked(); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+	}
+	s.mu.Unlock()
+
+	s.enforceBufferLimit()
+	segments, err := s.segments()
+	if err != nil {
+		return err
+	}
+	for _, segment := range segments {
+		if err := send(segment); err != nil {
+			return err
+		}
+		os.Remove(segment)
+		s.updateBufferedBytes()
+	}
+	return nil
+}
+
+// enforceBufferLimit drops the oldest segments once the spool exceeds its
+// size limit, so an unreachable sink cannot fill the volume.
+func (s *spool) enforceBufferLimit() {
+	segments, err := s.segments()
+	if err != nil {
+		return
+	}
+	var total int64
+	sizes := make([]int64, len(segments))
+	for i, segment := range segments {
+		if info, err := os.Stat(segment); err == nil {
+			sizes[i] = info.Size()
+			total += sizes[i]
+		}
+	}
+	for i := 0; total > s.maxBufferBytes && i < len(segments); i++ {
+		lines := countLines(segments[i])
+		if err := os.Remove(segments[i]); err != nil {
+			continue
+		}
+		total -= sizes[i]
+		s.dropped.Add(float64(lines))
+		klog.Errorf("%s spool exceeds %d bytes, dropped %d buffered decision(s)", s.sink, s.maxBufferBytes, lines)
+	}
+	s.updateBufferedBytes()
+}
+
+func (s *spool) updateBufferedBytes() {
+	var total int64
+	matches, _ := filepath.Glob(filepath.Join(s.dir, "*.ndjson"))
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil {
+			total += info.Size()
+		}
+	}
+	s.buffered.Set(float64(total))
+}
+
+func countLines(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	return bytes.Count(data, []byte{'\n'})
+}
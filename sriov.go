@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	sriovPolicyIgnore = "ignore"
+	sriovPolicyStrip  = "strip"
+	sriovPolicySkip   = "skip"
+	sriovPolicyDeny   = "deny"
+
+	sriovResourceNameAnnotation = "k8s.v1.cni.cncf.io/resourceName"
+
+	nadCacheTTL      = time.Minute
+	nadLookupTimeout = 2 * time.Second
+)
+
+var nadGVR = schema.GroupVersionResource{Group: "k8s.cni.cncf.io", Version: "v1", Resource: "network-attachment-definitions"}
+
+var sriovAttachments = newCounterVec(prometheus.CounterOpts{
+	Name: "gateway_yeeter_sriov_attachments_total",
+	Help: "Gateway-bearing attachments backed by SR-IOV resources, by applied policy.",
+}, "policy")
+
+type nadCacheEntry struct {
+	resourceName string
+	expires      time.Time
+}
+
+type nadCache struct {
+	mu      sync.Mutex
+	entries map[string]nadCacheEntry
+	now     func() time.Time
+}
+
+var nads = newNADCache()
+
+func newNADCache() *nadCache {
+	return &nadCache{entries: make(map[string]nadCacheEntry), now: time.Now}
+}
+
+func (c *nadCache) resourceName(namespace, name string) (string, error) {
+	key := namespace + "/" + name
+
+	c.mu.Lock()
+	entry, exists := c.entries[key]
+	c.mu.Unlock()
+	if exists && c.now().Before(entry.expires) {
+		return entry.resourceName, nil
+	}
+
+	client, err := kube.dynamicFor(lookupNAD)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), nadLookupTimeout)
+	defer cancel()
+
+	resourceName := ""
+	nad, err := client.Resource(nadGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+	case err != nil:
+		return "", err
+	default:
+		resourceName = nad.GetAnnotations()[sriovResourceNameAnnotation]
+	}
+
+	c.mu.Lock()
+	c.entries[key] = nadCacheEntry{resourceName: resourceName, expires: c.now().Add(nadCacheTTL)}
+	c.mu.Unlock()
+	return resourceName, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func testNAD(name string, annotations map[string]string) *unstructured.Unstructured {
+	nad := &unstructured.Unstructured{}
+	nad.SetAPIVersion("k8s.cni.cncf.io/v1")
+	nad.SetKind("NetworkAttachmentDefinition")
+	nad.SetNamespace("test")
+	nad.SetName(name)
+	nad.SetAnnotations(annotations)
+	return nad
+}
+
+func withFakeNADs(t *testing.T, objects ...*unstructured.Unstructured) {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{nadGVR: "NetworkAttachmentDefinitionList"})
+	for _, obj := range objects {
+		if err := client.Tracker().Create(nadGVR, obj, obj.GetNamespace()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old, oldCache := kube, nads
+	kube = &kubeClients{dynamic: map[lookupCategory]dynamic.Interface{lookupNAD: client}}
+	nads = newNADCache()
+	t.Cleanup(func() { kube, nads = old, oldCache })
+}
+
+func reviewSRIOVPod(t *testing.T) *admissionv1.AdmissionResponse {
+	rawPod, _ := json.Marshal(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "importer-test",
+			Namespace: "test",
+			Labels:    map[string]string{"app": "containerized-data-importer"},
+			Annotations: map[string]string{
+				"k8s.v1.cni.cncf.io/networks": `[{"name":"vf","default-route":["10.0.0.1"]},{"name":"bridge","default-route":["10.1.0.1"]}]`,
+			},
+		},
+	})
+	return reviewPod(&admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{UID: "test", Namespace: "test", Object: runtime.RawExtension{Raw: rawPod}},
+	})
+}
+
+func TestNADCacheResourceName(t *testing.T) {
+	withFakeNADs(t,
+		testNAD("vf", map[string]string{sriovResourceNameAnnotation: "openshift.io/sriovnic"}),
+		testNAD("bridge", nil),
+	)
+
+	if got, err := nads.resourceName("test", "vf"); err != nil || got != "openshift.io/sriovnic" {
+		t.Fatalf("expected SR-IOV resource, got %q, %v", got, err)
+	}
+	if got, err := nads.resourceName("test", "bridge"); err != nil || got != "" {
+		t.Fatalf("expected no resource, got %q, %v", got, err)
+	}
+	if got, err := nads.resourceName("test", "missing"); err != nil || got != "" {
+		t.Fatalf("expected missing NAD to be non-SR-IOV, got %q, %v", got, err)
+	}
+}
+
+func TestNADCacheExpiry(t *testing.T) {
+	withFakeNADs(t, testNAD("vf", map[string]string{sriovResourceNameAnnotation: "openshift.io/sriovnic"}))
+	now := time.Now()
+	nads.now = func() time.Time { return now }
+	nads.resourceName("test", "vf")
+
+	kube = &kubeClients{}
+	if got, err := nads.resourceName("test", "vf"); err != nil || got != "openshift.io/sriovnic" {
+		t.Fatalf("expected cached resource, got %q, %v", got, err)
+	}
+	now = now.Add(nadCacheTTL + time.Second)
+	if _, err := nads.resourceName("test", "vf"); err == nil {
+		t.Fatal("expected a fresh lookup after expiry")
+	}
+}
+
+func TestReviewPodSRIOVPolicy(t *testing.T) {
+	tests := []struct {
+		policy   string
+		allowed  bool
+		networks string
+	}{
+		{sriovPolicyStrip, true, `[{"name":"vf"},{"name":"bridge"}]`},
+		{sriovPolicySkip, true, `[{"name":"vf","default-route":["10.0.0.1"]},{"name":"bridge"}]`},
+		{sriovPolicyDeny, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			withFakeNADs(t, testNAD("vf", map[string]string{sriovResourceNameAnnotation: "openshift.io/sriovnic"}))
+			old := cfg
+			cfg.SRIOVPolicy = tt.policy
+			defer func() { cfg = old }()
+
+			resp := reviewSRIOVPod(t)
+			if resp.Allowed != tt.allowed {
+				t.Fatalf("expected allowed=%v, got %+v", tt.allowed, resp)
+			}
+			if !tt.allowed {
+				if resp.Result == nil || resp.Result.Code != 403 {
+					t.Fatalf("expected a 403 result, got %+v", resp.Result)
+				}
+				return
+			}
+			var patches []patch
+			json.Unmarshal(resp.Patch, &patches)
+			if len(patches) != 1 || patches[0].Value != tt.networks {
+				t.Fatalf("unexpected patch %s", resp.Patch)
+			}
+		})
+	}
+}
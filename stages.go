@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+)
+
+const (
+	stageDecode   = "decode"
+	stageClassify = "classify"
+	stageEnrich   = "enrich"
+	stagePatch    = "patch"
+)
+
+var stages = []string{stageDecode, stageClassify, stageEnrich, stagePatch}
+
+// stageShares partition the request deadline: decoding and classifying are
+// local work, enrichment waits on API lookups (Plans, NADs, namespaces) and
+// gets the largest share, patching includes writing the response.
+var stageShares = map[string]float64{
+	stageDecode:   0.1,
+	stageClassify: 0.2,
+	stageEnrich:   0.5,
+	stagePatch:    0.2,
+}
+
+var (
+	stageDuration = newHistogramVec(prometheus.HistogramOpts{
+		Name:    "gateway_yeeter_stage_duration_seconds",
+		Help:    "Time spent per admission review in each stage (decode, classify, enrich, patch).",
+		Buckets: []float64{.0001, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, "stage")
+	stageBudgetExceeded = newCounterVec(prometheus.CounterOpts{
+		Name: "gateway_yeeter_stage_budget_exceeded_total",
+		Help: "Admission reviews in which a stage took longer than its share of the request deadline, by stage.",
+	}, "stage")
+	deadlineUsed = newHistogram(prometheus.HistogramOpts{
+		Name:    "gateway_yeeter_deadline_used_ratio",
+		Help:    "Fraction of the request deadline an admission review took.",
+		Buckets: []float64{.01, .05, .1, .25, .5, .75, .9, 1},
+	})
+)
+
+// stageTimer attributes the time of one admission review to the stage it
+// is in. Lookups switch to the enrich stage and back, so interleaved work
+// is accounted correctly. A nil stageTimer ignores all calls, for offline
+// evaluation.
+type stageTimer struct {
+	deadline time.Duration
+	start    time.Time
+	current  string
+	since    time.Time
+	spent    map[string]time.Duration
+	now      func() time.Time
+}
+
+func newStageTimer(start time.Time, deadline time.Duration) *stageTimer {
+	return &stageTimer{
+		deadline: deadline,
+		start:    start,
+		current:  stageDecode,
+		since:    start,
+		spent:    make(map[string]time.Duration, len(stages)),
+		now:      time.Now,
+	}
+}
+
+// requestDeadline returns the timeout the API server put on the request.
+func requestDeadline(r *http.Request) time.Duration {
+	if timeout, err := time.ParseDuration(r.URL.Query().Get("timeout")); err == nil && timeout > 0 {
+		return timeout
+	}
+	return cfg.WebhookTimeout
+}
+
+// enter switches to stage and returns the previous one.
+func (t *stageTimer) enter(stage string) string {
+	if t == nil {
+		return ""
+	}
+	now := t.now()
+	t.spent[t.current] += now.Sub(t.since)
+	previous := t.current
+	t.current, t.since = stage, now
+	return previous
+}
+
+// finish records the time of every stage and warns about stages that took
+// longer than their share of the deadline.
+func (t *stageTimer) finish(uid string) {
+	if t == nil {
+		return
+	}
+	t.enter(t.current)
+	total := t.now().Sub(t.start)
+	deadlineUsed.Observe(total.Seconds() / t.deadline.Seconds())
+
+	var exceeded []string
+	for _, stage := range stages {
+		stageDuration.WithLabelValues(stage).Observe(t.spent[stage].Seconds())
+		if budget := time.Duration(stageShares[stage] * float64(t.deadline)); t.spent[stage] > budget {
+			stageBudgetExceeded.WithLabelValues(stage).Inc()
+			exceeded = append(exceeded, fmt.Sprintf("%s took %s of %s", stage, t.spent[stage].Round(time.Millisecond), budget))
+		}
+	}
+	if len(exceeded) > 0 {
+		klog.Warningf("Admission review (uid=%s) took %s of the %s deadline, %s", uid, total.Round(time.Millisecond), t.deadline, strings.Join(exceeded, ", "))
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRequestDeadline(t *testing.T) {
+	for target, want := range map[string]time.Duration{
+		"/mutate?timeout=5s":   5 * time.Second,
+		"/mutate":              cfg.WebhookTimeout,
+		"/mutate?timeout=junk": cfg.WebhookTimeout,
+		"/mutate?timeout=-1s":  cfg.WebhookTimeout,
+	} {
+		if got := requestDeadline(httptest.NewRequest("POST", target, nil)); got != want {
+			t.Errorf("%s: expected %s, got %s", target, want, got)
+		}
+	}
+}
+
+func TestStageTimer(t *testing.T) {
+	start := time.Now()
+	clock := start
+	stages := newStageTimer(start, time.Second)
+	stages.now = func() time.Time { return clock }
+
+	clock = clock.Add(50 * time.Millisecond)
+	stages.enter(stageClassify)
+	clock = clock.Add(100 * time.Millisecond)
+	previous := stages.enter(stageEnrich)
+	clock = clock.Add(600 * time.Millisecond)
+	stages.enter(previous)
+	clock = clock.Add(50 * time.Millisecond)
+	stages.enter(stagePatch)
+	clock = clock.Add(100 * time.Millisecond)
+
+	exceeded := testutil.ToFloat64(stageBudgetExceeded.WithLabelValues(stageEnrich))
+	classifyExceeded := testutil.ToFloat64(stageBudgetExceeded.WithLabelValues(stageClassify))
+	stages.finish("test")
+
+	for stage, want := range map[string]time.Duration{stageDecode: 50 * time.Millisecond, stageClassify: 150 * time.Millisecond, stageEnrich: 600 * time.Millisecond, stagePatch: 100 * time.Millisecond} {
+		if stages.spent[stage] != want {
+			t.Errorf("expected %s to take %s, got %s", stage, want, stages.spent[stage])
+		}
+	}
+	if got := testutil.ToFloat64(stageBudgetExceeded.WithLabelValues(stageEnrich)); got != exceeded+1 {
+		t.Fatalf("expected the enrich budget to be exceeded")
+	}
+	if got := testutil.ToFloat64(stageBudgetExceeded.WithLabelValues(stageClassify)); got != classifyExceeded {
+		t.Fatalf("expected the classify budget to be kept")
+	}
+}
+
+func TestStageTimerNil(t *testing.T) {
+	var stages *stageTimer
+	if previous := stages.enter(stageEnrich); previous != "" {
+		t.Fatalf("expected no previous stage, got %q", previous)
+	}
+	stages.finish("test")
+	if resp, _ := reviewRulesPod(t, "test", `[{"name":"transfer","default-route":["10.0.0.1"]}]`); resp.Patch == nil {
+		t.Fatalf("expected the pod to be patched without a stage timer")
+	}
+}
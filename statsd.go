@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/klog/v2"
+)
+
+const statsdMaxPacketBytes = 1432
+
+// statsdEmitter sends DogStatsD metrics over UDP for clusters without
+// Prometheus scraping: tagged counters per decision, and periodically the
+// contents of the Prometheus registry (counters as deltas, gauges as is).
+type statsdEmitter struct {
+	conn   net.Conn
+	prefix string
+	tags   []string
+
+	mu       sync.Mutex
+	counters map[string]float64
+}
+
+var statsd *statsdEmitter
+
+func newStatsdEmitter(address, prefix string, tags []string) (*statsdEmitter, error) {
+	if address == "" {
+		return nil, nil
+	}
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdEmitter{conn: conn, prefix: prefix, tags: tags, counters: make(map[string]float64)}, nil
+}
+
+func (s *statsdEmitter) decision(d *decision) {
+	if s == nil || d.Mode != "" {
+		return
+	}
+	tags := []string{
+		"namespace:" + cfg.Redaction.value(channelMetrics, fieldNamespace, d.Namespace),
+		"pod_type:" + d.PodType,
+		"action:" + d.Outcome,
+	}
+	if d.SkipReason != "" {
+		tags = append(tags, "skip_reason:"+d.SkipReason)
+	}
+	removed := 0
+	for _, network := range d.Networks {
+		removed += len(network.RemovedGateways)
+	}
+	s.send([]string{
+		s.line("decisions", "1", "c", tags),
+		s.line("gateways_removed", strconv.Itoa(removed), "c", tags),
+	})
+}
+
+func (s *statsdEmitter) line(name, value, kind string, tags []string) string {
+	line := s.prefix + "." + name + ":" + value + "|" + kind
+	if all := append(append([]string{}, s.tags...), tags...); len(all) > 0 {
+		line += "|#" + strings.Join(all, ",")
+	}
+	return line
+}
+
+// send packs lines into datagrams below the usual MTU. Delivery is best
+// effort, the admission path never waits for the agent.
+func (s *statsdEmitter) send(lines []string) {
+	var packet bytes.Buffer
+	flush := func() {
+		if packet.Len() == 0 {
+			return
+		}
+		if _, err := s.conn.Write(packet.Bytes()); err != nil {
+			klog.V(4).Infof("Could not send DogStatsD packet: %v", err)
+		}
+		packet.Reset()
+	}
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsdMaxPacketBytes {
+			flush()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	flush()
+}
+
+func (s *statsdEmitter) run(interval time.Duration) {
+	if s == nil {
+		return
+	}
+	for range time.Tick(interval) {
+		s.mirrorRegistry()
+	}
+}
+
+func (s *statsdEmitter) mirrorRegistry() {
+	families, err := metricsRegistry.Gather()
+	if err != nil {
+		klog.Warningf("Could not gather metrics for DogStatsD: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var lines []string
+	for _, family := range families {
+		name := strings.TrimPrefix(family.GetName(), "gateway_yeeter_")
+		for _, metric := range family.GetMetric() {
+			tags := statsdLabelTags(metric.GetLabel())
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				key := family.GetName() + "{" + strings.Join(tags, ",") + "}"
+				value := metric.GetCounter().GetValue()
+				if delta := value - s.counters[key]; delta > 0 {
+					lines = append(lines, s.line(name, formatStatsdValue(delta), "c", tags))
+				}
+				s.counters[key] = value
+			case dto.MetricType_GAUGE:
+				lines = append(lines, s.line(name, formatStatsdValue(metric.GetGauge().GetValue()), "g", tags))
+			}
+		}
+	}
+	s.send(lines)
+}
+
+func statsdLabelTags(labels []*dto.LabelPair) []string {
+	tags := make([]string, 0, len(labels))
+	for _, label := range labels {
+		tags = append(tags, label.GetName()+":"+label.GetValue())
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+func formatStatsdValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
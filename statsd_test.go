@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestStatsd(t *testing.T) (*statsdEmitter, net.PacketConn) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+
+	s, err := newStatsdEmitter(pc.LocalAddr().String(), "gy", []string{"env:test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, pc
+}
+
+func readStatsdPacket(t *testing.T, pc net.PacketConn) []string {
+	buf := make([]byte, 65536)
+	pc.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(string(buf[:n]), "\n")
+}
+
+func readStatsdPackets(pc net.PacketConn) []string {
+	var lines []string
+	buf := make([]byte, 65536)
+	for {
+		pc.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			return lines
+		}
+		lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+	}
+}
+
+func TestStatsdDecision(t *testing.T) {
+	s, pc := newTestStatsd(t)
+	// Pass-through decisions applied nothing and are not sent.
+	s.decision(&decision{Namespace: "mtv", PodType: "cdi", Outcome: outcomeMutated, Mode: modeShadow})
+	s.decision(&decision{
+		Namespace: "mtv",
+		PodType:   "cdi",
+		Outcome:   outcomeMutated,
+		Networks:  []networkChange{{Network: "mtv/transfer", RemovedGateways: []string{"10.0.0.1", "fd00::1"}}},
+	})
+
+	lines := readStatsdPacket(t, pc)
+	expected := []string{
+		"gy.decisions:1|c|#env:test,namespace:mtv,pod_type:cdi,action:mutated",
+		"gy.gateways_removed:2|c|#env:test,namespace:mtv,pod_type:cdi,action:mutated",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("expected %v, got %v", expected, lines)
+	}
+}
+
+func TestStatsdRedactsNamespace(t *testing.T) {
+	old := cfg
+	cfg.Redaction = redactionPolicy{channelMetrics: {fieldNamespace}}
+	defer func() { cfg = old }()
+
+	s, pc := newTestStatsd(t)
+	s.decision(&decision{Namespace: "mtv", PodType: "cdi", Outcome: outcomeUnchanged})
+	if line := readStatsdPacket(t, pc)[0]; strings.Contains(line, "namespace:mtv") || !strings.Contains(line, "namespace:redacted:") {
+		t.Fatalf("expected a redacted namespace tag, got %s", line)
+	}
+}
+
+func TestStatsdMirrorRegistryDeltas(t *testing.T) {
+	s, pc := newTestStatsd(t)
+	rejectedPayloads.WithLabelValues("statsd-test").Add(3)
+	s.mirrorRegistry()
+	if !containsPrefix(readStatsdPackets(pc), "gy.rejected_payloads_total:3|c|#env:test,reason:statsd-test") {
+		t.Fatal("expected the counter value on the first mirror")
+	}
+
+	rejectedPayloads.WithLabelValues("statsd-test").Inc()
+	s.mirrorRegistry()
+	if !containsPrefix(readStatsdPackets(pc), "gy.rejected_payloads_total:1|c|#env:test,reason:statsd-test") {
+		t.Fatal("expected only the delta on the second mirror")
+	}
+}
+
+func TestStatsdPacketSize(t *testing.T) {
+	s, pc := newTestStatsd(t)
+	lines := make([]string, 100)
+	for i := range lines {
+		lines[i] = strings.Repeat("x", 100)
+	}
+	s.send(lines)
+	if got := len(readStatsdPacket(t, pc)); got >= 100 || got == 0 {
+		t.Fatalf("expected lines to be split across packets, got %d in the first", got)
+	}
+}
+
+func containsPrefix(lines []string, prefix string) bool {
+	for _, line := range lines {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
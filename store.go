@@ -0,0 +1,244 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	bolt "go.etcd.io/bbolt"
+	"k8s.io/klog/v2"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	decisionStoreMemory = "memory"
+	decisionStoreBolt   = "bolt"
+	decisionStoreSQLite = "sqlite"
+)
+
+var decisionStoreErrors = newCounterVec(prometheus.CounterOpts{
+	Name: "gateway_yeeter_decision_store_errors_total",
+	Help: "Failed reads and writes of the --decision-store, by operation.",
+}, "operation")
+
+var decisionsBucket = []byte("decisions")
+
+// openDecisionStore opens the store selected by c.DecisionStore. Persistent
+// stores keep the last c.RecentDecisions records across restarts, sealed
+// with cipher when one is configured.
+func openDecisionStore(c config, cipher *recordCipher) (decisionStore, error) {
+	switch c.DecisionStore {
+	case decisionStoreBolt:
+		return openBoltDecisionStore(c.DecisionStorePath, c.RecentDecisions, cipher)
+	case decisionStoreSQLite:
+		return openSQLiteDecisionStore(c.DecisionStorePath, c.RecentDecisions, cipher)
+	default:
+		return newDecisionLog(c.RecentDecisions), nil
+	}
+}
+
+func encodeDecision(d *decision, cipher *recordCipher) ([]byte, error) {
+	raw, err := json.Marshal(d)
+	if err != nil || cipher == nil {
+		return raw, err
+	}
+	return cipher.seal(raw)
+}
+
+func decodeDecision(raw []byte, cipher *recordCipher) (*decision, error) {
+	if cipher != nil {
+		opened, err := cipher.open(raw)
+		if err != nil {
+			return nil, err
+		}
+		raw = opened
+	}
+	d := &decision{}
+	if err := json.Unmarshal(raw, d); err != nil {
+		return nil, err
+	}
+	if d.Kind == "Encrypted" {
+		return nil, fmt.Errorf("record is encrypted and --record-encryption-key is not set")
+	}
+	return d, nil
+}
+
+type boltDecisionStore struct {
+	db       *bolt.DB
+	capacity int
+	cipher   *recordCipher
+	tally    *outcomeTally
+}
+
+func openBoltDecisionStore(path string, capacity int, cipher *recordCipher) (*boltDecisionStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("could not open decision store %s: %w", path, err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(decisionsBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not initialize decision store %s: %w", path, err)
+	}
+	return &boltDecisionStore{db: db, capacity: max(capacity, 1), cipher: cipher, tally: newOutcomeTally()}, nil
+}
+
+func (s *boltDecisionStore) add(d *decision) error {
+	s.tally.add(d.Outcome)
+	raw, err := encodeDecision(d, s.cipher)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(decisionsBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		if err := b.Put(key, raw); err != nil {
+			return err
+		}
+		// Keys are increasing sequence numbers, so the oldest records are
+		// first.
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && binary.BigEndian.Uint64(k)+uint64(s.capacity) <= seq; k, _ = c.First() {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltDecisionStore) list() []*decision {
+	out := []*decision{}
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(decisionsBucket).Cursor()
+		for k, v := c.Last(); k != nil && len(out) < s.capacity; k, v = c.Prev() {
+			d, err := decodeDecision(v, s.cipher)
+			if err != nil {
+				return fmt.Errorf("record %d: %w", binary.BigEndian.Uint64(k), err)
+			}
+			out = append(out, d)
+		}
+		return nil
+	}); err != nil {
+		decisionStoreErrors.WithLabelValues("list").Inc()
+		klog.Errorf("Could not read decisions from %s: %v", s.db.Path(), err)
+	}
+	return out
+}
+
+func (s *boltDecisionStore) stats() decisionStats {
+	return s.tally.stats()
+}
+
+func (s *boltDecisionStore) close() error {
+	return s.db.Close()
+}
+
+// sqliteDecisionStore keeps the time, pod type, outcome and reason of every
+// record in columns, and the namespace and pod unless records are encrypted,
+// so the file can be queried with the sqlite3 shell.
+type sqliteDecisionStore struct {
+	db       *sql.DB
+	path     string
+	capacity int
+	cipher   *recordCipher
+	tally    *outcomeTally
+}
+
+const sqliteDecisionSchema = `
+CREATE TABLE IF NOT EXISTS decisions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	time TEXT NOT NULL,
+	namespace TEXT NOT NULL,
+	pod TEXT NOT NULL,
+	pod_type TEXT NOT NULL,
+	outcome TEXT NOT NULL,
+	reason TEXT NOT NULL,
+	record BLOB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS decisions_time ON decisions (time);
+CREATE INDEX IF NOT EXISTS decisions_namespace ON decisions (namespace, time);
+`
+
+func openSQLiteDecisionStore(path string, capacity int, cipher *recordCipher) (*sqliteDecisionStore, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("could not open decision store %s: %w", path, err)
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteDecisionSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not initialize decision store %s: %w", path, err)
+	}
+	return &sqliteDecisionStore{db: db, path: path, capacity: max(capacity, 1), cipher: cipher, tally: newOutcomeTally()}, nil
+}
+
+func (s *sqliteDecisionStore) add(d *decision) error {
+	s.tally.add(d.Outcome)
+	raw, err := encodeDecision(d, s.cipher)
+	if err != nil {
+		return err
+	}
+	namespace, pod := d.Namespace, d.Pod
+	if s.cipher != nil {
+		namespace, pod = "", ""
+	}
+	result, err := s.db.Exec(`INSERT INTO decisions (time, namespace, pod, pod_type, outcome, reason, record) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		d.Time.UTC().Format(time.RFC3339Nano), namespace, pod, d.PodType, d.Outcome, d.Reason, raw)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`DELETE FROM decisions WHERE id <= ?`, id-int64(s.capacity))
+	return err
+}
+
+func (s *sqliteDecisionStore) list() []*decision {
+	out := []*decision{}
+	rows, err := s.db.Query(`SELECT id, record FROM decisions ORDER BY id DESC LIMIT ?`, s.capacity)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var id int64
+			var raw []byte
+			if err = rows.Scan(&id, &raw); err != nil {
+				break
+			}
+			d, decodeErr := decodeDecision(raw, s.cipher)
+			if decodeErr != nil {
+				err = fmt.Errorf("record %d: %w", id, decodeErr)
+				break
+			}
+			out = append(out, d)
+		}
+		if err == nil {
+			err = rows.Err()
+		}
+	}
+	if err != nil {
+		decisionStoreErrors.WithLabelValues("list").Inc()
+		klog.Errorf("Could not read decisions from %s: %v", s.path, err)
+	}
+	return out
+}
+
+func (s *sqliteDecisionStore) stats() decisionStats {
+	return s.tally.stats()
+}
+
+func (s *sqliteDecisionStore) close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testDecisionStores(t *testing.T) map[string]func(capacity int, cipher *recordCipher) decisionStore {
+	dir := t.TempDir()
+	return map[string]func(int, *recordCipher) decisionStore{
+		decisionStoreMemory: func(capacity int, cipher *recordCipher) decisionStore {
+			return newDecisionLog(capacity)
+		},
+		decisionStoreBolt: func(capacity int, cipher *recordCipher) decisionStore {
+			s, err := openBoltDecisionStore(filepath.Join(dir, "decisions.db"), capacity, cipher)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		},
+		decisionStoreSQLite: func(capacity int, cipher *recordCipher) decisionStore {
+			s, err := openSQLiteDecisionStore(filepath.Join(dir, "decisions.sqlite"), capacity, cipher)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		},
+	}
+}
+
+func TestDecisionStores(t *testing.T) {
+	for name, open := range testDecisionStores(t) {
+		t.Run(name, func(t *testing.T) {
+			s := open(3, nil)
+			defer s.close()
+			for i := 0; i < 5; i++ {
+				outcome := outcomeMutated
+				if i == 4 {
+					outcome = outcomeDenied
+				}
+				if err := s.add(&decision{Kind: "Decision", Time: time.Now(), Pod: fmt.Sprintf("importer-%d", i), Outcome: outcome}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			records := s.list()
+			if len(records) != 3 || records[0].Pod != "importer-4" || records[2].Pod != "importer-2" {
+				t.Fatalf("expected the 3 newest decisions, newest first, got %+v", records)
+			}
+			if stats := s.stats(); stats.Total != 5 || stats.Outcomes[outcomeMutated] != 4 || stats.Outcomes[outcomeDenied] != 1 {
+				t.Fatalf("unexpected stats %+v", stats)
+			}
+		})
+	}
+}
+
+func TestDecisionStoresPersist(t *testing.T) {
+	cipher, err := newRecordCipher(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, open := range testDecisionStores(t) {
+		if name == decisionStoreMemory {
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			s := open(10, cipher)
+			if err := s.add(&decision{Kind: "Decision", Namespace: "mtv", Pod: "importer-a", Outcome: outcomeMutated}); err != nil {
+				t.Fatal(err)
+			}
+			s.close()
+
+			s = open(10, cipher)
+			if records := s.list(); len(records) != 1 || records[0].Pod != "importer-a" {
+				t.Fatalf("expected the decision to survive a restart, got %+v", records)
+			}
+			if stats := s.stats(); stats.Total != 0 {
+				t.Fatalf("expected stats to count decisions since the start only, got %+v", stats)
+			}
+			s.close()
+
+			s = open(10, nil)
+			defer s.close()
+			if records := s.list(); len(records) != 0 {
+				t.Fatalf("expected encrypted records to be unreadable without the key, got %+v", records)
+			}
+		})
+	}
+}
+
+func TestSQLiteDecisionStoreColumns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decisions.sqlite")
+	s, err := openSQLiteDecisionStore(path, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	if err := s.add(&decision{Namespace: "mtv", Pod: "importer-a", PodType: "cdi", Outcome: outcomeDenied, Reason: reasonDenyRule}); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM decisions WHERE namespace = 'mtv' AND outcome = ? AND reason = ?`, outcomeDenied, reasonDenyRule).Scan(&count); err != nil || count != 1 {
+		t.Fatalf("expected the decision to be queryable, got %d (%v)", count, err)
+	}
+}
+
+func TestDecisionStoreConfig(t *testing.T) {
+	c := defaultConfig()
+	c.DecisionStore = "s3"
+	if err := c.validate(); err == nil {
+		t.Fatal("expected an unknown decision store to be rejected")
+	}
+	c.DecisionStore = decisionStoreBolt
+	if err := c.validate(); err == nil {
+		t.Fatal("expected a persistent decision store without a path to be rejected")
+	}
+	c.DecisionStorePath = filepath.Join(t.TempDir(), "decisions.db")
+	if err := c.validate(); err != nil {
+		t.Fatal(err)
+	}
+	s, err := openDecisionStore(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	if _, ok := s.(*boltDecisionStore); !ok {
+		t.Fatalf("expected a bolt store, got %T", s)
+	}
+}
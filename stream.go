@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/websocket"
+	"k8s.io/klog/v2"
+)
+
+const streamBuffer = 64
+
+var streamClients = newGauge(prometheus.GaugeOpts{
+	Name: "gateway_yeeter_stream_clients",
+	Help: "Clients connected to the live decision stream.",
+})
+
+var streamDropped = newCounter(prometheus.CounterOpts{
+	Name: "gateway_yeeter_stream_dropped_decisions_total",
+	Help: "Decisions not delivered to live stream clients that could not keep up.",
+})
+
+// decisionStream fans decisions out to live stream clients. Publishing never
+// blocks admission; clients that fall behind lose decisions.
+type decisionStream struct {
+	mu          sync.Mutex
+	subscribers map[chan *decision]struct{}
+}
+
+var liveDecisions = newDecisionStream()
+
+func newDecisionStream() *decisionStream {
+	return &decisionStream{subscribers: make(map[chan *decision]struct{})}
+}
+
+func (s *decisionStream) subscribe() chan *decision {
+	ch := make(chan *decision, streamBuffer)
+	s.mu.Lock()
+	s.subscribers[ch] = struct{}{}
+	streamClients.Set(float64(len(s.subscribers)))
+	s.mu.Unlock()
+	return ch
+}
+
+func (s *decisionStream) unsubscribe(ch chan *decision) {
+	s.mu.Lock()
+	delete(s.subscribers, ch)
+	streamClients.Set(float64(len(s.subscribers)))
+	s.mu.Unlock()
+}
+
+func (s *decisionStream) publish(d *decision) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.subscribers) == 0 {
+		return
+	}
+	d = cfg.Redaction.decision(channelAdmin, d)
+	for ch := range s.subscribers {
+		select {
+		case ch <- d:
+		default:
+			streamDropped.Inc()
+		}
+	}
+}
+
+// checkStreamOrigin accepts clients without an Origin header (kubectl,
+// websocat, scripts) and browsers on the same host, so other sites cannot
+// ride on a client certificate.
+func checkStreamOrigin(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host != r.Host {
+		return fmt.Errorf("origin %q not allowed", origin)
+	}
+	return nil
+}
+
+func handleDecisionStream(w http.ResponseWriter, r *http.Request) {
+	f, err := parseDecisionFilter(r.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	user := requestPrincipal(r)
+
+	websocket.Server{Handshake: checkStreamOrigin, Handler: func(ws *websocket.Conn) {
+		defer ws.Close()
+		// The server's read timeout still applies to the hijacked connection.
+		ws.SetDeadline(time.Time{})
+		ch := liveDecisions.subscribe()
+		defer liveDecisions.unsubscribe(ch)
+		klog.Infof("%s connected to the decision stream from %s", user, r.RemoteAddr)
+		defer klog.Infof("%s disconnected from the decision stream", user)
+
+		closed := make(chan struct{})
+		go func() {
+			io.Copy(io.Discard, ws)
+			close(closed)
+		}()
+		for {
+			select {
+			case d := <-ch:
+				if !f.matches(d) {
+					continue
+				}
+				if err := websocket.JSON.Send(ws, d); err != nil {
+					klog.V(2).Infof("Could not send decision to stream client %s: %v", user, err)
+					return
+				}
+			case <-closed:
+				return
+			}
+		}
+	}}.ServeHTTP(w, r)
+}
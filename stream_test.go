@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestDecisionStream(t *testing.T) {
+	old := liveDecisions
+	liveDecisions = newDecisionStream()
+	defer func() { liveDecisions = old }()
+
+	a := newAdminAuth([]string{"viewer"}, nil)
+	a.reviewToken = fakeTokenReview(map[string]*principal{"viewer-token": {User: "viewer"}})
+	withAdminAuth(t, a)
+	mux := http.NewServeMux()
+	registerAdminHandlers(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	if code := adminRequest(mux, "/decisions/stream", ""); code != http.StatusUnauthorized {
+		t.Fatalf("expected unauthenticated stream request to be rejected, got %d", code)
+	}
+
+	dial := func(origin string) (*websocket.Conn, error) {
+		config, _ := websocket.NewConfig("ws"+strings.TrimPrefix(server.URL, "http")+"/decisions/stream?outcome=mutated", origin)
+		config.Header.Set("Authorization", "Bearer viewer-token")
+		return websocket.DialConfig(config)
+	}
+	if _, err := dial("https://evil.example"); err == nil {
+		t.Fatal("expected a foreign origin to be rejected")
+	}
+	ws, err := dial(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		liveDecisions.mu.Lock()
+		subscribers := len(liveDecisions.subscribers)
+		liveDecisions.mu.Unlock()
+		if subscribers == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("client did not subscribe")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	liveDecisions.publish(&decision{UID: "unchanged", Outcome: outcomeUnchanged})
+	liveDecisions.publish(&decision{UID: "mutated", Outcome: outcomeMutated})
+	ws.SetReadDeadline(deadline)
+	var d decision
+	if err := websocket.JSON.Receive(ws, &d); err != nil || d.UID != "mutated" {
+		t.Fatalf("expected the mutated decision, got %+v (%v)", d, err)
+	}
+}
+
+func TestDecisionStreamDropsSlowClients(t *testing.T) {
+	s := newDecisionStream()
+	ch := s.subscribe()
+	defer s.unsubscribe(ch)
+	for i := 0; i < streamBuffer+1; i++ {
+		s.publish(&decision{Outcome: outcomeMutated})
+	}
+	if len(ch) != streamBuffer {
+		t.Fatalf("expected the buffer to be full, got %d", len(ch))
+	}
+}
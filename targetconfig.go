@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+var configReloads = newCounterVec(prometheus.CounterOpts{
+	Name: "gateway_yeeter_config_reloads_total",
+	Help: "Reloads of the --config file after it changed, by result (success, error).",
+}, "result")
+
+// targetConfigFile is the layout of the --config file. Every target has the
+// spec of a GatewayYeetPolicy.
+type targetConfigFile struct {
+	Targets []targetPolicySpec `json:"targets"`
+}
+
+// targetConfigWatcher holds the target pods of the --config file and
+// reloads them when the file content changes, which is how the kubelet
+// updates a mounted ConfigMap.
+type targetConfigWatcher struct {
+	file string
+
+	mu      sync.Mutex
+	targets []targetPod
+	sum     [sha256.Size]byte
+}
+
+var targetConfig *targetConfigWatcher
+
+// newTargetConfigWatcher loads file, returning nil without a file.
+func newTargetConfigWatcher(file string) (*targetConfigWatcher, error) {
+	if file == "" {
+		return nil, nil
+	}
+	w := &targetConfigWatcher{file: file}
+	if _, err := w.reload("startup"); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func loadTargetConfig(file string) ([]targetPod, [sha256.Size]byte, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, [sha256.Size]byte{}, fmt.Errorf("could not read config file: %w", err)
+	}
+	var f targetConfigFile
+	if err := yaml.UnmarshalStrict(raw, &f); err != nil {
+		return nil, [sha256.Size]byte{}, fmt.Errorf("could not parse config file %s: %w", file, err)
+	}
+	if len(f.Targets) == 0 {
+		return nil, [sha256.Size]byte{}, fmt.Errorf("config file %s defines no targets", file)
+	}
+	targets := make([]targetPod, 0, len(f.Targets))
+	for i, spec := range f.Targets {
+		target, err := spec.target(fmt.Sprintf("%s#%d", file, i))
+		if err != nil {
+			return nil, [sha256.Size]byte{}, fmt.Errorf("invalid target %d in config file %s: %w", i, file, err)
+		}
+		targets = append(targets, target)
+	}
+	return targets, sha256.Sum256(raw), nil
+}
+
+func (w *targetConfigWatcher) run(interval time.Duration) {
+	if w == nil {
+		return
+	}
+	for range time.Tick(interval) {
+		w.refresh(actorRefresh)
+	}
+}
+
+// refresh reloads the file and counts the result, also for reloads
+// requested on /reload, attributing changes to actor.
+func (w *targetConfigWatcher) refresh(actor string) error {
+	if w == nil {
+		return nil
+	}
+	changed, err := w.reload(actor)
+	switch {
+	case err != nil:
+		// Keep the last targets, a typo in the ConfigMap must not change
+		// which pods are stripped.
+		configReloads.WithLabelValues("error").Inc()
+		klog.Errorf("Could not reload %s, keeping the previous targets: %v", w.file, err)
+	case changed:
+		configReloads.WithLabelValues("success").Inc()
+	}
+	return err
+}
+
+// reload reads the file and replaces the targets if its content changed.
+func (w *targetConfigWatcher) reload(actor string) (bool, error) {
+	raw, err := os.ReadFile(w.file)
+	if err != nil {
+		return false, fmt.Errorf("could not read config file: %w", err)
+	}
+	w.mu.Lock()
+	unchanged := w.targets != nil && sha256.Sum256(raw) == w.sum
+	w.mu.Unlock()
+	if unchanged {
+		return false, nil
+	}
+
+	targets, sum, err := loadTargetConfig(w.file)
+	if err != nil {
+		return false, err
+	}
+	var names []string
+	for _, target := range targets {
+		names = append(names, target.name)
+	}
+	w.mu.Lock()
+	old := targetsHash(w.targets)
+	w.targets, w.sum = targets, sum
+	w.mu.Unlock()
+	klog.Infof("Target pods defined by %s: %s", w.file, strings.Join(names, ", "))
+	if next := targetsHash(targets); next != old {
+		auditPolicyChange(changeSourceConfigFile, actor, old, next, viewTargets(targets))
+	}
+	return true, nil
+}
+
+// current returns the target pods of the file, or the built-in targets
+// without --config.
+func (w *targetConfigWatcher) current() []targetPod {
+	if w == nil {
+		return targetPods
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.targets
+}
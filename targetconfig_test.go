@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTargetConfigWatcher(t *testing.T) {
+	file := writeTestFile(t, "config.yaml", `targets:
+- podType: importer
+  podSelector:
+    matchLabels:
+      app: containerized-data-importer
+  namespaces: ["mtv-*"]
+`)
+	w, err := newTargetConfigWatcher(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldTargets := targetConfig
+	targetConfig = w
+	t.Cleanup(func() { targetConfig = oldTargets })
+
+	names := func(namespace string, labels map[string]string) []string {
+		var names []string
+		for _, target := range podTargets(namespace, labels) {
+			names = append(names, target.name)
+		}
+		return names
+	}
+	if got := names("mtv-prod", map[string]string{"app": "containerized-data-importer"}); !reflect.DeepEqual(got, []string{"importer"}) {
+		t.Fatalf("expected the importer target, got %v", got)
+	}
+	if got := names("other", map[string]string{"forklift.app": "virt-v2v"}); got != nil {
+		t.Fatalf("expected the built-in targets to be replaced, got %v", got)
+	}
+
+	// An unchanged file is not reloaded.
+	if changed, err := w.reload("test"); changed || err != nil {
+		t.Fatalf("expected no reload, got %v, %v", changed, err)
+	}
+
+	os.WriteFile(file, []byte(`targets:
+- podType: converter
+  podSelector:
+    matchExpressions:
+    - {key: role, operator: In, values: [v2v]}
+`), 0o600)
+	if changed, err := w.reload("test"); !changed || err != nil {
+		t.Fatalf("expected a reload, got %v, %v", changed, err)
+	}
+	if got := names("team-a", map[string]string{"role": "v2v"}); !reflect.DeepEqual(got, []string{"converter"}) {
+		t.Fatalf("expected the reloaded target, got %v", got)
+	}
+
+	// An invalid file keeps the previous targets.
+	os.WriteFile(file, []byte("targets:\n- podType: converter\n"), 0o600)
+	if _, err := w.reload("test"); err == nil || !strings.Contains(err.Error(), "podSelector") {
+		t.Fatalf("expected an invalid selector error, got %v", err)
+	}
+	if got := names("team-a", map[string]string{"role": "v2v"}); !reflect.DeepEqual(got, []string{"converter"}) {
+		t.Fatalf("expected the previous target to be kept, got %v", got)
+	}
+}
+
+func TestTargetConfigPrecedence(t *testing.T) {
+	oldTargets := targetConfig
+	t.Cleanup(func() { targetConfig = oldTargets })
+
+	targetConfig = nil
+	if got := targetPolicies.current(); !reflect.DeepEqual(got, targetPods) {
+		t.Fatalf("expected the built-in targets without --config, got %v", got)
+	}
+	targetConfig = &targetConfigWatcher{targets: []targetPod{{name: "from-file"}}}
+	withTargetPolicies(t)
+	if got := targetPolicies.current(); len(got) != 1 || got[0].name != "from-file" {
+		t.Fatalf("expected the targets of the file without policies, got %v", got)
+	}
+}
+
+func TestLoadTargetConfigErrors(t *testing.T) {
+	var empty string
+	for name, content := range map[string]string{
+		"empty":         "targets: []\n",
+		"unknown field": "targets:\n- podType: x\n  podSelector: {matchLabels: {app: x}}\n  selector: {}\n",
+		"bad pattern":   "targets:\n- podType: x\n  podSelector: {matchLabels: {app: x}}\n  namespaces: ['[']\n",
+	} {
+		file := writeTestFile(t, strings.ReplaceAll(name, " ", "-")+".yaml", content)
+		if name == "empty" {
+			empty = file
+		}
+		if _, _, err := loadTargetConfig(file); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := newTargetConfigWatcher(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Fatal("expected a missing file to be rejected")
+	}
+
+	c := defaultConfig()
+	c.ConfigFile = empty
+	if err := c.validate(); err == nil {
+		t.Fatal("expected validate to reject an invalid config file")
+	}
+}
+
+func TestRenderManifestsConfigFile(t *testing.T) {
+	c := defaultConfig()
+	c.ConfigFile = "/etc/gateway-yeeter/config.yaml"
+	objects := renderedObjects(t, c)
+	for _, object := range objects {
+		switch object["kind"] {
+		case "MutatingWebhookConfiguration":
+			webhooks := object["webhooks"].([]interface{})
+			if len(webhooks) != 1 || webhooks[0].(map[string]interface{})["objectSelector"] != nil {
+				t.Fatalf("expected a single webhook without object selector, got %v", webhooks)
+			}
+		case "Deployment":
+			podSpec := object["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})
+			volumes := podSpec["volumes"].([]interface{})
+			if got := volumes[len(volumes)-1].(map[string]interface{})["configMap"]; !reflect.DeepEqual(got, map[string]interface{}{"name": "gateway-yeeter-config"}) {
+				t.Fatalf("expected the config ConfigMap volume, got %v", volumes)
+			}
+			mounts := podSpec["containers"].([]interface{})[0].(map[string]interface{})["volumeMounts"].([]interface{})
+			if got := mounts[len(mounts)-1].(map[string]interface{})["mountPath"]; got != "/etc/gateway-yeeter" {
+				t.Fatalf("expected the ConfigMap to be mounted at the directory of --config, got %v", mounts)
+			}
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+const targetPolicyKind = "GatewayYeetPolicy"
+
+var targetPolicyGVR = schema.GroupVersionResource{Group: crdGroup, Version: crdStorageVersion, Resource: "gatewayyeetpolicies"}
+
+var targetPoliciesActive = newGauge(prometheus.GaugeOpts{
+	Name: "gateway_yeeter_target_policies",
+	Help: "Number of GatewayYeetPolicy objects classifying target pods, 0 while the built-in targets apply.",
+})
+
+// targetPolicySpec is the v1alpha1 spec of a GatewayYeetPolicy. Namespaces and
+// Networks are glob patterns; a network pattern without a slash matches the
+// attachment name in any namespace.
+type targetPolicySpec struct {
+	PodType     string               `json:"podType"`
+	PodSelector metav1.LabelSelector `json:"podSelector"`
+	Namespaces  []string             `json:"namespaces,omitempty"`
+	Networks    []string             `json:"networks,omitempty"`
+}
+
+// targetWatcher watches the GatewayYeetPolicies with an informer, they
+// replace the built-in target pods while at least one exists.
+type targetWatcher struct {
+	mu       sync.Mutex
+	targets  []targetPod
+	versions map[string]string
+	synced   bool
+}
+
+var targetPolicies *targetWatcher
+
+func newTargetWatcher() *targetWatcher {
+	return &targetWatcher{versions: make(map[string]string)}
+}
+
+// run watches the policies until stop is closed. resync replays them
+// periodically, which changes nothing unless an update was missed.
+func (w *targetWatcher) run(resync time.Duration, stop <-chan struct{}) {
+	if w == nil {
+		return
+	}
+	client, err := kube.dynamicFor(lookupRules)
+	if err != nil {
+		klog.Errorf("Could not watch %s objects, keeping the built-in targets: %v", targetPolicyKind, err)
+		return
+	}
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, resync)
+	informer := factory.ForResource(targetPolicyGVR)
+	changed := func(interface{}) {
+		// The initial list is applied at once after the cache synced.
+		if informer.Informer().HasSynced() {
+			w.sync(informer.Lister(), actorWatch)
+		}
+	}
+	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    changed,
+		UpdateFunc: func(_, object interface{}) { changed(object) },
+		DeleteFunc: changed,
+	})
+	factory.Start(stop)
+	if cache.WaitForCacheSync(stop, informer.Informer().HasSynced) {
+		w.sync(informer.Lister(), actorWatch)
+	}
+}
+
+// sync applies the policies in the informer cache.
+func (w *targetWatcher) sync(lister cache.GenericLister, actor string) {
+	objects, err := lister.List(labels.Everything())
+	if err != nil {
+		klog.Warningf("Could not list %s objects: %v", targetPolicyKind, err)
+		return
+	}
+	items := make([]unstructured.Unstructured, 0, len(objects))
+	for _, object := range objects {
+		if item, ok := object.(*unstructured.Unstructured); ok {
+			items = append(items, *item)
+		}
+	}
+	w.update(items, actor)
+}
+
+// refresh lists the policies from the API server, for /reload, attributing
+// changes to actor.
+func (w *targetWatcher) refresh(actor string) {
+	client, err := kube.dynamicFor(lookupRules)
+	if err != nil {
+		klog.Warningf("Could not list %s objects: %v", targetPolicyKind, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ruleSourceTimeout)
+	defer cancel()
+	list, err := client.Resource(targetPolicyGVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		// Keep the last targets, an API server hiccup must not change which
+		// pods are stripped.
+		klog.Warningf("Could not list %s objects: %v", targetPolicyKind, err)
+		return
+	}
+	w.update(list.Items, actor)
+}
+
+func (w *targetWatcher) update(items []unstructured.Unstructured, actor string) {
+	w.mu.Lock()
+	old := targetsHash(w.targets)
+
+	previous := make(map[string]targetPod, len(w.targets))
+	for _, target := range w.targets {
+		previous[target.origin] = target
+	}
+	var targets []targetPod
+	versions := make(map[string]string, len(items))
+	for _, item := range items {
+		origin := item.GetNamespace() + "/" + item.GetName()
+		versions[origin] = item.GetResourceVersion()
+		target, err := parseTargetPolicy(item)
+		if err != nil {
+			if w.versions[origin] != item.GetResourceVersion() {
+				klog.Warningf("Invalid %s %s: %v", targetPolicyKind, origin, err)
+			}
+			// Keep the last valid version, a typo must not drop a target.
+			last, exists := previous[origin]
+			if !exists {
+				continue
+			}
+			target = last
+		}
+		targets = append(targets, target)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].origin < targets[j].origin })
+
+	// Unchanged policies keep the same list, so classifications cached for
+	// it stay valid.
+	if fmt.Sprint(versions) != fmt.Sprint(w.versions) {
+		w.targets = targets
+		var names []string
+		for _, target := range targets {
+			names = append(names, target.name+" ("+target.origin+")")
+		}
+		if len(targets) == 0 {
+			klog.Infof("No %s objects, using the targets of the configuration", targetPolicyKind)
+		} else {
+			klog.Infof("Target pods defined by %d %s object(s): %s", len(targets), targetPolicyKind, strings.Join(names, ", "))
+		}
+	}
+	w.versions, w.synced = versions, true
+	targetPoliciesActive.Set(float64(len(targets)))
+	next := targetsHash(w.targets)
+	w.mu.Unlock()
+
+	if next != old {
+		auditPolicyChange(changeSourceTargets, actor, old, next, viewTargets(targets))
+	}
+}
+
+// hasSynced reports whether the policies were listed at least once.
+func (w *targetWatcher) hasSynced() bool {
+	if w == nil {
+		return true
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.synced
+}
+
+// current returns the target pods of the policies, or those of the
+// configuration file or the built-in targets without policies.
+func (w *targetWatcher) current() []targetPod {
+	if w == nil {
+		return targetConfig.current()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.targets) == 0 {
+		return targetConfig.current()
+	}
+	return w.targets
+}
+
+// parseTargetPolicy converts a GatewayYeetPolicy of any version to a target
+// pod. Policies in the webhook's namespace may target any namespaces, all
+// others only their own.
+func parseTargetPolicy(item unstructured.Unstructured) (targetPod, error) {
+	object := item.DeepCopy().Object
+	if err := convertCustomResource(object, crdGroup+"/"+crdVersionAlpha); err != nil {
+		return targetPod{}, err
+	}
+	raw, err := json.Marshal(object["spec"])
+	if err != nil {
+		return targetPod{}, err
+	}
+	var spec targetPolicySpec
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		return targetPod{}, fmt.Errorf("invalid spec: %w", err)
+	}
+	target, err := spec.target(item.GetNamespace() + "/" + item.GetName())
+	if err != nil {
+		return targetPod{}, fmt.Errorf("invalid spec: %w", err)
+	}
+	if item.GetNamespace() != identity.Namespace || identity.Namespace == "" {
+		for _, namespace := range spec.Namespaces {
+			if namespace != item.GetNamespace() {
+				return targetPod{}, fmt.Errorf("spec.namespaces may only contain %s, only policies in %q may target other namespaces", item.GetNamespace(), identity.Namespace)
+			}
+		}
+		target.namespaces = []string{item.GetNamespace()}
+	}
+	return target, nil
+}
+
+// target validates s and converts it to a target pod defined in origin.
+func (s targetPolicySpec) target(origin string) (targetPod, error) {
+	if s.PodType == "" {
+		return targetPod{}, fmt.Errorf("podType must not be empty")
+	}
+	if len(s.PodSelector.MatchLabels) == 0 && len(s.PodSelector.MatchExpressions) == 0 {
+		return targetPod{}, fmt.Errorf("podSelector must not be empty")
+	}
+	selector, err := metav1.LabelSelectorAsSelector(&s.PodSelector)
+	if err != nil {
+		return targetPod{}, fmt.Errorf("invalid podSelector: %w", err)
+	}
+	for _, pattern := range append(append([]string(nil), s.Namespaces...), s.Networks...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return targetPod{}, fmt.Errorf("invalid pattern %q", pattern)
+		}
+	}
+	return targetPod{
+		name:       s.PodType,
+		labels:     s.PodSelector.MatchLabels,
+		selector:   selector,
+		namespaces: s.Namespaces,
+		networks:   s.Networks,
+		origin:     origin,
+	}, nil
+}
+
+// targetPolicyCRD renders the namespaced CustomResourceDefinition of
+// GatewayYeetPolicy.
+func targetPolicyCRD(crdLabels map[string]string, o manifestOptions) map[string]interface{} {
+	object := func(properties map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"type": "object", "properties": properties}
+	}
+	patterns := map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}}
+	selector := map[string]interface{}{"type": "object", "x-kubernetes-preserve-unknown-fields": true}
+	spec := func(networks map[string]interface{}) map[string]interface{} {
+		spec := object(map[string]interface{}{
+			"podType":     map[string]interface{}{"type": "string"},
+			"podSelector": selector,
+			"namespaces":  patterns,
+			"networks":    networks,
+		})
+		spec["required"] = []string{"podType", "podSelector"}
+		return object(map[string]interface{}{"spec": spec})
+	}
+	networkPattern := object(map[string]interface{}{
+		"namespace": map[string]interface{}{"type": "string"},
+		"name":      map[string]interface{}{"type": "string"},
+	})
+	networkPattern["required"] = []string{"name"}
+	return map[string]interface{}{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata": map[string]interface{}{
+			"name":        targetPolicyGVR.Resource + "." + targetPolicyGVR.Group,
+			"labels":      crdLabels,
+			"annotations": map[string]string{"service.beta.openshift.io/inject-cabundle": "true"},
+		},
+		"spec": map[string]interface{}{
+			"group": targetPolicyGVR.Group,
+			"names": map[string]interface{}{
+				"kind":     targetPolicyKind,
+				"listKind": targetPolicyKind + "List",
+				"plural":   targetPolicyGVR.Resource,
+				"singular": strings.ToLower(targetPolicyKind),
+			},
+			"scope": "Namespaced",
+			"versions": crdVersions(map[string]map[string]interface{}{
+				crdVersionAlpha: spec(patterns),
+				crdVersionBeta:  spec(map[string]interface{}{"type": "array", "items": networkPattern}),
+			}),
+			"conversion": conversionStrategy(o),
+		},
+	}
+}
+
+// matches reports whether t targets a pod with podLabels in namespace.
+func (t targetPod) matches(namespace string, podLabels map[string]string) bool {
+	if len(t.namespaces) > 0 && !matchesNamespace(t.namespaces, namespace) {
+		return false
+	}
+	if t.selector != nil {
+		return t.selector.Matches(labels.Set(podLabels))
+	}
+	for key, value := range t.labels {
+		if podLabels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// targetsNetwork reports whether the default-route of the attachment
+// namespace/name is stripped from pods of t.
+func (t targetPod) targetsNetwork(namespace, name string) bool {
+	if len(t.networks) == 0 {
+		return true
+	}
+	for _, pattern := range t.networks {
+		subject := name
+		if strings.Contains(pattern, "/") {
+			subject = namespace + "/" + name
+		}
+		if ok, _ := path.Match(pattern, subject); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// attachmentNamespace returns the namespace of an attachment that names
+// namespace, defaulting to the namespace of the pod.
+func attachmentNamespace(namespace, podNamespace string) string {
+	if namespace == "" {
+		return podNamespace
+	}
+	return namespace
+}
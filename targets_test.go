@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func testTargetPolicy(namespace, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": targetPolicyGVR.GroupVersion().String(),
+		"kind":       targetPolicyKind,
+		"metadata":   map[string]interface{}{"namespace": namespace, "name": name},
+		"spec":       spec,
+	}}
+}
+
+func withTargetPolicies(t *testing.T, objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{targetPolicyGVR: targetPolicyKind + "List"}, objects...)
+	oldKube, oldIdentity, oldTargets := kube, identity, targetPolicies
+	kube = &kubeClients{dynamic: map[lookupCategory]dynamic.Interface{lookupRules: client}}
+	identity = instanceIdentity{Namespace: "openshift-mtv"}
+	targetPolicies = newTargetWatcher()
+	t.Cleanup(func() { kube, identity, targetPolicies = oldKube, oldIdentity, oldTargets })
+	return client
+}
+
+func TestTargetWatcher(t *testing.T) {
+	client := withTargetPolicies(t,
+		testTargetPolicy("openshift-mtv", "importers", map[string]interface{}{
+			"podType":     "cdi",
+			"podSelector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "containerized-data-importer"}},
+			"namespaces":  []interface{}{"mtv-*"},
+		}),
+		testTargetPolicy("team-a", "converters", map[string]interface{}{
+			"podType":     "converter",
+			"podSelector": map[string]interface{}{"matchExpressions": []interface{}{map[string]interface{}{"key": "role", "operator": "In", "values": []interface{}{"v2v", "convert"}}}},
+		}),
+		testTargetPolicy("team-b", "escalating", map[string]interface{}{
+			"podType":     "cdi",
+			"podSelector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "containerized-data-importer"}},
+			"namespaces":  []interface{}{"*"},
+		}),
+	)
+
+	if got := targetPolicies.current(); !reflect.DeepEqual(got, targetPods) {
+		t.Fatalf("expected the built-in targets before the first refresh, got %+v", got)
+	}
+	targetPolicies.refresh("test")
+
+	names := func(namespace string, labels map[string]string) []string {
+		var names []string
+		for _, target := range podTargets(namespace, labels) {
+			names = append(names, target.name)
+		}
+		return names
+	}
+	for _, tt := range []struct {
+		namespace string
+		labels    map[string]string
+		want      []string
+	}{
+		{"mtv-prod", map[string]string{"app": "containerized-data-importer"}, []string{"cdi"}},
+		{"other", map[string]string{"app": "containerized-data-importer"}, nil},
+		{"team-a", map[string]string{"role": "convert"}, []string{"converter"}},
+		{"team-c", map[string]string{"role": "convert"}, nil},
+		{"mtv-prod", map[string]string{"forklift.app": "virt-v2v"}, nil},
+	} {
+		if got := names(tt.namespace, tt.labels); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %v: expected %v, got %v", tt.namespace, tt.labels, tt.want, got)
+		}
+	}
+
+	// An invalid update keeps the last valid version.
+	policy, _ := client.Resource(targetPolicyGVR).Namespace("team-a").Get(context.Background(), "converters", metav1.GetOptions{})
+	unstructured.SetNestedField(policy.Object, "", "spec", "podType")
+	client.Resource(targetPolicyGVR).Namespace("team-a").Update(context.Background(), policy, metav1.UpdateOptions{})
+	targetPolicies.refresh("test")
+	if got := names("team-a", map[string]string{"role": "v2v"}); !reflect.DeepEqual(got, []string{"converter"}) {
+		t.Fatalf("expected the last valid policy to be kept, got %v", got)
+	}
+
+	// Without policies the built-in targets apply again.
+	for _, ref := range [][2]string{{"openshift-mtv", "importers"}, {"team-a", "converters"}, {"team-b", "escalating"}} {
+		client.Resource(targetPolicyGVR).Namespace(ref[0]).Delete(context.Background(), ref[1], metav1.DeleteOptions{})
+	}
+	targetPolicies.refresh("test")
+	if got := names("other", map[string]string{"forklift.app": "virt-v2v"}); !reflect.DeepEqual(got, []string{"virt-v2v"}) {
+		t.Fatalf("expected the built-in targets, got %v", got)
+	}
+}
+
+func TestTargetWatcherWatches(t *testing.T) {
+	client := withTargetPolicies(t)
+	go targetPolicies.run(time.Hour, t.Context().Done())
+
+	waitFor := func(want []string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			var got []string
+			for _, target := range podTargets("team-a", map[string]string{"role": "v2v"}) {
+				got = append(got, target.name)
+			}
+			if reflect.DeepEqual(got, want) {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected targets %v, got %v", want, got)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	for !targetPolicies.hasSynced() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	waitFor(nil)
+
+	policy := testTargetPolicy("team-a", "converters", map[string]interface{}{
+		"podType":     "converter",
+		"podSelector": map[string]interface{}{"matchLabels": map[string]interface{}{"role": "v2v"}},
+	})
+	if _, err := client.Resource(targetPolicyGVR).Namespace("team-a").Create(context.Background(), policy, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor([]string{"converter"})
+
+	client.Resource(targetPolicyGVR).Namespace("team-a").Delete(context.Background(), "converters", metav1.DeleteOptions{})
+	waitFor(nil)
+}
+
+func TestParseTargetPolicy(t *testing.T) {
+	withTargetPolicies(t)
+	for name, spec := range map[string]map[string]interface{}{
+		"missing pod type": {"podSelector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "x"}}},
+		"empty selector":   {"podType": "x"},
+		"bad operator":     {"podType": "x", "podSelector": map[string]interface{}{"matchExpressions": []interface{}{map[string]interface{}{"key": "app", "operator": "Near"}}}},
+		"bad pattern":      {"podType": "x", "podSelector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "x"}}, "networks": []interface{}{map[string]interface{}{"name": "["}}},
+		"other namespace":  {"podType": "x", "podSelector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "x"}}, "namespaces": []interface{}{"team-b"}},
+	} {
+		if _, err := parseTargetPolicy(*testTargetPolicy("team-a", "p", spec)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestTargetPolicyNetworks(t *testing.T) {
+	withTargetPolicies(t, testTargetPolicy("test", "transfer-only", map[string]interface{}{
+		"podType":     "cdi",
+		"podSelector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "containerized-data-importer"}},
+		"networks":    []interface{}{map[string]interface{}{"name": "transfer"}, map[string]interface{}{"namespace": "shared", "name": "storage-*"}},
+	}))
+	targetPolicies.refresh("test")
+
+	resp, d := reviewRulesPod(t, "test", `[{"name":"transfer","default-route":["10.0.0.1"]},{"name":"backup","default-route":["10.0.1.1"]},{"name":"storage-a","namespace":"shared","default-route":["10.0.2.1"]}]`)
+	if !resp.Allowed || d.Outcome != outcomeMutated {
+		t.Fatalf("expected the pod to be mutated, got %+v %+v", resp, d)
+	}
+	var stripped []string
+	for _, change := range d.Networks {
+		stripped = append(stripped, change.Network)
+	}
+	if !reflect.DeepEqual(stripped, []string{"/transfer", "shared/storage-a"}) {
+		t.Fatalf("expected only the target networks to be stripped, got %v", stripped)
+	}
+	if !strings.Contains(d.Patch, `10.0.1.1`) {
+		t.Fatalf("expected the default-route of backup to be kept, got %s", d.Patch)
+	}
+}
+
+func TestRenderManifestsTargetPolicies(t *testing.T) {
+	c := defaultConfig()
+	c.TargetPolicies = true
+	objects := renderedObjects(t, c)
+	if objects[0]["kind"] != "CustomResourceDefinition" || objects[0]["metadata"].(map[string]interface{})["name"] != "gatewayyeetpolicies.gateway.yeet" {
+		t.Fatalf("expected the target policy CRD first, got %v", objects[0])
+	}
+	for _, object := range objects {
+		if object["kind"] != "MutatingWebhookConfiguration" {
+			continue
+		}
+		webhooks := object["webhooks"].([]interface{})
+		if len(webhooks) != 1 || webhooks[0].(map[string]interface{})["objectSelector"] != nil {
+			t.Fatalf("expected a single webhook without object selector, got %v", webhooks)
+		}
+	}
+	if names := objectNames(objects, "ClusterRole"); !reflect.DeepEqual(names, []string{"ClusterRole gateway-yeeter-rules"}) {
+		t.Fatalf("expected a rules ClusterRole, got %v", names)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"sort"
+)
+
+const (
+	ovnPodNetworksAnnotation = "k8s.ovn.org/pod-networks"
+	ovnRolePrimary           = "primary"
+)
+
+type ovnPodRoute struct {
+	Dest    string `json:"dest"`
+	NextHop string `json:"nextHop"`
+}
+
+func yeetOVNPodNetworks(annotation string) (string, []networkChange, error) {
+	var networks map[string]map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(annotation), &networks); err != nil {
+		return "", nil, err
+	}
+
+	names := make([]string, 0, len(networks))
+	for name := range networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var changes []networkChange
+	for _, name := range names {
+		network := networks[name]
+
+		var role string
+		if raw, exists := network["role"]; exists {
+			json.Unmarshal(raw, &role)
+		}
+		if role == ovnRolePrimary {
+			continue
+		}
+
+		change := networkChange{Network: "ovn:" + name}
+		var gateways []string
+		if raw, exists := network["gateway_ips"]; exists {
+			if err := json.Unmarshal(raw, &gateways); err != nil {
+				return "", nil, err
+			}
+			delete(network, "gateway_ips")
+		}
+		var gateway string
+		if raw, exists := network["gateway_ip"]; exists {
+			if err := json.Unmarshal(raw, &gateway); err != nil {
+				return "", nil, err
+			}
+			delete(network, "gateway_ip")
+			if !contains(gateways, gateway) {
+				gateways = append(gateways, gateway)
+			}
+		}
+		change.RemovedGateways = append(change.RemovedGateways, gateways...)
+
+		if raw, exists := network["routes"]; exists {
+			var routes []ovnPodRoute
+			if err := json.Unmarshal(raw, &routes); err != nil {
+				return "", nil, err
+			}
+			kept := routes[:0]
+			for _, route := range routes {
+				if isDefaultRouteDest(route.Dest) {
+					change.RemovedGateways = append(change.RemovedGateways, route.NextHop)
+					continue
+				}
+				kept = append(kept, route)
+			}
+			if len(kept) == 0 {
+				delete(network, "routes")
+			} else if len(kept) != len(routes) {
+				network["routes"], _ = json.Marshal(kept)
+			}
+		}
+
+		if len(change.RemovedGateways) > 0 {
+			changes = append(changes, change)
+		}
+	}
+
+	if len(changes) == 0 {
+		return annotation, nil, nil
+	}
+	modified, err := json.Marshal(networks)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(modified), changes, nil
+}
+
+func isDefaultRouteDest(dest string) bool {
+	_, ipNet, err := net.ParseCIDR(dest)
+	if err != nil {
+		return false
+	}
+	ones, _ := ipNet.Mask.Size()
+	return ones == 0
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const testOVNPodNetworks = `{
+	"default": {"ip_addresses":["10.128.0.5/23"],"mac_address":"0a:58:0a:80:00:05","gateway_ips":["10.128.0.1"],"ip_address":"10.128.0.5/23","gateway_ip":"10.128.0.1","role":"infrastructure-locked"},
+	"ns1/transfer": {"ip_addresses":["192.168.10.5/24"],"mac_address":"0a:58:c0:a8:0a:05","gateway_ips":["192.168.10.1"],"routes":[{"dest":"0.0.0.0/0","nextHop":"192.168.10.254"},{"dest":"172.16.0.0/16","nextHop":"192.168.10.1"}],"role":"secondary"},
+	"ns1/udn": {"ip_addresses":["10.200.0.5/16"],"mac_address":"0a:58:0a:c8:00:05","gateway_ips":["10.200.0.1"],"role":"primary","tunnel_id":4}
+}`
+
+func TestYeetOVNPodNetworks(t *testing.T) {
+	modified, changes, err := yeetOVNPodNetworks(testOVNPodNetworks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes[0].Network != "ovn:default" || changes[1].Network != "ovn:ns1/transfer" {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+	if len(changes[1].RemovedGateways) != 2 || changes[1].RemovedGateways[1] != "192.168.10.254" {
+		t.Fatalf("expected gateway and default route next hop to be removed, got %v", changes[1].RemovedGateways)
+	}
+
+	var networks map[string]map[string]json.RawMessage
+	json.Unmarshal([]byte(modified), &networks)
+
+	if _, exists := networks["default"]["gateway_ips"]; exists {
+		t.Fatal("expected gateway to be removed from infrastructure-locked network")
+	}
+	if string(networks["ns1/transfer"]["routes"]) != `[{"dest":"172.16.0.0/16","nextHop":"192.168.10.1"}]` {
+		t.Fatalf("expected only the default route to be removed, got %s", networks["ns1/transfer"]["routes"])
+	}
+	if string(networks["ns1/udn"]["gateway_ips"]) != `["10.200.0.1"]` || string(networks["ns1/udn"]["tunnel_id"]) != "4" {
+		t.Fatal("expected primary network to be untouched")
+	}
+}
+
+func TestYeetOVNPodNetworksPrimaryOnly(t *testing.T) {
+	annotation := `{"default":{"ip_addresses":["10.128.0.5/23"],"gateway_ips":["10.128.0.1"],"role":"primary"}}`
+	modified, changes, err := yeetOVNPodNetworks(annotation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 || modified != annotation {
+		t.Fatal("expected primary-only annotation to be left alone")
+	}
+}
+
+func TestReviewPodOVNPodNetworks(t *testing.T) {
+	old := cfg
+	cfg.HandleOVNPodNetworks = true
+	defer func() { cfg = old }()
+
+	rawPod, _ := json.Marshal(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "virt-v2v-test",
+			Namespace:   "test",
+			Labels:      map[string]string{"forklift.app": "virt-v2v"},
+			Annotations: map[string]string{ovnPodNetworksAnnotation: testOVNPodNetworks},
+		},
+	})
+	resp := reviewPod(&admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{UID: "test", Object: runtime.RawExtension{Raw: rawPod}},
+	})
+
+	var patches []patch
+	json.Unmarshal(resp.Patch, &patches)
+	if len(patches) != 1 || patches[0].Path != "/metadata/annotations/k8s.ovn.org~1pod-networks" {
+		t.Fatalf("expected pod-networks patch, got %s", resp.Patch)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	validateModeOff     = "off"
+	validateModeAudit   = "audit"
+	validateModeEnforce = "enforce"
+)
+
+var validations = newCounterVec(prometheus.CounterOpts{
+	Name: "gateway_yeeter_validations_total",
+	Help: "Pods reviewed on /validate, by mode and result (passed, unmutated, skipped).",
+}, "mode", "result")
+
+// handleValidate backs the validating webhook. Validating webhooks run
+// after all mutating webhooks, so a target pod that still carries
+// default-route gateways here was never mutated, e.g. because the mutating
+// webhook was unreachable and its failurePolicy let the pod through.
+func handleValidate(w http.ResponseWriter, r *http.Request) {
+	admissionReview, ok := readAdmissionReview(w, r)
+	if !ok {
+		return
+	}
+	admissionReview.Response = validatePod(&admissionReview, cfg.ValidateMode)
+	admissionReview.Response.UID = admissionReview.Request.UID
+	if err := writeAdmissionReviewResponse(w, r, &admissionReview); err != nil {
+		http.Error(w, "could not marshal response", http.StatusInternalServerError)
+	}
+}
+
+// validatePod reviews the pod of ar again without recording a decision and
+// rejects it in enforce mode when the review would still remove gateways.
+// Pods the mutating webhook would have admitted unmodified on purpose, in
+// maintenance, dry-run and shadow mode, always pass.
+func validatePod(ar *admissionv1.AdmissionReview, mode string) *admissionv1.AdmissionResponse {
+	allowed := &admissionv1.AdmissionResponse{Allowed: true}
+	if ar.Request.Kind.Group != "" || ar.Request.Kind.Kind != "Pod" || ar.Request.Operation == admissionv1.Delete {
+		validations.WithLabelValues(mode, "skipped").Inc()
+		return allowed
+	}
+	if maintenance.current().Enabled || cfg.DryRun || cfg.Shadow {
+		validations.WithLabelValues(mode, "skipped").Inc()
+		return allowed
+	}
+
+	d := newDecision(ar)
+	rules := ruleSources.current()
+	evaluatePod(ar, d, rules)
+	if rules.dryRun(d.Rule) {
+		validations.WithLabelValues(mode, "skipped").Inc()
+		return allowed
+	}
+	var networks []string
+	for _, change := range d.Networks {
+		if len(change.RemovedGateways) > 0 {
+			networks = append(networks, cfg.Redaction.value(channelLogs, fieldNetworks, change.Network))
+		}
+	}
+	if len(networks) == 0 {
+		validations.WithLabelValues(mode, "passed").Inc()
+		return allowed
+	}
+
+	validations.WithLabelValues(mode, "unmutated").Inc()
+	logNS := cfg.Redaction.value(channelLogs, fieldNamespace, d.Namespace)
+	logPod := cfg.Redaction.value(channelLogs, fieldPod, d.Pod)
+	msg := "default-route gateways were not removed from " + strings.Join(networks, ", ") + ", the mutating webhook was bypassed"
+	if mode == validateModeEnforce {
+		klog.Warningf("Denying pod %s/%s that kept its default-route gateways on %s (uid=%s)", logNS, logPod, strings.Join(networks, ", "), ar.Request.UID)
+		return deniedResponse(reasonDenyUnmutated, msg)
+	}
+	klog.Warningf("Pod %s/%s kept its default-route gateways on %s (uid=%s)", logNS, logPod, strings.Join(networks, ", "), ar.Request.UID)
+	allowed.Warnings = []string{warning(reasonWarnUnmutated, msg)}
+	return allowed
+}
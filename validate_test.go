@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func validateReview(networks string) *admissionv1.AdmissionReview {
+	pod := corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:        "importer-test",
+		Namespace:   "test",
+		Labels:      map[string]string{"app": "containerized-data-importer"},
+		Annotations: map[string]string{"k8s.v1.cni.cncf.io/networks": networks},
+	}}
+	raw, _ := json.Marshal(pod)
+	return &admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{
+		UID:       "validate",
+		Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		Operation: admissionv1.Create,
+		Object:    runtime.RawExtension{Raw: raw},
+	}}
+}
+
+func TestValidatePod(t *testing.T) {
+	unmutated := validateReview(`[{"name":"transfer","namespace":"default","default-route":["10.0.0.1"]}]`)
+	mutated := validateReview(`[{"name":"transfer","namespace":"default"}]`)
+
+	if resp := validatePod(mutated, validateModeEnforce); !resp.Allowed || len(resp.Warnings) != 0 {
+		t.Fatalf("expected a mutated pod to pass, got %+v", resp)
+	}
+	resp := validatePod(unmutated, validateModeEnforce)
+	if resp.Allowed || string(resp.Result.Reason) != reasonDenyUnmutated {
+		t.Fatalf("expected an unmutated pod to be denied, got %+v", resp)
+	}
+	resp = validatePod(unmutated, validateModeAudit)
+	if !resp.Allowed || len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], reasonWarnUnmutated) {
+		t.Fatalf("expected an unmutated pod to be admitted with a warning, got %+v", resp)
+	}
+
+	old := cfg
+	defer func() { cfg = old }()
+	cfg.DryRun = true
+	if resp := validatePod(unmutated, validateModeEnforce); !resp.Allowed {
+		t.Fatalf("expected unmutated pods to pass in dry-run mode, got %+v", resp)
+	}
+}
+
+func TestHandleValidate(t *testing.T) {
+	old := cfg
+	defer func() { cfg = old }()
+	cfg.ValidateMode = validateModeEnforce
+
+	body, _ := json.Marshal(validateReview(`[{"name":"transfer","namespace":"default","default-route":["10.0.0.1"]}]`))
+	w := httptest.NewRecorder()
+	handleValidate(w, httptest.NewRequest("POST", "/validate", bytes.NewReader(body)))
+
+	var response admissionv1.AdmissionReview
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Response.Allowed || response.Response.UID != "validate" {
+		t.Fatalf("expected the pod to be denied, got %+v", response.Response)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+)
+
+const warmUpPollInterval = 100 * time.Millisecond
+
+var warmUpDuration = newGauge(prometheus.GaugeOpts{
+	Name: "gateway_yeeter_warm_up_duration_seconds",
+	Help: "Time the warm-up took before the replica reported ready, with --warm-up.",
+})
+
+// warmUpState keeps /readyz failing until rule sources, target policies and
+// namespaces are read, a review was evaluated in-process and a self-probe went through
+// the HTTPS stack, so the first admissions after a rollout do not pay for
+// cold caches and connections.
+type warmUpState struct {
+	mu   sync.Mutex
+	step string
+	done bool
+}
+
+var warmUp *warmUpState
+
+func newWarmUp() *warmUpState {
+	return &warmUpState{step: "not started"}
+}
+
+func (w *warmUpState) run(timeout time.Duration) {
+	if w == nil {
+		return
+	}
+	start := time.Now()
+	deadline := start.Add(timeout)
+
+	w.set("syncing rule sources, target policies and namespaces")
+	for !ruleSources.hasSynced() || !targetPolicies.hasSynced() || !namespaceLabels.hasSynced() {
+		if !w.wait(deadline) {
+			return
+		}
+	}
+
+	w.set("evaluating a review")
+	review := selfProbeReview()
+	evaluatePod(review, newDecision(review), ruleSources.current())
+
+	if selfProbe != nil {
+		w.set("sending a self-probe")
+		for {
+			err := selfProbe.send()
+			if err == nil {
+				break
+			}
+			klog.V(2).Infof("Warm-up self-probe failed, retrying: %v", err)
+			if !w.wait(deadline) {
+				return
+			}
+		}
+	}
+
+	elapsed := time.Since(start)
+	warmUpDuration.Set(elapsed.Seconds())
+	klog.Infof("Warm-up completed in %s", elapsed)
+	w.mu.Lock()
+	w.done = true
+	w.mu.Unlock()
+}
+
+// wait sleeps for one poll interval. Past the deadline it gives up and
+// reports ready anyway, a replica stuck in warm-up would block the rollout.
+func (w *warmUpState) wait(deadline time.Time) bool {
+	if time.Now().Before(deadline) {
+		time.Sleep(warmUpPollInterval)
+		return true
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	klog.Errorf("Warm-up did not complete in time while %s, reporting ready anyway", w.step)
+	w.done = true
+	return false
+}
+
+func (w *warmUpState) set(step string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.step = step
+}
+
+func (w *warmUpState) status() (bool, string) {
+	if w == nil {
+		return true, "no warm-up"
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.done {
+		return false, "warming up: " + w.step
+	}
+	return true, "warmed up"
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWarmUp(t *testing.T) {
+	oldPolicies := targetPolicies
+	defer func() { targetPolicies = oldPolicies }()
+
+	w := newWarmUp()
+	if ready, message := w.status(); ready || !strings.HasPrefix(message, "warming up") {
+		t.Fatalf("expected not to be ready before the warm-up, got %s", message)
+	}
+	targetPolicies = nil
+	w.run(time.Second)
+	if ready, message := w.status(); !ready {
+		t.Fatalf("expected to be ready after the warm-up, got %s", message)
+	}
+
+	// Policies that are never listed give up at the timeout.
+	targetPolicies = newTargetWatcher()
+	w = newWarmUp()
+	w.run(time.Millisecond)
+	if ready, _ := w.status(); !ready {
+		t.Fatal("expected to be ready after the warm-up timed out")
+	}
+
+	if ready, _ := (*warmUpState)(nil).status(); !ready {
+		t.Fatal("expected to be ready without warm-up")
+	}
+}
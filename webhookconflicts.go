@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+)
+
+const webhookListTimeout = 30 * time.Second
+
+var conflictingWebhooks = newGaugeVec(prometheus.GaugeOpts{
+	Name: "gateway_yeeter_conflicting_webhooks",
+	Help: "Other mutating webhooks that receive migration pods and may rewrite their networks annotation, by configuration and webhook.",
+}, "configuration", "webhook")
+
+// webhookConflictChecker periodically looks for other mutating webhooks
+// that receive target pods. The API server calls mutating webhooks in
+// order, so one that rewrites the networks annotation after us silently
+// undoes the stripping.
+type webhookConflictChecker struct {
+	mu        sync.Mutex
+	conflicts []string
+	reported  map[string]bool
+}
+
+var webhookConflicts *webhookConflictChecker
+
+func newWebhookConflictChecker() *webhookConflictChecker {
+	return &webhookConflictChecker{reported: make(map[string]bool)}
+}
+
+func (c *webhookConflictChecker) run(interval time.Duration) {
+	if c == nil {
+		return
+	}
+	if err := c.check(); err != nil {
+		klog.Warningf("Could not check for conflicting mutating webhooks: %v", err)
+	}
+	for range time.Tick(interval) {
+		if err := c.check(); err != nil {
+			klog.Warningf("Could not check for conflicting mutating webhooks: %v", err)
+		}
+	}
+}
+
+func (c *webhookConflictChecker) check() error {
+	client, err := kube.typedFor(lookupWebhook)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), webhookListTimeout)
+	defer cancel()
+	list, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	c.update(list.Items)
+	return nil
+}
+
+func (c *webhookConflictChecker) update(configurations []admissionregistrationv1.MutatingWebhookConfiguration) {
+	own := ownWebhookConfiguration(configurations)
+	ownWebhook.observe(configurations)
+	conflictingWebhooks.Reset()
+	var conflicts []string
+	found := make(map[string]bool)
+	for _, configuration := range configurations {
+		if configuration.Name == own {
+			continue
+		}
+		for _, webhook := range configuration.Webhooks {
+			if !receivesTargetPods(webhook) {
+				continue
+			}
+			name := configuration.Name + "/" + webhook.Name
+			conflicts = append(conflicts, name)
+			found[name] = true
+			conflictingWebhooks.WithLabelValues(configuration.Name, webhook.Name).Set(1)
+
+			c.mu.Lock()
+			reported := c.reported[name]
+			c.reported[name] = true
+			c.mu.Unlock()
+			if reported {
+				continue
+			}
+			order := "before"
+			if own == "" || configuration.Name > own {
+				order = "after"
+			}
+			klog.Warningf("Mutating webhook %s also receives migration pods and is called %s gateway-yeeter; if it rewrites the networks annotation, default routes may be reintroduced", name, order)
+		}
+	}
+	sort.Strings(conflicts)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conflicts = conflicts
+	for name := range c.reported {
+		if !found[name] {
+			klog.Infof("Mutating webhook %s no longer receives migration pods", name)
+			delete(c.reported, name)
+		}
+	}
+}
+
+// current returns the webhooks found by the last check.
+func (c *webhookConflictChecker) current() []string {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conflicts
+}
+
+// ownWebhookConfiguration returns the configuration calling this webhook's
+// service, or "" when it cannot be found.
+func ownWebhookConfiguration(configurations []admissionregistrationv1.MutatingWebhookConfiguration) string {
+	for _, configuration := range configurations {
+		for _, webhook := range configuration.Webhooks {
+			if service := webhook.ClientConfig.Service; service != nil && service.Name == identity.Service && service.Namespace == identity.Namespace {
+				return configuration.Name
+			}
+		}
+	}
+	return ""
+}
+
+// receivesTargetPods reports whether webhook is called for pod creation and
+// its objectSelector matches a target pod. The namespaceSelector is not
+// evaluated, so webhooks limited to other namespaces are reported too.
+func receivesTargetPods(webhook admissionregistrationv1.MutatingWebhook) bool {
+	intercepts := false
+	for _, rule := range webhook.Rules {
+		if matchesAny(rule.APIGroups, "") && matchesAny(rule.APIVersions, "v1") &&
+			(matchesAny(rule.Resources, "pods") || contains(rule.Resources, "*/*")) &&
+			interceptsCreate(rule.Operations) {
+			intercepts = true
+		}
+	}
+	if !intercepts {
+		return false
+	}
+	if webhook.ObjectSelector == nil {
+		return true
+	}
+	selector, err := metav1.LabelSelectorAsSelector(webhook.ObjectSelector)
+	if err != nil {
+		return false
+	}
+	for _, target := range targetPolicies.current() {
+		if selector.Matches(labels.Set(target.labels)) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(values []string, value string) bool {
+	return contains(values, value) || contains(values, "*")
+}
+
+func interceptsCreate(operations []admissionregistrationv1.OperationType) bool {
+	for _, operation := range operations {
+		if operation == admissionregistrationv1.Create || operation == admissionregistrationv1.OperationAll {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testMutatingWebhook(name string, resources []string, operation admissionregistrationv1.OperationType, selector *metav1.LabelSelector) admissionregistrationv1.MutatingWebhook {
+	return admissionregistrationv1.MutatingWebhook{
+		Name: name,
+		Rules: []admissionregistrationv1.RuleWithOperations{{
+			Operations: []admissionregistrationv1.OperationType{operation},
+			Rule:       admissionregistrationv1.Rule{APIGroups: []string{""}, APIVersions: []string{"v1"}, Resources: resources},
+		}},
+		ObjectSelector: selector,
+	}
+}
+
+func TestReceivesTargetPods(t *testing.T) {
+	tests := []struct {
+		name    string
+		webhook admissionregistrationv1.MutatingWebhook
+		want    bool
+	}{
+		{"all pods", testMutatingWebhook("a", []string{"pods"}, admissionregistrationv1.Create, nil), true},
+		{"wildcards", testMutatingWebhook("a", []string{"*/*"}, admissionregistrationv1.OperationAll, nil), true},
+		{"importer pods", testMutatingWebhook("a", []string{"pods"}, admissionregistrationv1.Create, &metav1.LabelSelector{MatchLabels: map[string]string{"app": "containerized-data-importer"}}), true},
+		{"other pods", testMutatingWebhook("a", []string{"pods"}, admissionregistrationv1.Create, &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}), false},
+		{"excluded pods", testMutatingWebhook("a", []string{"pods"}, admissionregistrationv1.Create, &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "app", Operator: metav1.LabelSelectorOpExists}}}), true},
+		{"updates only", testMutatingWebhook("a", []string{"pods"}, admissionregistrationv1.Update, nil), false},
+		{"other resources", testMutatingWebhook("a", []string{"pods/exec", "services"}, admissionregistrationv1.Create, nil), false},
+	}
+	for _, tt := range tests {
+		if got := receivesTargetPods(tt.webhook); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestWebhookConflictChecker(t *testing.T) {
+	oldIdentity := identity
+	identity = instanceIdentity{Namespace: "openshift-mtv", Pod: "gateway-yeeter-0", Service: "gateway-yeeter"}
+	defer func() { identity = oldIdentity }()
+	defer conflictingWebhooks.Reset()
+
+	own := testMutatingWebhook("cdi.gateway.yeet", []string{"pods"}, admissionregistrationv1.Create, nil)
+	own.ClientConfig.Service = &admissionregistrationv1.ServiceReference{Namespace: "openshift-mtv", Name: "gateway-yeeter"}
+	configurations := []admissionregistrationv1.MutatingWebhookConfiguration{
+		{ObjectMeta: metav1.ObjectMeta{Name: "gateway-yeeter"}, Webhooks: []admissionregistrationv1.MutatingWebhook{own}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "sidecar-injector"}, Webhooks: []admissionregistrationv1.MutatingWebhook{
+			testMutatingWebhook("inject.sidecar.io", []string{"pods"}, admissionregistrationv1.Create, nil),
+			testMutatingWebhook("services.sidecar.io", []string{"services"}, admissionregistrationv1.Create, nil),
+		}},
+	}
+
+	c := newWebhookConflictChecker()
+	c.update(configurations)
+	if got, want := c.current(), []string{"sidecar-injector/inject.sidecar.io"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected conflicts %v, got %v", want, got)
+	}
+	if got := testutil.ToFloat64(conflictingWebhooks.WithLabelValues("sidecar-injector", "inject.sidecar.io")); got != 1 {
+		t.Fatalf("expected conflicting webhook gauge, got %v", got)
+	}
+
+	c.update(configurations[:1])
+	if got := c.current(); len(got) != 0 || len(c.reported) != 0 {
+		t.Fatalf("expected removed webhooks to be forgotten, got %v", got)
+	}
+	if got := testutil.CollectAndCount(conflictingWebhooks); got != 0 {
+		t.Fatalf("expected no conflicting webhook series, got %d", got)
+	}
+}
+
+func TestReviewPodWarnsAboutConflictingWebhooks(t *testing.T) {
+	old := webhookConflicts
+	webhookConflicts = newWebhookConflictChecker()
+	webhookConflicts.conflicts = []string{"sidecar-injector/inject.sidecar.io"}
+	defer func() { webhookConflicts = old }()
+
+	resp, d := reviewRulesPod(t, "mtv", `[{"name":"transfer","default-route":["10.0.0.1"]}]`)
+	if d.Outcome != outcomeMutated || len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], reasonWarnConflictingWebhooks+": mutating webhook(s) sidecar-injector/inject.sidecar.io") {
+		t.Fatalf("expected a conflicting webhook warning, got %v", resp.Warnings)
+	}
+
+	resp, d = reviewRulesPod(t, "mtv", `[{"name":"storage"}]`)
+	if d.Outcome != outcomeUnchanged || len(resp.Warnings) != 0 {
+		t.Fatalf("expected no warning for unchanged pods, got %v", resp.Warnings)
+	}
+}
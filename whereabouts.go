@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// IPAM plugins such as whereabouts and static read these keys from a
+// selection element's cni-args, which can put a default route on the
+// attachment without any default-route request.
+var ipamGatewayKeys = []string{"gateway", "gateways"}
+
+type ipamRoute struct {
+	Dst string `json:"dst"`
+	GW  string `json:"gw,omitempty"`
+}
+
+func yeetIPAMRoutes(annotation string, skip map[int]bool) (string, []networkChange, error) {
+	var networks []map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(annotation), &networks); err != nil {
+		return "", nil, err
+	}
+
+	var changes []networkChange
+	for i, network := range networks {
+		raw, exists := network["cni-args"]
+		if !exists || skip[i] {
+			continue
+		}
+		var cniArgs map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &cniArgs); err != nil {
+			return "", nil, fmt.Errorf("network %d: cni-args: %w", i, err)
+		}
+
+		var name, namespace string
+		json.Unmarshal(network["name"], &name)
+		json.Unmarshal(network["namespace"], &namespace)
+		change := networkChange{Network: namespace + "/" + name}
+
+		for _, key := range ipamGatewayKeys {
+			raw, exists := cniArgs[key]
+			if !exists {
+				continue
+			}
+			var gateways []string
+			if err := json.Unmarshal(raw, &gateways); err != nil {
+				var gateway string
+				if err := json.Unmarshal(raw, &gateway); err != nil {
+					return "", nil, fmt.Errorf("network %d: cni-args %s: %w", i, key, err)
+				}
+				gateways = []string{gateway}
+			}
+			change.RemovedGateways = append(change.RemovedGateways, gateways...)
+			delete(cniArgs, key)
+		}
+
+		if raw, exists := cniArgs["routes"]; exists {
+			var routes []ipamRoute
+			if err := json.Unmarshal(raw, &routes); err != nil {
+				return "", nil, fmt.Errorf("network %d: cni-args routes: %w", i, err)
+			}
+			kept := routes[:0]
+			for _, route := range routes {
+				if isDefaultRouteDest(route.Dst) {
+					change.RemovedGateways = append(change.RemovedGateways, route.GW)
+					continue
+				}
+				kept = append(kept, route)
+			}
+			if len(kept) == 0 {
+				delete(cniArgs, "routes")
+			} else if len(kept) != len(routes) {
+				cniArgs["routes"], _ = json.Marshal(kept)
+			}
+		}
+
+		if len(change.RemovedGateways) == 0 {
+			continue
+		}
+		if len(cniArgs) == 0 {
+			delete(network, "cni-args")
+		} else {
+			network["cni-args"], _ = json.Marshal(cniArgs)
+		}
+		changes = append(changes, change)
+	}
+
+	if len(changes) == 0 {
+		return annotation, nil, nil
+	}
+	modified, err := json.Marshal(networks)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(modified), changes, nil
+}
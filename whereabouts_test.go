@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestYeetIPAMRoutes(t *testing.T) {
+	annotation := `[{"name":"transfer","namespace":"mtv","cni-args":{"gateway":"10.0.0.1","routes":[{"dst":"0.0.0.0/0","gw":"10.0.0.254"},{"dst":"192.168.0.0/16","gw":"10.0.0.2"}],"ips":["10.0.0.5/24"]}},{"name":"plain"}]`
+
+	modified, changes, err := yeetIPAMRoutes(annotation, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []networkChange{{Network: "mtv/transfer", RemovedGateways: []string{"10.0.0.1", "10.0.0.254"}}}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, changes)
+	}
+	want := `[{"cni-args":{"ips":["10.0.0.5/24"],"routes":[{"dst":"192.168.0.0/16","gw":"10.0.0.2"}]},"name":"transfer","namespace":"mtv"},{"name":"plain"}]`
+	if modified != want {
+		t.Fatalf("expected %s, got %s", want, modified)
+	}
+}
+
+func TestYeetIPAMRoutesGatewayList(t *testing.T) {
+	modified, changes, err := yeetIPAMRoutes(`[{"name":"transfer","cni-args":{"gateways":["10.0.0.1","fd00::1"]}}]`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || len(changes[0].RemovedGateways) != 2 {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+	if modified != `[{"name":"transfer"}]` {
+		t.Fatalf("expected empty cni-args to be removed, got %s", modified)
+	}
+}
+
+func TestYeetIPAMRoutesUnchanged(t *testing.T) {
+	annotation := `[{"name":"transfer","cni-args":{"ips":["10.0.0.5/24"]}}]`
+	modified, changes, err := yeetIPAMRoutes(annotation, nil)
+	if err != nil || len(changes) != 0 || modified != annotation {
+		t.Fatalf("expected no changes, got %s, %+v, %v", modified, changes, err)
+	}
+}
+
+func TestYeetIPAMRoutesInvalid(t *testing.T) {
+	if _, _, err := yeetIPAMRoutes(`[{"name":"transfer","cni-args":{"gateway":42}}]`, nil); err == nil {
+		t.Fatal("expected an error for a non-string gateway")
+	}
+}
+
+func TestReviewPodStripsIPAMRoutes(t *testing.T) {
+	old := cfg
+	cfg.StripIPAMRoutes = true
+	defer func() { cfg = old }()
+
+	rawPod, _ := json.Marshal(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "importer-test",
+			Namespace: "test",
+			Labels:    map[string]string{"app": "containerized-data-importer"},
+			Annotations: map[string]string{
+				"k8s.v1.cni.cncf.io/networks": `[{"name":"transfer","cni-args":{"gateway":"10.0.0.1"}}]`,
+			},
+		},
+	})
+	resp := reviewPod(&admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{UID: "test", Namespace: "test", Object: runtime.RawExtension{Raw: rawPod}},
+	})
+
+	var patches []patch
+	json.Unmarshal(resp.Patch, &patches)
+	if len(patches) != 1 || patches[0].Value != `[{"name":"transfer"}]` {
+		t.Fatalf("unexpected patch %s", resp.Patch)
+	}
+}